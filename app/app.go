@@ -1,7 +1,9 @@
 package app
 
 import (
+	"context"
 	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"sync"
 	"sync/atomic"
 	"github.com/OhBonsai/go-web-boilerplate/model"
 	"github.com/gorilla/mux"
@@ -10,7 +12,7 @@ import (
 	"net/http"
 	"fmt"
 	"crypto/ecdsa"
-	"github.com/mattermost/mattermost-server/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
 	"github.com/OhBonsai/go-web-boilerplate/store/sqlstore"
 )
 
@@ -20,7 +22,7 @@ type App struct {
 
 	Srv                     *Server
 	Log                     *mlog.Logger
-	newStore 				func() store.Store
+	newStore 				func() (store.Store, error)
 	sessionCache         	*utils.Cache
 
 	Cluster          		einterfaces.ClusterInterface
@@ -28,14 +30,19 @@ type App struct {
 
 
 	config                  atomic.Value
+	configLock              sync.Mutex
 	envConfig               map[string]interface{}
 	configFile              string
+	envPrefix               string
 	siteURL                 string
 	configListeners         map[string]func(*model.Config, *model.Config)
+	configListenersLock     sync.RWMutex
 	configListenerId     	string
 	logListenerId        	string
+	storeListenerId      	string
 	disableConfigWatch		bool
-	configWatcher        	*utils.ConfigWatcher
+	configStore          	utils.ConfigStore
+	configWatching       	bool
 
 	timezones 				atomic.Value
 
@@ -57,6 +64,12 @@ func New(options ...Option) (outApp *App, outErr error) {
 
 	for _, option := range options {option(app)}
 
+	// translations must be available before the config is validated so errors carry a readable message
+	if err := utils.TranslationsPerInit(); err != nil {
+		return nil, err
+	}
+	model.AppErrorInit(utils.T)
+
 	// load config
 	if err := app.LoadConfig(app.configFile); err != nil {
 		return nil, err
@@ -66,7 +79,13 @@ func New(options ...Option) (outApp *App, outErr error) {
 		addConfigWatcher().
 		addTimeZoneSupport().
 		addI18nSupport().
-		addStore().
+		addCluster()
+
+	if err := app.addStore(); err != nil {
+		return nil, err
+	}
+
+	app.addRateLimiter().
 		addBuiltInPlugins().
 		addRoute().
 		addWebSocket()
@@ -84,9 +103,10 @@ func ensureJustOneAppAlive() {
 func simpleInitApp() *App {
 	return &App{
 		goroutineExitSignal: make(chan struct{}, 1),
-		Srv:                 &Server{Router: mux.NewRouter()},
-		sessionCache:     	 utils.NewLru(model.SESSION_CACHE_SIZE),
+		Srv:                 &Server{Router: mux.NewRouter(), LocalRouter: mux.NewRouter()},
+		sessionCache:     	 utils.NewLruWithParams(model.SESSION_CACHE_SIZE, SESSION_CACHE_NAME, 0, model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_SESSIONS),
 		configFile:          "./config/config.json",
+		envPrefix:           utils.DEFAULT_ENV_PREFIX,
 		configListeners:     make(map[string]func(*model.Config, *model.Config)),
 	}
 }
@@ -95,10 +115,15 @@ func (a *App) addLogger() *App{
 	a.Log = mlog.NewLogger(utils.MloggerConfigFromLoggerConfig(&a.Config().LogSettings))
 	mlog.RedirectStdLog(a.Log)
 	mlog.InitGlobalLogger(a.Log)
+
+	a.logListenerId = a.AddConfigListener(func(_, after *model.Config) {
+		a.Log.ChangeLevels(utils.MloggerConfigFromLoggerConfig(&after.LogSettings))
+	})
 	return a
 }
 
 func (a *App) addConfigWatcher() *App{
+	a.EnableConfigWatch()
 	return a
 }
 
@@ -107,17 +132,38 @@ func (a *App) addTimeZoneSupport() *App{
 }
 
 func (a *App) addI18nSupport() *App{
+	if err := utils.InitTranslations(a.Config().LocalizationSettings); err != nil {
+		mlog.Error(fmt.Sprintf("Failed to load translations err=%v", err.Error()))
+		return a
+	}
+	model.AppErrorInit(utils.T)
 	return a
 }
 
-func (a *App) addStore() *App{
+func (a *App) addStore() error {
 	if a.newStore == nil {
-		a.newStore = func() store.Store {
-			return store.NewLayeredStore(sqlstore.NewSqlSupplier(a.Config().SqlSettings, a.Metrics), a.Metrics, a.Cluster)
+		a.newStore = func() (store.Store, error) {
+			supplier, err := sqlstore.NewSqlSupplier(context.Background(), a.Config().SqlSettings, a.Metrics)
+			if err != nil {
+				return nil, err
+			}
+
+			a.storeListenerId = a.AddConfigListener(func(_, after *model.Config) {
+				if err := supplier.ReloadReplicas(after.SqlSettings); err != nil {
+					mlog.Error(fmt.Sprintf("Failed to reload the SQL replicas err=%v", err))
+				}
+			})
+
+			return store.NewLayeredStore(supplier, a.Metrics, a.Cluster), nil
 		}
 	}
-	a.Srv.Store = a.newStore()
-	return a
+
+	newStore, err := a.newStore()
+	if err != nil {
+		return err
+	}
+	a.Srv.Store = newStore
+	return nil
 }
 func (a *App) addBuiltInPlugins() *App{
 	return a
@@ -125,6 +171,7 @@ func (a *App) addBuiltInPlugins() *App{
 
 func (a *App) addRoute() *App{
 	a.Srv.Router.NotFoundHandler = http.HandlerFunc(a.Handle404)
+	a.addCacheRoutes()
 	return a
 }
 func (a *App) addWebSocket() *App{
@@ -138,16 +185,46 @@ func (a *App) Shutdown() {
 	mlog.Info("Stopping Server...")
 
 	a.StopServer()
+	a.WaitForGoroutines()
+
+	a.RemoveConfigListener(a.logListenerId)
+	a.RemoveConfigListener(a.storeListenerId)
+	a.closeConfigStore()
+	a.stopCluster()
 
 	if a.Srv.Store != nil {
 		a.Srv.Store.Close()
 	}
+	a.sessionCache.Unregister()
 	a.Srv = nil
 	mlog.Info("Server stopped")
 
 }
 
 
+// Go creates a goroutine, but maintains a record of it to ensure that execution completes before
+// the app is destroyed.
+func (a *App) Go(f func()) {
+	atomic.AddInt32(&a.goroutineCount, 1)
+
+	go func() {
+		f()
+
+		atomic.AddInt32(&a.goroutineCount, -1)
+		select {
+		case a.goroutineExitSignal <- struct{}{}:
+		default:
+		}
+	}()
+}
+
+// WaitForGoroutines blocks until all goroutines created by App.Go exit.
+func (a *App) WaitForGoroutines() {
+	for atomic.LoadInt32(&a.goroutineCount) != 0 {
+		<-a.goroutineExitSignal
+	}
+}
+
 func (a *App) Handle404(w http.ResponseWriter, r *http.Request) {
 	err := model.NewAppError("Handle404", "api.context.404.app_error", nil, "", http.StatusNotFound)
 	mlog.Debug(fmt.Sprintf("%v: code=404 ip=%v", r.URL.Path, utils.GetIpAddress(r)))
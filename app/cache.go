@@ -0,0 +1,46 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+const (
+	CACHE_ROUTE_PREFIX = "/api/v4/caches"
+	SESSION_CACHE_NAME = "Session"
+)
+
+// addCacheRoutes exposes the statistics of every registered cache. The routes are only served in local
+// mode, since they are meant for operators on the host and carry no authentication of their own.
+func (a *App) addCacheRoutes() {
+	caches := a.Srv.LocalRouter.PathPrefix(CACHE_ROUTE_PREFIX).Subrouter()
+	caches.HandleFunc("", a.getCacheStats).Methods("GET")
+	caches.HandleFunc("/{name}/purge", a.purgeCache).Methods("POST")
+}
+
+func (a *App) getCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(model.CacheStatsListToJson(utils.GetCacheStats())))
+}
+
+func (a *App) purgeCache(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if !utils.PurgeCache(name) {
+		writeAppError(w, model.NewAppError("purgeCache", "api.cache.purge.not_found.app_error", map[string]interface{}{"Name": name}, "", http.StatusNotFound))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(utils.GetRegisteredCache(name).Stats().ToJson()))
+}
+
+func writeAppError(w http.ResponseWriter, err *model.AppError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.StatusCode)
+	w.Write([]byte(err.ToJson()))
+}
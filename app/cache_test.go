@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+func TestCacheRoutesLocalMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "local.socket")
+
+	a := newTestApp(t, func(cfg *model.Config) {
+		*cfg.ServiceSettings.EnableLocalMode = true
+		*cfg.ServiceSettings.LocalModeSocketLocation = socket
+	})
+	a.addRoute()
+
+	if err := a.StartServer(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.StopServer()
+
+	if info, err := os.Stat(socket); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Fatalf("socket should only be accessible to its owner, got %v", info.Mode().Perm())
+	}
+
+	local := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	resp, err := local.Get("http://localhost" + CACHE_ROUTE_PREFIX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := model.CacheStatsListFromJson(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(stats) == 0 {
+		t.Fatalf("should list the caches over the socket, got %v %v", resp.StatusCode, stats)
+	}
+
+	resp, err = local.Post("http://localhost"+CACHE_ROUTE_PREFIX+"/"+SESSION_CACHE_NAME+"/purge", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("should purge over the socket, got %v", resp.StatusCode)
+	}
+
+	resp, err = local.Post("http://localhost"+CACHE_ROUTE_PREFIX+"/missing/purge", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("should not find an unknown cache, got %v", resp.StatusCode)
+	}
+
+	resp, err = http.Post("http://"+a.Srv.ListenAddr.String()+CACHE_ROUTE_PREFIX+"/"+SESSION_CACHE_NAME+"/purge", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("should not serve the cache routes on the listen address")
+	}
+
+	a.StopServer()
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatalf("socket should be removed on shutdown, got %v", err)
+	}
+}
+
+func TestCacheRoutesLocalModeDisabled(t *testing.T) {
+	a := newTestApp(t, nil)
+	a.addRoute()
+
+	if err := a.StartServer(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.StopServer()
+
+	if a.Srv.LocalModeServer != nil {
+		t.Fatal("should not serve local mode unless enabled")
+	}
+}
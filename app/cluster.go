@@ -0,0 +1,54 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/OhBonsai/go-web-boilerplate/cluster"
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+// addCluster starts the built-in cluster when it is enabled and no other implementation was provided, and
+// shares the invalidations of the caches of the app with the other nodes. The store shares those of its own
+// caches through the cluster it is given.
+func (a *App) addCluster() *App {
+	settings := a.Config().ClusterSettings
+
+	if a.Cluster == nil && *settings.Enable {
+		c, err := cluster.NewCluster(&settings)
+		if err != nil {
+			mlog.Error(fmt.Sprintf("Failed to create the cluster: %v", err.Error()))
+			return a
+		}
+		a.Cluster = c
+	}
+
+	if a.Cluster == nil {
+		return a
+	}
+
+	for _, cache := range a.clusterCaches() {
+		cluster.RegisterCacheInvalidation(a.Cluster, cache)
+	}
+
+	a.Cluster.StartInterNodeCommunication()
+
+	return a
+}
+
+func (a *App) stopCluster() {
+	if a.Cluster == nil {
+		return
+	}
+
+	for _, cache := range a.clusterCaches() {
+		cache.SetInvalidationHandler(nil)
+	}
+
+	a.Cluster.StopInterNodeCommunication()
+}
+
+// clusterCaches returns the caches of the app whose invalidations are shared with the other nodes.
+func (a *App) clusterCaches() []*utils.Cache {
+	return []*utils.Cache{a.sessionCache}
+}
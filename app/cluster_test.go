@@ -0,0 +1,81 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+func freeClusterAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// newClusterApp returns an app that joins a TCP cluster on address, with peers as the other nodes.
+func newClusterApp(t *testing.T, address string, peers ...string) *App {
+	a := newTestApp(t, func(cfg *model.Config) {
+		*cfg.ClusterSettings.Enable = true
+		*cfg.ClusterSettings.ClusterName = "test"
+		*cfg.ClusterSettings.Transport = model.CLUSTER_TRANSPORT_TCP
+		*cfg.ClusterSettings.BindAddress = address
+		*cfg.ClusterSettings.SharedSecret = "0123456789abcdef0123456789abcdef"
+		cfg.ClusterSettings.Peers = peers
+	})
+	a.addCluster()
+	if a.Cluster == nil {
+		t.Fatal("should start the cluster")
+	}
+	return a
+}
+
+func TestClusterSessionCacheInvalidation(t *testing.T) {
+	addresses := []string{freeClusterAddress(t), freeClusterAddress(t)}
+	apps := []*App{
+		newClusterApp(t, addresses[0], addresses[1]),
+		newClusterApp(t, addresses[1], addresses[0]),
+	}
+	for _, a := range apps {
+		defer a.stopCluster()
+		a.sessionCache.Add("a", 1)
+		a.sessionCache.Add("b", 2)
+		a.sessionCache.Add("", 3)
+	}
+
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the invalidation")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	removed := func(cache *utils.Cache, key string) func() bool {
+		return func() bool {
+			_, ok := cache.Get(key)
+			return !ok
+		}
+	}
+
+	apps[0].sessionCache.Remove("a")
+	waitFor(removed(apps[1].sessionCache, "a"))
+
+	apps[0].sessionCache.Remove("")
+	waitFor(removed(apps[1].sessionCache, ""))
+	if _, ok := apps[1].sessionCache.Get("b"); !ok {
+		t.Fatal("only the removed keys should be invalidated")
+	}
+
+	apps[1].sessionCache.Purge()
+	waitFor(func() bool {
+		return apps[0].sessionCache.Len() == 0
+	})
+}
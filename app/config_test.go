@@ -0,0 +1,205 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+func TestConfigListeners(t *testing.T) {
+	a := simpleInitApp()
+	if err := a.LoadConfig("memory://"); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			id := a.AddConfigListener(func(old, current *model.Config) {
+				atomic.AddInt32(&calls, 1)
+			})
+			a.InvokeConfigListeners(a.Config(), a.Config())
+			a.RemoveConfigListener(id)
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&calls) < 10 {
+		t.Fatalf("should call every listener registered at the time, got %v calls", calls)
+	}
+
+	// A listener may remove itself while being called.
+	var id string
+	id = a.AddConfigListener(func(old, current *model.Config) {
+		a.RemoveConfigListener(id)
+	})
+	a.InvokeConfigListeners(a.Config(), a.Config())
+	if len(a.configListeners) != 0 {
+		t.Fatal("should have removed the listener")
+	}
+}
+
+// writeConfigFile writes the default config to a new file in dir.
+func writeConfigFile(t *testing.T, dir string, name string) string {
+	t.Helper()
+
+	cfg := &model.Config{}
+	cfg.SetDefaults()
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(cfg.ToJson()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigSwitchStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := simpleInitApp()
+	if err := a.LoadConfig(writeConfigFile(t, dir, "first.json")); err != nil {
+		t.Fatal(err)
+	}
+	a.EnableConfigWatch()
+	defer a.closeConfigStore()
+
+	first := a.configStore
+	second := writeConfigFile(t, dir, "second.json")
+	if err := a.LoadConfig(second); err != nil {
+		t.Fatal(err)
+	}
+	if a.configStore == first {
+		t.Fatal("should open the new store")
+	}
+	if !a.configWatching {
+		t.Fatal("should keep watching after switching stores")
+	}
+
+	reloaded := make(chan string, 1)
+	a.AddConfigListener(func(old, current *model.Config) {
+		reloaded <- *current.ServiceSettings.SiteURL
+	})
+
+	// Someone else edits the new file.
+	cfg := a.Config().Clone()
+	*cfg.ServiceSettings.SiteURL = "http://example.com"
+	if err := ioutil.WriteFile(second, []byte(cfg.ToJson()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case siteURL := <-reloaded:
+		if siteURL != "http://example.com" {
+			t.Fatalf("should reload the edited config, got %v", siteURL)
+		}
+	case <-time.After(10 * utils.CONFIG_WATCHER_DEBOUNCE):
+		t.Fatal("should reload when the new store changes")
+	}
+
+	if err := a.LoadConfig("unknown://"); err == nil {
+		t.Fatal("should fail to open an unknown store")
+	}
+	if a.ConfigFileName() != second {
+		t.Fatalf("should keep the running store when another fails to open, got %v", a.ConfigFileName())
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := simpleInitApp()
+	if err := a.LoadConfig(writeConfigFile(t, dir, "config.json")); err != nil {
+		t.Fatal(err)
+	}
+	a.EnableConfigWatch()
+	defer a.closeConfigStore()
+
+	var calls int32
+	a.AddConfigListener(func(old, current *model.Config) {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	cfg := a.Config().Clone()
+	*cfg.ServiceSettings.SiteURL = "http://example.com"
+	if err := a.SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if *a.Config().ServiceSettings.SiteURL != "http://example.com" {
+		t.Fatal("should apply the saved config")
+	}
+
+	// Give the watcher the time to notice the write, which it should leave to SaveConfig.
+	time.Sleep(3 * utils.CONFIG_WATCHER_DEBOUNCE)
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Fatalf("should call the listeners once per save, got %v", calls)
+	}
+
+	a.DisableConfigWatch()
+	if a.configStore == nil {
+		t.Fatal("should keep the store when no longer watching")
+	}
+
+	*cfg.ServiceSettings.SiteURL = "http://other.example.com"
+	if err := a.SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if *a.Config().ServiceSettings.SiteURL != "http://other.example.com" {
+		t.Fatal("should still save once no longer watching")
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	os.Setenv("FIRSTAPP_SERVICESETTINGS_SITEURL", "http://first.example.com")
+	os.Setenv("SECONDAPP_SERVICESETTINGS_SITEURL", "http://second.example.com")
+	defer os.Unsetenv("FIRSTAPP_SERVICESETTINGS_SITEURL")
+	defer os.Unsetenv("SECONDAPP_SERVICESETTINGS_SITEURL")
+
+	first, second, none := simpleInitApp(), simpleInitApp(), simpleInitApp()
+	EnvPrefix("firstapp")(first)
+	EnvPrefix("secondapp")(second)
+	EnvPrefix("")(none)
+
+	var wg sync.WaitGroup
+	for _, a := range []*App{first, second, none} {
+		wg.Add(1)
+		go func(a *App) {
+			defer wg.Done()
+			if err := a.LoadConfig("memory://"); err != nil {
+				t.Error(err)
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	if siteURL := *first.Config().ServiceSettings.SiteURL; siteURL != "http://first.example.com" {
+		t.Fatalf("should apply the overrides named after the prefix of the app, got %v", siteURL)
+	}
+	if siteURL := *second.Config().ServiceSettings.SiteURL; siteURL != "http://second.example.com" {
+		t.Fatalf("should apply the overrides named after the prefix of the app, got %v", siteURL)
+	}
+	if siteURL := *none.Config().ServiceSettings.SiteURL; siteURL != "" || len(none.EnvironmentOverrides()) != 0 {
+		t.Fatalf("should ignore the environment without a prefix, got %v", siteURL)
+	}
+	if _, ok := first.EnvironmentOverrides()["ServiceSettings.SiteURL"]; !ok {
+		t.Fatal("should report the overridden setting")
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Certificates are renewed this long before they expire.
+const LETS_ENCRYPT_RENEW_BEFORE = 30 * 24 * time.Hour
+
+func (a *App) newCertManager() *autocert.Manager {
+	settings := a.Config().ServiceSettings
+
+	m := &autocert.Manager{
+		Cache:       NewCertificateFileCache(*settings.LetsEncryptCertificateCacheFile),
+		Prompt:      autocert.AcceptTOS,
+		RenewBefore: LETS_ENCRYPT_RENEW_BEFORE,
+	}
+
+	if siteURL, err := url.Parse(*settings.SiteURL); err == nil && siteURL.Hostname() != "" {
+		m.HostPolicy = autocert.HostWhitelist(siteURL.Hostname())
+	}
+
+	if directoryURL := *settings.LetsEncryptDirectoryURL; directoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: directoryURL}
+	}
+
+	return m
+}
+
+// CertificateFileCache is an autocert.Cache which keeps every account key and certificate in a single
+// JSON file, so that issued certificates survive a restart.
+type CertificateFileCache struct {
+	path string
+	lock sync.Mutex
+}
+
+func NewCertificateFileCache(path string) *CertificateFileCache {
+	return &CertificateFileCache{path: path}
+}
+
+func (c *CertificateFileCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := entries[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *CertificateFileCache) Put(ctx context.Context, key string, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	entries[key] = data
+	return c.write(entries)
+}
+
+func (c *CertificateFileCache) Delete(ctx context.Context, key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := entries[key]; !ok {
+		return nil
+	}
+	delete(entries, key)
+	return c.write(entries)
+}
+
+func (c *CertificateFileCache) read() (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+
+	raw, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 {
+		return entries, nil
+	}
+
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (c *CertificateFileCache) write(entries map[string][]byte) error {
+	raw, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated cache behind.
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+func TestCertificateFileCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "letsencrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "certs", "letsencrypt.cache")
+	cache := NewCertificateFileCache(path)
+	ctx := context.Background()
+
+	if _, err := cache.Get(ctx, "example.com"); err != autocert.ErrCacheMiss {
+		t.Fatalf("should miss on an empty cache, got %v", err)
+	}
+
+	if err := cache.Put(ctx, "example.com", []byte("cert")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(ctx, "acme_account+key", []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("should keep the cache private, got %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("should rename the temporary file into place")
+	}
+
+	// A new cache on the same file sees what the first one stored.
+	reopened := NewCertificateFileCache(path)
+	if data, err := reopened.Get(ctx, "example.com"); err != nil || string(data) != "cert" {
+		t.Fatalf("should persist the certificate, got %q %v", data, err)
+	}
+
+	if err := reopened.Delete(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Delete(ctx, "example.com"); err != nil {
+		t.Fatalf("should ignore deleting a missing key, got %v", err)
+	}
+	if _, err := cache.Get(ctx, "example.com"); err != autocert.ErrCacheMiss {
+		t.Fatalf("should have deleted the certificate, got %v", err)
+	}
+	if data, err := cache.Get(ctx, "acme_account+key"); err != nil || string(data) != "key" {
+		t.Fatalf("should keep the other entries, got %q %v", data, err)
+	}
+}
+
+func TestCertificateFileCacheCorrupt(t *testing.T) {
+	file, err := ioutil.TempFile("", "letsencrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.Write([]byte("{not json"))
+	file.Close()
+
+	cache := NewCertificateFileCache(file.Name())
+	ctx := context.Background()
+
+	if _, err := cache.Get(ctx, "example.com"); err == nil || err == autocert.ErrCacheMiss {
+		t.Fatalf("should report a corrupt cache rather than a miss, got %v", err)
+	}
+	if err := cache.Put(ctx, "example.com", []byte("cert")); err == nil {
+		t.Fatal("should not overwrite a corrupt cache")
+	}
+
+	if raw, _ := ioutil.ReadFile(file.Name()); string(raw) != "{not json" {
+		t.Fatalf("should leave the corrupt cache for an operator to inspect, got %q", raw)
+	}
+}
+
+func TestNewCertManager(t *testing.T) {
+	// A local ACME server such as pebble.
+	const directoryURL = "https://localhost:14000/dir"
+
+	a := newTestApp(t, func(cfg *model.Config) {
+		*cfg.ServiceSettings.SiteURL = "https://chat.example.com:8443"
+		*cfg.ServiceSettings.LetsEncryptDirectoryURL = directoryURL
+		*cfg.ServiceSettings.LetsEncryptCertificateCacheFile = filepath.Join(os.TempDir(), "letsencrypt.cache")
+	})
+
+	m := a.newCertManager()
+	if m.Client == nil || m.Client.DirectoryURL != directoryURL {
+		t.Fatal("should use the configured ACME directory")
+	}
+	if m.RenewBefore != LETS_ENCRYPT_RENEW_BEFORE {
+		t.Fatalf("should renew %v before expiry, got %v", LETS_ENCRYPT_RENEW_BEFORE, m.RenewBefore)
+	}
+
+	ctx := context.Background()
+	if err := m.HostPolicy(ctx, "chat.example.com"); err != nil {
+		t.Fatalf("should accept the host of the site URL, got %v", err)
+	}
+	if err := m.HostPolicy(ctx, "other.example.com"); err == nil {
+		t.Fatal("should refuse hosts other than the site URL")
+	}
+
+	a = newTestApp(t, func(cfg *model.Config) {
+		*cfg.ServiceSettings.LetsEncryptDirectoryURL = ""
+	})
+	if m := a.newCertManager(); m.Client != nil || m.HostPolicy != nil {
+		t.Fatal("should fall back to the autocert defaults")
+	}
+}
+
+func TestStartServerLetsEncrypt(t *testing.T) {
+	a := newTestApp(t, func(cfg *model.Config) {
+		*cfg.ServiceSettings.ConnectionSecurity = model.CONN_SECURITY_TLS
+		*cfg.ServiceSettings.UseLetsEncrypt = true
+		*cfg.ServiceSettings.LetsEncryptDirectoryURL = "https://localhost:14000/dir"
+		*cfg.ServiceSettings.LetsEncryptCertificateCacheFile = filepath.Join(os.TempDir(), "letsencrypt.cache")
+	})
+
+	// Certificates are only requested on the first handshake, so the listener starts without the ACME server.
+	if err := a.StartServer(); err != nil {
+		t.Fatalf("should serve Let's Encrypt certificates on any port without forwarding, got %v", err)
+	}
+	defer a.StopServer()
+
+	if a.Srv.Server.TLSConfig == nil || a.Srv.Server.TLSConfig.GetCertificate == nil {
+		t.Fatal("should get certificates from the certificate manager")
+	}
+}
@@ -1,6 +1,8 @@
 package app
 
-import "github.com/OhBonsai/go-web-boilerplate/store"
+import (
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
 
 type Option func(a *App)
 
@@ -9,12 +11,12 @@ func StoreOverride(override interface{}) Option {
 	return func(a *App) {
 		switch o := override.(type) {
 		case store.Store:
-			a.newStore = func() store.Store {
-				return o
+			a.newStore = func() (store.Store, error) {
+				return o, nil
 			}
 		case func(*App) store.Store:
-			a.newStore = func() store.Store {
-				return o(a)
+			a.newStore = func() (store.Store, error) {
+				return o(a), nil
 			}
 		default:
 			panic("invalid StoreOverride")
@@ -22,12 +24,22 @@ func StoreOverride(override interface{}) Option {
 	}
 }
 
+// ConfigFile sets where the config is loaded from. It accepts a file path or a DSN-style URL selecting
+// the config store: file://, memory://, mysql:// or postgres://.
 func ConfigFile(file string) Option {
 	return func(a *App) {
 		a.configFile = file
 	}
 }
 
+// EnvPrefix sets the prefix of the environment variables that override config settings. An empty prefix
+// turns the overrides off.
+func EnvPrefix(prefix string) Option {
+	return func(a *App) {
+		a.envPrefix = prefix
+	}
+}
+
 func DisableConfigWatch(a *App) {
 	a.disableConfigWatch = true
 }
@@ -1,5 +1,229 @@
 package app
 
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/throttled/throttled"
+	"github.com/throttled/throttled/store/memstore"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
 type RateLimiter struct {
+	throttled.GCRARateLimiter
+	routes   map[string]*throttled.GCRARateLimiter
+	useAuth  bool
+	useIP    bool
+	useRoute bool
+	header   string
+	router   *mux.Router
+}
+
+// NewRateLimiter builds a GCRA (token bucket) limiter whose bucket state lives in a memory store
+// bounded to settings.MemoryStoreSize keys. Every route in settings.Routes gets a limiter of its own
+// sharing that store.
+func NewRateLimiter(settings *model.RateLimitSettings, router *mux.Router) (*RateLimiter, error) {
+	store, err := memstore.New(*settings.MemoryStoreSize)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize rate limiting memory store, err:%v", err)
+	}
+
+	throttledRateLimiter, err := newGCRARateLimiter(store, *settings.PerSec, *settings.MaxBurst)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]*throttled.GCRARateLimiter, len(settings.Routes))
+	for _, route := range settings.Routes {
+		if routes[route.Route], err = newGCRARateLimiter(store, route.PerSec, route.MaxBurst); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RateLimiter{
+		GCRARateLimiter: *throttledRateLimiter,
+		routes:          routes,
+		useAuth:         *settings.VaryByUser,
+		useIP:           *settings.VaryByRemoteAddr,
+		useRoute:        *settings.VaryByRoute,
+		header:          settings.VaryByHeader,
+		router:          router,
+	}, nil
+}
+
+func newGCRARateLimiter(store throttled.GCRAStore, perSec int, maxBurst int) (*throttled.GCRARateLimiter, error) {
+	quota := throttled.RateQuota{
+		MaxRate:  throttled.PerSec(perSec),
+		MaxBurst: maxBurst,
+	}
+
+	rateLimiter, err := throttled.NewGCRARateLimiter(store, quota)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize rate limiter, err:%v", err)
+	}
+	return rateLimiter, nil
+}
+
+func (rl *RateLimiter) GenerateKey(r *http.Request) string {
+	key := ""
+
+	if rl.useAuth {
+		token, tokenLocation := ParseAuthTokenFromRequest(r)
+		if tokenLocation != TokenLocationNotFound {
+			key += token
+		} else if rl.useIP { // If we don't find an authentication token and IP based is enabled, fall back to IP
+			key += utils.GetIpAddress(r)
+		}
+	} else if rl.useIP { // Only if Auth based is not enabled do we use a plain IP based
+		key += utils.GetIpAddress(r)
+	}
+
+	if rl.useRoute {
+		key += rl.routeTemplate(r)
+	}
+
+	// Note that most of the time the user won't have to set this because the utils.GetIpAddress function handles
+	// getting the IP when the server is behind a proxy.
+	if rl.header != "" {
+		key += r.Header.Get(rl.header)
+	}
+
+	return key
+}
+
+// routeTemplate returns the path template of the route that will serve r, so that every request to
+// a parameterised route shares one bucket. Unmatched requests fall back to the raw path.
+func (rl *RateLimiter) routeTemplate(r *http.Request) string {
+	var match mux.RouteMatch
+	if rl.router != nil && rl.router.Match(r, &match) && match.Route != nil {
+		if template, err := match.Route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// limiterFor picks the limiter for the route serving r and the key of its bucket there. The requests to a
+// route with a quota of its own always have a bucket per route, so that they never drain another one.
+func (rl *RateLimiter) limiterFor(r *http.Request) (*throttled.GCRARateLimiter, string) {
+	key := rl.GenerateKey(r)
+	if len(rl.routes) == 0 {
+		return &rl.GCRARateLimiter, key
+	}
+
+	template := rl.routeTemplate(r)
+	if limiter, ok := rl.routes[template]; ok {
+		if !rl.useRoute {
+			key += template
+		}
+		return limiter, key
+	}
+	return &rl.GCRARateLimiter, key
+}
+
+func (rl *RateLimiter) RateLimitWriter(key string, w http.ResponseWriter) bool {
+	return rateLimitWriter(&rl.GCRARateLimiter, key, w)
+}
+
+// RateLimitRequest counts r against the quota of the route serving it and answers 429 if it is used up.
+func (rl *RateLimiter) RateLimitRequest(w http.ResponseWriter, r *http.Request) bool {
+	limiter, key := rl.limiterFor(r)
+	return rateLimitWriter(limiter, key, w)
+}
+
+func rateLimitWriter(limiter *throttled.GCRARateLimiter, key string, w http.ResponseWriter) bool {
+	limited, context, err := limiter.RateLimit(key, 1)
+
+	if err != nil {
+		mlog.Critical("Internal server error when rate limiting. Rate Limiting broken. Error:" + err.Error())
+		return false
+	}
+
+	setRateLimitHeaders(w, context)
+
+	if limited {
+		mlog.Debug(fmt.Sprintf("Denied due to throttling settings code=429 key=%v", key))
+		http.Error(w, "limit exceeded", http.StatusTooManyRequests)
+	}
+
+	return limited
+}
+
+func (rl *RateLimiter) RateLimitHandler(wrappedHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limited := rl.RateLimitRequest(w, r)
+
+		if !limited {
+			wrappedHandler.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Copied from https://github.com/throttled/throttled http.go
+func setRateLimitHeaders(w http.ResponseWriter, context throttled.RateLimitResult) {
+	if v := context.Limit; v >= 0 {
+		w.Header().Add("X-RateLimit-Limit", strconv.Itoa(v))
+	}
+
+	if v := context.Remaining; v >= 0 {
+		w.Header().Add("X-RateLimit-Remaining", strconv.Itoa(v))
+	}
+
+	if v := context.ResetAfter; v >= 0 {
+		vi := int(math.Ceil(v.Seconds()))
+		w.Header().Add("X-RateLimit-Reset", strconv.Itoa(vi))
+	}
+
+	if v := context.RetryAfter; v >= 0 {
+		vi := int(math.Ceil(v.Seconds()))
+		w.Header().Add("Retry-After", strconv.Itoa(vi))
+	}
+}
+
+// rateLimitHandler consults the current limiter on every request, so a limiter replaced on config
+// reload takes effect without restarting the listener.
+func (a *App) rateLimitHandler(wrappedHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimiter := a.Srv.GetRateLimiter(); rateLimiter != nil {
+			if rateLimiter.RateLimitRequest(w, r) {
+				return
+			}
+		}
+		wrappedHandler.ServeHTTP(w, r)
+	})
+}
+
+func (a *App) configureRateLimiter(settings *model.RateLimitSettings) {
+	if !*settings.Enable {
+		a.Srv.SetRateLimiter(nil)
+		return
+	}
+
+	rateLimiter, err := NewRateLimiter(settings, a.Srv.Router)
+	if err != nil {
+		mlog.Error(err.Error())
+		return
+	}
+
+	mlog.Info("RateLimiter is enabled")
+	a.Srv.SetRateLimiter(rateLimiter)
+}
+
+func (a *App) addRateLimiter() *App {
+	a.configureRateLimiter(&a.Config().RateLimitSettings)
+
+	a.AddConfigListener(func(oldConfig *model.Config, newConfig *model.Config) {
+		if !reflect.DeepEqual(oldConfig.RateLimitSettings, newConfig.RateLimitSettings) {
+			a.configureRateLimiter(&newConfig.RateLimitSettings)
+		}
+	})
 
-}
\ No newline at end of file
+	return a
+}
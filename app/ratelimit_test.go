@@ -0,0 +1,260 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+func newRateLimitSettings(configure func(*model.RateLimitSettings)) *model.RateLimitSettings {
+	settings := &model.RateLimitSettings{}
+	settings.SetDefaults()
+	*settings.Enable = true
+	*settings.PerSec = 1
+	*settings.MaxBurst = 1
+	if configure != nil {
+		configure(settings)
+	}
+	return settings
+}
+
+func newRateLimitRouter() *mux.Router {
+	router := mux.NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/api/v4/users/{user_id}", ok)
+	router.HandleFunc("/api/v4/login", ok)
+	return router
+}
+
+func newRateLimitRequest(path string, remoteAddr string) *http.Request {
+	r := httptest.NewRequest("GET", path, nil)
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+func TestRateLimiterGenerateKey(t *testing.T) {
+	router := newRateLimitRouter()
+
+	tests := []struct {
+		name      string
+		configure func(*model.RateLimitSettings)
+		request   func() *http.Request
+		expected  string
+	}{
+		{
+			"RemoteAddr",
+			nil,
+			func() *http.Request { return newRateLimitRequest("/api/v4/login", "10.0.0.1:1234") },
+			"10.0.0.1",
+		},
+		{
+			"ForwardedFor",
+			nil,
+			func() *http.Request {
+				r := newRateLimitRequest("/api/v4/login", "10.0.0.1:1234")
+				r.Header.Set(model.HEADER_FORWARDED, "10.0.0.2, 10.0.0.3")
+				return r
+			},
+			"10.0.0.2",
+		},
+		{
+			"User",
+			func(s *model.RateLimitSettings) { *s.VaryByUser = true },
+			func() *http.Request {
+				r := newRateLimitRequest("/api/v4/login", "10.0.0.1:1234")
+				r.Header.Set(model.HEADER_AUTH, model.HEADER_BEARER+" token")
+				return r
+			},
+			"token",
+		},
+		{
+			"UserWithoutToken",
+			func(s *model.RateLimitSettings) { *s.VaryByUser = true },
+			func() *http.Request { return newRateLimitRequest("/api/v4/login", "10.0.0.1:1234") },
+			"10.0.0.1",
+		},
+		{
+			"Route",
+			func(s *model.RateLimitSettings) { *s.VaryByRoute = true },
+			func() *http.Request { return newRateLimitRequest("/api/v4/users/abc", "10.0.0.1:1234") },
+			"10.0.0.1/api/v4/users/{user_id}",
+		},
+		{
+			"UnmatchedRoute",
+			func(s *model.RateLimitSettings) { *s.VaryByRemoteAddr = false; *s.VaryByRoute = true },
+			func() *http.Request { return newRateLimitRequest("/unknown", "10.0.0.1:1234") },
+			"/unknown",
+		},
+		{
+			"Header",
+			func(s *model.RateLimitSettings) { *s.VaryByRemoteAddr = false; s.VaryByHeader = "X-Client" },
+			func() *http.Request {
+				r := newRateLimitRequest("/api/v4/login", "10.0.0.1:1234")
+				r.Header.Set("X-Client", "mobile")
+				return r
+			},
+			"mobile",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rateLimiter, err := NewRateLimiter(newRateLimitSettings(tc.configure), router)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if key := rateLimiter.GenerateKey(tc.request()); key != tc.expected {
+				t.Fatalf("expected key %q, got %q", tc.expected, key)
+			}
+		})
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	rateLimiter, err := NewRateLimiter(newRateLimitSettings(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := 0
+	handler := rateLimiter.RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+
+	// A burst of 1 lets two requests through at once.
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newRateLimitRequest("/", "10.0.0.1:1234"))
+		if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Fatalf("should let request %v through, got %v %v", i, w.Code, w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRateLimitRequest("/", "10.0.0.1:1234"))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("should deny a request over the quota, got %v", w.Code)
+	}
+	for _, header := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"} {
+		if w.Header().Get(header) == "" {
+			t.Fatalf("should set %v on a denied request", header)
+		}
+	}
+	if served != 2 {
+		t.Fatalf("should not serve a denied request, served %v", served)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRateLimitRequest("/", "10.0.0.2:1234"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("should count another address separately, got %v", w.Code)
+	}
+}
+
+func TestRateLimiterRoutes(t *testing.T) {
+	settings := newRateLimitSettings(func(s *model.RateLimitSettings) {
+		*s.PerSec = 100
+		*s.MaxBurst = 100
+		s.Routes = []model.RateLimitRoute{{Route: "/api/v4/login", PerSec: 1, MaxBurst: 1}}
+	})
+	rateLimiter, err := NewRateLimiter(settings, newRateLimitRouter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(path string) int {
+		w := httptest.NewRecorder()
+		rateLimiter.RateLimitRequest(w, newRateLimitRequest(path, "10.0.0.1:1234"))
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := request("/api/v4/login"); code != http.StatusOK {
+			t.Fatalf("should let request %v through, got %v", i, code)
+		}
+	}
+	if code := request("/api/v4/login"); code != http.StatusTooManyRequests {
+		t.Fatalf("should apply the quota of the route, got %v", code)
+	}
+
+	for i := 0; i < 10; i++ {
+		if code := request("/api/v4/users/abc"); code != http.StatusOK {
+			t.Fatalf("should apply the default quota to other routes, got %v", code)
+		}
+	}
+}
+
+func TestRateLimiterReconfigure(t *testing.T) {
+	a := newTestApp(t, func(cfg *model.Config) {
+		*cfg.RateLimitSettings.Enable = true
+		*cfg.RateLimitSettings.PerSec = 1
+		*cfg.RateLimitSettings.MaxBurst = 1
+	})
+	a.addRateLimiter()
+
+	first := a.Srv.GetRateLimiter()
+	if first == nil {
+		t.Fatal("should enable the rate limiter")
+	}
+
+	handler := a.rateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Requests keep flowing through the handler while the limiter is replaced.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				handler.ServeHTTP(httptest.NewRecorder(), newRateLimitRequest("/", "10.0.0.1:1234"))
+			}
+		}
+	}()
+
+	old := a.Config()
+	cfg := old.Clone()
+	*cfg.RateLimitSettings.PerSec = 1000
+	a.config.Store(cfg)
+	a.InvokeConfigListeners(old, cfg)
+
+	if a.Srv.GetRateLimiter() == first {
+		t.Fatal("should replace the rate limiter when its settings change")
+	}
+
+	unchanged := cfg.Clone()
+	a.config.Store(unchanged)
+	current := a.Srv.GetRateLimiter()
+	a.InvokeConfigListeners(cfg, unchanged)
+	if a.Srv.GetRateLimiter() != current {
+		t.Fatal("should keep the rate limiter when its settings are unchanged")
+	}
+
+	disabled := unchanged.Clone()
+	*disabled.RateLimitSettings.Enable = false
+	a.config.Store(disabled)
+	a.InvokeConfigListeners(unchanged, disabled)
+
+	close(stop)
+	wg.Wait()
+
+	if a.Srv.GetRateLimiter() != nil {
+		t.Fatal("should remove the rate limiter when disabled")
+	}
+	w := httptest.NewRecorder()
+	for i := 0; i < 5; i++ {
+		handler.ServeHTTP(w, newRateLimitRequest("/", "10.0.0.1:1234"))
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("should not limit once disabled, got %v", w.Code)
+	}
+}
@@ -7,7 +7,18 @@ import (
 	"github.com/OhBonsai/go-web-boilerplate/store"
 	"github.com/OhBonsai/go-web-boilerplate/mlog"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/handlers"
 	"time"
+	"fmt"
+	"sync"
+	"crypto/tls"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 const TIME_TO_WAIT_FOR_CONNECTIONS_TO_CLOSE_ON_SERVER_SHUTDOWN = time.Second
@@ -17,12 +28,278 @@ type Server struct {
 	//WebSocketRouter   *WebSocketRouter
 	Router            *mux.Router
 	Server            *http.Server
+	RedirectServer    *http.Server
+	// LocalRouter serves the local mode socket. Its routes skip authentication, since only users with
+	// access to the socket file can reach them.
+	LocalRouter       *mux.Router
+	LocalModeServer   *http.Server
 	ListenAddr        *net.TCPAddr
 	RateLimiter       *RateLimiter
 
+	rateLimiterLock   sync.RWMutex
 	didFinishListen   chan struct{}
+	serveErr          chan error
+	didFinishRedirect chan struct{}
+	didFinishLocal    chan struct{}
 }
 
+func (s *Server) GetRateLimiter() *RateLimiter {
+	s.rateLimiterLock.RLock()
+	defer s.rateLimiterLock.RUnlock()
+	return s.RateLimiter
+}
+
+func (s *Server) SetRateLimiter(rateLimiter *RateLimiter) {
+	s.rateLimiterLock.Lock()
+	defer s.rateLimiterLock.Unlock()
+	s.RateLimiter = rateLimiter
+}
+
+// ServeErr delivers the error that stopped the server from serving, if it stops for any reason other than
+// StopServer. It is nil until StartServer succeeds.
+func (s *Server) ServeErr() <-chan error {
+	return s.serveErr
+}
+
+type RecoveryLogger struct {
+}
+
+func (rl *RecoveryLogger) Println(i ...interface{}) {
+	mlog.Error("Please check the std error output for the stack trace")
+	mlog.Error(fmt.Sprint(i...))
+}
+
+func (a *App) StartServer() error {
+	mlog.Info("Starting Server...")
+
+	var handler http.Handler = a.rateLimitHandler(a.Srv.Router)
+
+	a.Srv.Server = &http.Server{
+		Handler:      handlers.RecoveryHandler(handlers.RecoveryLogger(&RecoveryLogger{}), handlers.PrintRecoveryStack(true))(handler),
+		ReadTimeout:  time.Duration(*a.Config().ServiceSettings.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(*a.Config().ServiceSettings.WriteTimeout) * time.Second,
+	}
+
+	useTLS := *a.Config().ServiceSettings.ConnectionSecurity == model.CONN_SECURITY_TLS
+
+	addr := *a.Config().ServiceSettings.ListenAddress
+	if addr == "" {
+		if useTLS {
+			addr = ":https"
+		} else {
+			addr = ":http"
+		}
+	}
+
+	var certManager *autocert.Manager
+	if useTLS {
+		if *a.Config().ServiceSettings.UseLetsEncrypt {
+			certManager = a.newCertManager()
+		}
+
+		tlsConfig, err := a.newTLSConfig(certManager)
+		if err != nil {
+			a.Srv.Server = nil
+			return err
+		}
+		a.Srv.Server.TLSConfig = tlsConfig
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		a.Srv.Server = nil
+		return fmt.Errorf("Error starting server, err:%v", err)
+	}
+	a.Srv.ListenAddr = listener.Addr().(*net.TCPAddr)
+
+	mlog.Info(fmt.Sprintf("Server is listening on %v", listener.Addr().String()))
+
+	if *a.Config().ServiceSettings.Forward80To443 {
+		if err := a.startRedirectServer(addr, certManager); err != nil {
+			listener.Close()
+			a.Srv.Server = nil
+			return err
+		}
+	}
+
+	if *a.Config().ServiceSettings.EnableLocalMode {
+		if err := a.startLocalModeServer(); err != nil {
+			a.stopRedirectServer()
+			listener.Close()
+			a.Srv.Server = nil
+			return err
+		}
+	}
+
+	a.Srv.didFinishListen = make(chan struct{})
+	a.Srv.serveErr = make(chan error, 1)
+	a.Go(func() {
+		var err error
+		if useTLS {
+			err = a.Srv.Server.ServeTLS(listener, "", "")
+		} else {
+			err = a.Srv.Server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			mlog.Critical(fmt.Sprintf("Error starting server, err:%v", err))
+			a.Srv.serveErr <- err
+		}
+		close(a.Srv.didFinishListen)
+	})
+
+	return nil
+}
+
+// newTLSConfig applies our cipher and protocol defaults. Certificates come from certManager when
+// Let's Encrypt is in use, otherwise from the configured certificate pair.
+func (a *App) newTLSConfig(certManager *autocert.Manager) (*tls.Config, error) {
+	settings := a.Config().ServiceSettings
+
+	tlsConfig := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+		NextProtos: []string{"h2", "http/1.1", acme.ALPNProto},
+	}
+
+	if certManager != nil {
+		tlsConfig.GetCertificate = certManager.GetCertificate
+		return tlsConfig, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(*settings.TLSCertFile, *settings.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load TLS certificate, err:%v", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	return tlsConfig, nil
+}
+
+// startRedirectServer listens on port 80 of the same host as addr and forwards every request to the port
+// the HTTPS server is listening on. When certManager is set the listener also answers its HTTP-01
+// challenges.
+func (a *App) startRedirectServer(addr string, certManager *autocert.Manager) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("Unable to setup forwarding, err:%v", err)
+	}
+
+	redirectListener, err := net.Listen("tcp", net.JoinHostPort(host, "http"))
+	if err != nil {
+		return fmt.Errorf("Unable to setup forwarding, err:%v", err)
+	}
+
+	var handler http.Handler = http.HandlerFunc(a.handleHTTPRedirect)
+	if certManager != nil {
+		handler = certManager.HTTPHandler(handler)
+	}
+
+	a.Srv.RedirectServer = &http.Server{
+		Handler: handler,
+	}
+
+	mlog.Info(fmt.Sprintf("Forwarding requests from %v to HTTPS", redirectListener.Addr().String()))
+
+	a.Srv.didFinishRedirect = make(chan struct{})
+	a.Go(func() {
+		if err := a.Srv.RedirectServer.Serve(redirectListener); err != nil && err != http.ErrServerClosed {
+			mlog.Error(fmt.Sprintf("Error serving forwarding listener, err:%v", err))
+		}
+		close(a.Srv.didFinishRedirect)
+	})
+
+	return nil
+}
+
+// startLocalModeServer serves LocalRouter on the configured unix socket. The socket is only accessible to
+// the user the server runs as.
+func (a *App) startLocalModeServer() error {
+	socket := *a.Config().ServiceSettings.LocalModeSocketLocation
+
+	// A socket left behind by a server that did not shut down cleanly would make Listen fail.
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove the local mode socket, err:%v", err)
+	}
+
+	localListener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("Unable to start local mode, err:%v", err)
+	}
+
+	if err := os.Chmod(socket, 0600); err != nil {
+		localListener.Close()
+		return fmt.Errorf("Unable to start local mode, err:%v", err)
+	}
+
+	a.Srv.LocalModeServer = &http.Server{
+		Handler: handlers.RecoveryHandler(handlers.RecoveryLogger(&RecoveryLogger{}), handlers.PrintRecoveryStack(true))(a.Srv.LocalRouter),
+	}
+
+	mlog.Info(fmt.Sprintf("Local mode is listening on %v", socket))
+
+	a.Srv.didFinishLocal = make(chan struct{})
+	a.Go(func() {
+		if err := a.Srv.LocalModeServer.Serve(localListener); err != nil && err != http.ErrServerClosed {
+			mlog.Error(fmt.Sprintf("Error serving local mode, err:%v", err))
+		}
+		close(a.Srv.didFinishLocal)
+	})
+
+	return nil
+}
+
+func (a *App) handleHTTPRedirect(w http.ResponseWriter, r *http.Request) {
+	target := &url.URL{
+		Scheme:   "https",
+		Host:     a.httpsHost(r.Host),
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+	}
+
+	if siteURL, err := url.Parse(*a.Config().ServiceSettings.SiteURL); err == nil && siteURL.Host != "" {
+		target.Host = siteURL.Host
+		// r.URL.Path starts with a slash, so the one a SiteURL may end with is dropped.
+		target.Path = strings.TrimSuffix(siteURL.Path, "/") + r.URL.Path
+	}
+
+	if target.Host == "" {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+}
+
+// httpsHost swaps the port of host for the one the HTTPS server is listening on, leaving it out when it
+// is the default.
+func (a *App) httpsHost(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return ""
+	}
+
+	port := "443"
+	if a.Srv.ListenAddr != nil {
+		port = strconv.Itoa(a.Srv.ListenAddr.Port)
+	}
+	if port == "443" {
+		// JoinHostPort brackets IPv6 addresses, which a host without a port still needs.
+		return strings.TrimSuffix(net.JoinHostPort(host, port), ":443")
+	}
+	return net.JoinHostPort(host, port)
+}
 
 func (a *App) StopServer() {
 	if a.Srv.Server != nil {
@@ -43,5 +320,34 @@ func (a *App) StopServer() {
 		}
 		a.Srv.Server.Close()
 		a.Srv.Server = nil
+		a.Srv.didFinishListen = nil
+	}
+
+	a.stopRedirectServer()
+
+	if a.Srv.LocalModeServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), TIME_TO_WAIT_FOR_CONNECTIONS_TO_CLOSE_ON_SERVER_SHUTDOWN)
+		defer cancel()
+		if err := a.Srv.LocalModeServer.Shutdown(ctx); err != nil {
+			mlog.Warn(err.Error())
+			a.Srv.LocalModeServer.Close()
+		}
+		<-a.Srv.didFinishLocal
+		a.Srv.LocalModeServer = nil
+		a.Srv.didFinishLocal = nil
+	}
+}
+
+func (a *App) stopRedirectServer() {
+	if a.Srv.RedirectServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), TIME_TO_WAIT_FOR_CONNECTIONS_TO_CLOSE_ON_SERVER_SHUTDOWN)
+		defer cancel()
+		if err := a.Srv.RedirectServer.Shutdown(ctx); err != nil {
+			mlog.Warn(err.Error())
+			a.Srv.RedirectServer.Close()
+		}
+		<-a.Srv.didFinishRedirect
+		a.Srv.RedirectServer = nil
+		a.Srv.didFinishRedirect = nil
 	}
 }
\ No newline at end of file
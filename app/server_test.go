@@ -0,0 +1,128 @@
+package app
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+// newTestApp returns an app with the default config and no store, enough to start the server.
+func newTestApp(t *testing.T, configure func(*model.Config)) *App {
+	t.Helper()
+
+	cfg := &model.Config{}
+	cfg.SetDefaults()
+	*cfg.ServiceSettings.ListenAddress = "127.0.0.1:0"
+	if configure != nil {
+		configure(cfg)
+	}
+
+	a := simpleInitApp()
+	a.config.Store(cfg)
+	return a
+}
+
+func TestStartServerListenAddr(t *testing.T) {
+	a := newTestApp(t, nil)
+	a.Srv.Router.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+
+	if err := a.StartServer(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.StopServer()
+
+	if a.Srv.ListenAddr == nil || a.Srv.ListenAddr.Port == 0 {
+		t.Fatalf("should report the port chosen for :0, got %v", a.Srv.ListenAddr)
+	}
+
+	resp, err := http.Get("http://" + a.Srv.ListenAddr.String() + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "pong" {
+		t.Fatalf("should serve on ListenAddr, got %q", body)
+	}
+}
+
+func TestStartServerListenError(t *testing.T) {
+	a := newTestApp(t, nil)
+	if err := a.StartServer(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.StopServer()
+
+	b := newTestApp(t, func(cfg *model.Config) {
+		*cfg.ServiceSettings.ListenAddress = a.Srv.ListenAddr.String()
+	})
+	if err := b.StartServer(); err == nil {
+		b.StopServer()
+		t.Fatal("should fail to listen on an address in use")
+	}
+	if b.Srv.Server != nil {
+		t.Fatal("should not keep a server that failed to start")
+	}
+}
+
+func TestStopServer(t *testing.T) {
+	a := newTestApp(t, nil)
+	if err := a.StartServer(); err != nil {
+		t.Fatal(err)
+	}
+	addr := a.Srv.ListenAddr.String()
+
+	a.StopServer()
+	a.WaitForGoroutines()
+
+	if _, err := http.Get("http://" + addr + "/"); err == nil {
+		t.Fatal("should stop listening")
+	}
+
+	select {
+	case err := <-a.Srv.ServeErr():
+		t.Fatalf("should not report StopServer as a serve failure, got %v", err)
+	default:
+	}
+}
+
+func TestHTTPRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		siteURL  string
+		port     int
+		host     string
+		expected string
+	}{
+		{"DefaultPort", "", 443, "example.com", "https://example.com/path?q=1"},
+		{"OtherPort", "", 8443, "example.com:80", "https://example.com:8443/path?q=1"},
+		{"IPv6", "", 443, "[::1]:80", "https://[::1]/path?q=1"},
+		{"IPv6OtherPort", "", 8443, "[::1]", "https://[::1]:8443/path?q=1"},
+		{"SiteURL", "https://chat.example.com:9443/sub", 8443, "example.com", "https://chat.example.com:9443/sub/path?q=1"},
+		{"SiteURLTrailingSlash", "https://host/", 8443, "example.com", "https://host/path?q=1"},
+		{"SiteURLSubpathTrailingSlash", "https://host/sub/", 8443, "example.com", "https://host/sub/path?q=1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestApp(t, func(cfg *model.Config) {
+				*cfg.ServiceSettings.SiteURL = tc.siteURL
+			})
+			a.Srv.ListenAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tc.port}
+
+			r := httptest.NewRequest("GET", "http://"+tc.host+"/path?q=1", nil)
+			w := httptest.NewRecorder()
+			a.handleHTTPRedirect(w, r)
+
+			if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tc.expected {
+				t.Fatalf("expected a redirect to %v, got %v %v", tc.expected, w.Code, w.Header().Get("Location"))
+			}
+		})
+	}
+}
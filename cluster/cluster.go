@@ -0,0 +1,204 @@
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+const (
+	SEEN_MESSAGES_CACHE_SIZE = 10000
+)
+
+// envelope wraps a message with what nodes need to drop messages they sent or have already handled.
+type envelope struct {
+	Id      string                `json:"id"`
+	Cluster string                `json:"cluster"`
+	Origin  string                `json:"origin"`
+	Message *model.ClusterMessage `json:"message"`
+}
+
+// Cluster is the built-in implementation of einterfaces.ClusterInterface. Every message is prefixed with
+// an HMAC-SHA256 of the envelope keyed by the shared secret, and messages that do not verify are dropped.
+type Cluster struct {
+	id        string
+	name      string
+	secret    []byte
+	transport Transport
+	seen      *utils.Cache
+
+	handlersLock sync.RWMutex
+	handlers     map[string]einterfaces.ClusterMessageHandler
+}
+
+// NewCluster creates a node using the transport selected by settings.
+func NewCluster(settings *model.ClusterSettings) (*Cluster, error) {
+	var transport Transport
+
+	switch *settings.Transport {
+	case model.CLUSTER_TRANSPORT_UDP:
+		udp, err := NewUdpTransport(*settings.MulticastAddress)
+		if err != nil {
+			return nil, err
+		}
+		transport = udp
+	case model.CLUSTER_TRANSPORT_TCP:
+		transport = NewTcpTransport(*settings.BindAddress, settings.Peers)
+	default:
+		return nil, fmt.Errorf("unknown cluster transport %v", *settings.Transport)
+	}
+
+	return NewClusterWithTransport(*settings.ClusterName, *settings.SharedSecret, transport), nil
+}
+
+// NewClusterWithTransport creates a node that only exchanges messages with nodes of the same cluster name
+// and shared secret.
+func NewClusterWithTransport(name, secret string, transport Transport) *Cluster {
+	return &Cluster{
+		id:        model.NewId(),
+		name:      name,
+		secret:    []byte(secret),
+		transport: transport,
+		seen:      utils.NewLru(SEEN_MESSAGES_CACHE_SIZE),
+		handlers:  make(map[string]einterfaces.ClusterMessageHandler),
+	}
+}
+
+func (c *Cluster) StartInterNodeCommunication() {
+	if err := c.transport.Start(c.receive); err != nil {
+		mlog.Error(fmt.Sprintf("Failed to start cluster communication: %v", err.Error()))
+		return
+	}
+
+	mlog.Info(fmt.Sprintf("Cluster node %v started", c.id))
+}
+
+func (c *Cluster) StopInterNodeCommunication() {
+	if err := c.transport.Close(); err != nil {
+		mlog.Error(fmt.Sprintf("Failed to stop cluster communication: %v", err.Error()))
+	}
+}
+
+func (c *Cluster) RegisterClusterMessageHandler(event string, crm einterfaces.ClusterMessageHandler) {
+	c.handlersLock.Lock()
+	defer c.handlersLock.Unlock()
+
+	c.handlers[event] = crm
+}
+
+func (c *Cluster) GetClusterId() string {
+	return c.id
+}
+
+func (c *Cluster) SendClusterMessage(msg *model.ClusterMessage) {
+	env := &envelope{
+		Id:      model.NewId(),
+		Cluster: c.name,
+		Origin:  c.id,
+		Message: msg,
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		mlog.Error(fmt.Sprintf("Failed to encode cluster message event=%v: %v", msg.Event, err.Error()))
+		return
+	}
+
+	c.seen.Add(env.Id, true)
+
+	if err := c.transport.Broadcast(c.sign(data)); err != nil {
+		mlog.Warn(fmt.Sprintf("Failed to send cluster message event=%v: %v", msg.Event, err.Error()))
+	}
+}
+
+func (c *Cluster) receive(signed []byte) {
+	data, ok := c.verify(signed)
+	if !ok {
+		mlog.Warn("Dropped a cluster message with an invalid signature")
+		return
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Message == nil {
+		mlog.Warn("Dropped a malformed cluster message")
+		return
+	}
+
+	if env.Cluster != c.name || env.Origin == c.id {
+		return
+	}
+
+	if _, ok := c.seen.Get(env.Id); ok {
+		return
+	}
+	c.seen.Add(env.Id, true)
+
+	if c.transport.Relay() {
+		if err := c.transport.Broadcast(signed); err != nil {
+			mlog.Debug(fmt.Sprintf("Failed to relay cluster message event=%v: %v", env.Message.Event, err.Error()))
+		}
+	}
+
+	c.handlersLock.RLock()
+	handler := c.handlers[env.Message.Event]
+	c.handlersLock.RUnlock()
+
+	if handler != nil {
+		handler(env.Message)
+	}
+}
+
+// sign prefixes data with its MAC.
+func (c *Cluster) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(data)
+	return append(mac.Sum(nil), data...)
+}
+
+// verify returns the data of a signed message if its MAC matches.
+func (c *Cluster) verify(signed []byte) ([]byte, bool) {
+	if len(signed) < sha256.Size {
+		return nil, false
+	}
+
+	data := signed[sha256.Size:]
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(data)
+	if !hmac.Equal(signed[:sha256.Size], mac.Sum(nil)) {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// RegisterCacheInvalidation shares the removals and purges of cache with the rest of the cluster, and
+// applies theirs to it. Caches without an invalidate cluster event are left alone.
+func RegisterCacheInvalidation(cluster einterfaces.ClusterInterface, cache *utils.Cache) {
+	event := cache.GetInvalidateClusterEvent()
+	if event == "" {
+		return
+	}
+
+	cache.SetInvalidationHandler(func(key string, purged bool) {
+		msg := &model.ClusterMessage{Event: event, Data: key}
+		if purged {
+			msg.Props = map[string]string{model.CLUSTER_PROP_PURGE_CACHE: "true"}
+		}
+		cluster.SendClusterMessage(msg)
+	})
+
+	cluster.RegisterClusterMessageHandler(event, func(msg *model.ClusterMessage) {
+		if msg.Props[model.CLUSTER_PROP_PURGE_CACHE] == "true" {
+			cache.PurgeLocal()
+		} else {
+			cache.RemoveLocal(msg.Data)
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// startTcpNodes starts a node per address, each connected to the addresses listed for it in peers.
+func startTcpNodes(t *testing.T, addresses []string, peers map[int][]int) []*Cluster {
+	var nodes []*Cluster
+	for i, address := range addresses {
+		var peerAddresses []string
+		for _, p := range peers[i] {
+			peerAddresses = append(peerAddresses, addresses[p])
+		}
+
+		node := NewClusterWithTransport("test", testSecret, NewTcpTransport(address, peerAddresses))
+		node.StartInterNodeCommunication()
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func stopNodes(nodes []*Cluster) {
+	for _, node := range nodes {
+		node.StopInterNodeCommunication()
+	}
+}
+
+func receiveMessage(t *testing.T, received chan *model.ClusterMessage) *model.ClusterMessage {
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+	return nil
+}
+
+func TestTcpGossip(t *testing.T) {
+	addresses := []string{freeAddress(t), freeAddress(t), freeAddress(t)}
+
+	// a line of nodes, so messages between the ends have to be relayed by the middle one
+	nodes := startTcpNodes(t, addresses, map[int][]int{0: {1}, 1: {0, 2}, 2: {1}})
+	defer stopNodes(nodes)
+
+	received := make([]chan *model.ClusterMessage, len(nodes))
+	for i, node := range nodes {
+		received[i] = make(chan *model.ClusterMessage, 10)
+		ch := received[i]
+		node.RegisterClusterMessageHandler("test", func(msg *model.ClusterMessage) {
+			ch <- msg
+		})
+	}
+
+	nodes[0].SendClusterMessage(&model.ClusterMessage{Event: "test", Data: "hello"})
+
+	for _, i := range []int{1, 2} {
+		if msg := receiveMessage(t, received[i]); msg.Data != "hello" {
+			t.Fatalf("node %v received %v", i, msg.Data)
+		}
+	}
+
+	// give duplicates a chance to arrive before checking there are none
+	time.Sleep(200 * time.Millisecond)
+	for i, ch := range received {
+		if len(ch) != 0 {
+			t.Fatalf("node %v received a message more than once, or its own message", i)
+		}
+	}
+}
+
+func TestTcpIgnoresOtherClusters(t *testing.T) {
+	addresses := []string{freeAddress(t), freeAddress(t)}
+
+	a := NewClusterWithTransport("a", testSecret, NewTcpTransport(addresses[0], []string{addresses[1]}))
+	b := NewClusterWithTransport("b", testSecret, NewTcpTransport(addresses[1], []string{addresses[0]}))
+	a.StartInterNodeCommunication()
+	b.StartInterNodeCommunication()
+	defer stopNodes([]*Cluster{a, b})
+
+	received := make(chan *model.ClusterMessage, 1)
+	b.RegisterClusterMessageHandler("test", func(msg *model.ClusterMessage) {
+		received <- msg
+	})
+
+	a.SendClusterMessage(&model.ClusterMessage{Event: "test"})
+
+	select {
+	case <-received:
+		t.Fatal("should ignore messages from another cluster")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestTcpIgnoresOtherSecrets(t *testing.T) {
+	addresses := []string{freeAddress(t), freeAddress(t)}
+
+	a := NewClusterWithTransport("test", testSecret, NewTcpTransport(addresses[0], []string{addresses[1]}))
+	b := NewClusterWithTransport("test", "fedcba9876543210fedcba9876543210", NewTcpTransport(addresses[1], []string{addresses[0]}))
+	a.StartInterNodeCommunication()
+	b.StartInterNodeCommunication()
+	defer stopNodes([]*Cluster{a, b})
+
+	received := make(chan *model.ClusterMessage, 1)
+	b.RegisterClusterMessageHandler("test", func(msg *model.ClusterMessage) {
+		received <- msg
+	})
+
+	a.SendClusterMessage(&model.ClusterMessage{Event: "test"})
+
+	select {
+	case <-received:
+		t.Fatal("should ignore messages signed with another secret")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestVerify(t *testing.T) {
+	c := NewClusterWithTransport("test", testSecret, nil)
+
+	signed := c.sign([]byte(`{"id":"1"}`))
+	if data, ok := c.verify(signed); !ok || string(data) != `{"id":"1"}` {
+		t.Fatalf("should verify its own message, got %q %v", data, ok)
+	}
+
+	tampered := append([]byte{}, signed...)
+	tampered[len(tampered)-2] ^= 1
+	if _, ok := c.verify(tampered); ok {
+		t.Fatal("should reject a modified message")
+	}
+
+	if _, ok := c.verify([]byte("short")); ok {
+		t.Fatal("should reject a message shorter than its MAC")
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	addresses := []string{freeAddress(t), freeAddress(t)}
+	nodes := startTcpNodes(t, addresses, map[int][]int{0: {1}, 1: {0}})
+	defer stopNodes(nodes)
+
+	caches := []*utils.Cache{
+		utils.NewLruWithParams(10, "", 0, "inv_test"),
+		utils.NewLruWithParams(10, "", 0, "inv_test"),
+	}
+	for i, cache := range caches {
+		RegisterCacheInvalidation(nodes[i], cache)
+		cache.Add("a", 1)
+		cache.Add("b", 2)
+		cache.Add("", 3)
+	}
+
+	waitFor := func(cond func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the invalidation")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	caches[0].Remove("a")
+	waitFor(func() bool {
+		_, ok := caches[1].Get("a")
+		return !ok
+	})
+	if _, ok := caches[1].Get("b"); !ok {
+		t.Fatal("only the removed key should be invalidated")
+	}
+
+	// An empty key is removed like any other, rather than purging the cache.
+	caches[0].Remove("")
+	waitFor(func() bool {
+		_, ok := caches[1].Get("")
+		return !ok
+	})
+	if _, ok := caches[1].Get("b"); !ok {
+		t.Fatal("removing the empty key should not purge the cache")
+	}
+
+	caches[1].Purge()
+	waitFor(func() bool {
+		return caches[0].Len() == 0
+	})
+}
+
+func TestUdpMulticast(t *testing.T) {
+	var nodes []*Cluster
+	for i := 0; i < 2; i++ {
+		transport, err := NewUdpTransport("239.255.75.76:18075")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		node := NewClusterWithTransport("test", testSecret, transport)
+		if err := transport.Start(node.receive); err != nil {
+			stopNodes(nodes)
+			t.Skipf("multicast is unavailable: %v", err)
+		}
+		nodes = append(nodes, node)
+	}
+	defer stopNodes(nodes)
+
+	received := make(chan *model.ClusterMessage, 10)
+	nodes[1].RegisterClusterMessageHandler("test", func(msg *model.ClusterMessage) {
+		received <- msg
+	})
+
+	nodes[0].SendClusterMessage(&model.ClusterMessage{Event: "test", Data: "hello"})
+
+	select {
+	case msg := <-received:
+		if msg.Data != "hello" {
+			t.Fatalf("received %v", msg.Data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Skip("multicast is not routed on this host")
+	}
+}
@@ -0,0 +1,248 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+)
+
+const (
+	TCP_DIAL_TIMEOUT     = 2 * time.Second
+	TCP_WRITE_TIMEOUT    = 2 * time.Second
+	TCP_MAX_FRAME_SIZE   = 1 << 20
+	TCP_PEER_QUEUE_SIZE  = 1000
+	TCP_FRAME_HEADER_LEN = 4
+)
+
+// TcpTransport keeps a connection to each configured peer and gossips messages over them. Peers need not
+// form a full mesh, since every node forwards the messages it has not seen before.
+type TcpTransport struct {
+	bindAddress string
+	peers       []*tcpPeer
+	listener    net.Listener
+
+	lock    sync.Mutex
+	inbound map[net.Conn]bool
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type tcpPeer struct {
+	address string
+	queue   chan []byte
+	conn    net.Conn
+}
+
+func NewTcpTransport(bindAddress string, peers []string) *TcpTransport {
+	t := &TcpTransport{
+		bindAddress: bindAddress,
+		inbound:     make(map[net.Conn]bool),
+	}
+
+	for _, address := range peers {
+		t.peers = append(t.peers, &tcpPeer{address: address})
+	}
+
+	return t
+}
+
+// Addr returns the address the transport listens on once started.
+func (t *TcpTransport) Addr() net.Addr {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Addr()
+}
+
+func (t *TcpTransport) Start(receive func(data []byte)) error {
+	listener, err := net.Listen("tcp", t.bindAddress)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	t.listener = listener
+	t.lock.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !isClosedError(err) {
+					mlog.Error(fmt.Sprintf("Cluster listener stopped: %v", err.Error()))
+				}
+				return
+			}
+
+			t.lock.Lock()
+			t.inbound[conn] = true
+			t.lock.Unlock()
+
+			t.wg.Add(1)
+			go func() {
+				defer t.wg.Done()
+				t.readFrames(conn, receive)
+			}()
+		}
+	}()
+
+	for _, peer := range t.peers {
+		peer.queue = make(chan []byte, TCP_PEER_QUEUE_SIZE)
+
+		t.wg.Add(1)
+		go func(peer *tcpPeer) {
+			defer t.wg.Done()
+			peer.run()
+		}(peer)
+	}
+
+	return nil
+}
+
+func (t *TcpTransport) readFrames(conn net.Conn, receive func(data []byte)) {
+	defer func() {
+		t.lock.Lock()
+		delete(t.inbound, conn)
+		t.lock.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	header := make([]byte, TCP_FRAME_HEADER_LEN)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err != io.EOF && !isClosedError(err) {
+				mlog.Debug(fmt.Sprintf("Closing cluster connection from %v: %v", conn.RemoteAddr(), err.Error()))
+			}
+			return
+		}
+
+		size := binary.BigEndian.Uint32(header)
+		if size > TCP_MAX_FRAME_SIZE {
+			mlog.Warn(fmt.Sprintf("Closing cluster connection from %v: frame of %v bytes is too large", conn.RemoteAddr(), size))
+			return
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return
+		}
+
+		receive(data)
+	}
+}
+
+// Broadcast queues data for every peer. A message is dropped for a peer whose queue is full.
+func (t *TcpTransport) Broadcast(data []byte) error {
+	if len(data) > TCP_MAX_FRAME_SIZE {
+		return fmt.Errorf("message of %v bytes is too large", len(data))
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.listener == nil || t.closed {
+		return fmt.Errorf("the tcp transport is not running")
+	}
+
+	var dropped []string
+	for _, peer := range t.peers {
+		select {
+		case peer.queue <- data:
+		default:
+			dropped = append(dropped, peer.address)
+		}
+	}
+
+	if len(dropped) > 0 {
+		return fmt.Errorf("dropped message for peers with a full queue: %v", strings.Join(dropped, ", "))
+	}
+
+	return nil
+}
+
+func (t *TcpTransport) Relay() bool {
+	return true
+}
+
+func (t *TcpTransport) Close() error {
+	t.lock.Lock()
+	if t.listener == nil || t.closed {
+		t.lock.Unlock()
+		return nil
+	}
+
+	err := t.listener.Close()
+	t.closed = true
+	for conn := range t.inbound {
+		conn.Close()
+	}
+	for _, peer := range t.peers {
+		close(peer.queue)
+	}
+	t.lock.Unlock()
+
+	t.wg.Wait()
+
+	return err
+}
+
+func (p *tcpPeer) run() {
+	defer func() {
+		if p.conn != nil {
+			p.conn.Close()
+			p.conn = nil
+		}
+	}()
+
+	frame := make([]byte, TCP_FRAME_HEADER_LEN)
+	for data := range p.queue {
+		frame = append(frame[:TCP_FRAME_HEADER_LEN], data...)
+		binary.BigEndian.PutUint32(frame, uint32(len(data)))
+
+		// A connection may have gone stale since the last message, so the write is retried once on a fresh one.
+		for attempt := 0; attempt < 2; attempt++ {
+			if err := p.write(frame); err != nil {
+				mlog.Debug(fmt.Sprintf("Failed to send cluster message to %v: %v", p.address, err.Error()))
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (p *tcpPeer) write(frame []byte) error {
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.address, TCP_DIAL_TIMEOUT)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	p.conn.SetWriteDeadline(time.Now().Add(TCP_WRITE_TIMEOUT))
+	if _, err := p.conn.Write(frame); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+func isClosedError(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
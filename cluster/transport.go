@@ -0,0 +1,16 @@
+package cluster
+
+// Transport carries encoded cluster messages between nodes.
+type Transport interface {
+	// Start begins delivering every message received from other nodes to receive.
+	Start(receive func(data []byte)) error
+
+	// Broadcast sends data to the other nodes. Delivery is best effort.
+	Broadcast(data []byte) error
+
+	// Relay reports whether the transport only reaches some of the nodes directly, so that nodes must
+	// forward the messages they receive for them to reach the whole cluster.
+	Relay() bool
+
+	Close() error
+}
@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+)
+
+const (
+	UDP_MAX_DATAGRAM_SIZE = 65507
+)
+
+// UdpTransport broadcasts messages to every node listening on the same multicast group.
+type UdpTransport struct {
+	group    *net.UDPAddr
+	conn     *net.UDPConn
+	sendConn *net.UDPConn
+	wg       sync.WaitGroup
+}
+
+func NewUdpTransport(multicastAddress string) (*UdpTransport, error) {
+	group, err := net.ResolveUDPAddr("udp", multicastAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if !group.IP.IsMulticast() {
+		return nil, fmt.Errorf("%v is not a multicast address", multicastAddress)
+	}
+
+	return &UdpTransport{group: group}, nil
+}
+
+func (t *UdpTransport) Start(receive func(data []byte)) error {
+	conn, err := net.ListenMulticastUDP("udp", nil, t.group)
+	if err != nil {
+		return err
+	}
+
+	sendConn, err := net.DialUDP("udp", nil, t.group)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	t.conn = conn
+	t.sendConn = sendConn
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		buf := make([]byte, UDP_MAX_DATAGRAM_SIZE)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if !isClosedError(err) {
+					mlog.Error(fmt.Sprintf("Cluster multicast listener stopped: %v", err.Error()))
+				}
+				return
+			}
+
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			receive(data)
+		}
+	}()
+
+	return nil
+}
+
+func (t *UdpTransport) Broadcast(data []byte) error {
+	if t.sendConn == nil {
+		return fmt.Errorf("the multicast transport has not been started")
+	}
+
+	if len(data) > UDP_MAX_DATAGRAM_SIZE {
+		return fmt.Errorf("message of %v bytes does not fit in a datagram", len(data))
+	}
+
+	_, err := t.sendConn.Write(data)
+	return err
+}
+
+func (t *UdpTransport) Relay() bool {
+	return false
+}
+
+func (t *UdpTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+
+	t.sendConn.Close()
+	err := t.conn.Close()
+	t.wg.Wait()
+
+	t.conn = nil
+	t.sendConn = nil
+
+	return err
+}
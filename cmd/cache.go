@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/OhBonsai/go-web-boilerplate/app"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect the caches of a running server",
+}
+
+var CacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print cache statistics",
+	Long:  "Prints the size, capacity and hit ratio of every cache in a running server.",
+	Args:  cobra.NoArgs,
+	RunE:  cacheStatsCmdF,
+}
+
+var CachePurgeCmd = &cobra.Command{
+	Use:     "purge <name>",
+	Short:   "Purge a cache",
+	Long:    "Empties the named cache in a running server.",
+	Example: "cache purge Session",
+	Args:    cobra.ExactArgs(1),
+	RunE:    cachePurgeCmdF,
+}
+
+func init() {
+	CacheCmd.PersistentFlags().String("socket", "", "Path of the local mode socket of the running server. Defaults to the LocalModeSocketLocation in the config.")
+
+	CacheCmd.AddCommand(
+		CacheStatsCmd,
+		CachePurgeCmd,
+	)
+	RootCmd.AddCommand(CacheCmd)
+}
+
+// getLocalModeSocket returns the --socket flag, or the socket the configured server serves local mode on.
+func getLocalModeSocket(command *cobra.Command) (string, error) {
+	socket, err := command.Flags().GetString("socket")
+	if err != nil {
+		return "", err
+	}
+	if socket != "" {
+		return socket, nil
+	}
+
+	configStore, config, _, err := loadConfig(command)
+	if err != nil {
+		return "", err
+	}
+	defer configStore.Close()
+
+	if !*config.ServiceSettings.EnableLocalMode {
+		return "", errors.New("local mode is disabled, set ServiceSettings.EnableLocalMode to inspect the caches")
+	}
+
+	return *config.ServiceSettings.LocalModeSocketLocation, nil
+}
+
+func doCacheRequest(command *cobra.Command, method, path string) (*http.Response, error) {
+	socket, err := getLocalModeSocket(command)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	// The host is ignored, every request goes to the socket.
+	r, err := http.NewRequest(method, "http://localhost"+app.CACHE_ROUTE_PREFIX+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, model.AppErrorFromJson(resp.Body)
+	}
+
+	return resp, nil
+}
+
+func cacheStatsCmdF(command *cobra.Command, args []string) error {
+	resp, err := doCacheRequest(command, http.MethodGet, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	w := tabwriter.NewWriter(command.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tCAPACITY\tHITS\tMISSES\tEVICTIONS\tEXPIRATIONS\tHIT RATIO")
+	for _, stats := range model.CacheStatsListFromJson(resp.Body) {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%.2f%%\n", stats.Name, stats.Size, stats.Capacity, stats.Hits, stats.Misses, stats.Evictions, stats.Expirations, stats.HitRatio*100)
+	}
+
+	return w.Flush()
+}
+
+func cachePurgeCmdF(command *cobra.Command, args []string) error {
+	resp, err := doCacheRequest(command, http.MethodPost, "/"+url.PathEscape(args[0])+"/purge")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = fmt.Fprintf(command.OutOrStdout(), "Purged cache %v\n", args[0])
+	return err
+}
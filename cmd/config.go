@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/OhBonsai/go-web-boilerplate/app"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration",
+}
+
+var ConfigSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long:  "Prints a JSON Schema describing every config setting with its type and default value, for editors to validate config.json against.",
+	Args:  cobra.NoArgs,
+	RunE:  configSchemaCmdF,
+}
+
+var ConfigDefaultsCmd = &cobra.Command{
+	Use:   "defaults",
+	Short: "Print the default config file",
+	Long:  "Prints a complete config.json holding the default value of every setting. This is how config/default.json is generated.",
+	Args:  cobra.NoArgs,
+	RunE:  configDefaultsCmdF,
+}
+
+var ConfigValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate config file",
+	Long:  "If the config file is valid, this command will output a success message and have a zero exit code. If it is invalid, this command will output an error and have a non-zero exit code.",
+	Args:  cobra.NoArgs,
+	RunE:  configValidateCmdF,
+}
+
+var ConfigGetCmd = &cobra.Command{
+	Use:     "get <Section.Field>",
+	Short:   "Get config setting",
+	Long:    "Prints the effective value of a config setting by its name in dot notation.",
+	Example: "config get SqlSettings.DriverName",
+	Args:    cobra.ExactArgs(1),
+	RunE:    configGetCmdF,
+}
+
+var ConfigSetCmd = &cobra.Command{
+	Use:     "set <Section.Field> <value>...",
+	Short:   "Set config setting",
+	Long:    "Sets the value of a config setting by its name in dot notation. Accepts multiple values for array settings.",
+	Example: "config set SqlSettings.DriverName mysql",
+	Args:    cobra.MinimumNArgs(2),
+	RunE:    configSetCmdF,
+}
+
+var ConfigShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective config",
+	Long:  "Prints the config the server would run with, including environment overrides. Secrets are masked.",
+	Args:  cobra.NoArgs,
+	RunE:  configShowCmdF,
+}
+
+var ConfigDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the config with the defaults",
+	Long:  "Lists every setting whose value differs from its default. Secrets are masked.",
+	Args:  cobra.NoArgs,
+	RunE:  configDiffCmdF,
+}
+
+func init() {
+	ConfigCmd.AddCommand(
+		ConfigValidateCmd,
+		ConfigGetCmd,
+		ConfigSetCmd,
+		ConfigShowCmd,
+		ConfigDiffCmd,
+		ConfigSchemaCmd,
+		ConfigDefaultsCmd,
+	)
+	RootCmd.AddCommand(ConfigCmd)
+}
+
+// getConfigStore opens the config store named by the persistent --config flag.
+func getConfigStore(command *cobra.Command) (utils.ConfigStore, error) {
+	// Errors are more helpful translated, but the commands still work without the i18n directory.
+	if err := utils.TranslationsPerInit(); err == nil {
+		model.AppErrorInit(utils.T)
+	}
+
+	configDSN, err := command.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+
+	envPrefix, err := command.Flags().GetString("envprefix")
+	if err != nil {
+		return nil, err
+	}
+	configStore, appErr := app.NewConfigStore(configDSN, envPrefix)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return configStore, nil
+}
+
+func loadConfig(command *cobra.Command) (utils.ConfigStore, *model.Config, map[string]interface{}, error) {
+	configStore, err := getConfigStore(command)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	config, envConfig, appErr := configStore.Load()
+	if appErr != nil {
+		configStore.Close()
+		return nil, nil, nil, appErr
+	}
+
+	return configStore, config, envConfig, nil
+}
+
+func configValidateCmdF(command *cobra.Command, args []string) error {
+	configStore, _, _, err := loadConfig(command)
+	if err != nil {
+		return err
+	}
+	defer configStore.Close()
+
+	_, err = fmt.Fprintln(command.OutOrStdout(), "The document is valid")
+	return err
+}
+
+func configGetCmdF(command *cobra.Command, args []string) error {
+	configStore, config, _, err := loadConfig(command)
+	if err != nil {
+		return err
+	}
+	defer configStore.Close()
+
+	value, err := utils.GetConfigValue(config, args[0])
+	if err != nil {
+		return err
+	}
+
+	return printJson(command, value)
+}
+
+func configSetCmdF(command *cobra.Command, args []string) error {
+	configStore, config, envConfig, err := loadConfig(command)
+	if err != nil {
+		return err
+	}
+	defer configStore.Close()
+
+	if err := utils.SetConfigValue(config, args[0], args[1:]); err != nil {
+		return err
+	}
+
+	if appErr := config.IsValid(); appErr != nil {
+		return appErr
+	}
+
+	if appErr := configStore.Save(config); appErr != nil {
+		return appErr
+	}
+
+	for key := range utils.GetEnvironmentOverrides(config, envConfig) {
+		if strings.EqualFold(key, args[0]) {
+			fmt.Fprintf(command.OutOrStdout(), "%v is overridden by the environment, the saved value only applies once the override is removed\n", key)
+		}
+	}
+
+	return nil
+}
+
+func configShowCmdF(command *cobra.Command, args []string) error {
+	configStore, config, _, err := loadConfig(command)
+	if err != nil {
+		return err
+	}
+	defer configStore.Close()
+
+	config = config.Clone()
+	config.Sanitize()
+
+	return printJson(command, config)
+}
+
+func configDiffCmdF(command *cobra.Command, args []string) error {
+	configStore, config, envConfig, err := loadConfig(command)
+	if err != nil {
+		return err
+	}
+	defer configStore.Close()
+
+	config = config.Clone()
+	config.Sanitize()
+
+	defaults := utils.GenerateDefaultConfig()
+	defaults.Sanitize()
+
+	diffs, err := utils.DiffConfig(defaults, config)
+	if err != nil {
+		return err
+	}
+
+	overrides := utils.GetEnvironmentOverrides(config, envConfig)
+	for _, diff := range diffs {
+		actual, _ := json.Marshal(diff.ActualValue)
+		defaultValue, _ := json.Marshal(diff.DefaultValue)
+
+		line := fmt.Sprintf("%v: %s (default %s)", diff.Key, actual, defaultValue)
+		if _, ok := overrides[diff.Key]; ok {
+			line += " [environment]"
+		}
+		fmt.Fprintln(command.OutOrStdout(), line)
+	}
+
+	return nil
+}
+
+func configSchemaCmdF(command *cobra.Command, args []string) error {
+	return printJson(command, utils.GenerateConfigSchema())
+}
+
+func configDefaultsCmdF(command *cobra.Command, args []string) error {
+	return printJson(command, utils.GenerateDefaultConfig())
+}
+
+func printJson(command *cobra.Command, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(command.OutOrStdout(), string(b))
+	return err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/OhBonsai/go-web-boilerplate/store/sqlstore"
+)
+
+var DbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database",
+}
+
+var DbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage schema migrations",
+	Long:  "Applies and reverts the numbered schema migrations. The server applies pending migrations on start, so these are mainly needed to roll back or to migrate ahead of an upgrade.",
+}
+
+var DbMigrateUpCmd = &cobra.Command{
+	Use:     "up",
+	Short:   "Apply pending migrations",
+	Long:    "Applies pending schema migrations in version order, all of them unless --steps is given.",
+	Example: "db migrate up --steps 1",
+	Args:    cobra.NoArgs,
+	RunE:    dbMigrateUpCmdF,
+}
+
+var DbMigrateDownCmd = &cobra.Command{
+	Use:     "down",
+	Short:   "Revert applied migrations",
+	Long:    "Reverts the newest applied schema migrations, one unless --steps is given.",
+	Example: "db migrate down --steps 2",
+	Args:    cobra.NoArgs,
+	RunE:    dbMigrateDownCmdF,
+}
+
+var DbMigrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations",
+	Long:  "Lists every schema migration and when it was applied.",
+	Args:  cobra.NoArgs,
+	RunE:  dbMigrateStatusCmdF,
+}
+
+var DbRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt columns with the current key",
+	Long: `Re-encrypts the encrypted columns with SqlSettings.AtRestEncryptKey, in batches. To rotate the key, move the current key to SqlSettings.AtRestDecryptKeys, set a new AtRestEncryptKey and restart the servers, then run this command. Once it succeeds, the old key can be removed from AtRestDecryptKeys.
+
+Rows written before encryption was enabled are encrypted too.`,
+	Example: "db rotate-key --batch-size 500",
+	Args:    cobra.NoArgs,
+	RunE:    dbRotateKeyCmdF,
+}
+
+func init() {
+	DbRotateKeyCmd.Flags().Int("batch-size", sqlstore.ENCRYPTION_ROTATION_BATCH_SIZE, "Number of rows to re-encrypt in each transaction.")
+	DbMigrateUpCmd.Flags().Int("steps", 0, "Number of migrations to apply. Applies all pending migrations when 0.")
+	DbMigrateDownCmd.Flags().Int("steps", 1, "Number of migrations to revert.")
+
+	DbMigrateCmd.AddCommand(
+		DbMigrateUpCmd,
+		DbMigrateDownCmd,
+		DbMigrateStatusCmd,
+	)
+	DbCmd.AddCommand(
+		DbMigrateCmd,
+		DbRotateKeyCmd,
+	)
+	RootCmd.AddCommand(DbCmd)
+}
+
+// openSqlSupplier connects to the database of the configured SqlSettings without touching its schema.
+func openSqlSupplier(command *cobra.Command) (*sqlstore.SqlSupplier, error) {
+	configStore, config, _, err := loadConfig(command)
+	if err != nil {
+		return nil, err
+	}
+	defer configStore.Close()
+
+	return sqlstore.OpenSqlSupplier(context.Background(), config.SqlSettings, nil)
+}
+
+func dbMigrateUpCmdF(command *cobra.Command, args []string) error {
+	steps, err := command.Flags().GetInt("steps")
+	if err != nil {
+		return err
+	}
+
+	supplier, err := openSqlSupplier(command)
+	if err != nil {
+		return err
+	}
+	defer supplier.Close()
+
+	applied, appErr := sqlstore.NewMigrator(supplier).Up(steps)
+	for _, migration := range applied {
+		fmt.Fprintf(command.OutOrStdout(), "Applied %v %v\n", migration.Version, migration.Name)
+	}
+	if appErr != nil {
+		return appErr
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprintln(command.OutOrStdout(), "No pending migrations")
+	}
+	return nil
+}
+
+func dbMigrateDownCmdF(command *cobra.Command, args []string) error {
+	steps, err := command.Flags().GetInt("steps")
+	if err != nil {
+		return err
+	}
+
+	supplier, err := openSqlSupplier(command)
+	if err != nil {
+		return err
+	}
+	defer supplier.Close()
+
+	reverted, appErr := sqlstore.NewMigrator(supplier).Down(steps)
+	for _, migration := range reverted {
+		fmt.Fprintf(command.OutOrStdout(), "Reverted %v %v\n", migration.Version, migration.Name)
+	}
+	if appErr != nil {
+		return appErr
+	}
+
+	if len(reverted) == 0 {
+		fmt.Fprintln(command.OutOrStdout(), "No applied migrations")
+	}
+	return nil
+}
+
+func dbMigrateStatusCmdF(command *cobra.Command, args []string) error {
+	supplier, err := openSqlSupplier(command)
+	if err != nil {
+		return err
+	}
+	defer supplier.Close()
+
+	status, appErr := sqlstore.NewMigrator(supplier).Status()
+	if appErr != nil {
+		return appErr
+	}
+
+	w := tabwriter.NewWriter(command.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, migration := range status {
+		appliedAt := "pending"
+		if migration.AppliedAt != 0 {
+			appliedAt = time.Unix(0, migration.AppliedAt*int64(time.Millisecond)).Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", migration.Version, migration.Name, appliedAt)
+	}
+
+	return w.Flush()
+}
+
+func dbRotateKeyCmdF(command *cobra.Command, args []string) error {
+	batchSize, err := command.Flags().GetInt("batch-size")
+	if err != nil {
+		return err
+	}
+
+	supplier, err := openSqlSupplier(command)
+	if err != nil {
+		return err
+	}
+	defer supplier.Close()
+
+	rotations, appErr := supplier.RotateEncryptionKey(context.Background(), batchSize)
+	for _, rotation := range rotations {
+		fmt.Fprintf(command.OutOrStdout(), "Re-encrypted %v rows of %v.%v\n", rotation.Rows, rotation.Table, rotation.Column)
+	}
+	if appErr != nil {
+		return appErr
+	}
+	return nil
+}
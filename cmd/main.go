@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"github.com/spf13/cobra"
 	"os"
+	"github.com/OhBonsai/go-web-boilerplate/store/sqlstore"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
 )
 
 type Command = cobra.Command
@@ -21,11 +24,22 @@ func Run(args []string) error {
 func init(){
 	RootCmd.PersistentFlags().StringP("config", "c", "./config/config.json", "Configuration file to use.")
 	RootCmd.PersistentFlags().Bool("watch", true, "When set config.json will be loaded from disk when the file is changed.")
+	RootCmd.PersistentFlags().String("envprefix", utils.DEFAULT_ENV_PREFIX, "Prefix of the environment variables that override config settings. Leave empty to ignore the environment.")
 }
 
 
+// exitCode is the status the process exits with after err. Database failures keep the EXIT_* code of
+// the sqlstore error, anything else exits with 1.
+func exitCode(err error) int {
+	var sqlErr *sqlstore.SqlStoreError
+	if errors.As(err, &sqlErr) {
+		return sqlErr.ExitCode
+	}
+	return 1
+}
+
 func main(){
 	if err := Run(os.Args[1:]); err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
\ No newline at end of file
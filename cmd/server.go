@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
@@ -39,12 +41,27 @@ func serverCmdF(command *cobra.Command, args []string) error {
 		return err
 	}
 
+	watch, err := command.Flags().GetBool("watch")
+
+	if err != nil {
+		return err
+	}
+
+	envPrefix, err := command.Flags().GetString("envprefix")
+
+	if err != nil {
+		return err
+	}
+
 	interruptChan := make(chan os.Signal, 1)
-	return runServer(config, interruptChan)
+	return runServer(config, envPrefix, !watch, interruptChan)
 }
 
-func runServer(configFileLoc string, interruptChan chan os.Signal) error {
-	options := []app.Option{app.ConfigFile(configFileLoc)}
+func runServer(configFileLoc string, envPrefix string, disableConfigWatch bool, interruptChan chan os.Signal) error {
+	options := []app.Option{app.ConfigFile(configFileLoc), app.EnvPrefix(envPrefix)}
+	if disableConfigWatch {
+		options = append(options, app.DisableConfigWatch)
+	}
 
 	a, err := app.New(options...)
 	if err != nil {
@@ -59,7 +76,11 @@ func runServer(configFileLoc string, interruptChan chan os.Signal) error {
 	}
 
 	mlog.Info(fmt.Sprintf("Current working directory is %v", pwd))
-	mlog.Info(fmt.Sprintf("Loaded config file from %v", utils.FindConfigFile(configFileLocation)))
+	mlog.Info(fmt.Sprintf("Loaded config file from %v", utils.FindConfigFile(configFileLoc)))
+
+	for key := range a.EnvironmentOverrides() {
+		mlog.Info(fmt.Sprintf("Config setting %v is overridden by the environment", key))
+	}
 
 	backend, appErr := a.FileBackend()
 	if appErr == nil {
@@ -88,4 +109,15 @@ func runServer(configFileLoc string, interruptChan chan os.Signal) error {
 	web.NewWeb(a, a.Srv.Router)
 
 	a.ReloadConfig()
+
+	// wait for kill signal before attempting to gracefully shutdown
+	// the running service
+	signal.Notify(interruptChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-interruptChan:
+	case err := <-a.Srv.ServeErr():
+		return err
+	}
+
+	return nil
 }
\ No newline at end of file
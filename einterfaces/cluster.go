@@ -0,0 +1,15 @@
+package einterfaces
+
+import (
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+type ClusterMessageHandler func(msg *model.ClusterMessage)
+
+type ClusterInterface interface {
+	StartInterNodeCommunication()
+	StopInterNodeCommunication()
+	RegisterClusterMessageHandler(event string, crm ClusterMessageHandler)
+	GetClusterId() string
+	SendClusterMessage(msg *model.ClusterMessage)
+}
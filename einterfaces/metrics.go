@@ -0,0 +1,22 @@
+package einterfaces
+
+type MetricsInterface interface {
+	StartServer()
+	StopServer()
+
+	IncrementHttpRequest()
+	IncrementHttpError()
+
+	IncrementClusterRequest()
+	ObserveClusterRequestDuration(elapsed float64)
+	IncrementClusterEventType(eventType string)
+
+	IncrementMemCacheHitCounter(cacheName string)
+	IncrementMemCacheMissCounter(cacheName string)
+
+	ObserveStoreMethodDuration(method, success string, elapsed float64)
+
+	ObserveSqlQueryDuration(connection, success string, elapsed float64)
+	ObserveSqlQueryRows(connection string, rows float64)
+	IncrementSqlSlowQuery(connection, method string)
+}
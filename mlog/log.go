@@ -17,6 +17,12 @@ const (
 
 type Field = zapcore.Field
 
+// Field constructors from zap, so that callers needn't import it.
+var Int64 = zap.Int64
+var String = zap.String
+var Duration = zap.Duration
+var Err = zap.Error
+
 type LoggerConfiguration struct {
 	EnableConsole bool
 	ConsoleJson   bool
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type AnalyticsRow struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+type AnalyticsRows []*AnalyticsRow
+
+func (me AnalyticsRows) ToJson() string {
+	if b, err := json.Marshal(me); err != nil {
+		return "[]"
+	} else {
+		return string(b)
+	}
+}
+
+func AnalyticsRowsFromJson(data io.Reader) AnalyticsRows {
+	var me AnalyticsRows
+	json.NewDecoder(data).Decode(&me)
+	return me
+}
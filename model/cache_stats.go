@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// CacheStats describes the effectiveness of a single named cache.
+type CacheStats struct {
+	Name        string  `json:"name"`
+	Size        int     `json:"size"`
+	Capacity    int     `json:"capacity"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	Evictions   int64   `json:"evictions"`
+	Expirations int64   `json:"expirations"`
+	HitRatio    float64 `json:"hit_ratio"`
+}
+
+func (o *CacheStats) ToJson() string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func CacheStatsFromJson(data io.Reader) *CacheStats {
+	var o *CacheStats
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
+
+func CacheStatsListToJson(l []*CacheStats) string {
+	b, _ := json.Marshal(l)
+	return string(b)
+}
+
+func CacheStatsListFromJson(data io.Reader) []*CacheStats {
+	var o []*CacheStats
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
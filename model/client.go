@@ -3,4 +3,7 @@ package model
 const (
 	HEADER_FORWARDED          = "X-Forwarded-For"
 	HEADER_REAL_IP            = "X-Real-IP"
+	HEADER_AUTH               = "Authorization"
+	HEADER_BEARER             = "BEARER"
+	HEADER_TOKEN              = "token"
 )
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	CLUSTER_EVENT_INVALIDATE_CACHE_FOR_SESSIONS  = "inv_sessions"
+	CLUSTER_EVENT_INVALIDATE_CACHE_FOR_REACTIONS = "inv_reactions"
+	CLUSTER_EVENT_INVALIDATE_CACHE_FOR_ROLES     = "inv_roles"
+	CLUSTER_EVENT_INVALIDATE_CACHE_FOR_SCHEMES   = "inv_schemes"
+
+	// CLUSTER_PROP_PURGE_CACHE is set in the Props of an invalidation event that purges the whole cache
+	// rather than removing the key in its Data.
+	CLUSTER_PROP_PURGE_CACHE = "purge_cache"
+)
+
+type ClusterMessage struct {
+	Event string            `json:"event"`
+	Data  string            `json:"data,omitempty"`
+	Props map[string]string `json:"props,omitempty"`
+}
+
+func (o *ClusterMessage) ToJson() string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func ClusterMessageFromJson(data io.Reader) *ClusterMessage {
+	var o *ClusterMessage
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
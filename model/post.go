@@ -0,0 +1,251 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	POST_SYSTEM_MESSAGE_PREFIX = "system_"
+	POST_DEFAULT               = ""
+	POST_SYSTEM_GENERIC        = "system_generic"
+	POST_JOIN_LEAVE            = "system_join_leave"
+	POST_HEADER_CHANGE         = "system_header_change"
+	POST_EPHEMERAL             = "system_ephemeral"
+	POST_CUSTOM_TYPE_PREFIX    = "custom_"
+
+	POST_FILEIDS_MAX_RUNES    = 150
+	POST_FILENAMES_MAX_RUNES  = 4000
+	POST_HASHTAGS_MAX_RUNES   = 1000
+	POST_MESSAGE_MAX_RUNES_V1 = 4000
+	POST_MESSAGE_MAX_BYTES_V2 = 65535                         // Maximum size of a TEXT column in MySQL
+	POST_MESSAGE_MAX_RUNES_V2 = POST_MESSAGE_MAX_BYTES_V2 / 4 // Assume a worst-case representation
+	POST_PROPS_MAX_RUNES      = 8000
+	POST_PROPS_MAX_USER_RUNES = POST_PROPS_MAX_RUNES - 400 // Leave some room for system / pre-save modifications
+
+	POST_PROPS_DELETE_BY = "deleteBy"
+)
+
+type Post struct {
+	Id         string `json:"id"`
+	CreateAt   int64  `json:"create_at"`
+	UpdateAt   int64  `json:"update_at"`
+	EditAt     int64  `json:"edit_at"`
+	DeleteAt   int64  `json:"delete_at"`
+	IsPinned   bool   `json:"is_pinned"`
+	UserId     string `json:"user_id"`
+	ChannelId  string `json:"channel_id"`
+	RootId     string `json:"root_id"`
+	ParentId   string `json:"parent_id"`
+	OriginalId string `json:"original_id"`
+
+	Message string `json:"message"`
+
+	// MessageSource will contain the message as submitted by the user if Message has been modified
+	// before handing it back to the client. It is not persisted.
+	MessageSource string `json:"message_source,omitempty" db:"-"`
+
+	Type          string          `json:"type"`
+	Props         StringInterface `json:"props"`
+	Hashtags      string          `json:"hashtags"`
+	Filenames     StringArray     `json:"filenames,omitempty"` // Deprecated, do not use this field any more
+	FileIds       StringArray     `json:"file_ids,omitempty"`
+	PendingPostId string          `json:"pending_post_id" db:"-"`
+	HasReactions  bool            `json:"has_reactions,omitempty"`
+}
+
+type PostPatch struct {
+	IsPinned     *bool            `json:"is_pinned"`
+	Message      *string          `json:"message"`
+	Props        *StringInterface `json:"props"`
+	FileIds      *StringArray     `json:"file_ids"`
+	HasReactions *bool            `json:"has_reactions"`
+}
+
+type PostForIndexing struct {
+	Post
+	ParentCreateAt *int64 `json:"parent_create_at"`
+}
+
+func (o *Post) ToJson() string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func PostFromJson(data io.Reader) *Post {
+	var o *Post
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
+
+func (o *Post) Clone() *Post {
+	copy := *o
+	copy.Props = make(StringInterface, len(o.Props))
+	for key, value := range o.Props {
+		copy.Props[key] = value
+	}
+	if o.Filenames != nil {
+		copy.Filenames = append(StringArray{}, o.Filenames...)
+	}
+	if o.FileIds != nil {
+		copy.FileIds = append(StringArray{}, o.FileIds...)
+	}
+	return &copy
+}
+
+func (o *Post) IsValid(maxPostSize int) *AppError {
+	if len(o.Id) != 26 {
+		return NewAppError("Post.IsValid", "model.post.is_valid.id.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if o.CreateAt == 0 {
+		return NewAppError("Post.IsValid", "model.post.is_valid.create_at.app_error", nil, "id="+o.Id, http.StatusBadRequest)
+	}
+
+	if o.UpdateAt == 0 {
+		return NewAppError("Post.IsValid", "model.post.is_valid.update_at.app_error", nil, "id="+o.Id, http.StatusBadRequest)
+	}
+
+	if len(o.UserId) != 26 {
+		return NewAppError("Post.IsValid", "model.post.is_valid.user_id.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if len(o.ChannelId) != 26 {
+		return NewAppError("Post.IsValid", "model.post.is_valid.channel_id.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if !(len(o.RootId) == 26 || len(o.RootId) == 0) {
+		return NewAppError("Post.IsValid", "model.post.is_valid.root_id.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if !(len(o.ParentId) == 26 || len(o.ParentId) == 0) {
+		return NewAppError("Post.IsValid", "model.post.is_valid.parent_id.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if len(o.ParentId) == 26 && len(o.RootId) == 0 {
+		return NewAppError("Post.IsValid", "model.post.is_valid.root_parent.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if !(len(o.OriginalId) == 26 || len(o.OriginalId) == 0) {
+		return NewAppError("Post.IsValid", "model.post.is_valid.original_id.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if utf8.RuneCountInString(o.Message) > maxPostSize {
+		return NewAppError("Post.IsValid", "model.post.is_valid.msg.app_error", nil, "id="+o.Id, http.StatusBadRequest)
+	}
+
+	if utf8.RuneCountInString(o.Hashtags) > POST_HASHTAGS_MAX_RUNES {
+		return NewAppError("Post.IsValid", "model.post.is_valid.hashtags.app_error", nil, "id="+o.Id, http.StatusBadRequest)
+	}
+
+	switch o.Type {
+	case
+		POST_DEFAULT,
+		POST_SYSTEM_GENERIC,
+		POST_JOIN_LEAVE,
+		POST_HEADER_CHANGE,
+		POST_EPHEMERAL:
+	default:
+		if !strings.HasPrefix(o.Type, POST_CUSTOM_TYPE_PREFIX) {
+			return NewAppError("Post.IsValid", "model.post.is_valid.type.app_error", nil, "id="+o.Type, http.StatusBadRequest)
+		}
+	}
+
+	if utf8.RuneCountInString(ArrayToJson(o.Filenames)) > POST_FILENAMES_MAX_RUNES {
+		return NewAppError("Post.IsValid", "model.post.is_valid.filenames.app_error", nil, "id="+o.Id, http.StatusBadRequest)
+	}
+
+	if utf8.RuneCountInString(ArrayToJson(o.FileIds)) > POST_FILEIDS_MAX_RUNES {
+		return NewAppError("Post.IsValid", "model.post.is_valid.file_ids.app_error", nil, "id="+o.Id, http.StatusBadRequest)
+	}
+
+	if utf8.RuneCountInString(StringInterfaceToJson(o.Props)) > POST_PROPS_MAX_RUNES {
+		return NewAppError("Post.IsValid", "model.post.is_valid.props.app_error", nil, "id="+o.Id, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func (o *Post) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.OriginalId = ""
+
+	if o.CreateAt == 0 {
+		o.CreateAt = GetMillis()
+	}
+
+	o.UpdateAt = o.CreateAt
+	o.PreCommit()
+}
+
+func (o *Post) PreCommit() {
+	if o.Props == nil {
+		o.Props = make(map[string]interface{})
+	}
+
+	if o.Filenames == nil {
+		o.Filenames = []string{}
+	}
+
+	if o.FileIds == nil {
+		o.FileIds = []string{}
+	}
+
+	// There's a rare bug where the client sends up duplicate FileIds so protect against that
+	o.FileIds = RemoveDuplicateStrings(o.FileIds)
+}
+
+func (o *Post) MakeNonNil() {
+	if o.Props == nil {
+		o.Props = make(map[string]interface{})
+	}
+}
+
+func (o *Post) AddProp(key string, value interface{}) {
+	o.MakeNonNil()
+
+	o.Props[key] = value
+}
+
+func (o *Post) IsSystemMessage() bool {
+	return len(o.Type) >= len(POST_SYSTEM_MESSAGE_PREFIX) && o.Type[:len(POST_SYSTEM_MESSAGE_PREFIX)] == POST_SYSTEM_MESSAGE_PREFIX
+}
+
+func (p *Post) Patch(patch *PostPatch) {
+	if patch.IsPinned != nil {
+		p.IsPinned = *patch.IsPinned
+	}
+
+	if patch.Message != nil {
+		p.Message = *patch.Message
+	}
+
+	if patch.Props != nil {
+		p.Props = *patch.Props
+	}
+
+	if patch.FileIds != nil {
+		p.FileIds = *patch.FileIds
+	}
+
+	if patch.HasReactions != nil {
+		p.HasReactions = *patch.HasReactions
+	}
+}
+
+func (o *PostPatch) ToJson() string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func PostPatchFromJson(data io.Reader) *PostPatch {
+	var post PostPatch
+	json.NewDecoder(data).Decode(&post)
+	return &post
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+type PostList struct {
+	Order []string         `json:"order"`
+	Posts map[string]*Post `json:"posts"`
+}
+
+func NewPostList() *PostList {
+	return &PostList{
+		Order: make([]string, 0),
+		Posts: make(map[string]*Post),
+	}
+}
+
+func (o *PostList) Clone() *PostList {
+	orderCopy := make([]string, len(o.Order))
+	postsCopy := make(map[string]*Post)
+	for i, v := range o.Order {
+		orderCopy[i] = v
+	}
+	for k, v := range o.Posts {
+		postsCopy[k] = v.Clone()
+	}
+	return &PostList{
+		Order: orderCopy,
+		Posts: postsCopy,
+	}
+}
+
+func (o *PostList) ToJson() string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func (o *PostList) MakeNonNil() {
+	if o.Order == nil {
+		o.Order = make([]string, 0)
+	}
+
+	if o.Posts == nil {
+		o.Posts = make(map[string]*Post)
+	}
+
+	for _, v := range o.Posts {
+		v.MakeNonNil()
+	}
+}
+
+func (o *PostList) AddOrder(id string) {
+
+	if o.Order == nil {
+		o.Order = make([]string, 0, 128)
+	}
+
+	o.Order = append(o.Order, id)
+}
+
+func (o *PostList) AddPost(post *Post) {
+
+	if o.Posts == nil {
+		o.Posts = make(map[string]*Post)
+	}
+
+	o.Posts[post.Id] = post
+}
+
+func (o *PostList) Extend(other *PostList) {
+	for _, postId := range other.Order {
+		if _, ok := o.Posts[postId]; !ok {
+			o.AddPost(other.Posts[postId])
+			o.AddOrder(postId)
+		}
+	}
+}
+
+func (o *PostList) SortByCreateAt() {
+	sort.Slice(o.Order, func(i, j int) bool {
+		return o.Posts[o.Order[i]].CreateAt > o.Posts[o.Order[j]].CreateAt
+	})
+}
+
+func (o *PostList) Etag() string {
+
+	id := "0"
+	var t int64 = 0
+
+	for _, v := range o.Posts {
+		if v.UpdateAt > t {
+			t = v.UpdateAt
+			id = v.Id
+		} else if v.UpdateAt == t && v.Id > id {
+			t = v.UpdateAt
+			id = v.Id
+		}
+	}
+
+	return Etag(id, t)
+}
+
+func (o *PostList) IsChannelId(channelId string) bool {
+	for _, v := range o.Posts {
+		if v.ChannelId != channelId {
+			return false
+		}
+	}
+
+	return true
+}
+
+func PostListFromJson(data io.Reader) *PostList {
+	var o *PostList
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
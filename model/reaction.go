@@ -0,0 +1,69 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+const (
+	REACTION_EMOJI_NAME_MAX_LENGTH = 64
+)
+
+var validEmojiName = regexp.MustCompile(`^[a-zA-Z0-9\-\+_]+$`)
+
+type Reaction struct {
+	UserId    string `json:"user_id"`
+	PostId    string `json:"post_id"`
+	EmojiName string `json:"emoji_name"`
+	CreateAt  int64  `json:"create_at"`
+}
+
+func (o *Reaction) ToJson() string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func ReactionFromJson(data io.Reader) *Reaction {
+	var o *Reaction
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
+
+func ReactionsToJson(o []*Reaction) string {
+	b, _ := json.Marshal(o)
+	return string(b)
+}
+
+func ReactionsFromJson(data io.Reader) []*Reaction {
+	var o []*Reaction
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
+
+func (o *Reaction) IsValid() *AppError {
+	if !IsValidId(o.UserId) {
+		return NewAppError("Reaction.IsValid", "model.reaction.is_valid.user_id.app_error", nil, "user_id="+o.UserId, http.StatusBadRequest)
+	}
+
+	if !IsValidId(o.PostId) {
+		return NewAppError("Reaction.IsValid", "model.reaction.is_valid.post_id.app_error", nil, "post_id="+o.PostId, http.StatusBadRequest)
+	}
+
+	if len(o.EmojiName) == 0 || len(o.EmojiName) > REACTION_EMOJI_NAME_MAX_LENGTH || !validEmojiName.MatchString(o.EmojiName) {
+		return NewAppError("Reaction.IsValid", "model.reaction.is_valid.emoji_name.app_error", nil, "emoji_name="+o.EmojiName, http.StatusBadRequest)
+	}
+
+	if o.CreateAt == 0 {
+		return NewAppError("Reaction.IsValid", "model.reaction.is_valid.create_at.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func (o *Reaction) PreSave() {
+	if o.CreateAt == 0 {
+		o.CreateAt = GetMillis()
+	}
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	SYSTEM_USER_ROLE_ID  = "system_user"
+	SYSTEM_ADMIN_ROLE_ID = "system_admin"
+
+	ROLE_NAME_MAX_LENGTH         = 64
+	ROLE_DISPLAY_NAME_MAX_LENGTH = 128
+	ROLE_DESCRIPTION_MAX_LENGTH  = 1024
+)
+
+type Role struct {
+	Id            string   `json:"id"`
+	Name          string   `json:"name"`
+	DisplayName   string   `json:"display_name"`
+	Description   string   `json:"description"`
+	CreateAt      int64    `json:"create_at"`
+	UpdateAt      int64    `json:"update_at"`
+	DeleteAt      int64    `json:"delete_at"`
+	Permissions   []string `json:"permissions"`
+	SchemeManaged bool     `json:"scheme_managed"`
+	BuiltIn       bool     `json:"built_in"`
+}
+
+type RolePatch struct {
+	Permissions *[]string `json:"permissions"`
+}
+
+func (r *Role) ToJson() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func RoleFromJson(data io.Reader) *Role {
+	var r *Role
+	json.NewDecoder(data).Decode(&r)
+	return r
+}
+
+func RoleListToJson(r []*Role) string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func RoleListFromJson(data io.Reader) []*Role {
+	var roles []*Role
+	json.NewDecoder(data).Decode(&roles)
+	return roles
+}
+
+func (r *RolePatch) ToJson() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func RolePatchFromJson(data io.Reader) *RolePatch {
+	var rolePatch *RolePatch
+	json.NewDecoder(data).Decode(&rolePatch)
+	return rolePatch
+}
+
+func (r *Role) Patch(patch *RolePatch) {
+	if patch.Permissions != nil {
+		r.Permissions = *patch.Permissions
+	}
+}
+
+func (r *Role) IsValid() *AppError {
+	if !IsValidId(r.Id) {
+		return NewAppError("Role.IsValid", "model.role.is_valid.id.app_error", nil, "id="+r.Id, http.StatusBadRequest)
+	}
+
+	return r.IsValidWithoutId()
+}
+
+func (r *Role) IsValidWithoutId() *AppError {
+	if !IsValidRoleName(r.Name) {
+		return NewAppError("Role.IsValid", "model.role.is_valid.name.app_error", nil, "name="+r.Name, http.StatusBadRequest)
+	}
+
+	if len(r.DisplayName) == 0 || len(r.DisplayName) > ROLE_DISPLAY_NAME_MAX_LENGTH {
+		return NewAppError("Role.IsValid", "model.role.is_valid.display_name.app_error", nil, "name="+r.Name, http.StatusBadRequest)
+	}
+
+	if len(r.Description) > ROLE_DESCRIPTION_MAX_LENGTH {
+		return NewAppError("Role.IsValid", "model.role.is_valid.description.app_error", nil, "name="+r.Name, http.StatusBadRequest)
+	}
+
+	for _, permission := range r.Permissions {
+		if len(permission) == 0 || strings.ContainsAny(permission, " \t\n") {
+			return NewAppError("Role.IsValid", "model.role.is_valid.permission.app_error", nil, "name="+r.Name+" permission="+permission, http.StatusBadRequest)
+		}
+	}
+
+	return nil
+}
+
+func IsValidRoleName(roleName string) bool {
+	if len(roleName) <= 0 || len(roleName) > ROLE_NAME_MAX_LENGTH {
+		return false
+	}
+
+	if strings.TrimLeft(roleName, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+		return false
+	}
+
+	return true
+}
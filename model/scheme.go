@@ -0,0 +1,109 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+const (
+	SCHEME_DISPLAY_NAME_MAX_LENGTH = 128
+	SCHEME_NAME_MAX_LENGTH         = 64
+	SCHEME_DESCRIPTION_MAX_LENGTH  = 1024
+	SCHEME_SCOPE_TEAM              = "team"
+	SCHEME_SCOPE_CHANNEL           = "channel"
+)
+
+type Scheme struct {
+	Id                      string `json:"id"`
+	Name                    string `json:"name"`
+	DisplayName             string `json:"display_name"`
+	Description             string `json:"description"`
+	CreateAt                int64  `json:"create_at"`
+	UpdateAt                int64  `json:"update_at"`
+	DeleteAt                int64  `json:"delete_at"`
+	Scope                   string `json:"scope"`
+	DefaultTeamAdminRole    string `json:"default_team_admin_role"`
+	DefaultTeamUserRole     string `json:"default_team_user_role"`
+	DefaultChannelAdminRole string `json:"default_channel_admin_role"`
+	DefaultChannelUserRole  string `json:"default_channel_user_role"`
+}
+
+func (scheme *Scheme) ToJson() string {
+	b, _ := json.Marshal(scheme)
+	return string(b)
+}
+
+func SchemeFromJson(data io.Reader) *Scheme {
+	var scheme *Scheme
+	json.NewDecoder(data).Decode(&scheme)
+	return scheme
+}
+
+func SchemesToJson(schemes []*Scheme) string {
+	b, _ := json.Marshal(schemes)
+	return string(b)
+}
+
+func SchemesFromJson(data io.Reader) []*Scheme {
+	var schemes []*Scheme
+	json.NewDecoder(data).Decode(&schemes)
+	return schemes
+}
+
+func (scheme *Scheme) IsValid() *AppError {
+	if !IsValidId(scheme.Id) {
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.id.app_error", nil, "id="+scheme.Id, http.StatusBadRequest)
+	}
+
+	return scheme.IsValidForCreate()
+}
+
+func (scheme *Scheme) IsValidForCreate() *AppError {
+	if len(scheme.DisplayName) == 0 || len(scheme.DisplayName) > SCHEME_DISPLAY_NAME_MAX_LENGTH {
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.display_name.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if !IsValidSchemeName(scheme.Name) {
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.name.app_error", nil, "name="+scheme.Name, http.StatusBadRequest)
+	}
+
+	if len(scheme.Description) > SCHEME_DESCRIPTION_MAX_LENGTH {
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.description.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	switch scheme.Scope {
+	case SCHEME_SCOPE_TEAM, SCHEME_SCOPE_CHANNEL:
+	default:
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.scope.app_error", nil, "scope="+scheme.Scope, http.StatusBadRequest)
+	}
+
+	if !IsValidRoleName(scheme.DefaultChannelAdminRole) || !IsValidRoleName(scheme.DefaultChannelUserRole) {
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.default_roles.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if scheme.Scope == SCHEME_SCOPE_TEAM && (!IsValidRoleName(scheme.DefaultTeamAdminRole) || !IsValidRoleName(scheme.DefaultTeamUserRole)) {
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.default_roles.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if scheme.Scope == SCHEME_SCOPE_CHANNEL && (len(scheme.DefaultTeamAdminRole) != 0 || len(scheme.DefaultTeamUserRole) != 0) {
+		return NewAppError("Scheme.IsValid", "model.scheme.is_valid.default_roles.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// RoleNames lists the default roles of the scheme that are set.
+func (scheme *Scheme) RoleNames() []string {
+	var names []string
+	for _, name := range []string{scheme.DefaultTeamAdminRole, scheme.DefaultTeamUserRole, scheme.DefaultChannelAdminRole, scheme.DefaultChannelUserRole} {
+		if len(name) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func IsValidSchemeName(name string) bool {
+	return len(name) > 0 && len(name) <= SCHEME_NAME_MAX_LENGTH && IsValidRoleName(name)
+}
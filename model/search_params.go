@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+)
+
+type SearchParams struct {
+	Terms                  string
+	IsHashtag              bool
+	InChannels             []string
+	ExcludedChannels       []string
+	FromUsers              []string
+	ExcludedUsers          []string
+	AfterDate              string
+	ExcludedAfterDate      string
+	BeforeDate             string
+	ExcludedBeforeDate     string
+	OnDate                 string
+	ExcludedDate           string
+	OrTerms                bool
+	IncludeDeletedChannels bool
+	TimeZoneOffset         int
+}
+
+// Returns the epoch timestamp of the start of the day specified by SearchParams.AfterDate
+func (p *SearchParams) GetAfterDateMillis() int64 {
+	date, err := time.Parse("2006-01-02", PadDateStringZeros(p.AfterDate))
+	if err != nil {
+		date = time.Now()
+	}
+
+	// travel forward 1 day
+	oneDay := time.Hour * 24
+	afterDate := date.Add(oneDay)
+	return GetStartOfDayMillis(afterDate, p.TimeZoneOffset)
+}
+
+// Returns the epoch timestamp of the end of the day specified by SearchParams.BeforeDate
+func (p *SearchParams) GetBeforeDateMillis() int64 {
+	date, err := time.Parse("2006-01-02", PadDateStringZeros(p.BeforeDate))
+	if err != nil {
+		return 0
+	}
+
+	// travel back 1 day
+	oneDay := time.Duration(-24) * time.Hour
+	beforeDate := date.Add(oneDay)
+	return GetEndOfDayMillis(beforeDate, p.TimeZoneOffset)
+}
+
+// Returns the epoch timestamps of the start and end of the day specified by SearchParams.OnDate
+func (p *SearchParams) GetOnDateMillis() (int64, int64) {
+	date, err := time.Parse("2006-01-02", PadDateStringZeros(p.OnDate))
+	if err != nil {
+		return 0, 0
+	}
+
+	return GetStartOfDayMillis(date, p.TimeZoneOffset), GetEndOfDayMillis(date, p.TimeZoneOffset)
+}
@@ -1,5 +1,120 @@
 package model
 
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
 const (
-	SESSION_CACHE_SIZE                = 35000
+	SESSION_COOKIE_TOKEN             = "BONSAIAUTHTOKEN"
+	SESSION_CACHE_SIZE               = 35000
+	SESSION_PROP_PLATFORM            = "platform"
+	SESSION_PROP_OS                  = "os"
+	SESSION_PROP_BROWSER             = "browser"
+	SESSION_ACTIVITY_TIMEOUT         = 1000 * 60 * 5 // 5 minutes
+	SESSION_USER_ACCESS_TOKEN_EXPIRY = 100 * 365     // 100 years
 )
+
+type Session struct {
+	Id             string          `json:"id"`
+	Token          EncryptedString `json:"token"`
+	CreateAt       int64           `json:"create_at"`
+	ExpiresAt      int64           `json:"expires_at"`
+	LastActivityAt int64           `json:"last_activity_at"`
+	UserId         string          `json:"user_id"`
+	DeviceId       string          `json:"device_id"`
+	Roles          string          `json:"roles"`
+	IsOAuth        bool            `json:"is_oauth"`
+	Props          StringMap       `json:"props"`
+}
+
+func (me *Session) DeepCopy() *Session {
+	copySession := *me
+
+	if me.Props != nil {
+		copySession.Props = CopyStringMap(me.Props)
+	}
+
+	return &copySession
+}
+
+func (me *Session) ToJson() string {
+	b, _ := json.Marshal(me)
+	return string(b)
+}
+
+func SessionFromJson(data io.Reader) *Session {
+	var me *Session
+	json.NewDecoder(data).Decode(&me)
+	return me
+}
+
+func (me *Session) PreSave() {
+	if me.Id == "" {
+		me.Id = NewId()
+	}
+
+	if me.Token == "" {
+		me.Token = EncryptedString(NewId())
+	}
+
+	me.CreateAt = GetMillis()
+	me.LastActivityAt = me.CreateAt
+
+	if me.Props == nil {
+		me.Props = make(map[string]string)
+	}
+}
+
+func (me *Session) Sanitize() {
+	me.Token = ""
+}
+
+func (me *Session) IsExpired() bool {
+
+	if me.ExpiresAt <= 0 {
+		return false
+	}
+
+	if GetMillis() > me.ExpiresAt {
+		return true
+	}
+
+	return false
+}
+
+func (me *Session) SetExpireInDays(days int) {
+	if me.CreateAt == 0 {
+		me.ExpiresAt = GetMillis() + (1000 * 60 * 60 * 24 * int64(days))
+	} else {
+		me.ExpiresAt = me.CreateAt + (1000 * 60 * 60 * 24 * int64(days))
+	}
+}
+
+func (me *Session) AddProp(key string, value string) {
+
+	if me.Props == nil {
+		me.Props = make(map[string]string)
+	}
+
+	me.Props[key] = value
+}
+
+func (me *Session) GetUserRoles() []string {
+	return strings.Fields(me.Roles)
+}
+
+func SessionsToJson(o []*Session) string {
+	if b, err := json.Marshal(o); err != nil {
+		return "[]"
+	} else {
+		return string(b)
+	}
+}
+
+func SessionsFromJson(data io.Reader) []*Session {
+	var o []*Session
+	json.NewDecoder(data).Decode(&o)
+	return o
+}
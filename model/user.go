@@ -1,5 +1,373 @@
 package model
 
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
 const (
 	DEFAULT_LOCALE = "zh-CN"
-)
\ No newline at end of file
+
+	USER_AUTH_SERVICE_EMAIL = "email"
+
+	USER_EMAIL_MAX_LENGTH     = 128
+	USER_NICKNAME_MAX_RUNES   = 64
+	USER_POSITION_MAX_RUNES   = 128
+	USER_FIRST_NAME_MAX_RUNES = 64
+	USER_LAST_NAME_MAX_RUNES  = 64
+	USER_AUTH_DATA_MAX_LENGTH = 128
+	USER_NAME_MAX_LENGTH      = 64
+	USER_NAME_MIN_LENGTH      = 1
+	USER_PASSWORD_MAX_LENGTH  = 72
+	USER_LOCALE_MAX_LENGTH    = 5
+)
+
+type User struct {
+	Id                 string    `json:"id"`
+	CreateAt           int64     `json:"create_at,omitempty"`
+	UpdateAt           int64     `json:"update_at,omitempty"`
+	DeleteAt           int64     `json:"delete_at"`
+	Username           string    `json:"username"`
+	Password           string    `json:"password,omitempty"`
+	AuthData           *string   `json:"auth_data,omitempty"`
+	AuthService        string    `json:"auth_service"`
+	Email              string    `json:"email"`
+	EmailVerified      bool      `json:"email_verified,omitempty"`
+	Nickname           string    `json:"nickname"`
+	FirstName          string    `json:"first_name"`
+	LastName           string    `json:"last_name"`
+	Position           string    `json:"position"`
+	Roles              string    `json:"roles"`
+	Props              StringMap `json:"props,omitempty"`
+	LastPasswordUpdate int64     `json:"last_password_update,omitempty"`
+	LastPictureUpdate  int64     `json:"last_picture_update,omitempty"`
+	FailedAttempts     int       `json:"failed_attempts,omitempty"`
+	Locale             string    `json:"locale"`
+	Timezone           StringMap `json:"timezone"`
+}
+
+type UserPatch struct {
+	Username  *string   `json:"username"`
+	Nickname  *string   `json:"nickname"`
+	FirstName *string   `json:"first_name"`
+	LastName  *string   `json:"last_name"`
+	Position  *string   `json:"position"`
+	Email     *string   `json:"email"`
+	Props     StringMap `json:"props,omitempty"`
+	Locale    *string   `json:"locale"`
+	Timezone  StringMap `json:"timezone"`
+}
+
+// IsValid validates the user and returns an error if it isn't configured
+// correctly.
+func (u *User) IsValid() *AppError {
+
+	if len(u.Id) != 26 {
+		return InvalidUserError("id", "")
+	}
+
+	if u.CreateAt == 0 {
+		return InvalidUserError("create_at", u.Id)
+	}
+
+	if u.UpdateAt == 0 {
+		return InvalidUserError("update_at", u.Id)
+	}
+
+	if !IsValidUsername(u.Username) {
+		return InvalidUserError("username", u.Id)
+	}
+
+	if len(u.Email) > USER_EMAIL_MAX_LENGTH || len(u.Email) == 0 {
+		return InvalidUserError("email", u.Id)
+	}
+
+	if utf8.RuneCountInString(u.Nickname) > USER_NICKNAME_MAX_RUNES {
+		return InvalidUserError("nickname", u.Id)
+	}
+
+	if utf8.RuneCountInString(u.Position) > USER_POSITION_MAX_RUNES {
+		return InvalidUserError("position", u.Id)
+	}
+
+	if utf8.RuneCountInString(u.FirstName) > USER_FIRST_NAME_MAX_RUNES {
+		return InvalidUserError("first_name", u.Id)
+	}
+
+	if utf8.RuneCountInString(u.LastName) > USER_LAST_NAME_MAX_RUNES {
+		return InvalidUserError("last_name", u.Id)
+	}
+
+	if u.AuthData != nil && len(*u.AuthData) > USER_AUTH_DATA_MAX_LENGTH {
+		return InvalidUserError("auth_data", u.Id)
+	}
+
+	if u.AuthData != nil && len(*u.AuthData) > 0 && len(u.AuthService) == 0 {
+		return InvalidUserError("auth_data_type", u.Id)
+	}
+
+	if len(u.Password) > 0 && u.AuthData != nil && len(*u.AuthData) > 0 {
+		return InvalidUserError("auth_data_pwd", u.Id)
+	}
+
+	if len(u.Password) > USER_PASSWORD_MAX_LENGTH {
+		return InvalidUserError("password_limit", u.Id)
+	}
+
+	if len(u.Locale) > USER_LOCALE_MAX_LENGTH {
+		return InvalidUserError("locale", u.Id)
+	}
+
+	return nil
+}
+
+func InvalidUserError(fieldName string, userId string) *AppError {
+	id := "model.user.is_valid." + fieldName + ".app_error"
+	details := ""
+	if userId != "" {
+		details = "user_id=" + userId
+	}
+	return NewAppError("User.IsValid", id, nil, details, http.StatusBadRequest)
+}
+
+func NormalizeUsername(username string) string {
+	return strings.ToLower(username)
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+// PreSave will set the Id and Username if missing.  It will also fill
+// in the CreateAt, UpdateAt times.  It will also hash the password.  It should
+// be run before saving the user to the db.
+func (u *User) PreSave() {
+	if u.Id == "" {
+		u.Id = NewId()
+	}
+
+	if u.Username == "" {
+		u.Username = NewId()
+	}
+
+	if u.AuthData != nil && *u.AuthData == "" {
+		u.AuthData = nil
+	}
+
+	u.Username = NormalizeUsername(u.Username)
+	u.Email = NormalizeEmail(u.Email)
+
+	u.CreateAt = GetMillis()
+	u.UpdateAt = u.CreateAt
+
+	u.LastPasswordUpdate = u.CreateAt
+
+	if u.Locale == "" {
+		u.Locale = DEFAULT_LOCALE
+	}
+
+	if u.Props == nil {
+		u.Props = make(map[string]string)
+	}
+
+	if u.Timezone == nil {
+		u.Timezone = DefaultUserTimezone()
+	}
+
+	if len(u.Password) > 0 {
+		u.Password = HashPassword(u.Password)
+	}
+}
+
+// PreUpdate should be run before updating the user in the db.
+func (u *User) PreUpdate() {
+	u.Username = NormalizeUsername(u.Username)
+	u.Email = NormalizeEmail(u.Email)
+	u.UpdateAt = GetMillis()
+
+	if u.AuthData != nil && *u.AuthData == "" {
+		u.AuthData = nil
+	}
+
+	if u.Props == nil {
+		u.Props = make(map[string]string)
+	}
+}
+
+func (u *User) Patch(patch *UserPatch) {
+	if patch.Username != nil {
+		u.Username = *patch.Username
+	}
+
+	if patch.Nickname != nil {
+		u.Nickname = *patch.Nickname
+	}
+
+	if patch.FirstName != nil {
+		u.FirstName = *patch.FirstName
+	}
+
+	if patch.LastName != nil {
+		u.LastName = *patch.LastName
+	}
+
+	if patch.Position != nil {
+		u.Position = *patch.Position
+	}
+
+	if patch.Email != nil {
+		u.Email = *patch.Email
+	}
+
+	if patch.Props != nil {
+		u.Props = patch.Props
+	}
+
+	if patch.Locale != nil {
+		u.Locale = *patch.Locale
+	}
+
+	if patch.Timezone != nil {
+		u.Timezone = patch.Timezone
+	}
+}
+
+// ToJson convert a User to a json string
+func (u *User) ToJson() string {
+	b, _ := json.Marshal(u)
+	return string(b)
+}
+
+func (u *UserPatch) ToJson() string {
+	b, _ := json.Marshal(u)
+	return string(b)
+}
+
+// Remove any private data from the user object
+func (u *User) Sanitize() {
+	u.Password = ""
+	u.AuthData = NewString("")
+	u.FailedAttempts = 0
+}
+
+func (u *User) ClearNonProfileFields() {
+	u.Password = ""
+	u.AuthData = NewString("")
+	u.EmailVerified = false
+	u.LastPasswordUpdate = 0
+	u.FailedAttempts = 0
+}
+
+func (u *User) GetFullName() string {
+	if len(u.FirstName) > 0 && len(u.LastName) > 0 {
+		return u.FirstName + " " + u.LastName
+	} else if len(u.FirstName) > 0 {
+		return u.FirstName
+	} else if len(u.LastName) > 0 {
+		return u.LastName
+	} else {
+		return ""
+	}
+}
+
+func (u *User) GetRoles() []string {
+	return strings.Fields(u.Roles)
+}
+
+func (u *User) IsSystemAdmin() bool {
+	for _, role := range u.GetRoles() {
+		if role == SYSTEM_ADMIN_ROLE_ID {
+			return true
+		}
+	}
+	return false
+}
+
+// UserFromJson will decode the input and return a User
+func UserFromJson(data io.Reader) *User {
+	var user *User
+	json.NewDecoder(data).Decode(&user)
+	return user
+}
+
+func UserPatchFromJson(data io.Reader) *UserPatch {
+	var user *UserPatch
+	json.NewDecoder(data).Decode(&user)
+	return user
+}
+
+func UserMapToJson(u map[string]*User) string {
+	b, _ := json.Marshal(u)
+	return string(b)
+}
+
+func UserMapFromJson(data io.Reader) map[string]*User {
+	var users map[string]*User
+	json.NewDecoder(data).Decode(&users)
+	return users
+}
+
+func UserListToJson(u []*User) string {
+	b, _ := json.Marshal(u)
+	return string(b)
+}
+
+func UserListFromJson(data io.Reader) []*User {
+	var users []*User
+	json.NewDecoder(data).Decode(&users)
+	return users
+}
+
+// HashPassword generates a hash using the bcrypt.GenerateFromPassword
+func HashPassword(password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(hash)
+}
+
+// ComparePassword compares the hash
+func ComparePassword(hash string, password string) bool {
+
+	if len(password) == 0 || len(hash) == 0 {
+		return false
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil
+}
+
+var validUsernameChars = regexp.MustCompile(`^[a-z0-9\.\-_]+$`)
+
+var restrictedUsernames = []string{
+	"all",
+	"channel",
+	"here",
+	"system",
+}
+
+func IsValidUsername(s string) bool {
+	if len(s) < USER_NAME_MIN_LENGTH || len(s) > USER_NAME_MAX_LENGTH {
+		return false
+	}
+
+	if !validUsernameChars.MatchString(s) {
+		return false
+	}
+
+	for _, restrictedUsername := range restrictedUsernames {
+		if s == restrictedUsername {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,9 +1,42 @@
 package model
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
 	goi18n "github.com/nicksnyder/go-i18n/i18n"
 )
 
+type StringInterface map[string]interface{}
+type StringMap map[string]string
+type StringArray []string
+
+// EncryptedString is a string that the SQL store keeps encrypted with SqlSettings.AtRestEncryptKey.
+type EncryptedString string
+
+func (sa StringArray) Equals(input StringArray) bool {
+	if len(sa) != len(input) {
+		return false
+	}
+
+	for index := range sa {
+		if sa[index] != input[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
 type AppError struct {
 	Id            string `json:"id"`
 	Message       string `json:"message"`               // Message to be display to the end user without debugging information
@@ -17,6 +50,8 @@ type AppError struct {
 
 var translateFunc goi18n.TranslateFunc = nil
 
+var encoding = base32.NewEncoding("ybndrfg8ejkmcpqxot1uwisza345h769")
+
 func AppErrorInit(t goi18n.TranslateFunc) {
 	translateFunc = t
 }
@@ -30,10 +65,212 @@ func NewAppError(where string, id string, params map[string]interface{}, details
 	ap.DetailedError = details
 	ap.StatusCode = status
 	ap.IsOAuth = false
-	//ap.Translate(translateFunc)
+	ap.Translate(translateFunc)
 	return ap
 }
 
+func (er *AppError) Translate(T goi18n.TranslateFunc) {
+	if T == nil {
+		er.Message = er.Id
+		return
+	}
+
+	if er.params == nil {
+		er.Message = T(er.Id)
+	} else {
+		er.Message = T(er.Id, er.params)
+	}
+}
+
 func (er *AppError) Error() string {
 	return er.Where + ": " + er.Message + ", " + er.DetailedError
 }
+
+func (er *AppError) ToJson() string {
+	b, _ := json.Marshal(er)
+	return string(b)
+}
+
+// AppErrorFromJson will decode the input and return an AppError
+func AppErrorFromJson(data io.Reader) *AppError {
+	str := ""
+	bytes, rerr := ioutil.ReadAll(data)
+	if rerr != nil {
+		str = rerr.Error()
+	} else {
+		str = string(bytes)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(str))
+	var er AppError
+	err := decoder.Decode(&er)
+	if err == nil {
+		return &er
+	} else {
+		return NewAppError("AppErrorFromJson", "model.utils.decode_json.app_error", nil, "body: "+str, http.StatusInternalServerError)
+	}
+}
+
+// NewId is a globally unique identifier.  It is a [A-Z0-9] string 26
+// characters long.  It is a UUID version 4 Guid that is zbased32 encoded
+// with the padding stripped off.
+func NewId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	var b bytes.Buffer
+	encoder := base32.NewEncoder(encoding, &b)
+	encoder.Write(id)
+	encoder.Close()
+	b.Truncate(26) // removes the '==' padding
+	return b.String()
+}
+
+// NewRandomString returns a random string of the given length.
+// The resulting entropy will be (5 * length) bits.
+func NewRandomString(length int) string {
+	var b bytes.Buffer
+	str := make([]byte, length+8)
+	rand.Read(str)
+	encoder := base32.NewEncoder(encoding, &b)
+	encoder.Write(str)
+	encoder.Close()
+	b.Truncate(length) // removes the '==' padding
+	return b.String()
+}
+
+// GetMillis is a convenience method to get milliseconds since epoch.
+func GetMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// Etag joins the given parts into a strong etag clients can use to cache a response.
+func Etag(parts ...interface{}) string {
+	etag := make([]string, len(parts))
+	for i, part := range parts {
+		etag[i] = fmt.Sprintf("%v", part)
+	}
+
+	return strings.Join(etag, ".")
+}
+
+// GetMillisForTime is a convenience method to get milliseconds since epoch for provided Time.
+func GetMillisForTime(thisTime time.Time) int64 {
+	return thisTime.UnixNano() / int64(time.Millisecond)
+}
+
+// GetStartOfDayMillis is a convenience method to get milliseconds since epoch for provided date's start of day
+func GetStartOfDayMillis(thisTime time.Time, timeZoneOffset int) int64 {
+	localSearchTimeZone := time.FixedZone("Local Search Time Zone", timeZoneOffset)
+	resultTime := time.Date(thisTime.Year(), thisTime.Month(), thisTime.Day(), 0, 0, 0, 0, localSearchTimeZone)
+	return GetMillisForTime(resultTime)
+}
+
+// GetEndOfDayMillis is a convenience method to get milliseconds since epoch for provided date's end of day
+func GetEndOfDayMillis(thisTime time.Time, timeZoneOffset int) int64 {
+	localSearchTimeZone := time.FixedZone("Local Search Time Zone", timeZoneOffset)
+	resultTime := time.Date(thisTime.Year(), thisTime.Month(), thisTime.Day(), 23, 59, 59, 999999999, localSearchTimeZone)
+	return GetMillisForTime(resultTime)
+}
+
+// PadDateStringZeros is a convenience method to pad 2 digit date parts with zeros to meet ISO 8601 format
+func PadDateStringZeros(dateString string) string {
+	parts := strings.Split(dateString, "-")
+	for index, part := range parts {
+		if len(part) == 1 {
+			parts[index] = "0" + part
+		}
+	}
+	dateString = strings.Join(parts[:], "-")
+	return dateString
+}
+
+// IsValidId checks that value is an id as generated by NewId.
+func IsValidId(value string) bool {
+	if len(value) != 26 {
+		return false
+	}
+
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func CopyStringMap(originalMap map[string]string) map[string]string {
+	copyMap := make(map[string]string)
+	for k, v := range originalMap {
+		copyMap[k] = v
+	}
+	return copyMap
+}
+
+// MapToJson converts a map to a json string
+func MapToJson(objmap map[string]string) string {
+	b, _ := json.Marshal(objmap)
+	return string(b)
+}
+
+// MapFromJson will decode the key/value pair map
+func MapFromJson(data io.Reader) map[string]string {
+	decoder := json.NewDecoder(data)
+
+	var objmap map[string]string
+	if err := decoder.Decode(&objmap); err != nil {
+		return make(map[string]string)
+	} else {
+		return objmap
+	}
+}
+
+func ArrayToJson(objmap []string) string {
+	b, _ := json.Marshal(objmap)
+	return string(b)
+}
+
+func ArrayFromJson(data io.Reader) []string {
+	decoder := json.NewDecoder(data)
+
+	var objmap []string
+	if err := decoder.Decode(&objmap); err != nil {
+		return make([]string, 0)
+	} else {
+		return objmap
+	}
+}
+
+func StringInterfaceToJson(objmap map[string]interface{}) string {
+	b, _ := json.Marshal(objmap)
+	return string(b)
+}
+
+func StringInterfaceFromJson(data io.Reader) map[string]interface{} {
+	decoder := json.NewDecoder(data)
+
+	var objmap map[string]interface{}
+	if err := decoder.Decode(&objmap); err != nil {
+		return make(map[string]interface{})
+	} else {
+		return objmap
+	}
+}
+
+// RemoveDuplicateStrings returns arr without repeated values, keeping the first occurrence of each.
+func RemoveDuplicateStrings(arr []string) []string {
+	seen := make(map[string]bool, len(arr))
+	result := make([]string, 0, len(arr))
+
+	for _, item := range arr {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
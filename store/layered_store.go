@@ -2,19 +2,231 @@ package store
 
 import (
 	"context"
-	"github.com/mattermost/mattermost-server/einterfaces"
+
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/model"
 )
 
+type LayeredStoreDatabaseLayer interface {
+	LayeredStoreSupplier
+	Store
+}
 
+// LayeredStore runs queries through a chain of suppliers, the local cache first and the database last.
 type LayeredStore struct {
 	TmpContext      context.Context
+	ReactionStore   ReactionStore
+	RoleStore       RoleStore
+	SchemeStore     SchemeStore
+	DatabaseLayer   LayeredStoreDatabaseLayer
+	LocalCacheLayer *LocalCacheSupplier
+	LayerChainHead  LayeredStoreSupplier
 }
 
-
 func NewLayeredStore(db LayeredStoreDatabaseLayer, metrics einterfaces.MetricsInterface, cluster einterfaces.ClusterInterface) Store {
 	store := &LayeredStore{
 		TmpContext:      context.TODO(),
+		DatabaseLayer:   db,
+		LocalCacheLayer: NewLocalCacheSupplier(metrics, cluster),
 	}
 
+	store.ReactionStore = &LayeredReactionStore{store}
+	store.RoleStore = &LayeredRoleStore{store}
+	store.SchemeStore = &LayeredSchemeStore{store}
+
+	// Setup the chain
+	store.LocalCacheLayer.SetChainNext(store.DatabaseLayer)
+	store.LayerChainHead = store.LocalCacheLayer
+
 	return store
-}
\ No newline at end of file
+}
+
+type QueryFunction func(LayeredStoreSupplier) *LayeredStoreSupplierResult
+
+func (s *LayeredStore) RunQuery(queryFunction QueryFunction) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := queryFunction(s.LayerChainHead)
+		storeChannel <- result.StoreResult
+	}()
+
+	return storeChannel
+}
+
+func (s *LayeredStore) Post() PostStore {
+	return s.DatabaseLayer.Post()
+}
+
+func (s *LayeredStore) User() UserStore {
+	return s.DatabaseLayer.User()
+}
+
+func (s *LayeredStore) Session() SessionStore {
+	return s.DatabaseLayer.Session()
+}
+
+func (s *LayeredStore) Reaction() ReactionStore {
+	return s.ReactionStore
+}
+
+func (s *LayeredStore) Role() RoleStore {
+	return s.RoleStore
+}
+
+func (s *LayeredStore) Scheme() SchemeStore {
+	return s.SchemeStore
+}
+
+func (s *LayeredStore) Close() {
+	s.LocalCacheLayer.Close()
+	s.DatabaseLayer.Close()
+}
+
+// WithTransaction runs f with a layered view of the transaction of the database layer. The view reads past the
+// local cache, and the keys its writes invalidate are only removed once the outermost transaction commits.
+func (s *LayeredStore) WithTransaction(ctx context.Context, f func(tx Store) error) error {
+	var invalidations *cacheInvalidations
+	err := s.DatabaseLayer.WithTransaction(ctx, func(tx Store) error {
+		db := tx.(LayeredStoreDatabaseLayer)
+
+		// A transaction that runs again starts over with what it invalidates.
+		cache := s.LocalCacheLayer.forTransaction(db)
+		invalidations = cache.invalidations
+
+		view := &LayeredStore{
+			TmpContext:      ctx,
+			DatabaseLayer:   db,
+			LocalCacheLayer: cache,
+			LayerChainHead:  cache,
+		}
+		view.ReactionStore = &LayeredReactionStore{view}
+		view.RoleStore = &LayeredRoleStore{view}
+		view.SchemeStore = &LayeredSchemeStore{view}
+
+		return f(view)
+	})
+
+	if err != nil || invalidations == nil {
+		return err
+	}
+
+	// A nested transaction can still be rolled back with the one around it.
+	if s.LocalCacheLayer.invalidations != nil {
+		s.LocalCacheLayer.invalidations.merge(invalidations)
+	} else {
+		invalidations.apply()
+	}
+	return nil
+}
+
+type LayeredReactionStore struct {
+	*LayeredStore
+}
+
+func (s *LayeredReactionStore) Save(reaction *model.Reaction) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.ReactionSave(s.TmpContext, reaction)
+	})
+}
+
+func (s *LayeredReactionStore) Delete(reaction *model.Reaction) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.ReactionDelete(s.TmpContext, reaction)
+	})
+}
+
+func (s *LayeredReactionStore) GetForPost(postId string, allowFromCache bool) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		if allowFromCache {
+			return supplier.ReactionGetForPost(s.TmpContext, postId)
+		}
+		return supplier.ReactionGetForPost(s.TmpContext, postId, LSH_NO_CACHE)
+	})
+}
+
+func (s *LayeredReactionStore) DeleteAllWithEmojiName(emojiName string) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.ReactionDeleteAllWithEmojiName(s.TmpContext, emojiName)
+	})
+}
+
+func (s *LayeredReactionStore) PermanentDeleteBatch(endTime int64, limit int64) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.ReactionPermanentDeleteBatch(s.TmpContext, endTime, limit)
+	})
+}
+
+type LayeredRoleStore struct {
+	*LayeredStore
+}
+
+func (s *LayeredRoleStore) Save(role *model.Role) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.RoleSave(s.TmpContext, role)
+	})
+}
+
+func (s *LayeredRoleStore) Get(roleId string) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.RoleGet(s.TmpContext, roleId)
+	})
+}
+
+func (s *LayeredRoleStore) GetByName(name string) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.RoleGetByName(s.TmpContext, name)
+	})
+}
+
+func (s *LayeredRoleStore) GetByNames(names []string) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.RoleGetByNames(s.TmpContext, names)
+	})
+}
+
+func (s *LayeredRoleStore) Delete(roleId string) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.RoleDelete(s.TmpContext, roleId)
+	})
+}
+
+func (s *LayeredRoleStore) PermanentDeleteAll() StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.RolePermanentDeleteAll(s.TmpContext)
+	})
+}
+
+type LayeredSchemeStore struct {
+	*LayeredStore
+}
+
+func (s *LayeredSchemeStore) Save(scheme *model.Scheme) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.SchemeSave(s.TmpContext, scheme)
+	})
+}
+
+func (s *LayeredSchemeStore) Get(schemeId string) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.SchemeGet(s.TmpContext, schemeId)
+	})
+}
+
+func (s *LayeredSchemeStore) Delete(schemeId string) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.SchemeDelete(s.TmpContext, schemeId)
+	})
+}
+
+func (s *LayeredSchemeStore) GetAllPage(scope string, offset int, limit int) StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.SchemeGetAllPage(s.TmpContext, scope, offset, limit)
+	})
+}
+
+func (s *LayeredSchemeStore) PermanentDeleteAll() StoreChannel {
+	return s.RunQuery(func(supplier LayeredStoreSupplier) *LayeredStoreSupplierResult {
+		return supplier.SchemePermanentDeleteAll(s.TmpContext)
+	})
+}
@@ -2,7 +2,8 @@ package store
 
 import (
 	"context"
-	"github.com/mattermost/mattermost-server/model"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
 )
 
 type LayeredStoreSupplierResult struct {
@@ -22,7 +23,7 @@ type LayeredStoreSupplier interface {
 
 	//
 	// Reactions
-	//), hints ...LayeredStoreHint)
+	//
 	ReactionSave(ctx context.Context, reaction *model.Reaction, hints ...LayeredStoreHint) *LayeredStoreSupplierResult
 	ReactionDelete(ctx context.Context, reaction *model.Reaction, hints ...LayeredStoreHint) *LayeredStoreSupplierResult
 	ReactionGetForPost(ctx context.Context, postId string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult
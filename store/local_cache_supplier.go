@@ -0,0 +1,209 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/OhBonsai/go-web-boilerplate/cluster"
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+const (
+	REACTION_CACHE_NAME = "Reaction"
+	REACTION_CACHE_SIZE = 20000
+	REACTION_CACHE_SEC  = 30 * 60
+
+	ROLE_CACHE_NAME = "Role"
+	ROLE_CACHE_SIZE = 20000
+	ROLE_CACHE_SEC  = 30 * 60
+
+	SCHEME_CACHE_NAME = "Scheme"
+	SCHEME_CACHE_SIZE = 20000
+	SCHEME_CACHE_SEC  = 30 * 60
+)
+
+// LocalCacheSupplier answers reads from in-memory caches and passes everything else to the next supplier.
+// Writes invalidate the affected keys, on every node of the cluster when there is one.
+type LocalCacheSupplier struct {
+	next          LayeredStoreSupplier
+	reactionCache *utils.Cache
+	roleCache     *utils.Cache
+	schemeCache   *utils.Cache
+	metrics       einterfaces.MetricsInterface
+	cluster       einterfaces.ClusterInterface
+
+	// invalidations is set on the layer of a transaction, which reads past the caches and collects what its
+	// writes invalidate there until the transaction commits.
+	invalidations *cacheInvalidations
+}
+
+// cacheInvalidations are the keys removed from and the caches cleared by the writes of a transaction.
+type cacheInvalidations struct {
+	lock    sync.Mutex
+	removed map[*utils.Cache]map[string]bool
+	cleared map[*utils.Cache]bool
+}
+
+func newCacheInvalidations() *cacheInvalidations {
+	return &cacheInvalidations{
+		removed: make(map[*utils.Cache]map[string]bool),
+		cleared: make(map[*utils.Cache]bool),
+	}
+}
+
+func (i *cacheInvalidations) remove(cache *utils.Cache, key string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.removed[cache] == nil {
+		i.removed[cache] = make(map[string]bool)
+	}
+	i.removed[cache][key] = true
+}
+
+func (i *cacheInvalidations) clear(cache *utils.Cache) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.cleared[cache] = true
+}
+
+// merge adds the invalidations of a transaction nested in this one.
+func (i *cacheInvalidations) merge(nested *cacheInvalidations) {
+	nested.lock.Lock()
+	defer nested.lock.Unlock()
+
+	for cache, keys := range nested.removed {
+		for key := range keys {
+			i.remove(cache, key)
+		}
+	}
+	for cache := range nested.cleared {
+		i.clear(cache)
+	}
+}
+
+// apply invalidates the collected keys and caches, on every node of the cluster.
+func (i *cacheInvalidations) apply() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for cache := range i.cleared {
+		cache.Purge()
+	}
+	for cache, keys := range i.removed {
+		if i.cleared[cache] {
+			continue
+		}
+		for key := range keys {
+			cache.Remove(key)
+		}
+	}
+}
+
+func NewLocalCacheSupplier(metrics einterfaces.MetricsInterface, clusterInterface einterfaces.ClusterInterface) *LocalCacheSupplier {
+	supplier := &LocalCacheSupplier{
+		reactionCache: utils.NewLruWithParams(REACTION_CACHE_SIZE, REACTION_CACHE_NAME, REACTION_CACHE_SEC, model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_REACTIONS),
+		roleCache:     utils.NewLruWithParams(ROLE_CACHE_SIZE, ROLE_CACHE_NAME, ROLE_CACHE_SEC, model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_ROLES),
+		schemeCache:   utils.NewLruWithParams(SCHEME_CACHE_SIZE, SCHEME_CACHE_NAME, SCHEME_CACHE_SEC, model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_SCHEMES),
+		metrics:       metrics,
+		cluster:       clusterInterface,
+	}
+
+	if clusterInterface != nil {
+		cluster.RegisterCacheInvalidation(clusterInterface, supplier.reactionCache)
+		cluster.RegisterCacheInvalidation(clusterInterface, supplier.roleCache)
+		cluster.RegisterCacheInvalidation(clusterInterface, supplier.schemeCache)
+	}
+
+	return supplier
+}
+
+func (s *LocalCacheSupplier) SetChainNext(next LayeredStoreSupplier) {
+	s.next = next
+}
+
+func (s *LocalCacheSupplier) Next() LayeredStoreSupplier {
+	return s.next
+}
+
+// forTransaction returns a layer over the suppliers of a transaction that shares the caches of s, see
+// invalidations.
+func (s *LocalCacheSupplier) forTransaction(next LayeredStoreSupplier) *LocalCacheSupplier {
+	return &LocalCacheSupplier{
+		next:          next,
+		reactionCache: s.reactionCache,
+		roleCache:     s.roleCache,
+		schemeCache:   s.schemeCache,
+		metrics:       s.metrics,
+		cluster:       s.cluster,
+		invalidations: newCacheInvalidations(),
+	}
+}
+
+// Close stops sharing the invalidations of the caches and unregisters them. The layer of a transaction leaves
+// them to the store.
+func (s *LocalCacheSupplier) Close() {
+	if s.invalidations != nil {
+		return
+	}
+
+	for _, cache := range []*utils.Cache{s.reactionCache, s.roleCache, s.schemeCache} {
+		cache.SetInvalidationHandler(nil)
+		cache.Unregister()
+	}
+}
+
+func (s *LocalCacheSupplier) doStandardReadCache(ctx context.Context, cache *utils.Cache, key string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	if s.invalidations != nil {
+		return nil
+	}
+
+	if hintsContains(hints, LSH_NO_CACHE) {
+		if s.metrics != nil {
+			s.metrics.IncrementMemCacheMissCounter(cache.Name())
+		}
+		return nil
+	}
+
+	if cacheItem, ok := cache.Get(key); ok {
+		if s.metrics != nil {
+			s.metrics.IncrementMemCacheHitCounter(cache.Name())
+		}
+		result := NewSupplierResult()
+		result.Data = cacheItem
+		return result
+	}
+
+	if s.metrics != nil {
+		s.metrics.IncrementMemCacheMissCounter(cache.Name())
+	}
+
+	return nil
+}
+
+func (s *LocalCacheSupplier) doStandardAddToCache(ctx context.Context, cache *utils.Cache, key string, result *LayeredStoreSupplierResult, hints ...LayeredStoreHint) {
+	if s.invalidations == nil && result.Err == nil && result.Data != nil {
+		cache.Add(key, result.Data)
+	}
+}
+
+// doInvalidateCacheCluster removes key from cache. Removals reach the other nodes through the cache's
+// invalidation handler.
+func (s *LocalCacheSupplier) doInvalidateCacheCluster(cache *utils.Cache, key string) {
+	if s.invalidations != nil {
+		s.invalidations.remove(cache, key)
+		return
+	}
+	cache.Remove(key)
+}
+
+func (s *LocalCacheSupplier) doClearCacheCluster(cache *utils.Cache) {
+	if s.invalidations != nil {
+		s.invalidations.clear(cache)
+		return
+	}
+	cache.Purge()
+}
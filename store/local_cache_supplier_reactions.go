@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+func (s *LocalCacheSupplier) ReactionSave(ctx context.Context, reaction *model.Reaction, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	defer s.doInvalidateCacheCluster(s.reactionCache, reaction.PostId)
+	return s.Next().ReactionSave(ctx, reaction, hints...)
+}
+
+func (s *LocalCacheSupplier) ReactionDelete(ctx context.Context, reaction *model.Reaction, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	defer s.doInvalidateCacheCluster(s.reactionCache, reaction.PostId)
+	return s.Next().ReactionDelete(ctx, reaction, hints...)
+}
+
+func (s *LocalCacheSupplier) ReactionGetForPost(ctx context.Context, postId string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	if result := s.doStandardReadCache(ctx, s.reactionCache, postId, hints...); result != nil {
+		return result
+	}
+
+	result := s.Next().ReactionGetForPost(ctx, postId, hints...)
+
+	s.doStandardAddToCache(ctx, s.reactionCache, postId, result, hints...)
+
+	return result
+}
+
+func (s *LocalCacheSupplier) ReactionDeleteAllWithEmojiName(ctx context.Context, emojiName string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	// This could be improved. Right now we just clear the whole
+	// cache because we don't have a way find what post Ids have this emoji name.
+	defer s.doClearCacheCluster(s.reactionCache)
+	return s.Next().ReactionDeleteAllWithEmojiName(ctx, emojiName, hints...)
+}
+
+func (s *LocalCacheSupplier) ReactionPermanentDeleteBatch(ctx context.Context, endTime int64, limit int64, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	defer s.doClearCacheCluster(s.reactionCache)
+	return s.Next().ReactionPermanentDeleteBatch(ctx, endTime, limit, hints...)
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+func (s *LocalCacheSupplier) RoleSave(ctx context.Context, role *model.Role, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	if len(role.Name) != 0 {
+		defer s.doInvalidateCacheCluster(s.roleCache, role.Name)
+	}
+	return s.Next().RoleSave(ctx, role, hints...)
+}
+
+func (s *LocalCacheSupplier) RoleGet(ctx context.Context, roleId string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	// Roles are cached by name, as that is used much more frequently than id.
+	return s.Next().RoleGet(ctx, roleId, hints...)
+}
+
+func (s *LocalCacheSupplier) RoleGetByName(ctx context.Context, name string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	if result := s.doStandardReadCache(ctx, s.roleCache, name, hints...); result != nil {
+		return result
+	}
+
+	result := s.Next().RoleGetByName(ctx, name, hints...)
+
+	s.doStandardAddToCache(ctx, s.roleCache, name, result, hints...)
+
+	return result
+}
+
+func (s *LocalCacheSupplier) RoleGetByNames(ctx context.Context, roleNames []string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	var foundRoles []*model.Role
+	var rolesToQuery []string
+
+	for _, roleName := range roleNames {
+		if result := s.doStandardReadCache(ctx, s.roleCache, roleName, hints...); result != nil {
+			foundRoles = append(foundRoles, result.Data.(*model.Role))
+		} else {
+			rolesToQuery = append(rolesToQuery, roleName)
+		}
+	}
+
+	if len(rolesToQuery) == 0 {
+		result := NewSupplierResult()
+		result.Data = foundRoles
+		return result
+	}
+
+	result := s.Next().RoleGetByNames(ctx, rolesToQuery, hints...)
+
+	if result.Err == nil {
+		rolesFound := result.Data.([]*model.Role)
+		for _, role := range rolesFound {
+			res := NewSupplierResult()
+			res.Data = role
+			s.doStandardAddToCache(ctx, s.roleCache, role.Name, res, hints...)
+		}
+		result.Data = append(foundRoles, result.Data.([]*model.Role)...)
+	}
+
+	return result
+}
+
+func (s *LocalCacheSupplier) RoleDelete(ctx context.Context, roleId string, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	result := s.Next().RoleDelete(ctx, roleId, hints...)
+
+	if result.Err == nil {
+		role := result.Data.(*model.Role)
+		s.doInvalidateCacheCluster(s.roleCache, role.Name)
+	}
+
+	return result
+}
+
+func (s *LocalCacheSupplier) RolePermanentDeleteAll(ctx context.Context, hints ...LayeredStoreHint) *LayeredStoreSupplierResult {
+	defer s.doClearCacheCluster(s.roleCache)
+
+	return s.Next().RolePermanentDeleteAll(ctx, hints...)
+}
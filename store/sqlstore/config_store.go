@@ -0,0 +1,226 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+const (
+	CONFIG_TABLE_NAME          = "Configurations"
+	CONFIG_VALUE_MAX_SIZE      = 65535
+	CONFIG_STORE_POLL_INTERVAL = 10 * time.Second
+
+	// CONFIG_STORE_RETAINED_ROWS is how many saved versions of the config Save keeps.
+	CONFIG_STORE_RETAINED_ROWS = 10
+)
+
+// ConfigurationRow is one saved version of the config. Only the most recent row is active. Saves racing on
+// different nodes may both leave their row active, in which case the most recent of them is.
+type ConfigurationRow struct {
+	Id       string
+	Value    string
+	CreateAt int64
+	Active   bool
+}
+
+// SqlConfigStore keeps the config in the Configurations table so that every node pointing at the same
+// database shares it. Changes made by other nodes are picked up by polling.
+type SqlConfigStore struct {
+	dbmap     *gorp.DbMap
+	dsn       string
+	envPrefix string
+
+	lock     sync.Mutex
+	activeId string
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewSqlConfigStore opens a connection to the database described by driverName and dataSource and
+// creates the Configurations table if needed. The rest of the schema is left to the SqlSupplier. Settings are overridden by the environment variables named
+// after envPrefix.
+func NewSqlConfigStore(ctx context.Context, driverName string, dataSource string, envPrefix string) (*SqlConfigStore, error) {
+	settings := model.SqlSettings{
+		DriverName: model.NewString(driverName),
+		DataSource: model.NewString(dataSource),
+	}
+	settings.SetDefaults()
+
+	dbmap, err := setupConnection(ctx, "config", dataSource, &settings, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	table := dbmap.AddTableWithName(ConfigurationRow{}, CONFIG_TABLE_NAME).SetKeys(false, "Id")
+	table.ColMap("Id").SetMaxSize(26)
+	table.ColMap("Value").SetMaxSize(CONFIG_VALUE_MAX_SIZE)
+
+	if err := dbmap.CreateTablesIfNotExists(); err != nil {
+		dbmap.Db.Close()
+		return nil, NewSqlStoreError(EXIT_CREATE_TABLE, "Error creating config table", err)
+	}
+
+	return &SqlConfigStore{
+		dbmap:     dbmap,
+		dsn:       driverName + "://",
+		envPrefix: envPrefix,
+	}, nil
+}
+
+func (cs *SqlConfigStore) getActive() (*ConfigurationRow, error) {
+	var row ConfigurationRow
+	if err := cs.dbmap.SelectOne(&row, "SELECT * FROM "+CONFIG_TABLE_NAME+" WHERE Active = :Active ORDER BY CreateAt DESC, Id DESC LIMIT 1", map[string]interface{}{"Active": true}); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func (cs *SqlConfigStore) Load() (*model.Config, map[string]interface{}, *model.AppError) {
+	row, err := cs.getActive()
+	if err == sql.ErrNoRows {
+		// First start against this database, seed it with the defaults.
+		config := &model.Config{}
+		config.SetDefaults()
+		if appErr := cs.Save(config); appErr != nil {
+			return nil, nil, appErr
+		}
+		row, err = cs.getActive()
+	}
+	if err != nil {
+		return nil, nil, model.NewAppError("SqlConfigStore.Load", "store.sql_config.load.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	cs.lock.Lock()
+	cs.activeId = row.Id
+	cs.lock.Unlock()
+
+	return utils.ConfigFromJson(cs.String(), []byte(row.Value), cs.envPrefix)
+}
+
+func (cs *SqlConfigStore) Save(config *model.Config) *model.AppError {
+	persisted := &model.Config{}
+	if row, err := cs.getActive(); err == nil {
+		if stored, _, err := utils.ReadConfig(strings.NewReader(row.Value), ""); err == nil {
+			persisted = stored
+		}
+	}
+
+	row := &ConfigurationRow{
+		Id:       model.NewId(),
+		Value:    utils.RemoveEnvOverridesFrom(persisted, config, cs.envPrefix).ToJson(),
+		CreateAt: model.GetMillis(),
+		Active:   true,
+	}
+
+	transaction, err := cs.dbmap.Begin()
+	if err != nil {
+		return model.NewAppError("SqlConfigStore.Save", "store.sql_config.save.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	if _, err := transaction.Exec("UPDATE "+CONFIG_TABLE_NAME+" SET Active = :Inactive WHERE Active = :Active", map[string]interface{}{"Inactive": false, "Active": true}); err != nil {
+		transaction.Rollback()
+		return model.NewAppError("SqlConfigStore.Save", "store.sql_config.save.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	if err := transaction.Insert(row); err != nil {
+		transaction.Rollback()
+		return model.NewAppError("SqlConfigStore.Save", "store.sql_config.save.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	// Drop the versions older than the last CONFIG_STORE_RETAINED_ROWS. MySQL can't limit a subquery on the
+	// table it deletes from, so the cutoff is selected first.
+	cutoff, err := transaction.SelectInt("SELECT CreateAt FROM "+CONFIG_TABLE_NAME+" ORDER BY CreateAt DESC LIMIT 1 OFFSET :Offset", map[string]interface{}{"Offset": CONFIG_STORE_RETAINED_ROWS - 1})
+	if err == nil {
+		_, err = transaction.Exec("DELETE FROM "+CONFIG_TABLE_NAME+" WHERE CreateAt < :CreateAt", map[string]interface{}{"CreateAt": cutoff})
+	}
+	if err != nil {
+		transaction.Rollback()
+		return model.NewAppError("SqlConfigStore.Save", "store.sql_config.save.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return model.NewAppError("SqlConfigStore.Save", "store.sql_config.save.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	cs.lock.Lock()
+	cs.activeId = row.Id
+	cs.lock.Unlock()
+
+	return nil
+}
+
+func (cs *SqlConfigStore) Watch(f func()) error {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	if cs.stop != nil {
+		return nil
+	}
+
+	cs.stop = make(chan struct{})
+	cs.stopped = make(chan struct{})
+
+	go func(stop, stopped chan struct{}) {
+		defer close(stopped)
+
+		ticker := time.NewTicker(CONFIG_STORE_POLL_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				row, err := cs.getActive()
+				if err != nil {
+					mlog.Error(fmt.Sprintf("Failed to poll config from %v err=%v", cs.String(), err))
+					continue
+				}
+
+				cs.lock.Lock()
+				changed := row.Id != cs.activeId
+				cs.activeId = row.Id
+				cs.lock.Unlock()
+
+				if changed {
+					mlog.Info(fmt.Sprintf("Config watcher detected a change reloading %v", cs.String()))
+					f()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(cs.stop, cs.stopped)
+
+	return nil
+}
+
+func (cs *SqlConfigStore) Unwatch() {
+	cs.lock.Lock()
+	stop, stopped := cs.stop, cs.stopped
+	cs.stop, cs.stopped = nil, nil
+	cs.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-stopped
+	}
+}
+
+func (cs *SqlConfigStore) Close() error {
+	cs.Unwatch()
+	return cs.dbmap.Db.Close()
+}
+
+func (cs *SqlConfigStore) String() string {
+	return cs.dsn
+}
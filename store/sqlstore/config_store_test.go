@@ -0,0 +1,98 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+func TestSqlConfigStore(t *testing.T) {
+	settings := newSqliteSettings()
+
+	cs, err := NewSqlConfigStore(context.Background(), *settings.DriverName, *settings.DataSource, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	config, _, appErr := cs.Load()
+	if appErr != nil {
+		t.Fatal(appErr)
+	}
+	if config.SqlSettings.DriverName == nil {
+		t.Fatal("should seed an empty database with the defaults")
+	}
+
+	*config.ServiceSettings.SiteURL = "http://example.com"
+	if appErr := cs.Save(config); appErr != nil {
+		t.Fatal(appErr)
+	}
+
+	reopened, err := NewSqlConfigStore(context.Background(), *settings.DriverName, *settings.DataSource, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	if config, _, appErr := reopened.Load(); appErr != nil || *config.ServiceSettings.SiteURL != "http://example.com" {
+		t.Fatalf("should load the saved config, got %v", appErr)
+	}
+
+	// Only the config lives here until a supplier sets up the rest of the schema.
+	var tables []string
+	if _, err := cs.dbmap.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table'"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0] != CONFIG_TABLE_NAME {
+		t.Fatalf("should only create the %v table, got %v", CONFIG_TABLE_NAME, tables)
+	}
+
+	cs.Unwatch()
+	if _, _, appErr := cs.Load(); appErr != nil {
+		t.Fatalf("should still load once no longer watched, got %v", appErr)
+	}
+}
+
+func TestSqlConfigStoreHistory(t *testing.T) {
+	settings := newSqliteSettings()
+
+	cs, err := NewSqlConfigStore(context.Background(), *settings.DriverName, *settings.DataSource, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	config, _, appErr := cs.Load()
+	if appErr != nil {
+		t.Fatal(appErr)
+	}
+
+	for i := 0; i < CONFIG_STORE_RETAINED_ROWS+5; i++ {
+		*config.ServiceSettings.SiteURL = fmt.Sprintf("http://example.com/%v", i)
+		if appErr := cs.Save(config); appErr != nil {
+			t.Fatal(appErr)
+		}
+		// Versions are told apart by the millisecond they were saved at.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if count, err := cs.dbmap.SelectInt("SELECT COUNT(*) FROM " + CONFIG_TABLE_NAME); err != nil {
+		t.Fatal(err)
+	} else if count != CONFIG_STORE_RETAINED_ROWS {
+		t.Fatalf("should keep %v versions, got %v", CONFIG_STORE_RETAINED_ROWS, count)
+	}
+
+	// A save racing on another node leaves a second active row, and the most recent one wins.
+	raced := &ConfigurationRow{Id: model.NewId(), Value: `{"ServiceSettings":{"SiteURL":"http://raced.example.com"}}`, CreateAt: model.GetMillis() + 1000, Active: true}
+	if err := cs.dbmap.Insert(raced); err != nil {
+		t.Fatal(err)
+	}
+	if config, _, appErr := cs.Load(); appErr != nil {
+		t.Fatal(appErr)
+	} else if *config.ServiceSettings.SiteURL != "http://raced.example.com" {
+		t.Fatalf("should load the most recent active version, got %v", *config.ServiceSettings.SiteURL)
+	}
+}
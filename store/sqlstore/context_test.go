@@ -0,0 +1,126 @@
+package sqlstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+// slowQuery counts far enough to run until it is interrupted.
+const slowQuery = `
+	WITH RECURSIVE counter(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM counter WHERE n < 1000000000)
+	SELECT COUNT(*) FROM counter`
+
+func TestQueryCancellation(t *testing.T) {
+	ss := newSqliteSupplier(t)
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		if _, err := withContext(ss.GetMaster(), ctx).SelectInt(slowQuery); err == nil {
+			t.Fatal("expected the query to be interrupted")
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("expected the query to stop when cancelled, took %v", elapsed)
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := withContext(ss.GetMaster(), ctx).SelectInt(slowQuery); err == nil {
+			t.Fatal("expected the query to be interrupted")
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("expected the query to stop at the deadline, took %v", elapsed)
+		}
+	})
+
+	t.Run("StoreDeadline", func(t *testing.T) {
+		post := &model.Post{ChannelId: model.NewId(), UserId: model.NewId(), Message: "deadline"}
+		if result := <-ss.Post().Save(post); result.Err != nil {
+			t.Fatal(result.Err)
+		}
+
+		// Make deleting posts run until it is interrupted.
+		for _, statement := range []string{
+			"CREATE VIEW SlowCounter AS " + slowQuery,
+			"CREATE TRIGGER SlowDelete BEFORE DELETE ON Posts BEGIN SELECT * FROM SlowCounter; END",
+		} {
+			if _, err := ss.GetMaster().Exec(statement); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		result := <-ss.Post().WithContext(ctx).PermanentDeleteByChannel(post.ChannelId)
+		if !store.IsTimeoutError(result.Err) {
+			t.Fatalf("expected a timeout, got %v", result.Err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("expected the delete to stop at the deadline, took %v", elapsed)
+		}
+	})
+	t.Run("StoreWriteDeadline", func(t *testing.T) {
+		ss := newSqliteSupplier(t)
+
+		post := &model.Post{ChannelId: model.NewId(), UserId: model.NewId(), Message: "deadline"}
+		if result := <-ss.Post().Save(post); result.Err != nil {
+			t.Fatal(result.Err)
+		}
+
+		// Make writing posts run until it is interrupted.
+		for _, statement := range []string{
+			"CREATE VIEW SlowCounter AS " + slowQuery,
+			"CREATE TRIGGER SlowInsert BEFORE INSERT ON Posts BEGIN SELECT * FROM SlowCounter; END",
+			"CREATE TRIGGER SlowUpdate BEFORE UPDATE ON Posts BEGIN SELECT * FROM SlowCounter; END",
+		} {
+			if _, err := ss.GetMaster().Exec(statement); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		updated := post.Clone()
+		updated.Message = "updated"
+
+		for name, write := range map[string]func(store.PostStore) store.StoreChannel{
+			"Save": func(s store.PostStore) store.StoreChannel {
+				return s.Save(&model.Post{ChannelId: post.ChannelId, UserId: post.UserId, Message: "saved"})
+			},
+			"Update": func(s store.PostStore) store.StoreChannel {
+				return s.Update(updated.Clone(), post.Clone())
+			},
+			"Overwrite": func(s store.PostStore) store.StoreChannel {
+				return s.Overwrite(updated.Clone())
+			},
+		} {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+			start := time.Now()
+			result := <-write(ss.Post().WithContext(ctx))
+			cancel()
+			if !store.IsTimeoutError(result.Err) {
+				t.Fatalf("expected %v to time out, got %v", name, result.Err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Fatalf("expected %v to stop at the deadline, took %v", name, elapsed)
+			}
+		}
+
+		if result := <-ss.Post().GetSingle(post.Id); result.Err != nil {
+			t.Fatal(result.Err)
+		} else if result.Data.(*model.Post).Message != post.Message {
+			t.Fatal("expected the interrupted writes to leave the post as it was")
+		}
+	})
+}
@@ -0,0 +1,336 @@
+package sqlstore
+
+import (
+	"context"
+	dbsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"time"
+)
+
+// gorp runs its statements in a context of its own, which only ends after SqlSettings.QueryTimeout. The
+// connections of the store are opened through the wrappers below so that a statement also stops when the
+// store call that runs it is cancelled or passes its deadline: the executor binds the arguments of the
+// statement to the context of the call, see contextArg, and the connection running it takes the context
+// back off them. The wrappers also report every statement to the queryObserver of the connection pool.
+
+// contextArg is an argument of a statement bound to the context of the store call running it. It implements
+// driver.Valuer so that gorp passes it on untouched rather than taking it for named parameters.
+type contextArg struct {
+	ctx   context.Context
+	value interface{}
+
+	// bare is set on the argument added to the statements that have none of their own. It is dropped before
+	// the statement runs.
+	bare bool
+
+	// failed, when set, receives the first error met reading the rows of the statement, which gorp drops when
+	// it selects a single value.
+	failed *error
+}
+
+func (a contextArg) Value() (driver.Value, error) {
+	return driver.DefaultParameterConverter.ConvertValue(a.value)
+}
+
+// openDB opens a connection pool on dataSource whose connections run statements in the context their
+// arguments are bound to and report them to observer.
+func openDB(driverName string, dataSource string, observer *queryObserver) (*dbsql.DB, error) {
+	// The driver registered under driverName is only reachable through a pool opened on it. Opening one
+	// doesn't connect.
+	db, err := dbsql.Open(driverName, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	var c driver.Connector = dsnConnector{dataSource: dataSource, driver: d}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if c, err = dc.OpenConnector(dataSource); err != nil {
+			return nil, err
+		}
+	}
+
+	return dbsql.OpenDB(connector{Connector: c, observer: observer}), nil
+}
+
+// dsnConnector opens connections with drivers that have no driver.Connector of their own.
+type dsnConnector struct {
+	dataSource string
+	driver     driver.Driver
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dataSource)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type connector struct {
+	driver.Connector
+
+	observer *queryObserver
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	inner, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: inner, observer: c.observer}, nil
+}
+
+// conn runs the statements of one connection. database/sql checks the arguments of a statement just
+// before it runs it, under the lock of the connection, so the context found among them is kept on the
+// connection for the statement that follows.
+type conn struct {
+	driver.Conn
+
+	bound    context.Context
+	failed   *error
+	observer *queryObserver
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.checkNamedValue(nv, nil)
+}
+
+// checkNamedValue takes the context off a contextArg and has the argument it wraps checked by checker, the
+// driver's own checker of the connection or the default one.
+func (c *conn) checkNamedValue(nv *driver.NamedValue, checker driver.NamedValueChecker) error {
+	if nv.Ordinal == 1 {
+		c.bound, c.failed = nil, nil
+	}
+
+	if arg, ok := nv.Value.(contextArg); ok {
+		c.bound, c.failed = arg.ctx, arg.failed
+		if arg.bare {
+			return driver.ErrRemoveArgument
+		}
+		nv.Value = arg.value
+	}
+
+	if checker == nil {
+		checker, _ = c.Conn.(driver.NamedValueChecker)
+	}
+	if checker != nil {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// context returns ctx, cancelled as well once the context the statement is bound to ends, and where to
+// record the error of its rows. The returned function releases the context after the statement.
+func (c *conn) context(ctx context.Context) (context.Context, *error, func()) {
+	bound, failed := c.bound, c.failed
+	c.bound, c.failed = nil, nil
+	if bound == nil || bound.Done() == nil {
+		return ctx, failed, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(bound, cancel)
+	return ctx, failed, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, _, release := c.context(ctx)
+	defer release()
+	return c.observeExec(query, time.Now(), func() (driver.Result, error) {
+		return execer.ExecContext(ctx, query, args)
+	})
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, failed, release := c.context(ctx)
+	started := time.Now()
+	result, err := queryer.QueryContext(ctx, query, args)
+	return c.observeQuery(query, started, result, err, failed, release)
+}
+
+// observeExec runs exec and reports the statement with the number of rows it affected. Statements the driver
+// skips are left to the prepared statement that database/sql runs instead.
+func (c *conn) observeExec(query string, started time.Time, exec func() (driver.Result, error)) (driver.Result, error) {
+	result, err := exec()
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+
+	var affected int64
+	if err == nil {
+		affected, _ = result.RowsAffected()
+	}
+	c.observer.ObserveQuery(query, time.Since(started), affected, err)
+	return result, err
+}
+
+// observeQuery wraps the rows of a query so that it is reported once they are closed, or reports the query
+// straight away when it failed.
+func (c *conn) observeQuery(query string, started time.Time, result driver.Rows, err error, failed *error, release func()) (driver.Rows, error) {
+	if err != nil {
+		release()
+		if err != driver.ErrSkip {
+			c.observer.ObserveQuery(query, time.Since(started), 0, err)
+		}
+		return nil, err
+	}
+	return &rows{Rows: result, release: release, observer: c.observer, query: query, started: started, failed: failed}, nil
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var inner driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		inner, err = preparer.PrepareContext(ctx, query)
+	} else {
+		inner, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: inner, conn: c, query: query}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	c.bound, c.failed = nil, nil
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// stmt is a prepared statement, which database/sql falls back to when the driver can't run a statement
+// directly.
+type stmt struct {
+	driver.Stmt
+
+	conn  *conn
+	query string
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	checker, _ := s.Stmt.(driver.NamedValueChecker)
+	return s.conn.checkNamedValue(nv, checker)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, _, release := s.conn.context(ctx)
+	defer release()
+
+	return s.conn.observeExec(s.query, time.Now(), func() (driver.Result, error) {
+		if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+			return execer.ExecContext(ctx, args)
+		}
+		values, err := namedValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Exec(values)
+	})
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, failed, release := s.conn.context(ctx)
+	started := time.Now()
+
+	var result driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		result, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			result, err = s.Stmt.Query(values)
+		}
+	}
+	return s.conn.observeQuery(s.query, started, result, err, failed, release)
+}
+
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// rows keeps the context of its statement alive until they are closed, and then reports the statement with
+// the time it took to read them.
+type rows struct {
+	driver.Rows
+
+	release  func()
+	observer *queryObserver
+	query    string
+	started  time.Time
+	count    int64
+	err      error
+	failed   *error
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.count++
+	} else if err != io.EOF && r.err == nil {
+		r.err = err
+		if r.failed != nil {
+			*r.failed = err
+		}
+	}
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.release()
+	r.observer.ObserveQuery(r.query, time.Since(r.started), r.count, r.err)
+	return err
+}
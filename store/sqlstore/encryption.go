@@ -0,0 +1,338 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+const (
+	ENCRYPTION_KEY_ID_LENGTH       = 8
+	ENCRYPTION_ROTATION_BATCH_SIZE = 1000
+)
+
+var (
+	ErrUnknownEncryptionKey = errors.New("the value was encrypted with a key missing from the keyring")
+	ErrInvalidCiphertext    = errors.New("the value is not a valid ciphertext")
+)
+
+// EncryptedColumn is a column mapped to a model.EncryptedString field, with the primary key of its table.
+type EncryptedColumn struct {
+	Table     string
+	KeyColumn string
+	Column    string
+}
+
+// encryptedColumns are the columns that RotateEncryptionKey re-encrypts. Add a column here when mapping a new
+// model.EncryptedString field.
+var encryptedColumns = []EncryptedColumn{
+	{Table: "Sessions", KeyColumn: "Id", Column: "Token"},
+}
+
+type encryptionKey struct {
+	id       string
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// newEncryptionKey derives the AES-256 key and the nonce key from secret. The id names the key in the values
+// it encrypts, so that it can be found again once it is no longer the primary key.
+func newEncryptionKey(secret string) (*encryptionKey, error) {
+	block, err := aes.NewCipher(deriveKey(secret, "encryption"))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	id := sha256.Sum256([]byte(secret))
+
+	return &encryptionKey{
+		id:       hex.EncodeToString(id[:])[:ENCRYPTION_KEY_ID_LENGTH],
+		aead:     aead,
+		nonceKey: deriveKey(secret, "nonce"),
+	}, nil
+}
+
+func deriveKey(secret string, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// encrypt seals plaintext with AES-GCM. The nonce is derived from plaintext, so that a value always encrypts
+// the same way under a key and can still be looked up in the database. Only equal values can be told apart.
+func (k *encryptionKey) encrypt(plaintext string) string {
+	mac := hmac.New(sha256.New, k.nonceKey)
+	mac.Write([]byte(plaintext))
+	nonce := mac.Sum(nil)[:k.aead.NonceSize()]
+
+	sealed := k.aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.id))
+	return k.id + ":" + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func (k *encryptionKey) decrypt(sealed string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < k.aead.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+
+	plaintext, err := k.aead.Open(nil, data[:k.aead.NonceSize()], data[k.aead.NonceSize():], []byte(k.id))
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plaintext), nil
+}
+
+// Keyring encrypts model.EncryptedString values with its primary key, SqlSettings.AtRestEncryptKey, and
+// decrypts those encrypted with any of its keys, which include SqlSettings.AtRestDecryptKeys. Values stored
+// before encryption was enabled are read as they are.
+type Keyring struct {
+	primary *encryptionKey
+	keys    map[string]*encryptionKey
+}
+
+// NewKeyring returns a keyring encrypting with primary and decrypting with primary and others.
+func NewKeyring(primary string, others ...string) (*Keyring, error) {
+	if len(primary) == 0 {
+		return nil, errors.New("missing encryption key")
+	}
+
+	k := &Keyring{keys: make(map[string]*encryptionKey, len(others)+1)}
+	for _, secret := range append([]string{primary}, others...) {
+		key, err := newEncryptionKey(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.primary == nil {
+			k.primary = key
+		}
+		if _, ok := k.keys[key.id]; !ok {
+			k.keys[key.id] = key
+		}
+	}
+
+	return k, nil
+}
+
+// Encrypt encrypts plaintext with the primary key. The empty string stays empty.
+func (k *Keyring) Encrypt(plaintext string) string {
+	if len(plaintext) == 0 {
+		return ""
+	}
+	return k.primary.encrypt(plaintext)
+}
+
+// Decrypt decrypts value with the key it names. A value that isn't encrypted is returned as it is.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	id, sealed, encrypted := splitCiphertext(value)
+	if !encrypted {
+		return value, nil
+	}
+
+	key, ok := k.keys[id]
+	if !ok {
+		return "", ErrUnknownEncryptionKey
+	}
+	return key.decrypt(sealed)
+}
+
+// IsCurrent reports whether value is encrypted with the primary key, or is empty.
+func (k *Keyring) IsCurrent(value string) bool {
+	id, _, encrypted := splitCiphertext(value)
+	return len(value) == 0 || (encrypted && id == k.primary.id)
+}
+
+// Ciphertexts lists every form plaintext may be stored in: encrypted with each key, and as it is for rows
+// written before encryption was enabled. Queries match a column against all of them.
+func (k *Keyring) Ciphertexts(plaintext string) []string {
+	ciphertexts := make([]string, 0, len(k.keys)+1)
+	ciphertexts = append(ciphertexts, plaintext, k.primary.encrypt(plaintext))
+	for _, key := range k.keys {
+		if key != k.primary {
+			ciphertexts = append(ciphertexts, key.encrypt(plaintext))
+		}
+	}
+	return ciphertexts
+}
+
+func splitCiphertext(value string) (id string, sealed string, encrypted bool) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || len(parts[0]) != ENCRYPTION_KEY_ID_LENGTH {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// encryptionConverter encrypts model.EncryptedString fields on their way to the database and decrypts them
+// on their way back, handing every other type to the converter it wraps.
+type encryptionConverter struct {
+	gorp.TypeConverter
+	keyring *Keyring
+}
+
+func (c encryptionConverter) ToDb(val interface{}) (interface{}, error) {
+	if s, ok := val.(model.EncryptedString); ok {
+		return c.keyring.Encrypt(string(s)), nil
+	}
+	return c.TypeConverter.ToDb(val)
+}
+
+func (c encryptionConverter) FromDb(target interface{}) (gorp.CustomScanner, bool) {
+	if _, ok := target.(*model.EncryptedString); ok {
+		binder := func(holder, target interface{}) error {
+			plaintext, err := c.keyring.Decrypt(*holder.(*string))
+			if err != nil {
+				return err
+			}
+			*target.(*model.EncryptedString) = model.EncryptedString(plaintext)
+			return nil
+		}
+		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	}
+	return c.TypeConverter.FromDb(target)
+}
+
+// Keyring returns the keyring the connections of the store encrypt with.
+func (ss *SqlSupplier) Keyring() *Keyring {
+	return ss.keyring
+}
+
+// KeyRotation counts the rows of a column that RotateEncryptionKey re-encrypted.
+type KeyRotation struct {
+	EncryptedColumn
+	Rows int64
+}
+
+type encryptedRow struct {
+	Id    string
+	Value string
+}
+
+// RotateEncryptionKey re-encrypts with the primary key the values of every encrypted column that were
+// encrypted with another key of the keyring, or not at all. Each batch of batchSize rows is updated in a
+// transaction, and a row changed since it was read is left for the next run.
+func (ss *SqlSupplier) RotateEncryptionKey(ctx context.Context, batchSize int) ([]KeyRotation, *model.AppError) {
+	if batchSize <= 0 {
+		batchSize = ENCRYPTION_ROTATION_BATCH_SIZE
+	}
+
+	var rotations []KeyRotation
+	for _, column := range encryptedColumns {
+		rows, err := ss.rotateColumn(ctx, column, batchSize)
+		rotations = append(rotations, KeyRotation{EncryptedColumn: column, Rows: rows})
+		if err != nil {
+			return rotations, err
+		}
+	}
+	return rotations, nil
+}
+
+func (ss *SqlSupplier) rotateColumn(ctx context.Context, column EncryptedColumn, batchSize int) (int64, *model.AppError) {
+	return ss.rewriteColumn(ctx, column, batchSize, func(value string) (string, bool, error) {
+		if ss.keyring.IsCurrent(value) {
+			return "", false, nil
+		}
+
+		plaintext, err := ss.keyring.Decrypt(value)
+		if err != nil {
+			return "", false, err
+		}
+		return ss.keyring.Encrypt(plaintext), true, nil
+	}, func(details string, err error) *model.AppError {
+		return rotationError(ctx, details, err)
+	})
+}
+
+// decryptColumn stores the encrypted values of column as plaintext again, for a schema that predates
+// encryption. It fails on a value encrypted with a key missing from the keyring.
+func (ss *SqlSupplier) decryptColumn(ctx context.Context, column EncryptedColumn, batchSize int, fail func(details string, err error) *model.AppError) (int64, *model.AppError) {
+	return ss.rewriteColumn(ctx, column, batchSize, func(value string) (string, bool, error) {
+		if _, _, encrypted := splitCiphertext(value); !encrypted {
+			return "", false, nil
+		}
+
+		plaintext, err := ss.keyring.Decrypt(value)
+		return plaintext, err == nil, err
+	}, fail)
+}
+
+// rewriteColumn replaces the values of column that rewrite changes, batchSize rows at a time with each batch in
+// a transaction. A row changed since it was read is left as it is. Errors are reported through fail, with the
+// column and the row they concern.
+func (ss *SqlSupplier) rewriteColumn(ctx context.Context, column EncryptedColumn, batchSize int, rewrite func(value string) (string, bool, error), fail func(details string, err error) *model.AppError) (int64, *model.AppError) {
+	details := "table=" + column.Table + ", column=" + column.Column
+
+	query := fmt.Sprintf("SELECT %v AS Id, %v AS Value FROM %v WHERE %v > :After ORDER BY %v LIMIT :Limit",
+		column.KeyColumn, column.Column, column.Table, column.KeyColumn, column.KeyColumn)
+	update := fmt.Sprintf("UPDATE %v SET %v = :New WHERE %v = :Id AND %v = :Old",
+		column.Table, column.Column, column.KeyColumn, column.Column)
+
+	var rewritten int64
+	after := ""
+	for {
+		var rows []*encryptedRow
+		if _, err := withContext(ss.GetMaster(), ctx).Select(&rows, query, map[string]interface{}{"After": after, "Limit": batchSize}); err != nil {
+			return rewritten, fail(details, err)
+		}
+		if len(rows) == 0 {
+			return rewritten, nil
+		}
+		after = rows[len(rows)-1].Id
+
+		transaction, err := ss.begin(ctx)
+		if err != nil {
+			return rewritten, fail(details, err)
+		}
+
+		var updated int64
+		for _, row := range rows {
+			value, changed, err := rewrite(row.Value)
+			if err != nil {
+				transaction.Rollback()
+				return rewritten, fail(details+", id="+row.Id, err)
+			}
+			if !changed {
+				continue
+			}
+
+			result, err := transaction.Exec(update, map[string]interface{}{"New": value, "Id": row.Id, "Old": row.Value})
+			if err != nil {
+				transaction.Rollback()
+				return rewritten, fail(details+", id="+row.Id, err)
+			}
+			if count, err := result.RowsAffected(); err == nil {
+				updated += count
+			}
+		}
+
+		if err := transaction.Commit(); err != nil {
+			return rewritten, fail(details, err)
+		}
+		rewritten += updated
+	}
+}
+
+func rotationError(ctx context.Context, details string, err error) *model.AppError {
+	if ctx.Err() != nil {
+		return store.NewContextError("SqlSupplier.RotateEncryptionKey", ctx.Err(), details+", "+err.Error())
+	}
+	return model.NewAppError("SqlSupplier.RotateEncryptionKey", "store.sql_encryption.rotate.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,248 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+func newTestKeyring(t *testing.T, primary string, others ...string) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(primary, others...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func TestKeyring(t *testing.T) {
+	oldKey, newKey := model.NewRandomString(32), model.NewRandomString(32)
+	old := newTestKeyring(t, oldKey)
+	keyring := newTestKeyring(t, newKey, oldKey)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		ciphertext := keyring.Encrypt("secret")
+		if ciphertext == "secret" || strings.Contains(ciphertext, "secret") {
+			t.Fatalf("should encrypt the value, got %v", ciphertext)
+		}
+		if ciphertext != keyring.Encrypt("secret") {
+			t.Fatal("should encrypt a value the same way every time")
+		}
+		if ciphertext == keyring.Encrypt("secret2") {
+			t.Fatal("should encrypt different values differently")
+		}
+
+		if plaintext, err := keyring.Decrypt(ciphertext); err != nil || plaintext != "secret" {
+			t.Fatalf("should decrypt the value, got %v %v", plaintext, err)
+		}
+		if !keyring.IsCurrent(ciphertext) {
+			t.Fatal("should be encrypted with the primary key")
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if keyring.Encrypt("") != "" {
+			t.Fatal("should leave the empty string empty")
+		}
+	})
+
+	t.Run("OldKey", func(t *testing.T) {
+		ciphertext := old.Encrypt("secret")
+		if keyring.IsCurrent(ciphertext) {
+			t.Fatal("should not be encrypted with the primary key")
+		}
+		if plaintext, err := keyring.Decrypt(ciphertext); err != nil || plaintext != "secret" {
+			t.Fatalf("should decrypt with an older key, got %v %v", plaintext, err)
+		}
+		if _, err := old.Decrypt(keyring.Encrypt("secret")); err != ErrUnknownEncryptionKey {
+			t.Fatalf("should not decrypt without the key, got %v", err)
+		}
+	})
+
+	t.Run("Plaintext", func(t *testing.T) {
+		if plaintext, err := keyring.Decrypt("not encrypted"); err != nil || plaintext != "not encrypted" {
+			t.Fatalf("should read values that aren't encrypted as they are, got %v %v", plaintext, err)
+		}
+		if keyring.IsCurrent("not encrypted") {
+			t.Fatal("should not count a value that isn't encrypted as current")
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		ciphertext := keyring.Encrypt("secret")
+		tampered := ciphertext[:len(ciphertext)-2] + "AA"
+		if tampered == ciphertext {
+			tampered = ciphertext[:len(ciphertext)-2] + "BB"
+		}
+		if _, err := keyring.Decrypt(tampered); err != ErrInvalidCiphertext {
+			t.Fatalf("should detect a modified value, got %v", err)
+		}
+	})
+
+	t.Run("Ciphertexts", func(t *testing.T) {
+		ciphertexts := keyring.Ciphertexts("secret")
+		expected := []string{"secret", keyring.Encrypt("secret"), old.Encrypt("secret")}
+		if len(ciphertexts) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, ciphertexts)
+		}
+		for i := range expected {
+			if ciphertexts[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, ciphertexts)
+			}
+		}
+	})
+}
+
+func storedToken(t *testing.T, ss *SqlSupplier, sessionId string) string {
+	t.Helper()
+
+	token, err := ss.GetMaster().SelectStr("SELECT Token FROM Sessions WHERE Id = :Id", map[string]interface{}{"Id": sessionId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestEncryptedSessionToken(t *testing.T) {
+	ss := newSqliteSupplier(t)
+
+	result := <-ss.Session().Save(&model.Session{UserId: model.NewId()})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	session := result.Data.(*model.Session)
+
+	if stored := storedToken(t, ss, session.Id); stored == string(session.Token) || !ss.Keyring().IsCurrent(stored) {
+		t.Fatalf("should store the token encrypted, got %v", stored)
+	}
+
+	result = <-ss.Session().Get(string(session.Token))
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if found := result.Data.(*model.Session); found.Id != session.Id || found.Token != session.Token {
+		t.Fatalf("should find the session by its token, got %v", found)
+	}
+
+	if result := <-ss.Session().Remove(string(session.Token)); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result := <-ss.Session().Get(session.Id); result.Err == nil {
+		t.Fatal("should remove the session by its token")
+	}
+}
+
+func TestRotateEncryptionKey(t *testing.T) {
+	settings := newSqliteSettings()
+	old := newSqliteSupplierWithSettings(t, settings)
+
+	var sessions []*model.Session
+	for i := 0; i < 5; i++ {
+		result := <-old.Session().Save(&model.Session{UserId: model.NewId()})
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		sessions = append(sessions, result.Data.(*model.Session))
+	}
+
+	// A row written before encryption was enabled.
+	legacy := &model.Session{Id: model.NewId(), Token: model.EncryptedString(model.NewId()), UserId: model.NewId()}
+	if _, err := old.GetMaster().Exec("INSERT INTO Sessions (Id, Token, CreateAt, ExpiresAt, LastActivityAt, UserId, DeviceId, Roles, IsOAuth, Props) VALUES (:Id, :Token, 0, 0, 0, :UserId, '', '', 0, '{}')",
+		map[string]interface{}{"Id": legacy.Id, "Token": string(legacy.Token), "UserId": legacy.UserId}); err != nil {
+		t.Fatal(err)
+	}
+	sessions = append(sessions, legacy)
+
+	settings.AtRestDecryptKeys = []string{settings.AtRestEncryptKey}
+	settings.AtRestEncryptKey = model.NewRandomString(32)
+	ss, err := OpenSqlSupplier(context.Background(), settings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	// Sessions encrypted with the old key are still found before the rotation.
+	if result := <-ss.Session().Get(string(sessions[0].Token)); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	rotations, appErr := ss.RotateEncryptionKey(context.Background(), 2)
+	if appErr != nil {
+		t.Fatal(appErr)
+	}
+	if len(rotations) != 1 || rotations[0].Table != "Sessions" || rotations[0].Rows != int64(len(sessions)) {
+		t.Fatalf("should re-encrypt every session, got %+v", rotations)
+	}
+
+	for _, session := range sessions {
+		if stored := storedToken(t, ss, session.Id); !ss.Keyring().IsCurrent(stored) {
+			t.Fatalf("should re-encrypt the token with the new key, got %v", stored)
+		}
+
+		result := <-ss.Session().Get(string(session.Token))
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		if found := result.Data.(*model.Session); found.Token != session.Token {
+			t.Fatalf("expected token %v, got %v", session.Token, found.Token)
+		}
+	}
+
+	if rotations, appErr := ss.RotateEncryptionKey(context.Background(), 2); appErr != nil || rotations[0].Rows != 0 {
+		t.Fatalf("should have nothing left to re-encrypt, got %+v %v", rotations, appErr)
+	}
+
+	// Without the old key, a row it encrypted can't be rotated.
+	if _, err := old.GetMaster().Exec("UPDATE Sessions SET Token = :Token WHERE Id = :Id",
+		map[string]interface{}{"Token": old.Keyring().Encrypt("stale"), "Id": sessions[0].Id}); err != nil {
+		t.Fatal(err)
+	}
+	settings.AtRestDecryptKeys = nil
+	unkeyed, err := OpenSqlSupplier(context.Background(), settings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unkeyed.Close()
+
+	if _, appErr := unkeyed.RotateEncryptionKey(context.Background(), 2); appErr == nil || appErr.Id != "store.sql_encryption.rotate.app_error" {
+		t.Fatalf("should fail on a value encrypted with an unknown key, got %v", appErr)
+	}
+}
+
+func TestDecryptSessionTokensOnDown(t *testing.T) {
+	settings := newSqliteSettings()
+	ss := newSqliteSupplierWithSettings(t, settings)
+
+	result := <-ss.Session().Save(&model.Session{UserId: model.NewId()})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	session := result.Data.(*model.Session)
+
+	// Without the key the token was encrypted with, the migration is left applied.
+	settings.AtRestEncryptKey = model.NewRandomString(32)
+	unkeyed, err := OpenSqlSupplier(context.Background(), settings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unkeyed.Close()
+
+	if _, appErr := NewMigrator(unkeyed).Down(1); appErr == nil || appErr.Id != "store.sql_migration.decrypt.app_error" {
+		t.Fatalf("should fail on a token encrypted with an unknown key, got %v", appErr)
+	}
+	if stored := storedToken(t, ss, session.Id); stored == string(session.Token) {
+		t.Fatal("should leave the token encrypted")
+	}
+
+	reverted, appErr := NewMigrator(ss).Down(1)
+	if appErr != nil {
+		t.Fatal(appErr)
+	}
+	checkVersions(t, reverted, 2)
+	if stored := storedToken(t, ss, session.Id); stored != string(session.Token) {
+		t.Fatalf("should decrypt the token before reverting, got %v", stored)
+	}
+}
@@ -0,0 +1,32 @@
+package sqlstore
+
+import (
+	"fmt"
+)
+
+// SqlStoreError is returned when the database can't be reached or its schema can't be set up. ExitCode is
+// the EXIT_* code a command should exit with, so that scripts can tell the failures apart.
+type SqlStoreError struct {
+	ExitCode int
+	Message  string
+	Err      error
+}
+
+func NewSqlStoreError(exitCode int, message string, err error) *SqlStoreError {
+	return &SqlStoreError{
+		ExitCode: exitCode,
+		Message:  message,
+		Err:      err,
+	}
+}
+
+func (e *SqlStoreError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%v: %v", e.Message, e.Err.Error())
+}
+
+func (e *SqlStoreError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,390 @@
+package sqlstore
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/gorp"
+)
+
+// tableKeys holds the key fields of the tables mapped with addTable by their type, as gorp keeps them to
+// itself.
+var tableKeys sync.Map
+
+// addTable maps the type of i to the table name, with keys that aren't auto-incremented. The executor writes
+// the rows of such a table in the context of the call.
+func addTable(db *gorp.DbMap, i interface{}, name string, keys ...string) *gorp.TableMap {
+	tableKeys.Store(reflect.TypeOf(i), keys)
+	return db.AddTableWithName(i, name).SetKeys(false, keys...)
+}
+
+// executor runs the statements of a store call in its context, on a connection pool or in a transaction. The
+// statements the store writes itself, those of Get, and Insert, Update and Delete on the tables mapped with
+// addTable all stop when the context ends.
+type executor struct {
+	gorp.SqlExecutor
+
+	// dbmap is the connection the statements run on, or that of the transaction, which Insert, Update and
+	// Delete take the dialect and type converter from.
+	dbmap *gorp.DbMap
+
+	ctx context.Context
+
+	// failed, when set, is told about the errors of the statements, see transaction.
+	failed func(error)
+}
+
+// withContext returns an executor that runs the statements of e in ctx.
+func withContext(e gorp.SqlExecutor, ctx context.Context) gorp.SqlExecutor {
+	if bound, ok := e.(*executor); ok {
+		return &executor{SqlExecutor: bound.SqlExecutor, dbmap: bound.dbmap, ctx: ctx, failed: bound.failed}
+	}
+	if t, ok := e.(*transaction); ok {
+		return &executor{SqlExecutor: t.executor.SqlExecutor, dbmap: t.executor.dbmap, ctx: ctx, failed: t.executor.failed}
+	}
+	dbmap, _ := e.(*gorp.DbMap)
+	return &executor{SqlExecutor: e, dbmap: dbmap, ctx: ctx}
+}
+
+// check hands err to the failed hook of the executor and returns it.
+func (e *executor) check(err error) error {
+	if err != nil && e.failed != nil {
+		e.failed(err)
+	}
+	return err
+}
+
+// bind binds the arguments of a statement to the context of the executor. The values of a map of named
+// parameters are bound one by one, so that gorp still expands them.
+func (e *executor) bind(args []interface{}) []interface{} {
+	return e.bindFailed(args, nil)
+}
+
+// bindFailed binds the arguments like bind, and has the error met reading the rows of the statement recorded
+// in failed.
+func (e *executor) bindFailed(args []interface{}, failed *error) []interface{} {
+	if len(args) == 1 {
+		if named, ok := args[0].(map[string]interface{}); ok {
+			bound := make(map[string]interface{}, len(named))
+			for key, value := range named {
+				bound[key] = contextArg{ctx: e.ctx, value: value, failed: failed}
+			}
+			return []interface{}{bound}
+		}
+	}
+
+	bound := make([]interface{}, len(args), len(args)+1)
+	for i, arg := range args {
+		bound[i] = contextArg{ctx: e.ctx, value: arg, failed: failed}
+	}
+	if len(bound) == 0 {
+		bound = append(bound, contextArg{ctx: e.ctx, bare: true, failed: failed})
+	}
+	return bound
+}
+
+// selected returns the error gorp returned for a statement selecting a single value, or otherwise the one it
+// dropped reading the row, which it takes for no row at all.
+func (e *executor) selected(err error, failed error) error {
+	if err == nil || err == dbsql.ErrNoRows {
+		if failed != nil {
+			err = failed
+		}
+	}
+	return e.check(err)
+}
+
+func (e *executor) Get(i interface{}, keys ...interface{}) (interface{}, error) {
+	obj, err := e.SqlExecutor.Get(i, e.bind(keys)...)
+	return obj, e.check(err)
+}
+
+// row is a struct to write to a table mapped with addTable.
+type row struct {
+	table *gorp.TableMap
+	elem  reflect.Value
+	keys  []string
+}
+
+// rowFor returns the row ptr points at, or nil if its table wasn't mapped with addTable, in which case gorp
+// writes it without the context.
+func (e *executor) rowFor(ptr interface{}) (*row, error) {
+	value := reflect.ValueOf(ptr)
+	if e.dbmap == nil || value.Kind() != reflect.Ptr {
+		return nil, nil
+	}
+
+	keys, ok := tableKeys.Load(value.Elem().Type())
+	if !ok {
+		return nil, nil
+	}
+
+	table, err := e.dbmap.TableFor(value.Elem().Type(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &row{table: table, elem: value.Elem(), keys: keys.([]string)}, nil
+}
+
+// value returns what gets written to column, converted for the database like gorp does.
+func (e *executor) value(r *row, column string) (interface{}, error) {
+	field, ok := fieldFor(r.elem, column)
+	if !ok {
+		return nil, fmt.Errorf("no field for column %v of table %v", column, r.table.TableName)
+	}
+
+	if e.dbmap.TypeConverter == nil {
+		return field.Interface(), nil
+	}
+	return e.dbmap.TypeConverter.ToDb(field.Interface())
+}
+
+// fieldFor returns the field of elem gorp maps to column, named by its db tag or otherwise its name. The fields
+// of elem come before those of the structs it embeds.
+func fieldFor(elem reflect.Value, column string) (reflect.Value, bool) {
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("db"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if name == column {
+			return elem.Field(i), true
+		}
+	}
+
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if value, ok := fieldFor(elem.Field(i), column); ok {
+				return value, true
+			}
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+// where appends the condition matching the keys of r to query and their values to args.
+func (e *executor) where(r *row, query *strings.Builder, args []interface{}) ([]interface{}, error) {
+	query.WriteString(" where ")
+	for i, key := range r.keys {
+		column := r.table.ColMap(key).ColumnName
+		value, err := e.value(r, column)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			query.WriteString(" and ")
+		}
+		query.WriteString(e.dbmap.Dialect.QuoteField(column) + "=" + e.dbmap.Dialect.BindVar(len(args)))
+		args = append(args, value)
+	}
+	return args, nil
+}
+
+// Insert, Update and Delete write the rows of the tables mapped with addTable with the statements gorp would,
+// run through Exec so that they are bound to the context.
+func (e *executor) Insert(list ...interface{}) error {
+	for _, ptr := range list {
+		r, err := e.rowFor(ptr)
+		if err != nil {
+			return e.check(err)
+		}
+		if r == nil {
+			if err := e.SqlExecutor.Insert(ptr); err != nil {
+				return e.check(err)
+			}
+			continue
+		}
+
+		var columns, binds []string
+		var args []interface{}
+		for _, column := range r.table.Columns {
+			if column.Transient {
+				continue
+			}
+
+			value, err := e.value(r, column.ColumnName)
+			if err != nil {
+				return e.check(err)
+			}
+			columns = append(columns, e.dbmap.Dialect.QuoteField(column.ColumnName))
+			binds = append(binds, e.dbmap.Dialect.BindVar(len(args)))
+			args = append(args, value)
+		}
+
+		query := fmt.Sprintf("insert into %s (%s) values (%s)%s", e.dbmap.Dialect.QuotedTableForQuery(r.table.SchemaName, r.table.TableName),
+			strings.Join(columns, ","), strings.Join(binds, ","), e.dbmap.Dialect.QuerySuffix())
+		if _, err := e.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *executor) Update(list ...interface{}) (int64, error) {
+	var count int64
+	for _, ptr := range list {
+		r, err := e.rowFor(ptr)
+		if err != nil {
+			return -1, e.check(err)
+		}
+		if r == nil {
+			rows, err := e.SqlExecutor.Update(ptr)
+			if err != nil {
+				return -1, e.check(err)
+			}
+			count += rows
+			continue
+		}
+
+		var query strings.Builder
+		var args []interface{}
+		query.WriteString("update " + e.dbmap.Dialect.QuotedTableForQuery(r.table.SchemaName, r.table.TableName) + " set ")
+		for _, column := range r.table.Columns {
+			if column.Transient {
+				continue
+			}
+
+			value, err := e.value(r, column.ColumnName)
+			if err != nil {
+				return -1, e.check(err)
+			}
+			if len(args) > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString(e.dbmap.Dialect.QuoteField(column.ColumnName) + "=" + e.dbmap.Dialect.BindVar(len(args)))
+			args = append(args, value)
+		}
+		if args, err = e.where(r, &query, args); err != nil {
+			return -1, e.check(err)
+		}
+		query.WriteString(e.dbmap.Dialect.QuerySuffix())
+
+		result, err := e.Exec(query.String(), args...)
+		if err != nil {
+			return -1, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return -1, e.check(err)
+		}
+		count += rows
+	}
+	return count, nil
+}
+
+func (e *executor) Delete(list ...interface{}) (int64, error) {
+	var count int64
+	for _, ptr := range list {
+		r, err := e.rowFor(ptr)
+		if err != nil {
+			return -1, e.check(err)
+		}
+		if r == nil {
+			rows, err := e.SqlExecutor.Delete(ptr)
+			if err != nil {
+				return -1, e.check(err)
+			}
+			count += rows
+			continue
+		}
+
+		var query strings.Builder
+		query.WriteString("delete from " + e.dbmap.Dialect.QuotedTableForQuery(r.table.SchemaName, r.table.TableName))
+		args, err := e.where(r, &query, nil)
+		if err != nil {
+			return -1, e.check(err)
+		}
+		query.WriteString(e.dbmap.Dialect.QuerySuffix())
+
+		result, err := e.Exec(query.String(), args...)
+		if err != nil {
+			return -1, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return -1, e.check(err)
+		}
+		count += rows
+	}
+	return count, nil
+}
+
+func (e *executor) Exec(query string, args ...interface{}) (dbsql.Result, error) {
+	result, err := e.SqlExecutor.Exec(query, e.bind(args)...)
+	return result, e.check(err)
+}
+
+func (e *executor) ExecNoTimeout(query string, args ...interface{}) (dbsql.Result, error) {
+	result, err := e.SqlExecutor.ExecNoTimeout(query, e.bind(args)...)
+	return result, e.check(err)
+}
+
+func (e *executor) Select(i interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	list, err := e.SqlExecutor.Select(i, query, e.bind(args)...)
+	return list, e.check(err)
+}
+
+func (e *executor) SelectInt(query string, args ...interface{}) (int64, error) {
+	var failed error
+	value, err := e.SqlExecutor.SelectInt(query, e.bindFailed(args, &failed)...)
+	return value, e.selected(err, failed)
+}
+
+func (e *executor) SelectNullInt(query string, args ...interface{}) (dbsql.NullInt64, error) {
+	var failed error
+	value, err := e.SqlExecutor.SelectNullInt(query, e.bindFailed(args, &failed)...)
+	return value, e.selected(err, failed)
+}
+
+func (e *executor) SelectFloat(query string, args ...interface{}) (float64, error) {
+	var failed error
+	value, err := e.SqlExecutor.SelectFloat(query, e.bindFailed(args, &failed)...)
+	return value, e.selected(err, failed)
+}
+
+func (e *executor) SelectNullFloat(query string, args ...interface{}) (dbsql.NullFloat64, error) {
+	var failed error
+	value, err := e.SqlExecutor.SelectNullFloat(query, e.bindFailed(args, &failed)...)
+	return value, e.selected(err, failed)
+}
+
+func (e *executor) SelectStr(query string, args ...interface{}) (string, error) {
+	var failed error
+	value, err := e.SqlExecutor.SelectStr(query, e.bindFailed(args, &failed)...)
+	return value, e.selected(err, failed)
+}
+
+func (e *executor) SelectNullStr(query string, args ...interface{}) (dbsql.NullString, error) {
+	var failed error
+	value, err := e.SqlExecutor.SelectNullStr(query, e.bindFailed(args, &failed)...)
+	return value, e.selected(err, failed)
+}
+
+func (e *executor) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	var failed error
+	err := e.SqlExecutor.SelectOne(holder, query, e.bindFailed(args, &failed)...)
+	return e.selected(err, failed)
+}
+
+// Query and QueryRow hand the context straight to database/sql. The errors of rows read later aren't checked.
+func (e *executor) Query(query string, args ...interface{}) (*dbsql.Rows, error) {
+	rows, err := e.SqlExecutor.QueryContext(e.ctx, query, args...)
+	return rows, e.check(err)
+}
+
+func (e *executor) QueryRow(query string, args ...interface{}) *dbsql.Row {
+	return e.SqlExecutor.QueryRowContext(e.ctx, query, args...)
+}
@@ -0,0 +1,428 @@
+package sqlstore
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+const (
+	MIGRATIONS_TABLE_NAME = "SchemaMigrations"
+
+	// MIGRATIONS_LOCK_KEY names the advisory lock held while migrating, so that nodes starting together
+	// against the same database don't migrate it twice.
+	MIGRATIONS_LOCK_KEY          = "bonsai_schema_migrations"
+	MIGRATIONS_LOCK_TIMEOUT_SECS = 300
+)
+
+// Migration is one numbered change to the schema. Up and Down hold the statements to run for each driver
+// name. Every driver has an entry, empty when its schema has nothing to change. BeforeDown, when set, prepares
+// the data for the statements of Down, which can't revert the schema without it.
+type Migration struct {
+	Version    int64
+	Name       string
+	Up         map[string][]string
+	Down       map[string][]string
+	BeforeDown func(ss *SqlSupplier) *model.AppError
+}
+
+// migrations is the history of the schema, in version order. CreateTablesIfNotExists always creates the
+// newest schema, so a migration is only run against a database created before it was added. Never change
+// or renumber a migration that has been released, add a new one instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "posts_message_max_size",
+		Up: map[string][]string{
+			model.DATABASE_DRIVER_POSTGRES: {"ALTER TABLE Posts ALTER COLUMN Message TYPE VARCHAR(65535)"},
+			// gorp creates columns of more than 255 characters as TEXT, which already holds 65535 bytes. This
+			// converts a column created any other way.
+			model.DATABASE_DRIVER_MYSQL: {"ALTER TABLE Posts MODIFY Message TEXT"},
+			// SQLite doesn't enforce the length of a VARCHAR.
+			model.DATABASE_DRIVER_SQLITE: {},
+		},
+		Down: map[string][]string{
+			model.DATABASE_DRIVER_POSTGRES: {"ALTER TABLE Posts ALTER COLUMN Message TYPE VARCHAR(4000)"},
+			// TEXT is what gorp created before as well.
+			model.DATABASE_DRIVER_MYSQL:  {},
+			model.DATABASE_DRIVER_SQLITE: {},
+		},
+	},
+	{
+		Version: 2,
+		Name:    "sessions_encrypted_token",
+		Up: map[string][]string{
+			model.DATABASE_DRIVER_POSTGRES: {"ALTER TABLE Sessions ALTER COLUMN Token TYPE VARCHAR(128)"},
+			model.DATABASE_DRIVER_MYSQL:    {"ALTER TABLE Sessions MODIFY Token VARCHAR(128)"},
+			model.DATABASE_DRIVER_SQLITE:   {},
+		},
+		Down: map[string][]string{
+			model.DATABASE_DRIVER_POSTGRES: {"ALTER TABLE Sessions ALTER COLUMN Token TYPE VARCHAR(26)"},
+			model.DATABASE_DRIVER_MYSQL:    {"ALTER TABLE Sessions MODIFY Token VARCHAR(26)"},
+			model.DATABASE_DRIVER_SQLITE:   {},
+		},
+		// An encrypted token doesn't fit the old column, and the servers from before it can't read one.
+		BeforeDown: decryptSessionTokens,
+	},
+}
+
+// decryptSessionTokens stores the session tokens as plaintext again. A server still running with encryption
+// may write an encrypted token before the column shrinks, which then fails rather than truncating it.
+func decryptSessionTokens(ss *SqlSupplier) *model.AppError {
+	column := EncryptedColumn{Table: "Sessions", KeyColumn: "Id", Column: "Token"}
+	_, err := ss.decryptColumn(context.Background(), column, ENCRYPTION_ROTATION_BATCH_SIZE, func(details string, err error) *model.AppError {
+		return model.NewAppError("Migrator.Down", "store.sql_migration.decrypt.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+	})
+	return err
+}
+
+// SchemaMigration is a row of the SchemaMigrations table, and the status of a migration. AppliedAt is
+// zero for a migration that is still pending.
+type SchemaMigration struct {
+	Version   int64
+	Name      string
+	AppliedAt int64
+}
+
+func mapMigrationsTable(db *gorp.DbMap) {
+	table := addTable(db, SchemaMigration{}, MIGRATIONS_TABLE_NAME, "Version")
+	table.ColMap("Name").SetMaxSize(64)
+}
+
+// Migrator applies and reverts the migrations of a database.
+type Migrator struct {
+	supplier   *SqlSupplier
+	migrations []Migration
+}
+
+func NewMigrator(supplier *SqlSupplier) *Migrator {
+	return &Migrator{
+		supplier:   supplier,
+		migrations: migrations,
+	}
+}
+
+// Status lists every migration with the time it was applied, oldest first.
+func (m *Migrator) Status() ([]*SchemaMigration, *model.AppError) {
+	if err := m.createTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := []*SchemaMigration{}
+	for _, migration := range m.migrations {
+		row, ok := applied[migration.Version]
+		if !ok {
+			row = &SchemaMigration{Version: migration.Version, Name: migration.Name}
+		}
+		status = append(status, row)
+		delete(applied, migration.Version)
+	}
+
+	// Versions recorded by a newer build that this one doesn't know about.
+	for _, row := range applied {
+		status = append(status, row)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+
+	return status, nil
+}
+
+// Up applies at most steps pending migrations in version order, or all of them when steps is zero or
+// less, and returns the ones it applied.
+func (m *Migrator) Up(steps int) ([]*SchemaMigration, *model.AppError) {
+	if exists, err := m.supplier.DoesTableExist("Posts"); err != nil {
+		return nil, model.NewAppError("Migrator.Up", "store.sql_migration.get.app_error", nil, err.Error(), http.StatusInternalServerError)
+	} else if !exists {
+		return nil, model.NewAppError("Migrator.Up", "store.sql_migration.no_schema.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	var done []*SchemaMigration
+	err := m.locked(func() *model.AppError {
+		var err *model.AppError
+		done, err = m.up(steps)
+		return err
+	})
+
+	return done, err
+}
+
+// up is Up for a caller holding the migrations lock.
+func (m *Migrator) up(steps int) ([]*SchemaMigration, *model.AppError) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*SchemaMigration
+	for _, migration := range m.migrations {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		row := &SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: model.GetMillis()}
+		if err := m.run("Migrator.Up", migration, migration.Up[m.supplier.DriverName()], row, true); err != nil {
+			return done, err
+		}
+
+		mlog.Info(fmt.Sprintf("Applied schema migration %v %v", migration.Version, migration.Name))
+		done = append(done, row)
+	}
+
+	return done, nil
+}
+
+// Down reverts at most steps applied migrations, newest first, and returns the ones it reverted. Steps of
+// zero or less reverts the newest one.
+func (m *Migrator) Down(steps int) ([]*SchemaMigration, *model.AppError) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	var done []*SchemaMigration
+	err := m.locked(func() *model.AppError {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			row, ok := applied[migration.Version]
+			if !ok {
+				continue
+			}
+
+			if migration.BeforeDown != nil {
+				if err := migration.BeforeDown(m.supplier); err != nil {
+					return err
+				}
+			}
+
+			if err := m.run("Migrator.Down", migration, migration.Down[m.supplier.DriverName()], row, false); err != nil {
+				return err
+			}
+
+			mlog.Info(fmt.Sprintf("Reverted schema migration %v %v", migration.Version, migration.Name))
+			done = append(done, row)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// migrate brings the schema up to date while holding the migrations lock, so that nodes starting together
+// against the same database neither create nor migrate it twice. An existing database has its pending
+// migrations applied before CreateTablesIfNotExists adds the tables it lacks. A new one gets the newest
+// schema from CreateTablesIfNotExists, and every migration is recorded as applied without running it.
+func (m *Migrator) migrate() *model.AppError {
+	return m.locked(func() *model.AppError {
+		// A database without the Posts table is new.
+		exists, err := m.supplier.DoesTableExist("Posts")
+		if err != nil {
+			return model.NewAppError("Migrator.migrate", "store.sql_migration.get.app_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+
+		if exists {
+			if _, err := m.up(0); err != nil {
+				return err
+			}
+		}
+
+		if err := m.supplier.master.CreateTablesIfNotExists(); err != nil {
+			return model.NewAppError("Migrator.migrate", "store.sql_migration.create_tables.app_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+
+		if !exists {
+			return m.baseline()
+		}
+		return nil
+	})
+}
+
+// baseline records every migration as applied without running it. The caller holds the migrations lock.
+func (m *Migrator) baseline() *model.AppError {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	now := model.GetMillis()
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		row := &SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: now}
+		if err := m.supplier.GetMaster().Insert(row); err != nil {
+			return model.NewAppError("Migrator.baseline", "store.sql_migration.save.app_error", nil, "version="+strconv.FormatInt(migration.Version, 10)+", "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) createTable() *model.AppError {
+	table, err := m.supplier.master.TableFor(reflect.TypeOf(SchemaMigration{}), false)
+	if err != nil {
+		return model.NewAppError("Migrator.createTable", "store.sql_migration.create_table.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	if _, err := m.supplier.GetMaster().Exec(table.SqlForCreate(true)); err != nil {
+		return model.NewAppError("Migrator.createTable", "store.sql_migration.create_table.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func (m *Migrator) applied() (map[int64]*SchemaMigration, *model.AppError) {
+	var rows []*SchemaMigration
+	if _, err := m.supplier.GetMaster().Select(&rows, "SELECT * FROM "+MIGRATIONS_TABLE_NAME+" ORDER BY Version"); err != nil {
+		return nil, model.NewAppError("Migrator.applied", "store.sql_migration.get.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	applied := make(map[int64]*SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return applied, nil
+}
+
+// run executes the statements of one migration and records it as applied or reverted. Postgres and SQLite
+// do both in a transaction. MySQL commits each schema change implicitly, so a failure there can leave a
+// migration partially applied and the error says so.
+func (m *Migrator) run(where string, migration Migration, statements []string, row *SchemaMigration, up bool) *model.AppError {
+	details := "version=" + strconv.FormatInt(migration.Version, 10) + ", name=" + migration.Name
+
+	if m.supplier.DriverName() == model.DATABASE_DRIVER_MYSQL {
+		if err := execMigration(m.supplier.GetMaster(), statements); err != nil {
+			return model.NewAppError(where, "store.sql_migration.partial.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+		}
+
+		if err := recordMigration(m.supplier.GetMaster(), row, up); err != nil {
+			return model.NewAppError(where, "store.sql_migration.save.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+		}
+
+		return nil
+	}
+
+	transaction, err := m.supplier.master.Begin()
+	if err != nil {
+		return model.NewAppError(where, "store.sql_migration.open_transaction.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+	}
+
+	if err := execMigration(transaction, statements); err != nil {
+		transaction.Rollback()
+		return model.NewAppError(where, "store.sql_migration.run.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+	}
+
+	if err := recordMigration(transaction, row, up); err != nil {
+		transaction.Rollback()
+		return model.NewAppError(where, "store.sql_migration.save.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return model.NewAppError(where, "store.sql_migration.commit_transaction.app_error", nil, details+", "+err.Error(), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func execMigration(executor gorp.SqlExecutor, statements []string) error {
+	for _, statement := range statements {
+		if _, err := executor.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordMigration(executor gorp.SqlExecutor, row *SchemaMigration, up bool) error {
+	if up {
+		return executor.Insert(row)
+	}
+
+	_, err := executor.Delete(row)
+	return err
+}
+
+// locked creates the SchemaMigrations table and runs f while holding the migrations lock.
+func (m *Migrator) locked(f func() *model.AppError) *model.AppError {
+	if err := m.createTable(); err != nil {
+		return err
+	}
+
+	// SQLite is used through a single connection, which already keeps two migrations from interleaving,
+	// and the database file is locked against other processes while a transaction writes to it.
+	if m.supplier.DriverName() == model.DATABASE_DRIVER_SQLITE {
+		return f()
+	}
+
+	ctx := context.Background()
+	conn, err := m.supplier.master.Db.Conn(ctx)
+	if err != nil {
+		return model.NewAppError("Migrator.lock", "store.sql_migration.lock.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+	defer conn.Close()
+
+	if err := m.lock(ctx, conn); err != nil {
+		return model.NewAppError("Migrator.lock", "store.sql_migration.lock.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	defer func() {
+		if err := m.unlock(ctx, conn); err != nil {
+			mlog.Error(fmt.Sprintf("Failed to release the schema migrations lock err=%v", err))
+		}
+	}()
+
+	return f()
+}
+
+// The advisory locks belong to the session that took them, so both ends run on the same connection.
+func (m *Migrator) lock(ctx context.Context, conn *dbsql.Conn) error {
+	if m.supplier.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", MIGRATIONS_LOCK_KEY)
+		return err
+	}
+
+	var locked dbsql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", MIGRATIONS_LOCK_KEY, MIGRATIONS_LOCK_TIMEOUT_SECS).Scan(&locked); err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("timed out after %v seconds waiting for lock %v", MIGRATIONS_LOCK_TIMEOUT_SECS, MIGRATIONS_LOCK_KEY)
+	}
+
+	return nil
+}
+
+func (m *Migrator) unlock(ctx context.Context, conn *dbsql.Conn) error {
+	if m.supplier.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", MIGRATIONS_LOCK_KEY)
+		return err
+	}
+
+	_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", MIGRATIONS_LOCK_KEY)
+	return err
+}
@@ -0,0 +1,228 @@
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+// testMigrations are numbered after the real migrations, which a new database records as applied.
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1001,
+			Name:    "create_widgets",
+			Up: map[string][]string{
+				model.DATABASE_DRIVER_SQLITE: {"CREATE TABLE Widgets (Id VARCHAR(26) PRIMARY KEY)"},
+			},
+			Down: map[string][]string{
+				model.DATABASE_DRIVER_SQLITE: {"DROP TABLE Widgets"},
+			},
+		},
+		{
+			Version: 1002,
+			Name:    "add_widgets_name",
+			Up: map[string][]string{
+				model.DATABASE_DRIVER_SQLITE: {"ALTER TABLE Widgets ADD COLUMN Name VARCHAR(64)"},
+			},
+			Down: map[string][]string{
+				model.DATABASE_DRIVER_SQLITE: {"ALTER TABLE Widgets DROP COLUMN Name"},
+			},
+		},
+	}
+}
+
+func tableExists(t *testing.T, supplier *SqlSupplier, tableName string) bool {
+	t.Helper()
+
+	exists, err := supplier.DoesTableExist(tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func columnExists(t *testing.T, supplier *SqlSupplier, tableName string, columnName string) bool {
+	t.Helper()
+
+	exists, err := supplier.DoesColumnExist(tableName, columnName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func checkVersions(t *testing.T, migrations []*SchemaMigration, versions ...int64) {
+	t.Helper()
+
+	if len(migrations) != len(versions) {
+		t.Fatalf("expected versions %v, got %v migrations", versions, len(migrations))
+	}
+	for i, migration := range migrations {
+		if migration.Version != versions[i] {
+			t.Fatalf("expected version %v at %v, got %v", versions[i], i, migration.Version)
+		}
+	}
+}
+
+func TestMigratorBaseline(t *testing.T) {
+	supplier := newSqliteSupplier(t)
+
+	status, err := NewMigrator(supplier).Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status) != len(migrations) {
+		t.Fatalf("expected %v migrations, got %v", len(migrations), len(status))
+	}
+	for _, migration := range status {
+		if migration.AppliedAt == 0 {
+			t.Fatalf("migration %v of a new database should be recorded as applied", migration.Version)
+		}
+	}
+
+	applied, err := NewMigrator(supplier).Up(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, applied)
+}
+
+func TestMigratorMigrate(t *testing.T) {
+	supplier := newSqliteSupplier(t)
+	if _, err := supplier.GetMaster().Exec("DROP TABLE Reactions"); err != nil {
+		t.Fatal(err)
+	}
+
+	migrator := &Migrator{supplier: supplier, migrations: append(append([]Migration{}, migrations...), testMigrations()...)}
+	if err := migrator.migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !tableExists(t, supplier, "Widgets") || !columnExists(t, supplier, "Widgets", "Name") {
+		t.Fatal("expected the pending migrations of an existing database to be applied")
+	}
+	if !tableExists(t, supplier, "Reactions") {
+		t.Fatal("expected the missing tables to be created")
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range status {
+		if migration.AppliedAt == 0 {
+			t.Fatalf("migration %v should be applied", migration.Version)
+		}
+	}
+
+	// Nothing is left to do the second time.
+	if err := migrator.migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrationsCoverEveryDriver(t *testing.T) {
+	drivers := []string{model.DATABASE_DRIVER_POSTGRES, model.DATABASE_DRIVER_MYSQL, model.DATABASE_DRIVER_SQLITE}
+	for _, migration := range migrations {
+		for _, driver := range drivers {
+			if _, ok := migration.Up[driver]; !ok {
+				t.Errorf("migration %v has no up entry for %v", migration.Version, driver)
+			}
+			if _, ok := migration.Down[driver]; !ok {
+				t.Errorf("migration %v has no down entry for %v", migration.Version, driver)
+			}
+		}
+	}
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	supplier := newSqliteSupplier(t)
+	migrator := &Migrator{supplier: supplier, migrations: testMigrations()}
+
+	applied, err := migrator.Up(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, applied, 1001)
+	if !tableExists(t, supplier, "Widgets") || columnExists(t, supplier, "Widgets", "Name") {
+		t.Fatal("expected only the first migration to be applied")
+	}
+
+	applied, err = migrator.Up(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, applied, 1002)
+	if !columnExists(t, supplier, "Widgets", "Name") {
+		t.Fatal("expected the second migration to be applied")
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, status[len(migrations):], 1001, 1002)
+	for _, migration := range status {
+		if migration.AppliedAt == 0 {
+			t.Fatalf("migration %v should be applied", migration.Version)
+		}
+	}
+
+	reverted, err := migrator.Down(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, reverted, 1002)
+	if columnExists(t, supplier, "Widgets", "Name") {
+		t.Fatal("expected the second migration to be reverted")
+	}
+
+	reverted, err = migrator.Down(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, reverted, 1001)
+	if tableExists(t, supplier, "Widgets") {
+		t.Fatal("expected the first migration to be reverted")
+	}
+
+	status, err = migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range status[len(migrations):] {
+		if migration.AppliedAt != 0 {
+			t.Fatalf("migration %v should be pending", migration.Version)
+		}
+	}
+}
+
+func TestMigratorRollback(t *testing.T) {
+	supplier := newSqliteSupplier(t)
+	migrations := testMigrations()
+	migrations[1].Up[model.DATABASE_DRIVER_SQLITE] = []string{
+		"ALTER TABLE Widgets ADD COLUMN Name VARCHAR(64)",
+		"ALTER TABLE NoSuchTable ADD COLUMN Name VARCHAR(64)",
+	}
+	migrator := &Migrator{supplier: supplier, migrations: migrations}
+
+	applied, err := migrator.Up(0)
+	if err == nil || err.Id != "store.sql_migration.run.app_error" {
+		t.Fatalf("expected the second migration to fail, got %v", err)
+	}
+	checkVersions(t, applied, 1001)
+
+	if columnExists(t, supplier, "Widgets", "Name") {
+		t.Fatal("expected the failed migration to be rolled back")
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status[len(migrations)].AppliedAt == 0 || status[len(migrations)+1].AppliedAt != 0 {
+		t.Fatal("expected only the first migration to be recorded")
+	}
+}
@@ -0,0 +1,138 @@
+package sqlstore
+
+import (
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+var (
+	sqlstorePackage = reflect.TypeOf(queryObserver{}).PkgPath() + "."
+
+	fingerprintStrings     = regexp.MustCompile(`'(?:[^']|'')*'`)
+	fingerprintNumbers     = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	fingerprintBindvars    = regexp.MustCompile(`\$\d+|:\w+`)
+	fingerprintLists       = regexp.MustCompile(`(?i)\bin\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintWhitespaces = regexp.MustCompile(`\s+`)
+)
+
+// queryObserver reports the statements run on one connection to the metrics and, past the threshold, to the
+// slow query log. With SqlSettings.Trace it logs every statement. The connections of the pool report their
+// statements to it, see openDB.
+type queryObserver struct {
+	connection         string
+	slowQueryThreshold time.Duration
+	trace              bool
+	metrics            einterfaces.MetricsInterface
+}
+
+func newQueryObserver(connection string, settings *model.SqlSettings, metrics einterfaces.MetricsInterface) *queryObserver {
+	return &queryObserver{
+		connection:         connection,
+		slowQueryThreshold: time.Duration(*settings.SlowQueryThresholdMilliseconds) * time.Millisecond,
+		trace:              settings.Trace,
+		metrics:            metrics,
+	}
+}
+
+// ObserveQuery reports a statement that took elapsed to run and read, and affected or returned rows rows.
+func (o *queryObserver) ObserveQuery(query string, elapsed time.Duration, rows int64, err error) {
+	if o.metrics != nil {
+		success := "true"
+		if err != nil {
+			success = "false"
+		}
+		o.metrics.ObserveSqlQueryDuration(o.connection, success, elapsed.Seconds())
+		o.metrics.ObserveSqlQueryRows(o.connection, float64(rows))
+	}
+
+	slow := o.slowQueryThreshold > 0 && elapsed >= o.slowQueryThreshold
+	if !slow && !o.trace {
+		return
+	}
+
+	// Walking the stack for the store method is too costly to do for every statement.
+	method := storeMethod()
+
+	fields := []mlog.Field{
+		mlog.String("connection", o.connection),
+		mlog.String("method", method),
+		mlog.String("fingerprint", QueryFingerprint(query)),
+		mlog.Duration("elapsed", elapsed),
+		mlog.Int64("rows", rows),
+	}
+	if err != nil {
+		fields = append(fields, mlog.Err(err))
+	}
+
+	if slow {
+		if o.metrics != nil {
+			o.metrics.IncrementSqlSlowQuery(o.connection, method)
+		}
+		mlog.Warn("Slow SQL query", fields...)
+	} else {
+		mlog.Info("SQL query", fields...)
+	}
+}
+
+// storeMethod names the function in this package that ran the statement being observed, such as
+// SqlPostStore.Save. The statement reaches the observer through gorp and database/sql, and through the types
+// of this package that run statements for the stores, which are all skipped.
+func storeMethod() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	for {
+		frame, more := frames.Next()
+
+		if strings.HasPrefix(frame.Function, sqlstorePackage) {
+			if name := strings.TrimPrefix(frame.Function, sqlstorePackage); !isPlumbing(name) {
+				return functionName(name)
+			}
+		}
+
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// isPlumbing reports whether the function of this package named name runs statements on behalf of the stores.
+func isPlumbing(name string) bool {
+	for _, prefix := range []string{"(*queryObserver).", "(*executor).", "(*transaction).", "(*conn).", "(*stmt).", "(*rows).", "connector.", "contextArg."} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// functionName turns a function name as the runtime reports it, like (*SqlPostStore).Save.func1, into
+// SqlPostStore.Save.
+func functionName(name string) string {
+	parts := strings.Split(strings.NewReplacer("(*", "", "(", "", ")", "").Replace(name), ".")
+
+	// Closures are named after the function they are in, with a .funcN suffix.
+	if len(parts) > 1 && !strings.HasPrefix(parts[1], "func") {
+		return parts[0] + "." + parts[1]
+	}
+	return parts[0]
+}
+
+// QueryFingerprint normalizes a statement so that the ones differing only in their values look the same:
+// literals and bind variables become ?, lists of them collapse and whitespace and case are made uniform.
+func QueryFingerprint(query string) string {
+	fingerprint := fingerprintStrings.ReplaceAllString(query, "?")
+	fingerprint = fingerprintBindvars.ReplaceAllString(fingerprint, "?")
+	fingerprint = fingerprintNumbers.ReplaceAllString(fingerprint, "?")
+	fingerprint = fingerprintLists.ReplaceAllString(fingerprint, "in (?+)")
+	fingerprint = fingerprintWhitespaces.ReplaceAllString(fingerprint, " ")
+
+	return strings.ToLower(strings.TrimSpace(fingerprint))
+}
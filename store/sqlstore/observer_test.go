@@ -0,0 +1,199 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+// queryMetrics records the SQL metrics it is given and ignores the others.
+type queryMetrics struct {
+	sync.Mutex
+	durations map[string]int
+	rows      map[string]float64
+	slow      map[string]int
+}
+
+func newQueryMetrics() *queryMetrics {
+	return &queryMetrics{
+		durations: make(map[string]int),
+		rows:      make(map[string]float64),
+		slow:      make(map[string]int),
+	}
+}
+
+func (m *queryMetrics) StartServer()                                                       {}
+func (m *queryMetrics) StopServer()                                                        {}
+func (m *queryMetrics) IncrementHttpRequest()                                              {}
+func (m *queryMetrics) IncrementHttpError()                                                {}
+func (m *queryMetrics) IncrementClusterRequest()                                           {}
+func (m *queryMetrics) ObserveClusterRequestDuration(elapsed float64)                      {}
+func (m *queryMetrics) IncrementClusterEventType(eventType string)                         {}
+func (m *queryMetrics) IncrementMemCacheHitCounter(cacheName string)                       {}
+func (m *queryMetrics) IncrementMemCacheMissCounter(cacheName string)                      {}
+func (m *queryMetrics) ObserveStoreMethodDuration(method, success string, elapsed float64) {}
+
+func (m *queryMetrics) ObserveSqlQueryDuration(connection, success string, elapsed float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.durations[connection+" "+success]++
+}
+
+func (m *queryMetrics) ObserveSqlQueryRows(connection string, rows float64) {
+	m.Lock()
+	defer m.Unlock()
+	m.rows[connection] += rows
+}
+
+func (m *queryMetrics) IncrementSqlSlowQuery(connection, method string) {
+	m.Lock()
+	defer m.Unlock()
+	m.slow[connection+" "+method]++
+}
+
+func TestQueryFingerprint(t *testing.T) {
+	tests := []struct {
+		query       string
+		fingerprint string
+	}{
+		{"SELECT * FROM Posts WHERE Id = :Id", "select * from posts where id = ?"},
+		{"SELECT * FROM Posts WHERE Id = $1 AND DeleteAt = 0", "select * from posts where id = ? and deleteat = ?"},
+		{"select * from Posts where Message = 'it''s here'  LIMIT 10", "select * from posts where message = ? limit ?"},
+		{"SELECT * FROM Posts WHERE Id IN (?, ?, ?)", "select * from posts where id in (?+)"},
+		{"SELECT * FROM Posts WHERE Id IN ('a','b')", "select * from posts where id in (?+)"},
+		{"\n\tSELECT\n\t\tCOUNT(*)\n\tFROM Posts2\n", "select count(*) from posts2"},
+		{"UPDATE Posts SET EditAt = 1.5 WHERE Id = ?", "update posts set editat = ? where id = ?"},
+	}
+
+	for _, tc := range tests {
+		if fingerprint := QueryFingerprint(tc.query); fingerprint != tc.fingerprint {
+			t.Errorf("%q: expected %q, got %q", tc.query, tc.fingerprint, fingerprint)
+		}
+	}
+}
+
+func TestFunctionName(t *testing.T) {
+	tests := map[string]string{
+		"(*SqlPostStore).Save.func1":    "SqlPostStore.Save",
+		"(*SqlPostStore).Save":          "SqlPostStore.Save",
+		"SqlSupplier.Next":              "SqlSupplier.Next",
+		"initSqlSupplierRoles":          "initSqlSupplierRoles",
+		"(*SqlSupplier).RoleSave.func1": "SqlSupplier.RoleSave",
+	}
+
+	for name, expected := range tests {
+		if actual := functionName(name); actual != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, actual)
+		}
+	}
+}
+
+func TestQueryObserverStoreMethod(t *testing.T) {
+	var lock sync.Mutex
+	methods := make(map[string]int)
+	info := mlog.Info
+	mlog.Info = func(msg string, fields ...mlog.Field) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, field := range fields {
+			if field.Key == "method" {
+				methods[field.String]++
+			}
+		}
+	}
+	defer func() {
+		mlog.Info = info
+	}()
+
+	settings := newSqliteSettings()
+	settings.Trace = true
+	metrics := newQueryMetrics()
+	supplier, err := NewSqlSupplier(context.Background(), settings, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer supplier.Close()
+
+	post := &model.Post{ChannelId: model.NewId(), UserId: model.NewId(), Message: "observed"}
+	if result := <-supplier.Post().Save(post); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result := <-supplier.Post().GetSingle(post.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if methods["SqlPostStore.Save"] == 0 || methods["SqlPostStore.GetSingle"] == 0 {
+		t.Fatalf("expected the queries of SqlPostStore.Save and GetSingle to be traced, got %v", methods)
+	}
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	if metrics.durations["master true"] == 0 {
+		t.Fatalf("expected the queries to be observed on the master, got %v", metrics.durations)
+	}
+	if metrics.rows["master"] == 0 {
+		t.Fatal("expected the rows inserted and read to be counted")
+	}
+}
+
+func TestQueryObserverSlowQueries(t *testing.T) {
+	var warnings []string
+	var infos []string
+	warn, info := mlog.Warn, mlog.Info
+	mlog.Warn = func(msg string, fields ...mlog.Field) {
+		for _, field := range fields {
+			if field.Key == "fingerprint" {
+				warnings = append(warnings, field.String)
+			}
+		}
+	}
+	mlog.Info = func(msg string, fields ...mlog.Field) {
+		infos = append(infos, msg)
+	}
+	defer func() {
+		mlog.Warn, mlog.Info = warn, info
+	}()
+
+	settings := newSqliteSettings()
+	*settings.SlowQueryThresholdMilliseconds = 100
+	metrics := newQueryMetrics()
+	observer := newQueryObserver("master", &settings, metrics)
+
+	observer.ObserveQuery("SELECT * FROM Posts WHERE Id = ?", 10*time.Millisecond, 1, nil)
+	if len(warnings) != 0 {
+		t.Fatal("should not log queries under the threshold")
+	}
+
+	observer.ObserveQuery("SELECT * FROM Posts WHERE Id = 'abc'", 200*time.Millisecond, 0, errors.New("failure"))
+	if len(warnings) != 1 || warnings[0] != "select * from posts where id = ?" {
+		t.Fatalf("should log the fingerprint of a slow query, got %v", warnings)
+	}
+	if metrics.slow["master TestQueryObserverSlowQueries"] != 1 {
+		t.Fatalf("should count the slow query, got %v", metrics.slow)
+	}
+	if metrics.durations["master false"] != 1 {
+		t.Fatalf("should observe the failed query, got %v", metrics.durations)
+	}
+	if len(infos) != 0 {
+		t.Fatal("should not trace queries unless asked to")
+	}
+
+	*settings.SlowQueryThresholdMilliseconds = 0
+	settings.Trace = true
+	observer = newQueryObserver("replica-0", &settings, nil)
+
+	observer.ObserveQuery("SELECT 1", time.Hour, 1, nil)
+	if len(warnings) != 1 {
+		t.Fatal("should not log slow queries with a threshold of 0")
+	}
+	if len(infos) != 1 {
+		t.Fatalf("should trace every query, got %v", infos)
+	}
+}
@@ -1,35 +1,1226 @@
 package sqlstore
 
 import (
-	"github.com/mattermost/mattermost-server/einterfaces"
-	"github.com/mattermost/mattermost-server/utils"
-	"github.com/mattermost/mattermost-server/model"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+)
+
+const (
+	LAST_POST_TIME_CACHE_NAME = "LastPostTime"
+	LAST_POST_TIME_CACHE_SIZE = 25000
+	LAST_POST_TIME_CACHE_SEC  = 900 // 15 minutes
+
+	LAST_POSTS_CACHE_NAME = "LastPosts"
+	LAST_POSTS_CACHE_SIZE = 1000
+	LAST_POSTS_CACHE_SEC  = 900 // 15 minutes
 )
 
+type SqlPostStore struct {
+	SqlStore
+	ctx               context.Context
+	metrics           einterfaces.MetricsInterface
+	lastPostTimeCache *utils.Cache
+	lastPostsCache    *utils.Cache
+	maxPostSize       *maxPostSize
+}
+
+// maxPostSize is determined once and shared with the stores WithContext returns.
+type maxPostSize struct {
+	once sync.Once
+	size int
+}
+
+func (s *SqlPostStore) ClearCaches() {
+	s.lastPostTimeCache.Purge()
+	s.lastPostsCache.Purge()
+}
+
 func NewSqlPostStore(sqlStore SqlStore, metrics einterfaces.MetricsInterface) store.PostStore {
 	s := &SqlPostStore{
 		SqlStore:          sqlStore,
+		ctx:               context.Background(),
 		metrics:           metrics,
-		lastPostTimeCache: utils.NewLru(LAST_POST_TIME_CACHE_SIZE),
-		lastPostsCache:    utils.NewLru(LAST_POSTS_CACHE_SIZE),
-		maxPostSizeCached: model.POST_MESSAGE_MAX_RUNES_V1,
-	}
-
-	for _, db := range sqlStore.GetAllConns() {
-		table := db.AddTableWithName(model.Post{}, "Posts").SetKeys(false, "Id")
-		table.ColMap("Id").SetMaxSize(26)
-		table.ColMap("UserId").SetMaxSize(26)
-		table.ColMap("ChannelId").SetMaxSize(26)
-		table.ColMap("RootId").SetMaxSize(26)
-		table.ColMap("ParentId").SetMaxSize(26)
-		table.ColMap("OriginalId").SetMaxSize(26)
-		table.ColMap("Message").SetMaxSize(model.POST_MESSAGE_MAX_BYTES_V2)
-		table.ColMap("Type").SetMaxSize(26)
-		table.ColMap("Hashtags").SetMaxSize(1000)
-		table.ColMap("Props").SetMaxSize(8000)
-		table.ColMap("Filenames").SetMaxSize(model.POST_FILENAMES_MAX_RUNES)
-		table.ColMap("FileIds").SetMaxSize(150)
+		lastPostTimeCache: utils.NewLruWithParams(LAST_POST_TIME_CACHE_SIZE, LAST_POST_TIME_CACHE_NAME, LAST_POST_TIME_CACHE_SEC, ""),
+		lastPostsCache:    utils.NewLruWithParams(LAST_POSTS_CACHE_SIZE, LAST_POSTS_CACHE_NAME, LAST_POSTS_CACHE_SEC, ""),
+		maxPostSize:       &maxPostSize{size: model.POST_MESSAGE_MAX_RUNES_V1},
 	}
 
 	return s
 }
+
+func mapPostsTable(db *gorp.DbMap) {
+	table := addTable(db, model.Post{}, "Posts", "Id")
+	table.ColMap("Id").SetMaxSize(26)
+	table.ColMap("UserId").SetMaxSize(26)
+	table.ColMap("ChannelId").SetMaxSize(26)
+	table.ColMap("RootId").SetMaxSize(26)
+	table.ColMap("ParentId").SetMaxSize(26)
+	table.ColMap("OriginalId").SetMaxSize(26)
+	table.ColMap("Message").SetMaxSize(model.POST_MESSAGE_MAX_BYTES_V2)
+	table.ColMap("Type").SetMaxSize(26)
+	table.ColMap("Hashtags").SetMaxSize(1000)
+	table.ColMap("Props").SetMaxSize(8000)
+	table.ColMap("Filenames").SetMaxSize(model.POST_FILENAMES_MAX_RUNES)
+	table.ColMap("FileIds").SetMaxSize(150)
+}
+
+// WithContext returns a copy of the store that shares its caches and runs its queries in ctx.
+func (s *SqlPostStore) WithContext(ctx context.Context) store.PostStore {
+	return s.withSqlStore(s.SqlStore, ctx)
+}
+
+// withSqlStore returns a copy of the store that shares its caches and runs its queries on sqlStore in ctx.
+func (s *SqlPostStore) withSqlStore(sqlStore SqlStore, ctx context.Context) *SqlPostStore {
+	return &SqlPostStore{
+		SqlStore:          sqlStore,
+		ctx:               ctx,
+		metrics:           s.metrics,
+		lastPostTimeCache: s.lastPostTimeCache,
+		lastPostsCache:    s.lastPostsCache,
+		maxPostSize:       s.maxPostSize,
+	}
+}
+
+// GetMaster, GetReplica and GetSearchReplica return connections whose queries run in the context of the store.
+func (s *SqlPostStore) GetMaster() gorp.SqlExecutor {
+	return withContext(s.SqlStore.GetMaster(), s.ctx)
+}
+
+func (s *SqlPostStore) GetReplica() gorp.SqlExecutor {
+	return withContext(s.SqlStore.GetReplica(), s.ctx)
+}
+
+func (s *SqlPostStore) GetSearchReplica() gorp.SqlExecutor {
+	return withContext(s.SqlStore.GetSearchReplica(), s.ctx)
+}
+
+func (s *SqlPostStore) CreateIndexesIfNotExists() error {
+	if _, err := s.CreateIndexIfNotExists("idx_posts_update_at", "Posts", "UpdateAt"); err != nil {
+		return err
+	}
+	if _, err := s.CreateIndexIfNotExists("idx_posts_create_at", "Posts", "CreateAt"); err != nil {
+		return err
+	}
+	if _, err := s.CreateIndexIfNotExists("idx_posts_delete_at", "Posts", "DeleteAt"); err != nil {
+		return err
+	}
+	if _, err := s.CreateIndexIfNotExists("idx_posts_channel_id", "Posts", "ChannelId"); err != nil {
+		return err
+	}
+	if _, err := s.CreateIndexIfNotExists("idx_posts_root_id", "Posts", "RootId"); err != nil {
+		return err
+	}
+	if _, err := s.CreateIndexIfNotExists("idx_posts_user_id", "Posts", "UserId"); err != nil {
+		return err
+	}
+	if _, err := s.CreateIndexIfNotExists("idx_posts_is_pinned", "Posts", "IsPinned"); err != nil {
+		return err
+	}
+
+	if _, err := s.CreateCompositeIndexIfNotExists("idx_posts_channel_id_update_at", "Posts", []string{"ChannelId", "UpdateAt"}); err != nil {
+		return err
+	}
+	if _, err := s.CreateCompositeIndexIfNotExists("idx_posts_channel_id_delete_at_create_at", "Posts", []string{"ChannelId", "DeleteAt", "CreateAt"}); err != nil {
+		return err
+	}
+
+	if _, err := s.CreateFullTextIndexIfNotExists("idx_posts_message_txt", "Posts", "Message"); err != nil {
+		return err
+	}
+	if _, err := s.CreateFullTextIndexIfNotExists("idx_posts_hashtags_txt", "Posts", "Hashtags"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SqlPostStore) Save(post *model.Post) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		if len(post.Id) > 0 {
+			result.Err = model.NewAppError("SqlPostStore.Save", "store.sql_post.save.existing.app_error", nil, "id="+post.Id, http.StatusBadRequest)
+			return
+		}
+
+		maxPostSize := (<-s.GetMaxPostSize()).Data.(int)
+
+		post.PreSave()
+		if result.Err = post.IsValid(maxPostSize); result.Err != nil {
+			return
+		}
+
+		if err := s.GetMaster().Insert(post); err != nil {
+			result.Err = model.NewAppError("SqlPostStore.Save", "store.sql_post.save.app_error", nil, "id="+post.Id+", "+err.Error(), http.StatusInternalServerError)
+		} else {
+			if len(post.RootId) > 0 {
+				s.GetMaster().Exec("UPDATE Posts SET UpdateAt = :UpdateAt WHERE Id = :RootId", map[string]interface{}{"UpdateAt": post.UpdateAt, "RootId": post.RootId})
+			}
+
+			result.Data = post
+		}
+	})
+}
+
+func (s *SqlPostStore) Update(newPost *model.Post, oldPost *model.Post) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		newPost.UpdateAt = model.GetMillis()
+		newPost.PreCommit()
+
+		oldPost.DeleteAt = newPost.UpdateAt
+		oldPost.UpdateAt = newPost.UpdateAt
+		oldPost.Id = model.NewId()
+		oldPost.PreCommit()
+
+		maxPostSize := (<-s.GetMaxPostSize()).Data.(int)
+
+		if result.Err = newPost.IsValid(maxPostSize); result.Err != nil {
+			return
+		}
+
+		if _, err := s.GetMaster().Update(newPost); err != nil {
+			result.Err = model.NewAppError("SqlPostStore.Update", "store.sql_post.update.app_error", nil, "id="+newPost.Id+", "+err.Error(), http.StatusInternalServerError)
+		} else {
+			if len(newPost.RootId) > 0 {
+				s.GetMaster().Exec("UPDATE Posts SET UpdateAt = :UpdateAt WHERE Id = :RootId AND UpdateAt < :UpdateAt", map[string]interface{}{"UpdateAt": newPost.UpdateAt, "RootId": newPost.RootId})
+			}
+
+			// mark the old post as deleted
+			s.GetMaster().Insert(oldPost)
+
+			result.Data = newPost
+		}
+	})
+}
+
+func (s *SqlPostStore) Overwrite(post *model.Post) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		post.UpdateAt = model.GetMillis()
+
+		maxPostSize := (<-s.GetMaxPostSize()).Data.(int)
+
+		if result.Err = post.IsValid(maxPostSize); result.Err != nil {
+			return
+		}
+
+		if _, err := s.GetMaster().Update(post); err != nil {
+			result.Err = model.NewAppError("SqlPostStore.Overwrite", "store.sql_post.overwrite.app_error", nil, "id="+post.Id+", "+err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = post
+		}
+	})
+}
+
+func (s *SqlPostStore) Get(id string) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		pl := model.NewPostList()
+
+		if len(id) == 0 {
+			result.Err = model.NewAppError("SqlPostStore.GetPost", "store.sql_post.get.app_error", nil, "id="+id, http.StatusBadRequest)
+			return
+		}
+
+		var post model.Post
+		err := s.GetReplica().SelectOne(&post, "SELECT * FROM Posts WHERE Id = :Id AND DeleteAt = 0", map[string]interface{}{"Id": id})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetPost", "store.sql_post.get.app_error", nil, "id="+id+err.Error(), http.StatusNotFound)
+			return
+		}
+
+		pl.AddPost(&post)
+		pl.AddOrder(id)
+
+		rootId := post.RootId
+
+		if rootId == "" {
+			rootId = post.Id
+		}
+
+		var posts []*model.Post
+		_, err = s.GetReplica().Select(&posts, "SELECT * FROM Posts WHERE (Id = :Id OR RootId = :RootId) AND DeleteAt = 0", map[string]interface{}{"Id": rootId, "RootId": rootId})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetPost", "store.sql_post.get.app_error", nil, "root_id="+rootId+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, p := range posts {
+			pl.AddPost(p)
+		}
+
+		result.Data = pl
+	})
+}
+
+func (s *SqlPostStore) GetSingle(id string) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		var post model.Post
+		err := s.GetReplica().SelectOne(&post, "SELECT * FROM Posts WHERE Id = :Id AND DeleteAt = 0", map[string]interface{}{"Id": id})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetSingle", "store.sql_post.get.app_error", nil, "id="+id+err.Error(), http.StatusNotFound)
+		}
+
+		result.Data = &post
+	})
+}
+
+type etagPosts struct {
+	Id       string
+	UpdateAt int64
+}
+
+func (s *SqlPostStore) InvalidateLastPostTimeCache(channelId string) {
+	s.lastPostTimeCache.Remove(channelId)
+	s.lastPostsCache.Remove(channelId)
+}
+
+func (s *SqlPostStore) GetEtag(channelId string, allowFromCache bool) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		if allowFromCache {
+			if cacheItem, ok := s.lastPostTimeCache.Get(channelId); ok {
+				if s.metrics != nil {
+					s.metrics.IncrementMemCacheHitCounter(LAST_POST_TIME_CACHE_NAME)
+				}
+				result.Data = model.Etag(cacheItem.(int64))
+				return
+			} else {
+				if s.metrics != nil {
+					s.metrics.IncrementMemCacheMissCounter(LAST_POST_TIME_CACHE_NAME)
+				}
+			}
+		} else {
+			if s.metrics != nil {
+				s.metrics.IncrementMemCacheMissCounter(LAST_POST_TIME_CACHE_NAME)
+			}
+		}
+
+		var et etagPosts
+		err := s.GetReplica().SelectOne(&et, "SELECT Id, UpdateAt FROM Posts WHERE ChannelId = :ChannelId ORDER BY UpdateAt DESC LIMIT 1", map[string]interface{}{"ChannelId": channelId})
+		if err != nil {
+			result.Data = model.Etag(model.GetMillis())
+		} else {
+			result.Data = model.Etag(et.UpdateAt)
+		}
+
+		s.lastPostTimeCache.AddWithExpiresInSecs(channelId, et.UpdateAt, LAST_POST_TIME_CACHE_SEC)
+	})
+}
+
+func (s *SqlPostStore) Delete(postId string, time int64, deleteByID string) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+
+		appErr := func(errMsg string) *model.AppError {
+			return model.NewAppError("SqlPostStore.Delete", "store.sql_post.delete.app_error", nil, "id="+postId+", err="+errMsg, http.StatusInternalServerError)
+		}
+
+		var post model.Post
+		err := s.GetReplica().SelectOne(&post, "SELECT * FROM Posts WHERE Id = :Id AND DeleteAt = 0", map[string]interface{}{"Id": postId})
+		if err != nil {
+			result.Err = appErr(err.Error())
+			return
+		}
+
+		post.AddProp(model.POST_PROPS_DELETE_BY, deleteByID)
+
+		_, err = s.GetMaster().Exec("UPDATE Posts SET DeleteAt = :DeleteAt, UpdateAt = :UpdateAt, Props = :Props WHERE Id = :Id", map[string]interface{}{"DeleteAt": time, "UpdateAt": time, "Id": postId, "Props": model.StringInterfaceToJson(post.Props)})
+		if err != nil {
+			result.Err = appErr(err.Error())
+			return
+		}
+
+		// the replies go with the post they belong to
+		_, err = s.GetMaster().Exec("UPDATE Posts SET DeleteAt = :DeleteAt, UpdateAt = :UpdateAt WHERE RootId = :RootId", map[string]interface{}{"DeleteAt": time, "UpdateAt": time, "RootId": postId})
+		if err != nil {
+			result.Err = appErr(err.Error())
+		}
+	})
+}
+
+func (s *SqlPostStore) permanentDelete(postId string) *model.AppError {
+	_, err := s.GetMaster().Exec("DELETE FROM Posts WHERE Id = :Id OR RootId = :RootId", map[string]interface{}{"Id": postId, "RootId": postId})
+	if err != nil {
+		return model.NewAppError("SqlPostStore.Delete", "store.sql_post.permanent_delete.app_error", nil, "id="+postId+", err="+err.Error(), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func (s *SqlPostStore) permanentDeleteAllCommentByUser(userId string) *model.AppError {
+	_, err := s.GetMaster().Exec("DELETE FROM Posts WHERE UserId = :UserId AND RootId != ''", map[string]interface{}{"UserId": userId})
+	if err != nil {
+		return model.NewAppError("SqlPostStore.permanentDeleteAllCommentByUser", "store.sql_post.permanent_delete_all_comments_by_user.app_error", nil, "userId="+userId+", err="+err.Error(), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func (s *SqlPostStore) PermanentDeleteByUser(userId string) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		// First attempt to delete all the comments for a user
+		if err := s.permanentDeleteAllCommentByUser(userId); err != nil {
+			result.Err = err
+			return
+		}
+
+		// Now attempt to delete all the root posts for a user. This will also
+		// delete all the comments for each post.
+		found := true
+		count := 0
+
+		for found {
+			var ids []string
+			_, err := s.GetMaster().Select(&ids, "SELECT Id FROM Posts WHERE UserId = :UserId LIMIT 1000", map[string]interface{}{"UserId": userId})
+			if err != nil {
+				result.Err = model.NewAppError("SqlPostStore.PermanentDeleteByUser.select", "store.sql_post.permanent_delete_by_user.app_error", nil, "userId="+userId+", err="+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			found = false
+			for _, id := range ids {
+				found = true
+				if err := s.permanentDelete(id); err != nil {
+					result.Err = err
+					return
+				}
+			}
+
+			// This is a fail safe, give up if more than 10k messages
+			count++
+			if count >= 10 {
+				result.Err = model.NewAppError("SqlPostStore.PermanentDeleteByUser.toolarge", "store.sql_post.permanent_delete_by_user.too_many.app_error", nil, "userId="+userId, http.StatusInternalServerError)
+				return
+			}
+		}
+	})
+}
+
+func (s *SqlPostStore) PermanentDeleteByChannel(channelId string) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		if _, err := s.GetMaster().Exec("DELETE FROM Posts WHERE ChannelId = :ChannelId", map[string]interface{}{"ChannelId": channelId}); err != nil {
+			result.Err = model.NewAppError("SqlPostStore.PermanentDeleteByChannel", "store.sql_post.permanent_delete_by_channel.app_error", nil, "channel_id="+channelId+", "+err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (s *SqlPostStore) GetPosts(channelId string, offset int, limit int, allowFromCache bool) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		if limit > 1000 {
+			result.Err = model.NewAppError("SqlPostStore.GetLinearPosts", "store.sql_post.get_posts.app_error", nil, "channelId="+channelId, http.StatusBadRequest)
+			return
+		}
+
+		if allowFromCache && offset == 0 && limit == 60 {
+			if cacheItem, ok := s.lastPostsCache.Get(channelId); ok {
+				if s.metrics != nil {
+					s.metrics.IncrementMemCacheHitCounter(LAST_POSTS_CACHE_NAME)
+				}
+
+				result.Data = cacheItem.(*model.PostList)
+				return
+			}
+		}
+
+		if s.metrics != nil {
+			s.metrics.IncrementMemCacheMissCounter(LAST_POSTS_CACHE_NAME)
+		}
+
+		rpc := s.getRootPosts(channelId, offset, limit)
+		cpc := s.getParentsPosts(channelId, offset, limit)
+
+		var err *model.AppError
+		list := model.NewPostList()
+
+		rpr := <-rpc
+		if rpr.Err != nil {
+			err = rpr.Err
+		}
+
+		cpr := <-cpc
+		if cpr.Err != nil {
+			err = cpr.Err
+		}
+
+		if err != nil {
+			result.Err = err
+			return
+		}
+
+		posts := rpr.Data.([]*model.Post)
+		parents := cpr.Data.([]*model.Post)
+
+		for _, p := range posts {
+			list.AddPost(p)
+			list.AddOrder(p.Id)
+		}
+
+		for _, p := range parents {
+			list.AddPost(p)
+		}
+
+		list.MakeNonNil()
+
+		// Only cache the first page of the default page size, which is what clients ask for when opening a channel
+		if offset == 0 && limit == 60 {
+			s.lastPostsCache.AddWithExpiresInSecs(channelId, list, LAST_POSTS_CACHE_SEC)
+		}
+
+		result.Data = list
+	})
+}
+
+func (s *SqlPostStore) GetPostsSince(channelId string, time int64, allowFromCache bool) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		if allowFromCache {
+			// If the last post in the channel's time is less than or equal to the time we are getting posts since,
+			// we can safely return no posts.
+			if cacheItem, ok := s.lastPostTimeCache.Get(channelId); ok && cacheItem.(int64) <= time {
+				if s.metrics != nil {
+					s.metrics.IncrementMemCacheHitCounter(LAST_POST_TIME_CACHE_NAME)
+				}
+				list := model.NewPostList()
+				result.Data = list
+				return
+			}
+		}
+
+		if s.metrics != nil {
+			s.metrics.IncrementMemCacheMissCounter(LAST_POST_TIME_CACHE_NAME)
+		}
+
+		var posts []*model.Post
+		_, err := s.GetReplica().Select(&posts,
+			`SELECT
+			    *
+			FROM
+			    Posts
+			WHERE
+			    (UpdateAt > :Time AND ChannelId = :ChannelId)
+			        OR Id IN (SELECT RootId FROM Posts WHERE UpdateAt > :Time AND ChannelId = :ChannelId)
+			ORDER BY CreateAt DESC
+			LIMIT 1000`,
+			map[string]interface{}{"ChannelId": channelId, "Time": time})
+
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetPostsSince", "store.sql_post.get_posts_since.app_error", nil, "channelId="+channelId+err.Error(), http.StatusInternalServerError)
+		} else {
+
+			list := model.NewPostList()
+
+			var latestUpdate int64 = 0
+
+			for _, p := range posts {
+				list.AddPost(p)
+				if p.UpdateAt > time {
+					list.AddOrder(p.Id)
+				}
+				if latestUpdate < p.UpdateAt {
+					latestUpdate = p.UpdateAt
+				}
+			}
+
+			s.lastPostTimeCache.AddWithExpiresInSecs(channelId, latestUpdate, LAST_POST_TIME_CACHE_SEC)
+
+			result.Data = list
+		}
+	})
+}
+
+func (s *SqlPostStore) GetPostsBefore(channelId string, postId string, numPosts int, offset int) store.StoreChannel {
+	return s.getPostsAround(channelId, postId, numPosts, offset, true)
+}
+
+func (s *SqlPostStore) GetPostsAfter(channelId string, postId string, numPosts int, offset int) store.StoreChannel {
+	return s.getPostsAround(channelId, postId, numPosts, offset, false)
+}
+
+func (s *SqlPostStore) getPostsAround(channelId string, postId string, numPosts int, offset int, before bool) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		var direction string
+		var sort string
+		if before {
+			direction = "<"
+			sort = "DESC"
+		} else {
+			direction = ">"
+			sort = "ASC"
+		}
+
+		var posts []*model.Post
+		var parents []*model.Post
+		_, err1 := s.GetReplica().Select(&posts,
+			`SELECT
+			    *
+			FROM
+			    Posts
+			WHERE
+				CreateAt `+direction+` (SELECT CreateAt FROM Posts WHERE Id = :PostId)
+			        AND ChannelId = :ChannelId
+					AND DeleteAt = 0
+			ORDER BY CreateAt `+sort+`
+			LIMIT :NumPosts
+			OFFSET :Offset`,
+			map[string]interface{}{"ChannelId": channelId, "PostId": postId, "NumPosts": numPosts, "Offset": offset})
+		_, err2 := s.GetReplica().Select(&parents,
+			`SELECT
+			    q2.*
+			FROM
+			    Posts q2
+			        INNER JOIN
+			    (SELECT DISTINCT
+			        q3.RootId
+			    FROM
+			        (SELECT
+			            RootId
+			        FROM
+			            Posts
+			        WHERE
+						CreateAt `+direction+` (SELECT CreateAt FROM Posts WHERE Id = :PostId)
+			                AND ChannelId = :ChannelId
+							AND DeleteAt = 0
+						ORDER BY CreateAt `+sort+`
+						LIMIT :NumPosts
+						OFFSET :Offset) q3
+			    WHERE q3.RootId != '') q1 ON q1.RootId = q2.Id OR q1.RootId = q2.RootId
+			WHERE
+			    ChannelId = :ChannelId
+			        AND DeleteAt = 0
+			ORDER BY CreateAt DESC`,
+			map[string]interface{}{"ChannelId": channelId, "PostId": postId, "NumPosts": numPosts, "Offset": offset})
+
+		if err1 != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetPostContext", "store.sql_post.get_posts_around.get.app_error", nil, "channelId="+channelId+err1.Error(), http.StatusInternalServerError)
+		} else if err2 != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetPostContext", "store.sql_post.get_posts_around.get_parent.app_error", nil, "channelId="+channelId+err2.Error(), http.StatusInternalServerError)
+		} else {
+
+			list := model.NewPostList()
+
+			// We need to flip the order if we selected backwards
+			if before {
+				for _, p := range posts {
+					list.AddPost(p)
+					list.AddOrder(p.Id)
+				}
+			} else {
+				l := len(posts)
+				for i := range posts {
+					list.AddPost(posts[l-i-1])
+					list.AddOrder(posts[l-i-1].Id)
+				}
+			}
+
+			for _, p := range parents {
+				list.AddPost(p)
+			}
+
+			result.Data = list
+		}
+	})
+}
+
+func (s *SqlPostStore) getRootPosts(channelId string, offset int, limit int) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		var posts []*model.Post
+		_, err := s.GetReplica().Select(&posts, "SELECT * FROM Posts WHERE ChannelId = :ChannelId AND DeleteAt = 0 ORDER BY CreateAt DESC LIMIT :Limit OFFSET :Offset", map[string]interface{}{"ChannelId": channelId, "Offset": offset, "Limit": limit})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetLinearPosts", "store.sql_post.get_root_posts.app_error", nil, "channelId="+channelId+err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = posts
+		}
+	})
+}
+
+func (s *SqlPostStore) getParentsPosts(channelId string, offset int, limit int) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		var posts []*model.Post
+		_, err := s.GetReplica().Select(&posts,
+			`SELECT
+			    q2.*
+			FROM
+			    Posts q2
+			        INNER JOIN
+			    (SELECT DISTINCT
+			        q3.RootId
+			    FROM
+			        (SELECT
+			            RootId
+			        FROM
+			            Posts
+			        WHERE
+			            ChannelId = :ChannelId1
+			                AND DeleteAt = 0
+			        ORDER BY CreateAt DESC
+			        LIMIT :Limit OFFSET :Offset) q3
+			    WHERE q3.RootId != '') q1 ON q1.RootId = q2.Id OR q1.RootId = q2.RootId
+			WHERE
+			    ChannelId = :ChannelId2
+			        AND DeleteAt = 0
+			ORDER BY CreateAt`,
+			map[string]interface{}{"ChannelId1": channelId, "Offset": offset, "Limit": limit, "ChannelId2": channelId})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetLinearPosts", "store.sql_post.get_parents_posts.app_error", nil, "channelId="+channelId+" err="+err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = posts
+		}
+	})
+}
+
+var specialSearchChar = []string{
+	"<",
+	">",
+	"+",
+	"-",
+	"(",
+	")",
+	"~",
+	"@",
+	":",
+}
+
+// sqliteFullTextTerms turns search terms into an FTS5 query. Each term is quoted so that it can't be read as
+// query syntax, keeping a trailing * as a prefix search.
+func sqliteFullTextTerms(terms string, orTerms bool) string {
+	var quoted []string
+	for _, term := range strings.Fields(terms) {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.Replace(strings.TrimRight(term, "*"), `"`, `""`, -1)
+		if term == "" {
+			continue
+		}
+
+		if prefix {
+			quoted = append(quoted, `"`+term+`"*`)
+		} else {
+			quoted = append(quoted, `"`+term+`"`)
+		}
+	}
+
+	if orTerms {
+		return strings.Join(quoted, " OR ")
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// sqliteLikeTerms matches search terms with LIKE, for SQLite builds without FTS5. Each term has to match a whole
+// word of column, or the start of one when it ends with *.
+func sqliteLikeTerms(column string, terms string, orTerms bool) (string, map[string]interface{}) {
+	escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+	var clauses []string
+	params := map[string]interface{}{}
+	for _, term := range strings.Fields(terms) {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.Trim(strings.TrimRight(term, "*"), `"`)
+		if term == "" {
+			continue
+		}
+
+		pattern := "% " + escaper.Replace(term) + " %"
+		if prefix {
+			pattern = "% " + escaper.Replace(term) + "%"
+		}
+
+		key := fmt.Sprintf("LikeTerm%v", len(clauses))
+		params[key] = pattern
+		clauses = append(clauses, fmt.Sprintf("(' ' || %s || ' ') LIKE :%s ESCAPE '\\'", column, key))
+	}
+
+	if len(clauses) == 0 {
+		return "AND 0 = 1", params
+	}
+
+	if orTerms {
+		return "AND (" + strings.Join(clauses, " OR ") + ")", params
+	}
+
+	return "AND " + strings.Join(clauses, " AND "), params
+}
+
+func (s *SqlPostStore) Search(params *model.SearchParams) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		queryParams := map[string]interface{}{}
+
+		termMap := map[string]bool{}
+		terms := params.Terms
+
+		if terms == "" && len(params.InChannels) == 0 && len(params.FromUsers) == 0 && len(params.OnDate) == 0 && len(params.AfterDate) == 0 && len(params.BeforeDate) == 0 {
+			result.Data = model.NewPostList()
+			return
+		}
+
+		searchType := "Message"
+		if params.IsHashtag {
+			searchType = "Hashtags"
+			for _, term := range strings.Split(terms, " ") {
+				termMap[strings.ToUpper(term)] = true
+			}
+		}
+
+		// these chars have special meaning and can be treated as spaces
+		for _, c := range specialSearchChar {
+			terms = strings.Replace(terms, c, " ", -1)
+		}
+
+		var posts []*model.Post
+
+		searchQuery := `
+			SELECT
+				*
+			FROM
+				Posts
+			WHERE
+				DeleteAt = 0
+				AND Type NOT LIKE '` + model.POST_SYSTEM_MESSAGE_PREFIX + `%'
+				POST_FILTER
+				SEARCH_CLAUSE
+				ORDER BY CreateAt DESC
+			LIMIT 100`
+
+		postFilter := ""
+
+		if len(params.InChannels) > 0 {
+			keys, inParams := MapStringsToQueryParams(params.InChannels, "InChannel")
+			postFilter += " AND ChannelId IN " + keys
+			for key, value := range inParams {
+				queryParams[key] = value
+			}
+		}
+
+		if len(params.ExcludedChannels) > 0 {
+			keys, inParams := MapStringsToQueryParams(params.ExcludedChannels, "ExcludedChannel")
+			postFilter += " AND ChannelId NOT IN " + keys
+			for key, value := range inParams {
+				queryParams[key] = value
+			}
+		}
+
+		if len(params.FromUsers) > 0 {
+			keys, inParams := MapStringsToQueryParams(params.FromUsers, "FromUser")
+			postFilter += " AND UserId IN (SELECT Id FROM Users WHERE Username IN " + keys + ")"
+			for key, value := range inParams {
+				queryParams[key] = value
+			}
+		}
+
+		if len(params.ExcludedUsers) > 0 {
+			keys, inParams := MapStringsToQueryParams(params.ExcludedUsers, "ExcludedUser")
+			postFilter += " AND UserId NOT IN (SELECT Id FROM Users WHERE Username IN " + keys + ")"
+			for key, value := range inParams {
+				queryParams[key] = value
+			}
+		}
+
+		// handle after: before: on: filters
+		if len(params.OnDate) > 0 {
+			onDateStart, onDateEnd := params.GetOnDateMillis()
+			queryParams["OnDateStart"] = onDateStart
+			queryParams["OnDateEnd"] = onDateEnd
+
+			// between `on date` start of day and end of day
+			postFilter += " AND CreateAt BETWEEN :OnDateStart AND :OnDateEnd "
+		} else {
+			if len(params.AfterDate) > 0 {
+				queryParams["AfterDate"] = params.GetAfterDateMillis()
+
+				// greater than `after date`
+				postFilter += " AND CreateAt >= :AfterDate "
+			}
+
+			if len(params.BeforeDate) > 0 {
+				queryParams["BeforeDate"] = params.GetBeforeDateMillis()
+
+				// less than `before date`
+				postFilter += " AND CreateAt <= :BeforeDate "
+			}
+		}
+
+		searchQuery = strings.Replace(searchQuery, "POST_FILTER", postFilter, 1)
+
+		if terms == "" {
+			// we've already confirmed that we have a channel or user to search for
+			searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", "", 1)
+		} else if s.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+			// Parse text for wildcards
+			if wildcard, err := regexp.Compile(`\*($| )`); err == nil {
+				terms = wildcard.ReplaceAllLiteralString(terms, ":* ")
+			}
+
+			if params.OrTerms {
+				terms = strings.Join(strings.Fields(terms), " | ")
+			} else {
+				terms = strings.Join(strings.Fields(terms), " & ")
+			}
+
+			searchClause := fmt.Sprintf("AND to_tsvector('english', %s) @@  to_tsquery('english', :Terms)", searchType)
+			searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", searchClause, 1)
+		} else if s.DriverName() == model.DATABASE_DRIVER_MYSQL {
+			searchClause := fmt.Sprintf("AND MATCH (%s) AGAINST (:Terms IN BOOLEAN MODE)", searchType)
+			searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", searchClause, 1)
+
+			if !params.OrTerms {
+				splitTerms := strings.Fields(terms)
+				for i, t := range strings.Fields(terms) {
+					splitTerms[i] = "+" + t
+				}
+
+				terms = strings.Join(splitTerms, " ")
+			}
+		} else if s.DriverName() == model.DATABASE_DRIVER_SQLITE {
+			fullTextTable := "idx_posts_message_txt"
+			if searchType == "Hashtags" {
+				fullTextTable = "idx_posts_hashtags_txt"
+			}
+
+			if sqliteFullTextAvailable() {
+				searchClause := fmt.Sprintf("AND Id IN (SELECT Id FROM %s WHERE %s MATCH :Terms)", fullTextTable, fullTextTable)
+				searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", searchClause, 1)
+
+				terms = sqliteFullTextTerms(terms, params.OrTerms)
+			} else {
+				searchClause, likeParams := sqliteLikeTerms(searchType, terms, params.OrTerms)
+				searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", searchClause, 1)
+				for key, value := range likeParams {
+					queryParams[key] = value
+				}
+			}
+		}
+
+		queryParams["Terms"] = terms
+
+		list := model.NewPostList()
+
+		_, err := s.GetSearchReplica().Select(&posts, searchQuery, queryParams)
+		if err != nil {
+			mlog.Warn(fmt.Sprintf("Query error searching posts: %v", err.Error()))
+			// Don't return the error to the caller as it is of no use to the user. Instead return an empty set of search results.
+		} else {
+			for _, p := range posts {
+				if searchType == "Hashtags" {
+					exactMatch := false
+					for _, tag := range strings.Split(p.Hashtags, " ") {
+						if termMap[strings.ToUpper(tag)] {
+							exactMatch = true
+						}
+					}
+					if !exactMatch {
+						continue
+					}
+				}
+				list.AddPost(p)
+				list.AddOrder(p.Id)
+			}
+		}
+
+		list.MakeNonNil()
+
+		result.Data = list
+	})
+}
+
+// analyticsWindow returns the last 31 full days, ending yesterday.
+func analyticsWindow() (int64, int64) {
+	yesterday := time.Now().AddDate(0, 0, -1)
+
+	end := model.GetEndOfDayMillis(yesterday, 0)
+	start := model.GetStartOfDayMillis(yesterday.AddDate(0, 0, -31), 0)
+
+	return start, end
+}
+
+func (s *SqlPostStore) AnalyticsUserCountsWithPostsByDay() store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		query :=
+			`SELECT DISTINCT
+			        DATE(FROM_UNIXTIME(Posts.CreateAt / 1000)) AS Name,
+			        COUNT(DISTINCT Posts.UserId) AS Value
+			FROM Posts
+			WHERE Posts.CreateAt >= :StartTime AND Posts.CreateAt <= :EndTime
+			GROUP BY DATE(FROM_UNIXTIME(Posts.CreateAt / 1000))
+			ORDER BY Name DESC
+			LIMIT 30`
+
+		if s.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+			query =
+				`SELECT
+					TO_CHAR(DATE(TO_TIMESTAMP(Posts.CreateAt / 1000)), 'YYYY-MM-DD') AS Name, COUNT(DISTINCT Posts.UserId) AS Value
+				FROM Posts
+				WHERE Posts.CreateAt >= :StartTime AND Posts.CreateAt <= :EndTime
+				GROUP BY DATE(TO_TIMESTAMP(Posts.CreateAt / 1000))
+				ORDER BY Name DESC
+				LIMIT 30`
+		} else if s.DriverName() == model.DATABASE_DRIVER_SQLITE {
+			query =
+				`SELECT
+					DATE(Posts.CreateAt / 1000, 'unixepoch') AS Name, COUNT(DISTINCT Posts.UserId) AS Value
+				FROM Posts
+				WHERE Posts.CreateAt >= :StartTime AND Posts.CreateAt <= :EndTime
+				GROUP BY DATE(Posts.CreateAt / 1000, 'unixepoch')
+				ORDER BY Name DESC
+				LIMIT 30`
+		}
+
+		start, end := analyticsWindow()
+
+		var rows model.AnalyticsRows
+		_, err := s.GetReplica().Select(
+			&rows,
+			query,
+			map[string]interface{}{"StartTime": start, "EndTime": end})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.AnalyticsUserCountsWithPostsByDay", "store.sql_post.analytics_user_counts_posts_by_day.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = rows
+		}
+	})
+}
+
+func (s *SqlPostStore) AnalyticsPostCountsByDay() store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		query :=
+			`SELECT
+			        DATE(FROM_UNIXTIME(Posts.CreateAt / 1000)) AS Name,
+			        COUNT(Posts.Id) AS Value
+			FROM Posts
+			WHERE Posts.CreateAt <= :EndTime AND Posts.CreateAt >= :StartTime
+			GROUP BY DATE(FROM_UNIXTIME(Posts.CreateAt / 1000))
+			ORDER BY Name DESC
+			LIMIT 30`
+
+		if s.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+			query =
+				`SELECT
+					TO_CHAR(DATE(TO_TIMESTAMP(Posts.CreateAt / 1000)), 'YYYY-MM-DD') AS Name, Count(Posts.Id) AS Value
+				FROM Posts
+				WHERE Posts.CreateAt <= :EndTime AND Posts.CreateAt >= :StartTime
+				GROUP BY DATE(TO_TIMESTAMP(Posts.CreateAt / 1000))
+				ORDER BY Name DESC
+				LIMIT 30`
+		} else if s.DriverName() == model.DATABASE_DRIVER_SQLITE {
+			query =
+				`SELECT
+					DATE(Posts.CreateAt / 1000, 'unixepoch') AS Name, COUNT(Posts.Id) AS Value
+				FROM Posts
+				WHERE Posts.CreateAt <= :EndTime AND Posts.CreateAt >= :StartTime
+				GROUP BY DATE(Posts.CreateAt / 1000, 'unixepoch')
+				ORDER BY Name DESC
+				LIMIT 30`
+		}
+
+		start, end := analyticsWindow()
+
+		var rows model.AnalyticsRows
+		_, err := s.GetReplica().Select(
+			&rows,
+			query,
+			map[string]interface{}{"StartTime": start, "EndTime": end})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.AnalyticsPostCountsByDay", "store.sql_post.analytics_posts_count_by_day.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = rows
+		}
+	})
+}
+
+func (s *SqlPostStore) AnalyticsPostCount(mustHaveFile bool, mustHaveHashtag bool) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		query := "SELECT COUNT(Posts.Id) AS Value FROM Posts WHERE DeleteAt = 0"
+
+		if mustHaveFile {
+			query += " AND (Posts.FileIds != '[]' OR Posts.Filenames != '[]')"
+		}
+
+		if mustHaveHashtag {
+			query += " AND Posts.Hashtags != ''"
+		}
+
+		if v, err := s.GetReplica().SelectInt(query); err != nil {
+			result.Err = model.NewAppError("SqlPostStore.AnalyticsPostCount", "store.sql_post.analytics_posts_count.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = v
+		}
+	})
+}
+
+func (s *SqlPostStore) GetPostsCreatedAt(channelId string, time int64) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		query := `SELECT * FROM Posts WHERE CreateAt = :CreateAt AND ChannelId = :ChannelId`
+
+		var posts []*model.Post
+		_, err := s.GetReplica().Select(&posts, query, map[string]interface{}{"CreateAt": time, "ChannelId": channelId})
+
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetPostsCreatedAt", "store.sql_post.get_posts_created_att.app_error", nil, "channelId="+channelId+err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = posts
+		}
+	})
+}
+
+func (s *SqlPostStore) GetPostsByIds(postIds []string) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		keys, params := MapStringsToQueryParams(postIds, "Post")
+
+		query := `SELECT * FROM Posts WHERE Id IN ` + keys + ` ORDER BY CreateAt DESC`
+
+		var posts []*model.Post
+		_, err := s.GetReplica().Select(&posts, query, params)
+
+		if err != nil {
+			mlog.Error(fmt.Sprint(err))
+			result.Err = model.NewAppError("SqlPostStore.GetPostsByIds", "store.sql_post.get_posts_by_ids.app_error", nil, "", http.StatusInternalServerError)
+		} else {
+			result.Data = posts
+		}
+	})
+}
+
+func (s *SqlPostStore) GetPostsBatchForIndexing(startTime int64, endTime int64, limit int) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		var posts []*model.PostForIndexing
+		_, err1 := s.GetSearchReplica().Select(&posts,
+			`SELECT
+				PostsQuery.*, ParentPosts.CreateAt AS ParentCreateAt
+			FROM (
+				SELECT
+					*
+				FROM
+					Posts
+				WHERE
+					Posts.CreateAt >= :StartTime
+				AND
+					Posts.CreateAt < :EndTime
+				ORDER BY
+					CreateAt ASC
+				LIMIT
+					:NumPosts
+				)
+			AS
+				PostsQuery
+			LEFT JOIN
+				Posts AS ParentPosts
+			ON
+				PostsQuery.RootId = ParentPosts.Id`,
+			map[string]interface{}{"StartTime": startTime, "EndTime": endTime, "NumPosts": limit})
+
+		if err1 != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetPostContext", "store.sql_post.get_posts_batch_for_indexing.get.app_error", nil, err1.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = posts
+		}
+	})
+}
+
+func (s *SqlPostStore) PermanentDeleteBatch(endTime int64, limit int64) store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		var query string
+		if s.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+			query = "DELETE from Posts WHERE Id = any (array (SELECT Id FROM Posts WHERE CreateAt < :EndTime LIMIT :Limit))"
+		} else if s.DriverName() == model.DATABASE_DRIVER_SQLITE {
+			query = "DELETE from Posts WHERE Id IN (SELECT Id FROM Posts WHERE CreateAt < :EndTime LIMIT :Limit)"
+		} else {
+			query = "DELETE from Posts WHERE CreateAt < :EndTime LIMIT :Limit"
+		}
+
+		sqlResult, err := s.GetMaster().Exec(query, map[string]interface{}{"EndTime": endTime, "Limit": limit})
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.PermanentDeleteBatch", "store.sql_post.permanent_delete_batch.app_error", nil, ""+err.Error(), http.StatusInternalServerError)
+		} else {
+			rowsAffected, err1 := sqlResult.RowsAffected()
+			if err1 != nil {
+				result.Err = model.NewAppError("SqlPostStore.PermanentDeleteBatch", "store.sql_post.permanent_delete_batch.app_error", nil, ""+err1.Error(), http.StatusInternalServerError)
+				result.Data = int64(0)
+			} else {
+				result.Data = rowsAffected
+			}
+		}
+	})
+}
+
+func (s *SqlPostStore) GetOldest() store.StoreChannel {
+	return store.DoContext(s.ctx, func(result *store.StoreResult) {
+		var post model.Post
+		err := s.GetReplica().SelectOne(&post, "SELECT * FROM Posts ORDER BY CreateAt LIMIT 1")
+		if err != nil {
+			result.Err = model.NewAppError("SqlPostStore.GetOldest", "store.sql_post.get.app_error", nil, err.Error(), http.StatusNotFound)
+		}
+
+		result.Data = &post
+	})
+}
+
+// determineMaxPostSize queries outside the context of the store, since the result is kept for good.
+func (s *SqlPostStore) determineMaxPostSize() int {
+	var maxPostSizeBytes int32
+
+	if s.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		// The Post.Message column in Postgres has historically been VARCHAR(4000), but
+		// may be manually enlarged to support longer posts.
+		if err := s.SqlStore.GetReplica().SelectOne(&maxPostSizeBytes, `
+			SELECT
+				COALESCE(character_maximum_length, 0)
+			FROM
+				information_schema.columns
+			WHERE
+				table_name = 'posts'
+			AND	column_name = 'message'
+		`); err != nil {
+			mlog.Error(utils.T("store.sql_post.query_max_post_size.error") + err.Error())
+		}
+	} else if s.DriverName() == model.DATABASE_DRIVER_MYSQL {
+		// The Post.Message column in MySQL has historically been TEXT, with a maximum
+		// limit of 65535.
+		if err := s.SqlStore.GetReplica().SelectOne(&maxPostSizeBytes, `
+			SELECT
+				COALESCE(CHARACTER_MAXIMUM_LENGTH, 0)
+			FROM
+				INFORMATION_SCHEMA.COLUMNS
+			WHERE
+				table_schema = DATABASE()
+			AND	table_name = 'Posts'
+			AND	column_name = 'Message'
+			LIMIT 0, 1
+		`); err != nil {
+			mlog.Error(utils.T("store.sql_post.query_max_post_size.error") + err.Error())
+		}
+	} else if s.DriverName() == model.DATABASE_DRIVER_SQLITE {
+		// SQLite doesn't enforce the declared length of a column.
+		maxPostSizeBytes = model.POST_MESSAGE_MAX_BYTES_V2
+	} else {
+		mlog.Warn("No implementation found to determine the maximum supported post size")
+	}
+
+	// Assume a worst-case representation of four bytes per rune.
+	maxPostSize := int(maxPostSizeBytes) / 4
+
+	// To maintain backwards compatibility, don't yield a maximum post
+	// size smaller than the previous limit, even though it wasn't
+	// actually possible to store 4000 runes in all cases.
+	if maxPostSize < model.POST_MESSAGE_MAX_RUNES_V1 {
+		maxPostSize = model.POST_MESSAGE_MAX_RUNES_V1
+	}
+
+	mlog.Info(fmt.Sprintf("Post.Message supports at most %d characters (%d bytes)", maxPostSize, maxPostSizeBytes))
+
+	return maxPostSize
+}
+
+// GetMaxPostSize returns the maximum number of runes that may be stored in a post.
+func (s *SqlPostStore) GetMaxPostSize() store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		s.maxPostSize.once.Do(func() {
+			s.maxPostSize.size = s.determineMaxPostSize()
+		})
+		result.Data = s.maxPostSize.size
+	})
+}
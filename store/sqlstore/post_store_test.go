@@ -0,0 +1,100 @@
+package sqlstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store/storetest"
+)
+
+// newSqliteSettings returns settings for an empty in-memory SQLite database.
+func newSqliteSettings() model.SqlSettings {
+	settings := model.SqlSettings{
+		DriverName: model.NewString(model.DATABASE_DRIVER_SQLITE),
+		DataSource: model.NewString("file:" + model.NewId() + "?mode=memory&cache=shared"),
+	}
+	settings.SetDefaults()
+
+	return settings
+}
+
+// newSqliteSupplier returns a supplier backed by an empty in-memory SQLite database.
+func newSqliteSupplier(t *testing.T) *SqlSupplier {
+	return newSqliteSupplierWithSettings(t, newSqliteSettings())
+}
+
+func newSqliteSupplierWithSettings(t *testing.T, settings model.SqlSettings) *SqlSupplier {
+	supplier, err := NewSqlSupplier(context.Background(), settings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(supplier.Close)
+
+	return supplier
+}
+
+func TestPostStore(t *testing.T) {
+	storetest.TestPostStore(t, newSqliteSupplier(t))
+}
+
+func TestReactionStore(t *testing.T) {
+	storetest.TestReactionStore(t, newSqliteSupplier(t))
+}
+
+func TestRoleStore(t *testing.T) {
+	storetest.TestRoleStore(t, newSqliteSupplier(t))
+}
+
+func TestSchemeStore(t *testing.T) {
+	storetest.TestSchemeStore(t, newSqliteSupplier(t))
+}
+
+func TestUserStore(t *testing.T) {
+	storetest.TestUserStore(t, newSqliteSupplier(t))
+}
+
+// TestSessionStore runs with tokens encrypted at rest, so lookups by token go through the keyring.
+func TestSessionStore(t *testing.T) {
+	settings := newSqliteSettings()
+	settings.AtRestEncryptKey = model.NewRandomString(32)
+	ss := newSqliteSupplierWithSettings(t, settings)
+	result := <-ss.Session().Save(&model.Session{UserId: model.NewId()})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if session := result.Data.(*model.Session); storedToken(t, ss, session.Id) == string(session.Token) {
+		t.Fatal("should store the session tokens encrypted")
+	}
+
+	storetest.TestSessionStore(t, ss)
+}
+
+func TestSqliteLikeTerms(t *testing.T) {
+	tests := []struct {
+		terms   string
+		orTerms bool
+		clause  string
+		params  map[string]interface{}
+	}{
+		{"apple", false, `AND (' ' || Message || ' ') LIKE :LikeTerm0 ESCAPE '\'`, map[string]interface{}{"LikeTerm0": "% apple %"}},
+		{"cher* 100%", false, `AND (' ' || Message || ' ') LIKE :LikeTerm0 ESCAPE '\' AND (' ' || Message || ' ') LIKE :LikeTerm1 ESCAPE '\'`, map[string]interface{}{"LikeTerm0": "% cher%", "LikeTerm1": `% 100\% %`}},
+		{"a_b c", true, `AND ((' ' || Message || ' ') LIKE :LikeTerm0 ESCAPE '\' OR (' ' || Message || ' ') LIKE :LikeTerm1 ESCAPE '\')`, map[string]interface{}{"LikeTerm0": `% a\_b %`, "LikeTerm1": "% c %"}},
+		{`"" *`, false, "AND 0 = 1", map[string]interface{}{}},
+	}
+
+	for _, tc := range tests {
+		clause, params := sqliteLikeTerms("Message", tc.terms, tc.orTerms)
+		if clause != tc.clause {
+			t.Errorf("%q: expected clause %v, got %v", tc.terms, tc.clause, clause)
+		}
+		if len(params) != len(tc.params) {
+			t.Errorf("%q: expected params %v, got %v", tc.terms, tc.params, params)
+		}
+		for key, value := range tc.params {
+			if params[key] != value {
+				t.Errorf("%q: expected %v = %v, got %v", tc.terms, key, value, params[key])
+			}
+		}
+	}
+}
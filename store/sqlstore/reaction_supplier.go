@@ -0,0 +1,244 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+const (
+	UPDATE_POST_HAS_REACTIONS_ON_INSERT_QUERY = `UPDATE Posts SET HasReactions = True, UpdateAt = :UpdateAt WHERE Id = :PostId`
+	UPDATE_POST_HAS_REACTIONS_ON_DELETE_QUERY = `UPDATE Posts SET UpdateAt = :UpdateAt, HasReactions = (SELECT count(0) > 0 FROM Reactions WHERE PostId = :PostId) WHERE Id = :PostId`
+)
+
+func mapReactionsTable(db *gorp.DbMap) {
+	table := addTable(db, model.Reaction{}, "Reactions", "UserId", "PostId", "EmojiName")
+	table.ColMap("UserId").SetMaxSize(26)
+	table.ColMap("PostId").SetMaxSize(26)
+	table.ColMap("EmojiName").SetMaxSize(64)
+}
+
+func (s *SqlSupplier) ReactionSave(ctx context.Context, reaction *model.Reaction, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	reaction.PreSave()
+	if result.Err = reaction.IsValid(); result.Err != nil {
+		return result
+	}
+
+	if transaction, err := s.begin(ctx); err != nil {
+		result.Err = model.NewAppError("SqlReactionStore.Save", "store.sql_reaction.save.begin.app_error", nil, err.Error(), http.StatusInternalServerError)
+	} else {
+		err := saveReactionAndUpdatePost(transaction, reaction)
+
+		if err != nil {
+			transaction.Rollback()
+
+			// We don't consider duplicated save calls as an error
+			if !IsUniqueConstraintError(err, []string{"reactions_pkey", "PRIMARY", "Reactions."}) {
+				result.Err = model.NewAppError("SqlReactionStore.Save", "store.sql_reaction.save.save.app_error", nil, err.Error(), http.StatusBadRequest)
+			}
+		} else {
+			if err := transaction.Commit(); err != nil {
+				// don't need to rollback here since the transaction is already closed
+				result.Err = model.NewAppError("SqlReactionStore.Save", "store.sql_reaction.save.commit.app_error", nil, err.Error(), http.StatusInternalServerError)
+			}
+		}
+
+		if result.Err == nil {
+			result.Data = reaction
+		}
+	}
+
+	return result
+}
+
+func (s *SqlSupplier) ReactionDelete(ctx context.Context, reaction *model.Reaction, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	if transaction, err := s.begin(ctx); err != nil {
+		result.Err = model.NewAppError("SqlReactionStore.Delete", "store.sql_reaction.delete.begin.app_error", nil, err.Error(), http.StatusInternalServerError)
+	} else {
+		err := deleteReactionAndUpdatePost(transaction, reaction)
+
+		if err != nil {
+			transaction.Rollback()
+
+			result.Err = model.NewAppError("SqlReactionStore.Delete", "store.sql_reaction.delete.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else if err := transaction.Commit(); err != nil {
+			// don't need to rollback here since the transaction is already closed
+			result.Err = model.NewAppError("SqlReactionStore.Delete", "store.sql_reaction.delete.commit.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = reaction
+		}
+	}
+
+	return result
+}
+
+func (s *SqlSupplier) ReactionGetForPost(ctx context.Context, postId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var reactions []*model.Reaction
+
+	if _, err := s.readConn(hints).Select(&reactions,
+		`SELECT
+				*
+			FROM
+				Reactions
+			WHERE
+				PostId = :PostId
+			ORDER BY
+				CreateAt`, map[string]interface{}{"PostId": postId}); err != nil {
+		result.Err = model.NewAppError("SqlReactionStore.GetForPost", "store.sql_reaction.get_for_post.app_error", nil, "", http.StatusInternalServerError)
+	} else {
+		result.Data = reactions
+	}
+
+	return result
+}
+
+func (s *SqlSupplier) ReactionDeleteAllWithEmojiName(ctx context.Context, emojiName string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var reactions []*model.Reaction
+
+	if _, err := s.readConn(hints).Select(&reactions,
+		`SELECT
+				*
+			FROM
+				Reactions
+			WHERE
+				EmojiName = :EmojiName`, map[string]interface{}{"EmojiName": emojiName}); err != nil {
+		result.Err = model.NewAppError("SqlReactionStore.DeleteAllWithEmojiName",
+			"store.sql_reaction.delete_all_with_emoji_name.get_reactions.app_error", nil,
+			"emoji_name="+emojiName+", error="+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	if _, err := withContext(s.GetMaster(), ctx).Exec(
+		`DELETE FROM
+			Reactions
+		WHERE
+			EmojiName = :EmojiName`, map[string]interface{}{"EmojiName": emojiName}); err != nil {
+		result.Err = model.NewAppError("SqlReactionStore.DeleteAllWithEmojiName",
+			"store.sql_reaction.delete_all_with_emoji_name.delete_reactions.app_error", nil,
+			"emoji_name="+emojiName+", error="+err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	for _, reaction := range reactions {
+		if _, err := withContext(s.GetMaster(), ctx).Exec(UPDATE_POST_HAS_REACTIONS_ON_DELETE_QUERY,
+			map[string]interface{}{"PostId": reaction.PostId, "UpdateAt": model.GetMillis()}); err != nil {
+			mlog.Warn(fmt.Sprintf("Unable to update Post.HasReactions while removing reactions post_id=%v, error=%v", reaction.PostId, err.Error()))
+		}
+	}
+
+	return result
+}
+
+func (s *SqlSupplier) ReactionPermanentDeleteBatch(ctx context.Context, endTime int64, limit int64, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var query string
+	if s.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		query = "DELETE from Reactions WHERE CreateAt = any (array (SELECT CreateAt FROM Reactions WHERE CreateAt < :EndTime LIMIT :Limit))"
+	} else if s.DriverName() == model.DATABASE_DRIVER_SQLITE {
+		query = "DELETE from Reactions WHERE rowid IN (SELECT rowid FROM Reactions WHERE CreateAt < :EndTime LIMIT :Limit)"
+	} else {
+		query = "DELETE from Reactions WHERE CreateAt < :EndTime LIMIT :Limit"
+	}
+
+	sqlResult, err := withContext(s.GetMaster(), ctx).Exec(query, map[string]interface{}{"EndTime": endTime, "Limit": limit})
+	if err != nil {
+		result.Err = model.NewAppError("SqlReactionStore.PermanentDeleteBatch", "store.sql_reaction.permanent_delete_batch.app_error", nil, err.Error(), http.StatusInternalServerError)
+	} else {
+		rowsAffected, err1 := sqlResult.RowsAffected()
+		if err1 != nil {
+			result.Err = model.NewAppError("SqlReactionStore.PermanentDeleteBatch", "store.sql_reaction.permanent_delete_batch.app_error", nil, err1.Error(), http.StatusInternalServerError)
+			result.Data = int64(0)
+		} else {
+			result.Data = rowsAffected
+		}
+	}
+
+	return result
+}
+
+func saveReactionAndUpdatePost(transaction gorp.SqlExecutor, reaction *model.Reaction) error {
+	if err := transaction.Insert(reaction); err != nil {
+		return err
+	}
+
+	return updatePostForReactionsOnInsert(transaction, reaction.PostId)
+}
+
+func deleteReactionAndUpdatePost(transaction gorp.SqlExecutor, reaction *model.Reaction) error {
+	if _, err := transaction.Exec(
+		`DELETE FROM
+			Reactions
+		WHERE
+			PostId = :PostId AND
+			UserId = :UserId AND
+			EmojiName = :EmojiName`,
+		map[string]interface{}{"PostId": reaction.PostId, "UserId": reaction.UserId, "EmojiName": reaction.EmojiName}); err != nil {
+		return err
+	}
+
+	return updatePostForReactionsOnDelete(transaction, reaction.PostId)
+}
+
+func updatePostForReactionsOnDelete(transaction gorp.SqlExecutor, postId string) error {
+	_, err := transaction.Exec(UPDATE_POST_HAS_REACTIONS_ON_DELETE_QUERY, map[string]interface{}{"PostId": postId, "UpdateAt": model.GetMillis()})
+
+	return err
+}
+
+func updatePostForReactionsOnInsert(transaction gorp.SqlExecutor, postId string) error {
+	_, err := transaction.Exec(UPDATE_POST_HAS_REACTIONS_ON_INSERT_QUERY, map[string]interface{}{"PostId": postId, "UpdateAt": model.GetMillis()})
+
+	return err
+}
+
+// SqlReactionStore exposes the reaction methods of the supplier as a store.ReactionStore, for callers that use
+// the supplier without a layered store in front of it.
+type SqlReactionStore struct {
+	supplier *SqlSupplier
+	ctx      context.Context
+}
+
+func (s SqlReactionStore) Save(reaction *model.Reaction) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.ReactionSave(s.ctx, reaction)
+	})
+}
+
+func (s SqlReactionStore) Delete(reaction *model.Reaction) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.ReactionDelete(s.ctx, reaction)
+	})
+}
+
+func (s SqlReactionStore) GetForPost(postId string, allowFromCache bool) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.ReactionGetForPost(s.ctx, postId)
+	})
+}
+
+func (s SqlReactionStore) DeleteAllWithEmojiName(emojiName string) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.ReactionDeleteAllWithEmojiName(s.ctx, emojiName)
+	})
+}
+
+func (s SqlReactionStore) PermanentDeleteBatch(endTime int64, limit int64) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.ReactionPermanentDeleteBatch(s.ctx, endTime, limit)
+	})
+}
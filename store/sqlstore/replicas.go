@@ -0,0 +1,301 @@
+package sqlstore
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+// replica is a read only connection together with the outcome of its last health check.
+type replica struct {
+	name       string
+	dataSource string
+	dbmap      *gorp.DbMap
+
+	// unhealthy and lag are updated by the health check while reads pick replicas, so they are accessed
+	// atomically. lag is in nanoseconds.
+	unhealthy int32
+	lag       int64
+}
+
+func newReplica(ctx context.Context, name string, dataSource string, settings *model.SqlSettings, keyring *Keyring, metrics einterfaces.MetricsInterface) (*replica, error) {
+	dbmap, err := setupConnection(ctx, name, dataSource, settings, keyring, metrics)
+	if err != nil {
+		return nil, err
+	}
+	mapTables(dbmap)
+
+	return &replica{
+		name:       name,
+		dataSource: dataSource,
+		dbmap:      dbmap,
+	}, nil
+}
+
+// usable reports whether reads may go to the replica: it passed its last health check and doesn't lag more
+// than maxLag behind the master. A maxLag of zero ignores the lag.
+func (r *replica) usable(maxLag time.Duration) bool {
+	if atomic.LoadInt32(&r.unhealthy) != 0 {
+		return false
+	}
+
+	return maxLag == 0 || time.Duration(atomic.LoadInt64(&r.lag)) <= maxLag
+}
+
+// pickReplica returns the next usable replica after the one counter last pointed at, or nil if there is none.
+func pickReplica(replicas []*replica, counter *int64, maxLag time.Duration) *gorp.DbMap {
+	if len(replicas) == 0 {
+		return nil
+	}
+
+	next := atomic.AddInt64(counter, 1)
+	for i := int64(0); i < int64(len(replicas)); i++ {
+		if r := replicas[(next+i)%int64(len(replicas))]; r.usable(maxLag) {
+			return r.dbmap
+		}
+	}
+
+	return nil
+}
+
+func (ss *SqlSupplier) startReplicaHealthCheck() {
+	ss.stopReplicaCheck = make(chan struct{})
+	ss.replicaCheckStopped = make(chan struct{})
+
+	go func() {
+		defer close(ss.replicaCheckStopped)
+
+		for {
+			ss.replicaLock.RLock()
+			interval := ss.replicaCheckInterval
+			ss.replicaLock.RUnlock()
+
+			select {
+			case <-ss.stopReplicaCheck:
+				return
+			case <-time.After(interval):
+				ss.CheckReplicas()
+			}
+		}
+	}()
+}
+
+func (ss *SqlSupplier) stopReplicaHealthCheck() {
+	if ss.stopReplicaCheck == nil {
+		return
+	}
+
+	close(ss.stopReplicaCheck)
+	<-ss.replicaCheckStopped
+	ss.stopReplicaCheck = nil
+}
+
+// CheckReplicas probes every replica and records whether it answers and how far it lags behind the master.
+// It runs every ReplicaHealthCheckIntervalSeconds in the background.
+func (ss *SqlSupplier) CheckReplicas() {
+	ss.replicaLock.RLock()
+	replicas := append(append([]*replica{}, ss.replicas...), ss.searchReplicas...)
+	maxLag := ss.replicaMaxLag
+	ss.replicaLock.RUnlock()
+
+	for _, r := range replicas {
+		ss.checkReplica(r, maxLag)
+	}
+}
+
+func (ss *SqlSupplier) checkReplica(r *replica, maxLag time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*ss.settings.PingTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	wasUsable := r.usable(maxLag)
+
+	lag, err := ss.replicaLag(ctx, r.dbmap.Db)
+	if err != nil {
+		atomic.StoreInt32(&r.unhealthy, 1)
+		if wasUsable {
+			mlog.Warn(fmt.Sprintf("SQL %v failed its health check, reading from the other replicas err=%v", r.name, err))
+		}
+		return
+	}
+
+	atomic.StoreInt64(&r.lag, int64(lag))
+	atomic.StoreInt32(&r.unhealthy, 0)
+
+	if usable := r.usable(maxLag); usable && !wasUsable {
+		mlog.Info(fmt.Sprintf("SQL %v is healthy again, lagging %v behind", r.name, lag))
+	} else if !usable && wasUsable {
+		mlog.Warn(fmt.Sprintf("SQL %v lags %v behind, more than the threshold of %v, reading from the other replicas", r.name, lag, maxLag))
+	}
+}
+
+// replicaLag returns how far db lags behind the master, which also shows that it answers. It is zero for a
+// database that isn't replicating.
+func (ss *SqlSupplier) replicaLag(ctx context.Context, db *dbsql.DB) (time.Duration, error) {
+	switch ss.DriverName() {
+	case model.DATABASE_DRIVER_POSTGRES:
+		// A standby that has replayed everything it received isn't behind, however long ago the last
+		// transaction on the master was.
+		var seconds float64
+		err := db.QueryRowContext(ctx, `
+			SELECT
+				CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+				END`).Scan(&seconds)
+		return time.Duration(seconds * float64(time.Second)), err
+
+	case model.DATABASE_DRIVER_MYSQL:
+		return mysqlReplicaLag(ctx, db)
+
+	default:
+		return 0, db.PingContext(ctx)
+	}
+}
+
+func mysqlReplicaLag(ctx context.Context, db *dbsql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(dbsql.NullString)
+	}
+	if err := rows.Scan(values...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" && column != "Seconds_Behind_Source" {
+			continue
+		}
+
+		value := values[i].(*dbsql.NullString)
+		if !value.Valid {
+			return 0, errors.New("replication is not running")
+		}
+
+		seconds, err := strconv.ParseInt(value.String, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return 0, errors.New("SHOW SLAVE STATUS has no Seconds_Behind_Master column")
+}
+
+// ReloadReplicas applies the replica settings of a changed config: it connects to added data sources,
+// disconnects from removed ones and picks up the lag threshold and health check interval. A removed replica
+// is closed once the query timeout has passed, so that the calls that picked it before can still finish.
+func (ss *SqlSupplier) ReloadReplicas(settings model.SqlSettings) error {
+	ss.replicaReloadLock.Lock()
+	defer ss.replicaReloadLock.Unlock()
+
+	ss.replicaLock.RLock()
+	currentReplicas, currentSearchReplicas := ss.replicas, ss.searchReplicas
+	ss.replicaLock.RUnlock()
+
+	maxLag := time.Duration(*settings.ReplicaLagThresholdSeconds) * time.Second
+
+	replicas, removed, err := ss.reloadReplicas(currentReplicas, settings.DataSourceReplicas, "replica", &settings, maxLag)
+	searchReplicas, removedSearch, searchErr := ss.reloadReplicas(currentSearchReplicas, settings.DataSourceSearchReplicas, "search-replica", &settings, maxLag)
+
+	ss.replicaLock.Lock()
+	ss.replicas = replicas
+	ss.searchReplicas = searchReplicas
+	ss.replicaMaxLag = maxLag
+	ss.replicaCheckInterval = time.Duration(*settings.ReplicaHealthCheckIntervalSeconds) * time.Second
+	ss.replicaLock.Unlock()
+
+	for _, r := range append(removed, removedSearch...) {
+		mlog.Info(fmt.Sprintf("Removed SQL %v", r.name))
+		ss.closeReplica(r, time.Duration(*settings.QueryTimeout)*time.Second)
+	}
+
+	if err != nil {
+		return err
+	}
+	return searchErr
+}
+
+// reloadReplicas keeps the replicas of current that are still in dataSources and connects to the others. A
+// replica that can't be reached yet is added anyway, and used once a health check finds it answering.
+func (ss *SqlSupplier) reloadReplicas(current []*replica, dataSources []string, prefix string, settings *model.SqlSettings, maxLag time.Duration) (replicas []*replica, removed []*replica, err error) {
+	byDataSource := make(map[string][]*replica, len(current))
+	for _, r := range current {
+		byDataSource[r.dataSource] = append(byDataSource[r.dataSource], r)
+	}
+
+	for i, dataSource := range dataSources {
+		if kept := byDataSource[dataSource]; len(kept) > 0 {
+			replicas = append(replicas, kept[0])
+			byDataSource[dataSource] = kept[1:]
+			continue
+		}
+
+		dbmap, openErr := openConnection(fmt.Sprintf("%v-%v", prefix, i), dataSource, settings, ss.keyring, ss.metrics)
+		if openErr != nil {
+			mlog.Error(fmt.Sprintf("Failed to add SQL %v-%v err=%v", prefix, i, openErr))
+			if err == nil {
+				err = openErr
+			}
+			continue
+		}
+		mapTables(dbmap)
+
+		r := &replica{
+			name:       fmt.Sprintf("%v-%v", prefix, i),
+			dataSource: dataSource,
+			dbmap:      dbmap,
+			unhealthy:  1,
+		}
+		ss.checkReplica(r, maxLag)
+
+		mlog.Info(fmt.Sprintf("Added SQL %v", r.name))
+		replicas = append(replicas, r)
+	}
+
+	for _, unused := range byDataSource {
+		removed = append(removed, unused...)
+	}
+
+	return replicas, removed, err
+}
+
+// closeReplica closes a removed replica after delay. Close closes it right away.
+func (ss *SqlSupplier) closeReplica(r *replica, delay time.Duration) {
+	ss.replicaLock.Lock()
+	defer ss.replicaLock.Unlock()
+
+	if ss.closingReplicas == nil {
+		ss.closingReplicas = make(map[*replica]*time.Timer)
+	}
+	ss.closingReplicas[r] = time.AfterFunc(delay, func() {
+		ss.replicaLock.Lock()
+		delete(ss.closingReplicas, r)
+		ss.replicaLock.Unlock()
+
+		r.dbmap.Db.Close()
+	})
+}
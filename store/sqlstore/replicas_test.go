@@ -0,0 +1,199 @@
+package sqlstore
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+// newSqliteSupplierWithReplicas returns a supplier whose replicas are further connections to its own
+// in-memory database. The data sources differ only in the order of their parameters.
+func newSqliteSupplierWithReplicas(t *testing.T) *SqlSupplier {
+	settings := newSqliteSettings()
+	name := strings.TrimSuffix(strings.TrimPrefix(*settings.DataSource, "file:"), "?mode=memory&cache=shared")
+	settings.DataSourceReplicas = []string{
+		"file:" + name + "?cache=shared&mode=memory",
+		"file:" + name + "?mode=memory&cache=shared&_replica=1",
+	}
+
+	// Checks run explicitly from the tests.
+	*settings.ReplicaHealthCheckIntervalSeconds = 3600
+
+	return newSqliteSupplierWithSettings(t, settings)
+}
+
+func replicaDbMaps(ss *SqlSupplier) []*gorp.DbMap {
+	ss.replicaLock.RLock()
+	defer ss.replicaLock.RUnlock()
+
+	var dbmaps []*gorp.DbMap
+	for _, r := range ss.replicas {
+		dbmaps = append(dbmaps, r.dbmap)
+	}
+	return dbmaps
+}
+
+func checkReads(t *testing.T, get func() gorp.SqlExecutor, expected ...*gorp.DbMap) {
+	t.Helper()
+
+	seen := make(map[gorp.SqlExecutor]bool)
+	for i := 0; i < 2*len(expected); i++ {
+		seen[get()] = true
+	}
+
+	if len(seen) != len(expected) {
+		t.Fatalf("expected reads from %v connections, got %v", len(expected), len(seen))
+	}
+	for _, dbmap := range expected {
+		if !seen[dbmap] {
+			t.Fatal("expected reads from every usable connection")
+		}
+	}
+}
+
+func TestReplicaRoundRobin(t *testing.T) {
+	ss := newSqliteSupplierWithReplicas(t)
+	replicas := replicaDbMaps(ss)
+
+	if len(replicas) != 2 {
+		t.Fatalf("expected 2 replicas, got %v", len(replicas))
+	}
+
+	checkReads(t, ss.GetReplica, replicas...)
+
+	// Without search replicas, searches go to the replicas too.
+	checkReads(t, ss.GetSearchReplica, replicas...)
+
+	var count int64
+	if err := ss.GetReplica().SelectOne(&count, "SELECT COUNT(*) FROM Posts"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicaHealthCheck(t *testing.T) {
+	ss := newSqliteSupplierWithReplicas(t)
+	replicas := replicaDbMaps(ss)
+
+	replicas[0].Db.Close()
+	ss.CheckReplicas()
+	checkReads(t, ss.GetReplica, replicas[1])
+
+	replicas[1].Db.Close()
+	ss.CheckReplicas()
+	checkReads(t, ss.GetReplica, ss.master)
+	checkReads(t, ss.GetSearchReplica, ss.master)
+}
+
+func TestReplicaLag(t *testing.T) {
+	ss := newSqliteSupplierWithReplicas(t)
+	replicas := replicaDbMaps(ss)
+
+	atomic.StoreInt64(&ss.replicas[0].lag, int64(time.Hour))
+	checkReads(t, ss.GetReplica, replicas[1])
+
+	atomic.StoreInt64(&ss.replicas[1].lag, int64(time.Hour))
+	checkReads(t, ss.GetReplica, ss.master)
+
+	// A threshold of zero ignores the lag.
+	settings := *ss.settings
+	settings.DataSourceReplicas = []string{ss.replicas[0].dataSource, ss.replicas[1].dataSource}
+	settings.ReplicaLagThresholdSeconds = new(int)
+	if err := ss.ReloadReplicas(settings); err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ss.GetReplica, replicas...)
+
+	// The health check measures the lag again, and SQLite doesn't replicate.
+	*settings.ReplicaLagThresholdSeconds = 1
+	if err := ss.ReloadReplicas(settings); err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ss.GetReplica, ss.master)
+	ss.CheckReplicas()
+	checkReads(t, ss.GetReplica, replicas...)
+}
+
+func TestReloadReplicas(t *testing.T) {
+	ss := newSqliteSupplierWithReplicas(t)
+	replicas := replicaDbMaps(ss)
+	kept, removed := ss.replicas[0].dataSource, ss.replicas[1].dataSource
+
+	settings := *ss.settings
+	settings.QueryTimeout = model.NewInt(1)
+	settings.DataSourceReplicas = []string{kept}
+	if err := ss.ReloadReplicas(settings); err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ss.GetReplica, replicas[0])
+
+	// The calls that picked the removed replica before the reload can still use it until the query timeout.
+	if err := replicas[1].Db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); replicas[1].Db.Ping() == nil; time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the removed replica to be closed")
+		}
+	}
+
+	settings.DataSourceSearchReplicas = []string{removed}
+	if err := ss.ReloadReplicas(settings); err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ss.GetReplica, replicas[0])
+
+	searchReplicas := func() []*gorp.DbMap {
+		ss.replicaLock.RLock()
+		defer ss.replicaLock.RUnlock()
+		return []*gorp.DbMap{ss.searchReplicas[0].dbmap}
+	}()
+	checkReads(t, ss.GetSearchReplica, searchReplicas...)
+
+	// A replica that can't be reached is added, but not read from until it answers.
+	settings.DataSourceReplicas = []string{kept, "file:" + t.TempDir() + "/missing/db.sqlite?mode=ro"}
+	if err := ss.ReloadReplicas(settings); err != nil {
+		t.Fatal(err)
+	}
+	if len(replicaDbMaps(ss)) != 2 {
+		t.Fatal("expected the unreachable replica to be added")
+	}
+	checkReads(t, ss.GetReplica, replicas[0])
+
+	settings.DataSourceReplicas = nil
+	settings.DataSourceSearchReplicas = nil
+	if err := ss.ReloadReplicas(settings); err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ss.GetReplica, ss.master)
+	checkReads(t, ss.GetSearchReplica, ss.master)
+}
+
+func TestReloadReplicasMapsTables(t *testing.T) {
+	ss := newSqliteSupplierWithReplicas(t)
+
+	user := &model.User{Username: "u" + model.NewId(), Email: model.NewId() + "@example.com"}
+	if result := <-ss.User().Save(user); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	settings := *ss.settings
+	settings.DataSourceReplicas = []string{ss.replicas[0].dataSource + "&_reloaded=1"}
+	if err := ss.ReloadReplicas(settings); err != nil {
+		t.Fatal(err)
+	}
+	checkReads(t, ss.GetReplica, replicaDbMaps(ss)...)
+
+	// Get finds the table through the mappings of the replica it reads from.
+	result := <-ss.User().Get(user.Id)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Data.(*model.User).Username != user.Username {
+		t.Fatal("expected the saved user")
+	}
+}
@@ -0,0 +1,75 @@
+package sqlstore
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+// RetryPolicy decides how long to wait for the database to answer before giving up. The wait between
+// attempts starts at InitialBackoff and doubles up to MaxBackoff.
+type RetryPolicy struct {
+	Attempts       int
+	Timeout        time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func NewRetryPolicy(settings *model.SqlSettings) RetryPolicy {
+	return RetryPolicy{
+		Attempts:       *settings.PingAttempts,
+		Timeout:        time.Duration(*settings.PingTimeoutSeconds) * time.Second,
+		InitialBackoff: DB_PING_INITIAL_BACKOFF,
+		MaxBackoff:     time.Duration(*settings.PingMaxBackoffSeconds) * time.Second,
+	}
+}
+
+// Backoff returns how long to wait after the given failed attempt, counting from zero.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 0; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// ping waits until db answers, retrying as the policy allows. It gives up early when ctx is done.
+func (p RetryPolicy) ping(ctx context.Context, conType string, db *dbsql.DB) error {
+	var err error
+	for attempt := 0; attempt < p.Attempts; attempt++ {
+		mlog.Info(fmt.Sprintf("Pinging SQL %v database", conType))
+
+		pingCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+		err = db.PingContext(pingCtx)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt == p.Attempts-1 {
+			break
+		}
+
+		backoff := p.Backoff(attempt)
+		mlog.Error(fmt.Sprintf("Failed to ping DB retrying in %v err=%v", backoff, err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,53 @@
+package sqlstore
+
+import (
+	"context"
+	dbsql "database/sql"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if backoff := policy.Backoff(attempt); backoff != expected {
+			t.Fatalf("expected backoff %v after attempt %v, got %v", expected, attempt, backoff)
+		}
+	}
+
+	policy.MaxBackoff = 0
+	if backoff := policy.Backoff(0); backoff != 0 {
+		t.Fatalf("expected no backoff, got %v", backoff)
+	}
+}
+
+func TestRetryPolicyPing(t *testing.T) {
+	// The directory doesn't exist, so every ping fails to open the database.
+	db, err := dbsql.Open("sqlite3", "file:"+t.TempDir()+"/missing/db.sqlite?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	t.Run("GivesUp", func(t *testing.T) {
+		policy := RetryPolicy{Attempts: 3, Timeout: time.Second, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+		if err := policy.ping(context.Background(), "master", db); err == nil {
+			t.Fatal("expected ping to fail")
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		policy := RetryPolicy{Attempts: 100, Timeout: time.Second, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+		start := time.Now()
+		if err := policy.ping(ctx, "master", db); err != context.Canceled {
+			t.Fatalf("expected the cancellation, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("expected ping to stop when cancelled, took %v", elapsed)
+		}
+	})
+}
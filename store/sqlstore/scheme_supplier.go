@@ -0,0 +1,276 @@
+package sqlstore
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func mapSchemesTable(db *gorp.DbMap) {
+	table := addTable(db, model.Scheme{}, "Schemes", "Id")
+	table.ColMap("Id").SetMaxSize(26)
+	table.ColMap("Name").SetMaxSize(model.SCHEME_NAME_MAX_LENGTH).SetUnique(true)
+	table.ColMap("DisplayName").SetMaxSize(model.SCHEME_DISPLAY_NAME_MAX_LENGTH)
+	table.ColMap("Description").SetMaxSize(model.SCHEME_DESCRIPTION_MAX_LENGTH)
+	table.ColMap("Scope").SetMaxSize(32)
+	table.ColMap("DefaultTeamAdminRole").SetMaxSize(64)
+	table.ColMap("DefaultTeamUserRole").SetMaxSize(64)
+	table.ColMap("DefaultChannelAdminRole").SetMaxSize(64)
+	table.ColMap("DefaultChannelUserRole").SetMaxSize(64)
+}
+
+func (s *SqlSupplier) SchemeSave(ctx context.Context, scheme *model.Scheme, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	if len(scheme.Id) == 0 {
+		if transaction, err := s.begin(ctx); err != nil {
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeSave", "store.sql_scheme.save.open_transaction.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+			result = s.createScheme(ctx, scheme, transaction, hints...)
+
+			if result.Err != nil {
+				transaction.Rollback()
+			} else if err := transaction.Commit(); err != nil {
+				result.Err = model.NewAppError("SqlSchemeStore.SchemeSave", "store.sql_scheme.save_scheme.commit_transaction.app_error", nil, err.Error(), http.StatusInternalServerError)
+			}
+		}
+	} else {
+		if err := scheme.IsValid(); err != nil {
+			result.Err = err
+			return result
+		}
+
+		scheme.UpdateAt = model.GetMillis()
+
+		if rowsChanged, err := withContext(s.GetMaster(), ctx).Update(scheme); err != nil {
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeSave", "store.sql_scheme.save.update.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else if rowsChanged != 1 {
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeSave", "store.sql_scheme.save.update.app_error", nil, "no record to update", http.StatusInternalServerError)
+		}
+
+		result.Data = scheme
+	}
+
+	return result
+}
+
+// createScheme creates the default roles of the scheme along with it, so they share the transaction.
+func (s *SqlSupplier) createScheme(ctx context.Context, scheme *model.Scheme, transaction gorp.SqlExecutor, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	createSchemeRole := func(displayName string) (string, *model.AppError) {
+		role := &model.Role{
+			Name:          model.NewId(),
+			DisplayName:   fmt.Sprintf("%v Role for Scheme %s", displayName, scheme.Name),
+			Permissions:   []string{},
+			SchemeManaged: true,
+		}
+
+		roleResult := s.createRole(ctx, role, transaction)
+		if roleResult.Err != nil {
+			return "", roleResult.Err
+		}
+
+		return roleResult.Data.(*model.Role).Name, nil
+	}
+
+	var err *model.AppError
+
+	if scheme.Scope == model.SCHEME_SCOPE_TEAM {
+		if scheme.DefaultTeamAdminRole, err = createSchemeRole("Team Admin"); err != nil {
+			result.Err = err
+			return result
+		}
+
+		if scheme.DefaultTeamUserRole, err = createSchemeRole("Team User"); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	if scheme.Scope == model.SCHEME_SCOPE_TEAM || scheme.Scope == model.SCHEME_SCOPE_CHANNEL {
+		if scheme.DefaultChannelAdminRole, err = createSchemeRole("Channel Admin"); err != nil {
+			result.Err = err
+			return result
+		}
+
+		if scheme.DefaultChannelUserRole, err = createSchemeRole("Channel User"); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	scheme.Id = model.NewId()
+	scheme.CreateAt = model.GetMillis()
+	scheme.UpdateAt = scheme.CreateAt
+
+	// Validate the scheme
+	if result.Err = scheme.IsValidForCreate(); result.Err != nil {
+		return result
+	}
+
+	if err := transaction.Insert(scheme); err != nil {
+		result.Err = model.NewAppError("SqlSchemeStore.SchemeSave", "store.sql_scheme.save.insert.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	result.Data = scheme
+
+	return result
+}
+
+func (s *SqlSupplier) SchemeGet(ctx context.Context, schemeId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var scheme model.Scheme
+
+	if err := s.readConn(hints).SelectOne(&scheme, "SELECT * from Schemes WHERE Id = :Id", map[string]interface{}{"Id": schemeId}); err != nil {
+		if err == dbsql.ErrNoRows {
+			result.Err = model.NewAppError("SqlSchemeStore.Get", "store.sql_scheme.get.app_error", nil, "Id="+schemeId+", "+err.Error(), http.StatusNotFound)
+		} else {
+			result.Err = model.NewAppError("SqlSchemeStore.Get", "store.sql_scheme.get.app_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+
+		return result
+	}
+
+	result.Data = &scheme
+
+	return result
+}
+
+func (s *SqlSupplier) SchemeDelete(ctx context.Context, schemeId string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	// Get the scheme
+	var scheme model.Scheme
+	if err := withContext(s.GetMaster(), ctx).SelectOne(&scheme, "SELECT * from Schemes WHERE Id = :Id", map[string]interface{}{"Id": schemeId}); err != nil {
+		if err == dbsql.ErrNoRows {
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.get.app_error", nil, "Id="+schemeId+", "+err.Error(), http.StatusNotFound)
+		} else {
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.get.app_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+
+		return result
+	}
+
+	transaction, err := s.begin(ctx)
+	if err != nil {
+		result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.open_transaction.app_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	time := model.GetMillis()
+
+	// Delete the roles belonging to the scheme
+	roleNames := scheme.RoleNames()
+	if len(roleNames) > 0 {
+		var inQueryList []string
+		queryArgs := map[string]interface{}{"UpdateAt": time, "DeleteAt": time}
+		for i, roleId := range roleNames {
+			inQueryList = append(inQueryList, fmt.Sprintf(":RoleName%v", i))
+			queryArgs[fmt.Sprintf("RoleName%v", i)] = roleId
+		}
+		inQuery := strings.Join(inQueryList, ", ")
+
+		if _, err := transaction.Exec("UPDATE Roles SET UpdateAt = :UpdateAt, DeleteAt = :DeleteAt WHERE Name IN ("+inQuery+")", queryArgs); err != nil {
+			transaction.Rollback()
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.role_update.app_error", nil, err.Error(), http.StatusInternalServerError)
+			return result
+		}
+	}
+
+	// Delete the scheme itself.
+	scheme.UpdateAt = time
+	scheme.DeleteAt = time
+
+	if rowsChanged, err := transaction.Update(&scheme); err != nil {
+		transaction.Rollback()
+		result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.update.app_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	} else if rowsChanged != 1 {
+		transaction.Rollback()
+		result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.update.app_error", nil, "no record to update", http.StatusInternalServerError)
+		return result
+	}
+
+	if err := transaction.Commit(); err != nil {
+		result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.commit_transaction.app_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = &scheme
+
+	return result
+}
+
+func (s *SqlSupplier) SchemeGetAllPage(ctx context.Context, scope string, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var schemes []*model.Scheme
+
+	scopeClause := ""
+	if len(scope) > 0 {
+		scopeClause = " AND Scope=:Scope "
+	}
+
+	if _, err := s.readConn(hints).Select(&schemes, "SELECT * from Schemes WHERE DeleteAt = 0 "+scopeClause+" ORDER BY CreateAt DESC LIMIT :Limit OFFSET :Offset", map[string]interface{}{"Limit": limit, "Offset": offset, "Scope": scope}); err != nil {
+		result.Err = model.NewAppError("SqlSchemeStore.Get", "store.sql_scheme.get.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	result.Data = schemes
+
+	return result
+}
+
+func (s *SqlSupplier) SchemePermanentDeleteAll(ctx context.Context, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	if _, err := withContext(s.GetMaster(), ctx).Exec("DELETE from Schemes"); err != nil {
+		result.Err = model.NewAppError("SqlSchemeStore.PermanentDeleteAll", "store.sql_scheme.permanent_delete_all.app_error", nil, err.Error(), http.StatusInternalServerError)
+	}
+
+	return result
+}
+
+// SqlSchemeStore exposes the scheme methods of the supplier as a store.SchemeStore.
+type SqlSchemeStore struct {
+	supplier *SqlSupplier
+	ctx      context.Context
+}
+
+func (s SqlSchemeStore) Save(scheme *model.Scheme) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.SchemeSave(s.ctx, scheme)
+	})
+}
+
+func (s SqlSchemeStore) Get(schemeId string) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.SchemeGet(s.ctx, schemeId)
+	})
+}
+
+func (s SqlSchemeStore) Delete(schemeId string) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.SchemeDelete(s.ctx, schemeId)
+	})
+}
+
+func (s SqlSchemeStore) GetAllPage(scope string, offset int, limit int) store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.SchemeGetAllPage(s.ctx, scope, offset, limit)
+	})
+}
+
+func (s SqlSchemeStore) PermanentDeleteAll() store.StoreChannel {
+	return doSupplierQuery(func() *store.LayeredStoreSupplierResult {
+		return s.supplier.SchemePermanentDeleteAll(s.ctx)
+	})
+}
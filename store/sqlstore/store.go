@@ -0,0 +1,28 @@
+package sqlstore
+
+import (
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+// SqlStore is what the individual sql stores need from the supplier that owns the connections.
+type SqlStore interface {
+	DriverName() string
+	GetMaster() gorp.SqlExecutor
+	GetSearchReplica() gorp.SqlExecutor
+	GetReplica() gorp.SqlExecutor
+	GetAllConns() []*gorp.DbMap
+	DoesTableExist(tablename string) (bool, error)
+	DoesColumnExist(tableName string, columName string) (bool, error)
+	CreateIndexIfNotExists(indexName string, tableName string, columnName string) (bool, error)
+	CreateUniqueIndexIfNotExists(indexName string, tableName string, columnName string) (bool, error)
+	CreateCompositeIndexIfNotExists(indexName string, tableName string, columnNames []string) (bool, error)
+	CreateFullTextIndexIfNotExists(indexName string, tableName string, columnName string) (bool, error)
+	RemoveIndexIfExists(indexName string, tableName string) (bool, error)
+	Close()
+	Post() store.PostStore
+	User() store.UserStore
+	Session() store.SessionStore
+	Keyring() *Keyring
+}
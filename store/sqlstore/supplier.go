@@ -1,22 +1,32 @@
 package sqlstore
 
 import (
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
 	"github.com/OhBonsai/go-web-boilerplate/store"
 	"github.com/OhBonsai/go-web-boilerplate/model"
 	"github.com/mattermost/gorp"
-	"github.com/mattermost/mattermost-server/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
 	"fmt"
 	"time"
-	"os"
 	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/utils"
+
+	// Full text search on SQLite uses FTS5, which go-sqlite3 only includes with the sqlite_fts5 build tag.
+	// Without it posts are searched with LIKE, see sqliteFullTextAvailable.
+	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
 	INDEX_TYPE_FULL_TEXT	 	= "full_text"
 	INDEX_TYPE_DEFAULT   	= "default"
 	MAX_DB_CONN_LIFETIME 	= 60
-	DB_PING_ATTEMPTS     		= 18
-	DB_PING_TIMEOUT_SECS 	= 10
+	DB_PING_INITIAL_BACKOFF 	= time.Second
 )
 
 const (
@@ -49,6 +59,8 @@ const (
 	EXIT_REMOVE_INDEX_SQLITE         	= 136
 	EXIT_TABLE_EXISTS_SQLITE         	= 137
 	EXIT_DOES_COLUMN_EXISTS_SQLITE   	= 138
+	EXIT_MIGRATE                     	= 139
+	EXIT_ENCRYPTION_KEY              	= 140
 )
 type SqlSupplier struct {
 	// rrCounter and srCounter should be kept first.
@@ -57,115 +69,781 @@ type SqlSupplier struct {
 	srCounter      int64
 	next           store.LayeredStoreSupplier
 	master         *gorp.DbMap
-	replicas       []*gorp.DbMap
-	searchReplicas []*gorp.DbMap
+	replicaLock    sync.RWMutex
+	replicas       []*replica
+	searchReplicas []*replica
+	replicaMaxLag  time.Duration
 	oldStores      SqlSupplierOldStores
 	settings       *model.SqlSettings
+	metrics        einterfaces.MetricsInterface
+	keyring        *Keyring
+
+	// transaction is set on the view of the store that WithTransaction passes on.
+	transaction *transaction
+
+	replicaReloadLock    sync.Mutex
+	closingReplicas      map[*replica]*time.Timer
+	replicaCheckInterval time.Duration
+	stopReplicaCheck     chan struct{}
+	replicaCheckStopped  chan struct{}
 }
 
 type SqlSupplierOldStores struct {
 	post                 store.PostStore
+	user                 store.UserStore
+	session              store.SessionStore
+	reaction             store.ReactionStore
+	role                 store.RoleStore
+	scheme               store.SchemeStore
+}
+
+func NewSqlSupplier(ctx context.Context, settings model.SqlSettings, metrics einterfaces.MetricsInterface) (*SqlSupplier, error) {
+	supplier, err := OpenSqlSupplier(ctx, settings, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := supplier.createSchema(); err != nil {
+		supplier.Close()
+		return nil, err
+	}
+
+	return supplier, nil
 }
 
-func NewSqlSupplier(settings model.SqlSettings, metrics einterfaces.MetricsInterface) *SqlSupplier {
+// OpenSqlSupplier connects to the database and maps the tables without creating or migrating them, for
+// tools that manage the schema themselves. Servers use NewSqlSupplier.
+func OpenSqlSupplier(ctx context.Context, settings model.SqlSettings, metrics einterfaces.MetricsInterface) (*SqlSupplier, error) {
 	supplier := &SqlSupplier{
 		rrCounter: 0,
 		srCounter: 0,
 		settings:  &settings,
+		metrics:   metrics,
 	}
 
-	supplier.initConnection()
+	if err := supplier.initConnection(ctx); err != nil {
+		return nil, err
+	}
 
 	supplier.oldStores.post = NewSqlPostStore(supplier, metrics)
+	supplier.oldStores.user = NewSqlUserStore(supplier, metrics)
+	supplier.oldStores.session = NewSqlSessionStore(supplier)
+	supplier.oldStores.reaction = SqlReactionStore{supplier, context.Background()}
+	supplier.oldStores.role = SqlRoleStore{supplier, context.Background()}
+	supplier.oldStores.scheme = SqlSchemeStore{supplier, context.Background()}
 
-	//initSqlSupplierReactions(supplier)
-	//initSqlSupplierRoles(supplier)
-	//initSqlSupplierSchemes(supplier)
+	supplier.startReplicaHealthCheck()
 
-	err := supplier.GetMaster().CreateTablesIfNotExists()
-	if err != nil {
-		mlog.Critical(fmt.Sprintf("Error creating database tables: %v", err))
-		time.Sleep(time.Second)
-		os.Exit(EXIT_CREATE_TABLE)
+	return supplier, nil
+}
+
+func (ss *SqlSupplier) createSchema() error {
+	if appErr := NewMigrator(ss).migrate(); appErr != nil {
+		return NewSqlStoreError(EXIT_MIGRATE, "Error migrating the database schema", appErr)
+	}
+
+	if err := ss.oldStores.post.(*SqlPostStore).CreateIndexesIfNotExists(); err != nil {
+		return err
+	}
+	if err := ss.oldStores.user.(*SqlUserStore).CreateIndexesIfNotExists(); err != nil {
+		return err
 	}
+	return ss.oldStores.session.(*SqlSessionStore).CreateIndexesIfNotExists()
+}
 
-	UpgradeDatabase(supplier)
+// mapTables maps the tables of all the stores on a connection. Every connection of the supplier goes through
+// it, the replicas ReloadReplicas adds included, so that gorp finds the tables whichever one a query picks.
+func mapTables(db *gorp.DbMap) {
+	mapPostsTable(db)
+	mapUsersTable(db)
+	mapSessionsTable(db)
+	mapReactionsTable(db)
+	mapRolesTable(db)
+	mapSchemesTable(db)
+	mapMigrationsTable(db)
+}
 
-	supplier.oldStores.post.(*SqlPostStore).CreateIndexesIfNotExists()
+func setupConnection(ctx context.Context, con_type string, dataSource string, settings *model.SqlSettings, keyring *Keyring, metrics einterfaces.MetricsInterface) (*gorp.DbMap, error) {
+	dbmap, err := openConnection(con_type, dataSource, settings, keyring, metrics)
+	if err != nil {
+		return nil, err
+	}
 
+	if err := NewRetryPolicy(settings).ping(ctx, con_type, dbmap.Db); err != nil {
+		dbmap.Db.Close()
+		return nil, NewSqlStoreError(EXIT_PING, "Failed to ping DB", err)
+	}
 
-	return supplier
+	return dbmap, nil
 }
 
-func setupConnection(con_type string, dataSource string, settings *model.SqlSettings) *gorp.DbMap {
-	db, err := dbsql.Open(*settings.DriverName, dataSource)
+// openConnection sets up the connection pool for dataSource without waiting for the database to answer. Its
+// queries are reported to metrics and the logs under the name con_type. The model.EncryptedString fields it
+// maps are encrypted with keyring, which only connections without such fields may leave nil.
+func openConnection(con_type string, dataSource string, settings *model.SqlSettings, keyring *Keyring, metrics einterfaces.MetricsInterface) (*gorp.DbMap, error) {
+	db, err := openDB(*settings.DriverName, dataSource, newQueryObserver(con_type, settings, metrics))
 	if err != nil {
-		mlog.Critical(fmt.Sprintf("Failed to open SQL connection to err:%v", err.Error()))
-		time.Sleep(time.Second)
-		os.Exit(EXIT_DB_OPEN)
+		return nil, NewSqlStoreError(EXIT_DB_OPEN, "Failed to open SQL connection", err)
 	}
 
-	for i := 0; i < DB_PING_ATTEMPTS; i++ {
-		mlog.Info(fmt.Sprintf("Pinging SQL %v database", con_type))
-		ctx, cancel := context.WithTimeout(context.Background(), DB_PING_TIMEOUT_SECS*time.Second)
-		defer cancel()
-		err = db.PingContext(ctx)
-		if err == nil {
-			break
-		} else {
-			if i == DB_PING_ATTEMPTS-1 {
-				mlog.Critical(fmt.Sprintf("Failed to ping DB, server will exit err=%v", err))
-				time.Sleep(time.Second)
-				os.Exit(EXIT_PING)
-			} else {
-				mlog.Error(fmt.Sprintf("Failed to ping DB retrying in %v seconds err=%v", DB_PING_TIMEOUT_SECS, err))
-				time.Sleep(DB_PING_TIMEOUT_SECS * time.Second)
-			}
-		}
+	if *settings.DriverName == model.DATABASE_DRIVER_SQLITE {
+		// SQLite takes a single writer at a time, and an in-memory database only lives as long as a
+		// connection to it is open, so all queries share one connection that is never recycled.
+		db.SetMaxIdleConns(1)
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxIdleConns(*settings.MaxIdleConns)
+		db.SetMaxOpenConns(*settings.MaxOpenConns)
+		db.SetConnMaxLifetime(time.Duration(MAX_DB_CONN_LIFETIME) * time.Minute)
 	}
 
-	db.SetMaxIdleConns(*settings.MaxIdleConns)
-	db.SetMaxOpenConns(*settings.MaxOpenConns)
-	db.SetConnMaxLifetime(time.Duration(MAX_DB_CONN_LIFETIME) * time.Minute)
+	var converter gorp.TypeConverter = mattermConverter{}
+	if keyring != nil {
+		converter = encryptionConverter{TypeConverter: converter, keyring: keyring}
+	}
 
 	var dbmap *gorp.DbMap
 
 	connectionTimeout := time.Duration(*settings.QueryTimeout) * time.Second
 
 	if *settings.DriverName == model.DATABASE_DRIVER_SQLITE {
-		dbmap = &gorp.DbMap{Db: db, TypeConverter: mattermConverter{}, Dialect: gorp.SqliteDialect{}, QueryTimeout: connectionTimeout}
+		dbmap = &gorp.DbMap{Db: db, TypeConverter: converter, Dialect: gorp.SqliteDialect{}, QueryTimeout: connectionTimeout}
 	} else if *settings.DriverName == model.DATABASE_DRIVER_MYSQL {
-		dbmap = &gorp.DbMap{Db: db, TypeConverter: mattermConverter{}, Dialect: gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8MB4"}, QueryTimeout: connectionTimeout}
+		dbmap = &gorp.DbMap{Db: db, TypeConverter: converter, Dialect: gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8MB4"}, QueryTimeout: connectionTimeout}
 	} else if *settings.DriverName == model.DATABASE_DRIVER_POSTGRES {
-		dbmap = &gorp.DbMap{Db: db, TypeConverter: mattermConverter{}, Dialect: gorp.PostgresDialect{}, QueryTimeout: connectionTimeout}
+		dbmap = &gorp.DbMap{Db: db, TypeConverter: converter, Dialect: gorp.PostgresDialect{}, QueryTimeout: connectionTimeout}
 	} else {
-		mlog.Critical("Failed to create dialect specific driver")
-		time.Sleep(time.Second)
-		os.Exit(EXIT_NO_DRIVER)
+		db.Close()
+		return nil, NewSqlStoreError(EXIT_NO_DRIVER, "Failed to create dialect specific driver", nil)
+	}
+
+	return dbmap, nil
+}
+
+
+func (s *SqlSupplier) initConnection(ctx context.Context) error {
+	var err error
+	if s.keyring, err = NewKeyring(s.settings.AtRestEncryptKey, s.settings.AtRestDecryptKeys...); err != nil {
+		return NewSqlStoreError(EXIT_ENCRYPTION_KEY, "Failed to load the at rest encryption keys", err)
+	}
+
+	if s.master, err = setupConnection(ctx, "master", *s.settings.DataSource, s.settings, s.keyring, s.metrics); err != nil {
+		return err
+	}
+	mapTables(s.master)
+
+	for i, dataSource := range s.settings.DataSourceReplicas {
+		r, err := newReplica(ctx, fmt.Sprintf("replica-%v", i), dataSource, s.settings, s.keyring, s.metrics)
+		if err != nil {
+			s.Close()
+			return err
+		}
+		s.replicas = append(s.replicas, r)
 	}
 
-	if settings.Trace {
-		dbmap.TraceOn("", sqltrace.New(os.Stdout, "sql-trace:", sqltrace.Lmicroseconds))
+	for i, dataSource := range s.settings.DataSourceSearchReplicas {
+		r, err := newReplica(ctx, fmt.Sprintf("search-replica-%v", i), dataSource, s.settings, s.keyring, s.metrics)
+		if err != nil {
+			s.Close()
+			return err
+		}
+		s.searchReplicas = append(s.searchReplicas, r)
+	}
+
+	s.replicaMaxLag = time.Duration(*s.settings.ReplicaLagThresholdSeconds) * time.Second
+	s.replicaCheckInterval = time.Duration(*s.settings.ReplicaHealthCheckIntervalSeconds) * time.Second
+
+	return nil
+}
+
+// GetMaster returns the master, or the transaction on it in the view of a transaction.
+func (ss *SqlSupplier) GetMaster() gorp.SqlExecutor {
+	if ss.transaction != nil {
+		return ss.transaction
 	}
+	return ss.master
+}
+
+func (s *SqlSupplier) SetChainNext(next store.LayeredStoreSupplier) {
+	s.next = next
+}
+
+func (s *SqlSupplier) Next() store.LayeredStoreSupplier {
+	return s.next
+}
+
+// GetSearchReplica returns the next usable search replica, and otherwise what GetReplica returns.
+func (ss *SqlSupplier) GetSearchReplica() gorp.SqlExecutor {
+	ss.replicaLock.RLock()
+	dbmap := pickReplica(ss.searchReplicas, &ss.srCounter, ss.replicaMaxLag)
+	ss.replicaLock.RUnlock()
 
+	if dbmap == nil {
+		return ss.GetReplica()
+	}
 	return dbmap
 }
 
+// GetReplica returns the next usable replica in turn, skipping those that failed their last health check or
+// lag too far behind. It returns the master when there is none.
+func (ss *SqlSupplier) GetReplica() gorp.SqlExecutor {
+	ss.replicaLock.RLock()
+	dbmap := pickReplica(ss.replicas, &ss.rrCounter, ss.replicaMaxLag)
+	ss.replicaLock.RUnlock()
 
-func (s *SqlSupplier) initConnection() {
-	s.master = setupConnection("master", *s.settings.DataSource, s.settings)
+	if dbmap == nil {
+		return ss.GetMaster()
+	}
+	return dbmap
+}
 
-	if len(s.settings.DataSourceReplicas) > 0 {
-		s.replicas = make([]*gorp.DbMap, len(s.settings.DataSourceReplicas))
-		for i, replica := range s.settings.DataSourceReplicas {
-			s.replicas[i] = setupConnection(fmt.Sprintf("replica-%v", i), replica, s.settings)
+// readConn picks the connection a read should go to, honouring LSH_MASTER_ONLY.
+func (ss *SqlSupplier) readConn(hints []store.LayeredStoreHint) gorp.SqlExecutor {
+	for _, hint := range hints {
+		if hint == store.LSH_MASTER_ONLY {
+			return ss.GetMaster()
 		}
 	}
 
-	if len(s.settings.DataSourceSearchReplicas) > 0 {
-		s.searchReplicas = make([]*gorp.DbMap, len(s.settings.DataSourceSearchReplicas))
-		for i, replica := range s.settings.DataSourceSearchReplicas {
-			s.searchReplicas[i] = setupConnection(fmt.Sprintf("search-replica-%v", i), replica, s.settings)
+	return ss.GetReplica()
+}
+
+func (ss *SqlSupplier) GetAllConns() []*gorp.DbMap {
+	ss.replicaLock.RLock()
+	defer ss.replicaLock.RUnlock()
+
+	all := make([]*gorp.DbMap, 0, len(ss.replicas)+1)
+	for _, r := range ss.replicas {
+		all = append(all, r.dbmap)
+	}
+	return append(all, ss.master)
+}
+
+func (ss *SqlSupplier) DriverName() string {
+	return *ss.settings.DriverName
+}
+
+func (ss *SqlSupplier) DoesTableExist(tableName string) (bool, error) {
+	if ss.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		count, err := ss.GetMaster().SelectInt(
+			`SELECT count(relname) FROM pg_class WHERE relname=$1`,
+			strings.ToLower(tableName),
+		)
+
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_TABLE_EXISTS, "Failed to check if table exists", err)
+		}
+
+		return count > 0, nil
+
+	} else if ss.DriverName() == model.DATABASE_DRIVER_MYSQL {
+
+		count, err := ss.GetMaster().SelectInt(
+			`SELECT
+		    COUNT(0) AS table_exists
+			FROM
+			    information_schema.TABLES
+			WHERE
+			    TABLE_SCHEMA = DATABASE()
+			        AND TABLE_NAME = ?
+		    `,
+			tableName,
+		)
+
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_TABLE_EXISTS_MYSQL, "Failed to check if table exists", err)
+		}
+
+		return count > 0, nil
+
+	} else if ss.DriverName() == model.DATABASE_DRIVER_SQLITE {
+		count, err := ss.GetMaster().SelectInt(
+			`SELECT COUNT(0) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+			tableName,
+		)
+
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_TABLE_EXISTS_SQLITE, "Failed to check if table exists", err)
+		}
+
+		return count > 0, nil
+
+	} else {
+		return false, NewSqlStoreError(EXIT_COLUMN_EXISTS, "Failed to check if table exists because of missing driver", nil)
+	}
+}
+
+func (ss *SqlSupplier) DoesColumnExist(tableName string, columnName string) (bool, error) {
+	if ss.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		count, err := ss.GetMaster().SelectInt(
+			`SELECT COUNT(0)
+			FROM   pg_attribute
+			WHERE  attrelid = $1::regclass
+			AND    attname = $2
+			AND    NOT attisdropped`,
+			strings.ToLower(tableName),
+			strings.ToLower(columnName),
+		)
+
+		if err != nil {
+			if err.Error() == "pq: relation \""+strings.ToLower(tableName)+"\" does not exist" {
+				return false, nil
+			}
+
+			return false, NewSqlStoreError(EXIT_DOES_COLUMN_EXISTS_POSTGRES, "Failed to check if column exists", err)
+		}
+
+		return count > 0, nil
+
+	} else if ss.DriverName() == model.DATABASE_DRIVER_MYSQL {
+
+		count, err := ss.GetMaster().SelectInt(
+			`SELECT
+		    COUNT(0) AS column_exists
+		FROM
+		    information_schema.COLUMNS
+		WHERE
+		    TABLE_SCHEMA = DATABASE()
+		        AND TABLE_NAME = ?
+		        AND COLUMN_NAME = ?`,
+			tableName,
+			columnName,
+		)
+
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_DOES_COLUMN_EXISTS_MYSQL, "Failed to check if column exists", err)
+		}
+
+		return count > 0, nil
+
+	} else if ss.DriverName() == model.DATABASE_DRIVER_SQLITE {
+		count, err := ss.GetMaster().SelectInt(
+			`SELECT COUNT(0) FROM pragma_table_info(?) WHERE name = ?`,
+			tableName,
+			columnName,
+		)
+
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_DOES_COLUMN_EXISTS_SQLITE, "Failed to check if column exists", err)
 		}
+
+		return count > 0, nil
+
+	} else {
+		return false, NewSqlStoreError(EXIT_DOES_COLUMN_EXISTS_MISSING, "Failed to check if column exists because of missing driver", nil)
 	}
-}
\ No newline at end of file
+}
+
+func (ss *SqlSupplier) CreateIndexIfNotExists(indexName string, tableName string, columnName string) (bool, error) {
+	return ss.createIndexIfNotExists(indexName, tableName, []string{columnName}, INDEX_TYPE_DEFAULT, false)
+}
+
+func (ss *SqlSupplier) CreateUniqueIndexIfNotExists(indexName string, tableName string, columnName string) (bool, error) {
+	return ss.createIndexIfNotExists(indexName, tableName, []string{columnName}, INDEX_TYPE_DEFAULT, true)
+}
+
+func (ss *SqlSupplier) CreateCompositeIndexIfNotExists(indexName string, tableName string, columnNames []string) (bool, error) {
+	return ss.createIndexIfNotExists(indexName, tableName, columnNames, INDEX_TYPE_DEFAULT, false)
+}
+
+func (ss *SqlSupplier) CreateFullTextIndexIfNotExists(indexName string, tableName string, columnName string) (bool, error) {
+	return ss.createIndexIfNotExists(indexName, tableName, []string{columnName}, INDEX_TYPE_FULL_TEXT, false)
+}
+
+func (ss *SqlSupplier) createIndexIfNotExists(indexName string, tableName string, columnNames []string, indexType string, unique bool) (bool, error) {
+
+	uniqueStr := ""
+	if unique {
+		uniqueStr = "UNIQUE "
+	}
+
+	if ss.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		_, errExists := ss.GetMaster().SelectStr("SELECT $1::regclass", indexName)
+		// It should fail if the index does not exist
+		if errExists == nil {
+			return false, nil
+		}
+
+		query := ""
+		if indexType == INDEX_TYPE_FULL_TEXT {
+			if len(columnNames) != 1 {
+				return false, NewSqlStoreError(EXIT_CREATE_INDEX_POSTGRES, "Unable to create multi column full text index "+indexName, nil)
+			}
+			columnName := columnNames[0]
+			postgresColumnNames := convertMySQLFullTextColumnsToPostgres(columnName)
+			query = "CREATE INDEX " + indexName + " ON " + tableName + " USING gin(to_tsvector('english', " + postgresColumnNames + "))"
+		} else {
+			query = "CREATE " + uniqueStr + "INDEX " + indexName + " ON " + tableName + " (" + strings.Join(columnNames, ", ") + ")"
+		}
+
+		_, err := ss.GetMaster().ExecNoTimeout(query)
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_CREATE_INDEX_POSTGRES, "Failed to create index "+indexName, err)
+		}
+	} else if ss.DriverName() == model.DATABASE_DRIVER_MYSQL {
+
+		count, err := ss.GetMaster().SelectInt("SELECT COUNT(0) AS index_exists FROM information_schema.statistics WHERE TABLE_SCHEMA = DATABASE() and table_name = ? AND index_name = ?", tableName, indexName)
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_CREATE_INDEX_MYSQL, "Failed to check index "+indexName, err)
+		}
+
+		if count > 0 {
+			return false, nil
+		}
+
+		fullTextIndex := ""
+		if indexType == INDEX_TYPE_FULL_TEXT {
+			fullTextIndex = " FULLTEXT "
+		}
+
+		_, err = ss.GetMaster().ExecNoTimeout("CREATE  " + uniqueStr + fullTextIndex + " INDEX " + indexName + " ON " + tableName + " (" + strings.Join(columnNames, ", ") + ")")
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_CREATE_INDEX_FULL_MYSQL, "Failed to create index "+indexName, err)
+		}
+	} else if ss.DriverName() == model.DATABASE_DRIVER_SQLITE {
+		if indexType == INDEX_TYPE_FULL_TEXT {
+			return ss.createSqliteFullTextTableIfNotExists(indexName, tableName, columnNames)
+		}
+
+		count, err := ss.GetMaster().SelectInt("SELECT COUNT(0) FROM sqlite_master WHERE type = 'index' AND name = ?", indexName)
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_CREATE_INDEX_SQLITE, "Failed to check index "+indexName, err)
+		}
+
+		if count > 0 {
+			return false, nil
+		}
+
+		_, err = ss.GetMaster().ExecNoTimeout("CREATE " + uniqueStr + "INDEX " + indexName + " ON " + tableName + " (" + strings.Join(columnNames, ", ") + ")")
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_CREATE_INDEX_SQLITE, "Failed to create index "+indexName, err)
+		}
+	} else {
+		return false, NewSqlStoreError(EXIT_CREATE_INDEX_MISSING, "Failed to create index because of missing driver", nil)
+	}
+
+	return true, nil
+}
+
+var (
+	sqliteFullTextOnce      sync.Once
+	sqliteFullTextSupported bool
+)
+
+// sqliteFullTextAvailable reports whether the SQLite linked in was built with FTS5. When it wasn't, full text
+// indexes are skipped and posts are searched with LIKE.
+func sqliteFullTextAvailable() bool {
+	sqliteFullTextOnce.Do(func() {
+		db, err := dbsql.Open(model.DATABASE_DRIVER_SQLITE, ":memory:")
+		if err != nil {
+			return
+		}
+		defer db.Close()
+
+		if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&sqliteFullTextSupported); err != nil {
+			sqliteFullTextSupported = false
+		}
+
+		if !sqliteFullTextSupported {
+			mlog.Warn("SQLite was built without FTS5, posts are searched without a full text index. Build with -tags sqlite_fts5 to enable it.")
+		}
+	})
+
+	return sqliteFullTextSupported
+}
+
+// createSqliteFullTextTableIfNotExists stands in for a full text index on SQLite, which has none. It creates an
+// FTS5 table of the indexed columns keyed by the Id of their row, and triggers that keep it in step with the table.
+// Search it with "Id IN (SELECT Id FROM <indexName> WHERE <indexName> MATCH ...)".
+func (ss *SqlSupplier) createSqliteFullTextTableIfNotExists(indexName string, tableName string, columnNames []string) (bool, error) {
+	if !sqliteFullTextAvailable() {
+		return false, nil
+	}
+
+	if exists, err := ss.DoesTableExist(indexName); err != nil || exists {
+		return false, err
+	}
+
+	var columns []string
+	for _, columnName := range columnNames {
+		columns = append(columns, strings.Split(columnName, ", ")...)
+	}
+
+	var newValues, changed, sets []string
+	for _, column := range columns {
+		newValues = append(newValues, "new."+column)
+		changed = append(changed, "old."+column+" IS NOT new."+column)
+		sets = append(sets, column+" = new."+column)
+	}
+
+	columnList := strings.Join(columns, ", ")
+
+	statements := []string{
+		"CREATE VIRTUAL TABLE " + indexName + " USING fts5(Id UNINDEXED, " + columnList + ")",
+		"CREATE TRIGGER " + indexName + "_insert AFTER INSERT ON " + tableName + " BEGIN " +
+			"INSERT INTO " + indexName + " (Id, " + columnList + ") VALUES (new.Id, " + strings.Join(newValues, ", ") + "); END",
+		"CREATE TRIGGER " + indexName + "_update AFTER UPDATE ON " + tableName + " WHEN " + strings.Join(changed, " OR ") + " BEGIN " +
+			"UPDATE " + indexName + " SET " + strings.Join(sets, ", ") + " WHERE Id = new.Id; END",
+		"CREATE TRIGGER " + indexName + "_delete AFTER DELETE ON " + tableName + " BEGIN " +
+			"DELETE FROM " + indexName + " WHERE Id = old.Id; END",
+		"INSERT INTO " + indexName + " (Id, " + columnList + ") SELECT Id, " + columnList + " FROM " + tableName,
+	}
+
+	transaction, err := ss.master.Begin()
+	if err != nil {
+		return false, NewSqlStoreError(EXIT_CREATE_INDEX_SQLITE, "Failed to create index "+indexName, err)
+	}
+
+	for _, statement := range statements {
+		if _, err := transaction.Exec(statement); err != nil {
+			transaction.Rollback()
+			return false, NewSqlStoreError(EXIT_CREATE_INDEX_SQLITE, "Failed to create index "+indexName, err)
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return false, NewSqlStoreError(EXIT_CREATE_INDEX_SQLITE, "Failed to create index "+indexName, err)
+	}
+
+	return true, nil
+}
+
+func (ss *SqlSupplier) RemoveIndexIfExists(indexName string, tableName string) (bool, error) {
+
+	if ss.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		_, err := ss.GetMaster().SelectStr("SELECT $1::regclass", indexName)
+		// It should fail if the index does not exist
+		if err != nil {
+			return false, nil
+		}
+
+		_, err = ss.GetMaster().ExecNoTimeout("DROP INDEX " + indexName)
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_REMOVE_INDEX_POSTGRES, "Failed to remove index "+indexName, err)
+		}
+
+		return true, nil
+	} else if ss.DriverName() == model.DATABASE_DRIVER_MYSQL {
+
+		count, err := ss.GetMaster().SelectInt("SELECT COUNT(0) AS index_exists FROM information_schema.statistics WHERE TABLE_SCHEMA = DATABASE() and table_name = ? AND index_name = ?", tableName, indexName)
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_REMOVE_INDEX_MYSQL, "Failed to check index "+indexName, err)
+		}
+
+		if count <= 0 {
+			return false, nil
+		}
+
+		_, err = ss.GetMaster().ExecNoTimeout("DROP INDEX " + indexName + " ON " + tableName)
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_REMOVE_INDEX_MYSQL, "Failed to remove index "+indexName, err)
+		}
+	} else if ss.DriverName() == model.DATABASE_DRIVER_SQLITE {
+		indexType, err := ss.GetMaster().SelectNullStr("SELECT type FROM sqlite_master WHERE name = ? AND type IN ('index', 'table')", indexName)
+		if err != nil {
+			return false, NewSqlStoreError(EXIT_REMOVE_INDEX_SQLITE, "Failed to check index "+indexName, err)
+		}
+
+		if !indexType.Valid {
+			return false, nil
+		}
+
+		statements := []string{"DROP INDEX " + indexName}
+
+		// full text indexes are tables, see createSqliteFullTextTableIfNotExists
+		if indexType.String == "table" {
+			statements = []string{
+				"DROP TRIGGER IF EXISTS " + indexName + "_insert",
+				"DROP TRIGGER IF EXISTS " + indexName + "_update",
+				"DROP TRIGGER IF EXISTS " + indexName + "_delete",
+				"DROP TABLE " + indexName,
+			}
+		}
+
+		for _, statement := range statements {
+			if _, err := ss.GetMaster().ExecNoTimeout(statement); err != nil {
+				return false, NewSqlStoreError(EXIT_REMOVE_INDEX_SQLITE, "Failed to remove index "+indexName, err)
+			}
+		}
+	} else {
+		return false, NewSqlStoreError(EXIT_REMOVE_INDEX_MISSING, "Failed to remove index because of missing driver", nil)
+	}
+
+	return true, nil
+}
+
+func (ss *SqlSupplier) Post() store.PostStore {
+	return ss.oldStores.post
+}
+
+func (ss *SqlSupplier) User() store.UserStore {
+	return ss.oldStores.user
+}
+
+func (ss *SqlSupplier) Session() store.SessionStore {
+	return ss.oldStores.session
+}
+
+func (ss *SqlSupplier) Reaction() store.ReactionStore {
+	return ss.oldStores.reaction
+}
+
+func (ss *SqlSupplier) Role() store.RoleStore {
+	return ss.oldStores.role
+}
+
+func (ss *SqlSupplier) Scheme() store.SchemeStore {
+	return ss.oldStores.scheme
+}
+
+// doSupplierQuery runs a supplier method like store.Do runs a store query.
+func doSupplierQuery(f func() *store.LayeredStoreSupplierResult) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		*result = f().StoreResult
+	})
+}
+
+func (ss *SqlSupplier) Close() {
+	// The view of a transaction shares the connections of the store it was made from.
+	if ss.transaction != nil {
+		return
+	}
+
+	mlog.Info("Closing SqlStore")
+	ss.stopReplicaHealthCheck()
+
+	if post, ok := ss.oldStores.post.(*SqlPostStore); ok {
+		post.lastPostTimeCache.Unregister()
+		post.lastPostsCache.Unregister()
+	}
+
+	if ss.master != nil {
+		ss.master.Db.Close()
+	}
+
+	ss.replicaLock.Lock()
+	defer ss.replicaLock.Unlock()
+
+	for _, r := range ss.replicas {
+		r.dbmap.Db.Close()
+	}
+	for _, r := range ss.searchReplicas {
+		r.dbmap.Db.Close()
+	}
+	for r, timer := range ss.closingReplicas {
+		if timer.Stop() {
+			r.dbmap.Db.Close()
+		}
+	}
+	ss.closingReplicas = nil
+}
+
+func IsUniqueConstraintError(err error, indexName []string) bool {
+	unique := false
+	msg := err.Error()
+	if strings.Contains(msg, "unique constraint") || strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "duplicate key value") || strings.Contains(msg, "23505") ||
+		strings.Contains(msg, "Duplicate entry") {
+		unique = true
+	}
+
+	field := false
+	for _, contain := range indexName {
+		if strings.Contains(msg, contain) {
+			field = true
+			break
+		}
+	}
+
+	return unique && field
+}
+
+type mattermConverter struct{}
+
+func (me mattermConverter) ToDb(val interface{}) (interface{}, error) {
+
+	switch t := val.(type) {
+	case model.StringMap:
+		return model.MapToJson(t), nil
+	case map[string]string:
+		return model.MapToJson(model.StringMap(t)), nil
+	case model.StringArray:
+		return model.ArrayToJson(t), nil
+	case model.StringInterface:
+		return model.StringInterfaceToJson(t), nil
+	case map[string]interface{}:
+		return model.StringInterfaceToJson(model.StringInterface(t)), nil
+	}
+
+	return val, nil
+}
+
+func (me mattermConverter) FromDb(target interface{}) (gorp.CustomScanner, bool) {
+	switch target.(type) {
+	case *model.StringMap:
+		binder := func(holder, target interface{}) error {
+			s, ok := holder.(*string)
+			if !ok {
+				return errors.New(utils.T("store.sql.convert_string_map"))
+			}
+			b := []byte(*s)
+			return json.Unmarshal(b, target)
+		}
+		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	case *map[string]string:
+		binder := func(holder, target interface{}) error {
+			s, ok := holder.(*string)
+			if !ok {
+				return errors.New(utils.T("store.sql.convert_string_map"))
+			}
+			b := []byte(*s)
+			return json.Unmarshal(b, target)
+		}
+		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	case *model.StringArray:
+		binder := func(holder, target interface{}) error {
+			s, ok := holder.(*string)
+			if !ok {
+				return errors.New(utils.T("store.sql.convert_string_array"))
+			}
+			b := []byte(*s)
+			return json.Unmarshal(b, target)
+		}
+		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	case *model.StringInterface:
+		binder := func(holder, target interface{}) error {
+			s, ok := holder.(*string)
+			if !ok {
+				return errors.New(utils.T("store.sql.convert_string_interface"))
+			}
+			b := []byte(*s)
+			return json.Unmarshal(b, target)
+		}
+		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	case *map[string]interface{}:
+		binder := func(holder, target interface{}) error {
+			s, ok := holder.(*string)
+			if !ok {
+				return errors.New(utils.T("store.sql.convert_string_interface"))
+			}
+			b := []byte(*s)
+			return json.Unmarshal(b, target)
+		}
+		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	}
+
+	return gorp.CustomScanner{}, false
+}
+
+func convertMySQLFullTextColumnsToPostgres(columnNames string) string {
+	columns := strings.Split(columnNames, ", ")
+	concatenatedColumnNames := ""
+	for i, c := range columns {
+		concatenatedColumnNames += c
+		if i < len(columns)-1 {
+			concatenatedColumnNames += " || ' ' || "
+		}
+	}
+
+	return concatenatedColumnNames
+}
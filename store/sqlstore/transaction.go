@@ -0,0 +1,221 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/mlog"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+const (
+	TRANSACTION_ATTEMPTS        = 5
+	TRANSACTION_INITIAL_BACKOFF = 10 * time.Millisecond
+	TRANSACTION_MAX_BACKOFF     = 500 * time.Millisecond
+)
+
+// transaction is a transaction on the master, or a savepoint inside one when it is begun on the view of a
+// transaction. Its statements run in the context it was begun in.
+type transaction struct {
+	*executor
+
+	tx        *gorp.Transaction
+	savepoint string
+	depth     int
+
+	// retryable is set once a statement of the transaction, or of a savepoint inside it, fails with an error
+	// after which the transaction may succeed when run again. The stores only keep the message of such an
+	// error, see IsRetryableTransactionError.
+	retryable *int32
+}
+
+// begin starts a transaction, or a savepoint inside the transaction of the view.
+func (ss *SqlSupplier) begin(ctx context.Context) (*transaction, error) {
+	if ss.transaction == nil {
+		tx, err := ss.master.Begin()
+		if err != nil {
+			return nil, err
+		}
+		return newTransaction(ctx, ss.master, tx, "", 0, new(int32)), nil
+	}
+
+	// Savepoints are named after their depth, which keeps the names of those open at the same time apart.
+	depth := ss.transaction.depth + 1
+	savepoint := fmt.Sprintf("savepoint_%d", depth)
+	if err := ss.transaction.tx.Savepoint(savepoint); err != nil {
+		return nil, err
+	}
+	return newTransaction(ctx, ss.master, ss.transaction.tx, savepoint, depth, ss.transaction.retryable), nil
+}
+
+func newTransaction(ctx context.Context, dbmap *gorp.DbMap, tx *gorp.Transaction, savepoint string, depth int, retryable *int32) *transaction {
+	t := &transaction{tx: tx, savepoint: savepoint, depth: depth, retryable: retryable}
+	t.executor = &executor{SqlExecutor: tx, dbmap: dbmap, ctx: ctx, failed: t.failed}
+	return t
+}
+
+func (t *transaction) failed(err error) {
+	if IsRetryableTransactionError(err) {
+		atomic.StoreInt32(t.retryable, 1)
+	}
+}
+
+// Commit commits the transaction, or releases its savepoint.
+func (t *transaction) Commit() error {
+	if t.savepoint == "" {
+		return t.tx.Commit()
+	}
+	return t.tx.ReleaseSavepoint(t.savepoint)
+}
+
+// Rollback rolls the transaction back, or rolls back to its savepoint and releases it, which leaves the
+// enclosing transaction as it was when the savepoint began.
+func (t *transaction) Rollback() error {
+	if t.savepoint == "" {
+		return t.tx.Rollback()
+	}
+	if err := t.tx.RollbackToSavepoint(t.savepoint); err != nil {
+		return err
+	}
+	return t.tx.ReleaseSavepoint(t.savepoint)
+}
+
+// WithTransaction runs f with a view of the store whose sub-stores all work in one transaction on the master,
+// reads included. A transaction nested in another one is a savepoint, which MySQL, Postgres and SQLite all
+// support. The outermost transaction runs again after a deadlock or serialization failure, see
+// IsRetryableTransactionError.
+func (ss *SqlSupplier) WithTransaction(ctx context.Context, f func(tx store.Store) error) error {
+	// Postgres and MySQL abort the whole transaction after a deadlock, so only the outermost one can retry.
+	if ss.transaction != nil {
+		err, _ := ss.runTransaction(ctx, f)
+		return err
+	}
+
+	policy := RetryPolicy{
+		Attempts:       TRANSACTION_ATTEMPTS,
+		InitialBackoff: TRANSACTION_INITIAL_BACKOFF,
+		MaxBackoff:     TRANSACTION_MAX_BACKOFF,
+	}
+
+	var err error
+	for attempt := 0; attempt < policy.Attempts; attempt++ {
+		var retryable bool
+		err, retryable = ss.runTransaction(ctx, f)
+		if err == nil || !retryable || attempt == policy.Attempts-1 {
+			break
+		}
+
+		backoff := policy.Backoff(attempt)
+		mlog.Warn(fmt.Sprintf("SQL transaction failed, retrying in %v err=%v", backoff, err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return store.NewContextError("SqlSupplier.WithTransaction", ctx.Err(), err.Error())
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// runTransaction begins a transaction, or a savepoint inside the transaction of the view, and commits it when
+// f succeeds. It also reports whether the transaction failed in a way that running it again may get past.
+func (ss *SqlSupplier) runTransaction(ctx context.Context, f func(tx store.Store) error) (error, bool) {
+	if ctx.Err() != nil {
+		return store.NewContextError("SqlSupplier.WithTransaction", ctx.Err(), ""), false
+	}
+
+	transaction, beginErr := ss.begin(ctx)
+	if beginErr != nil {
+		return ss.transactionError(ctx, "store.sql_transaction.begin.app_error", beginErr), IsRetryableTransactionError(beginErr)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			transaction.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := f(ss.transactionView(ctx, transaction)); !isNilError(err) {
+		if rollbackErr := transaction.Rollback(); rollbackErr != nil {
+			mlog.Error(fmt.Sprintf("Failed to roll back SQL transaction err=%v", rollbackErr))
+		}
+		return err, IsRetryableTransactionError(err) || atomic.LoadInt32(transaction.retryable) != 0
+	}
+
+	if commitErr := transaction.Commit(); commitErr != nil {
+		return ss.transactionError(ctx, "store.sql_transaction.commit.app_error", commitErr), IsRetryableTransactionError(commitErr)
+	}
+	return nil, false
+}
+
+func (ss *SqlSupplier) transactionError(ctx context.Context, id string, err error) *model.AppError {
+	if ctx.Err() != nil {
+		return store.NewContextError("SqlSupplier.WithTransaction", ctx.Err(), err.Error())
+	}
+	return model.NewAppError("SqlSupplier.WithTransaction", id, nil, err.Error(), http.StatusInternalServerError)
+}
+
+// transactionView returns a store whose queries all run in transaction. It shares the connections and caches of
+// ss, and has no replicas, so reads see what the transaction wrote.
+func (ss *SqlSupplier) transactionView(ctx context.Context, transaction *transaction) *SqlSupplier {
+	tx := &SqlSupplier{
+		next:        ss.next,
+		master:      ss.master,
+		settings:    ss.settings,
+		keyring:     ss.keyring,
+		transaction: transaction,
+	}
+
+	tx.oldStores.post = ss.oldStores.post.(*SqlPostStore).withSqlStore(tx, ctx)
+	tx.oldStores.user = &SqlUserStore{SqlStore: tx, metrics: ss.oldStores.user.(*SqlUserStore).metrics}
+	tx.oldStores.session = &SqlSessionStore{tx}
+	tx.oldStores.reaction = SqlReactionStore{tx, ctx}
+	tx.oldStores.role = SqlRoleStore{tx, ctx}
+	tx.oldStores.scheme = SqlSchemeStore{tx, ctx}
+
+	return tx
+}
+
+// isNilError reports whether err is nil, including a nil *model.AppError, which store calls return on success.
+func isNilError(err error) bool {
+	if appErr, ok := err.(*model.AppError); ok {
+		return appErr == nil
+	}
+	return err == nil
+}
+
+// IsRetryableTransactionError reports whether err is a deadlock, serialization failure or lock wait timeout in
+// Postgres or MySQL, after which the transaction may succeed when run again. The errors the stores return only
+// keep the message of the driver error, so WithTransaction also watches the statements of the transaction.
+func IsRetryableTransactionError(err error) bool {
+	if isNilError(err) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// deadlock_detected and serialization_failure
+		return pqErr.Code == "40P01" || pqErr.Code == "40001"
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_LOCK_DEADLOCK and ER_LOCK_WAIT_TIMEOUT
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+
+	return false
+}
@@ -0,0 +1,216 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+	"github.com/OhBonsai/go-web-boilerplate/store/storetest"
+)
+
+func TestWithTransaction(t *testing.T) {
+	storetest.TestWithTransaction(t, newSqliteSupplier(t))
+}
+
+func savePostInTransaction(t *testing.T, tx store.Store) *model.Post {
+	t.Helper()
+
+	post := &model.Post{ChannelId: model.NewId(), UserId: model.NewId(), Message: "transaction"}
+	if result := <-tx.Post().Save(post); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	return post
+}
+
+func checkPostSaved(t *testing.T, ss store.Store, post *model.Post, saved bool) {
+	t.Helper()
+
+	if result := <-ss.Post().GetSingle(post.Id); (result.Err == nil) != saved {
+		t.Fatalf("expected the post to be saved: %v, got %v", saved, result.Err)
+	}
+}
+
+func TestWithTransactionRetry(t *testing.T) {
+	ss := newSqliteSupplier(t)
+
+	t.Run("Deadlock", func(t *testing.T) {
+		var posts []*model.Post
+		err := ss.WithTransaction(context.Background(), func(tx store.Store) error {
+			posts = append(posts, savePostInTransaction(t, tx))
+			if len(posts) < 3 {
+				// A statement of the store failed on a deadlock, which the store only reports the message of.
+				tx.(*SqlSupplier).transaction.failed(&pq.Error{Code: "40P01", Message: "deadlock detected"})
+				return model.NewAppError("SqlPostStore.Save", "store.sql_post.save.app_error", nil, "pq: deadlock detected", 500)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(posts) != 3 {
+			t.Fatalf("expected 3 attempts, got %v", len(posts))
+		}
+		checkPostSaved(t, ss, posts[0], false)
+		checkPostSaved(t, ss, posts[1], false)
+		checkPostSaved(t, ss, posts[2], true)
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		attempts := 0
+		deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock; try restarting transaction"}
+		if err := ss.WithTransaction(context.Background(), func(tx store.Store) error {
+			attempts++
+			return deadlock
+		}); err != error(deadlock) {
+			t.Fatalf("expected the deadlock, got %v", err)
+		}
+
+		if attempts != TRANSACTION_ATTEMPTS {
+			t.Fatalf("expected %v attempts, got %v", TRANSACTION_ATTEMPTS, attempts)
+		}
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		attempts := 0
+		ss.WithTransaction(context.Background(), func(tx store.Store) error {
+			attempts++
+			return model.NewAppError("SqlPostStore.Save", "store.sql_post.save.app_error", nil, "pq: deadlock detected", 500)
+		})
+
+		if attempts != 1 {
+			t.Fatalf("expected 1 attempt, got %v", attempts)
+		}
+	})
+
+	t.Run("Nested", func(t *testing.T) {
+		// Only the outermost transaction retries.
+		attempts, nestedAttempts := 0, 0
+		ss.WithTransaction(context.Background(), func(tx store.Store) error {
+			attempts++
+			return tx.WithTransaction(context.Background(), func(nested store.Store) error {
+				nestedAttempts++
+				nested.(*SqlSupplier).transaction.failed(&pq.Error{Code: "40001", Message: "could not serialize access due to concurrent update"})
+				return errors.New("failure")
+			})
+		})
+
+		if attempts != TRANSACTION_ATTEMPTS || nestedAttempts != TRANSACTION_ATTEMPTS {
+			t.Fatalf("expected %v attempts, got %v and %v nested", TRANSACTION_ATTEMPTS, attempts, nestedAttempts)
+		}
+	})
+}
+
+func TestWithTransactionPanic(t *testing.T) {
+	ss := newSqliteSupplier(t)
+
+	var post *model.Post
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected the panic to propagate")
+			}
+		}()
+
+		ss.WithTransaction(context.Background(), func(tx store.Store) error {
+			post = savePostInTransaction(t, tx)
+			panic("failure")
+		})
+	}()
+
+	checkPostSaved(t, ss, post, false)
+}
+
+func TestIsRetryableTransactionError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{&mysql.MySQLError{Number: 1213}, true},
+		{&mysql.MySQLError{Number: 1205}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{fmt.Errorf("save post: %w", &pq.Error{Code: "40P01"}), true},
+		{errors.New("pq: deadlock detected"), false},
+		{(*model.AppError)(nil), false},
+		{nil, false},
+	} {
+		if retryable := IsRetryableTransactionError(tc.err); retryable != tc.retryable {
+			t.Errorf("expected %v to be retryable: %v", tc.err, tc.retryable)
+		}
+	}
+}
+
+func TestLayeredStoreTransactionInvalidation(t *testing.T) {
+	ss := newSqliteSupplier(t)
+	layered := store.NewLayeredStore(ss, nil, nil)
+
+	role := &model.Role{Name: model.NewId(), DisplayName: "Role", Permissions: []string{"create_post"}}
+	if result := <-layered.Role().Save(role); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	role = (<-layered.Role().GetByName(role.Name)).Data.(*model.Role)
+
+	// The cached role only changes once something invalidates it.
+	if _, err := ss.GetMaster().Exec("UPDATE Roles SET DisplayName = :DisplayName WHERE Id = :Id", map[string]interface{}{"DisplayName": "Changed", "Id": role.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkDisplayName := func(expected string) {
+		t.Helper()
+		if result := <-layered.Role().GetByName(role.Name); result.Err != nil {
+			t.Fatal(result.Err)
+		} else if displayName := result.Data.(*model.Role).DisplayName; displayName != expected {
+			t.Fatalf("expected the display name %v, got %v", expected, displayName)
+		}
+	}
+
+	// Transactions that don't write the role leave it cached.
+	post := savePostInTransaction(t, layered)
+	if err := layered.WithTransaction(context.Background(), func(tx store.Store) error {
+		return (<-tx.Reaction().Save(&model.Reaction{UserId: model.NewId(), PostId: post.Id, EmojiName: "smile"})).Err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkDisplayName("Role")
+
+	saveRole := func(tx store.Store) error {
+		// Reads in the transaction go past the cache.
+		result := <-tx.Role().GetByName(role.Name)
+		if result.Err != nil {
+			return result.Err
+		}
+		stored := result.Data.(*model.Role)
+		if stored.DisplayName != "Changed" {
+			return fmt.Errorf("expected the stored display name, got %v", stored.DisplayName)
+		}
+		stored.Description = "saved"
+		return (<-tx.Role().Save(stored)).Err
+	}
+
+	// Nor do those rolled back, even when a nested one that wrote it committed.
+	rollback := errors.New("rollback")
+	if err := layered.WithTransaction(context.Background(), func(tx store.Store) error {
+		if err := tx.WithTransaction(context.Background(), saveRole); err != nil {
+			return err
+		}
+		return rollback
+	}); err != rollback {
+		t.Fatalf("expected the transaction to roll back, got %v", err)
+	}
+	checkDisplayName("Role")
+
+	if err := layered.WithTransaction(context.Background(), func(tx store.Store) error {
+		return tx.WithTransaction(context.Background(), saveRole)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkDisplayName("Changed")
+}
@@ -0,0 +1,363 @@
+package sqlstore
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/gorp"
+
+	"github.com/OhBonsai/go-web-boilerplate/einterfaces"
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+const (
+	USER_SEARCH_TYPE_ALL = "Username, FirstName, LastName, Nickname, Email"
+)
+
+type SqlUserStore struct {
+	SqlStore
+	metrics einterfaces.MetricsInterface
+}
+
+func NewSqlUserStore(sqlStore SqlStore, metrics einterfaces.MetricsInterface) store.UserStore {
+	us := &SqlUserStore{
+		SqlStore: sqlStore,
+		metrics:  metrics,
+	}
+
+	return us
+}
+
+func mapUsersTable(db *gorp.DbMap) {
+	table := addTable(db, model.User{}, "Users", "Id")
+	table.ColMap("Id").SetMaxSize(26)
+	table.ColMap("Username").SetMaxSize(model.USER_NAME_MAX_LENGTH).SetUnique(true)
+	table.ColMap("Password").SetMaxSize(128)
+	table.ColMap("AuthData").SetMaxSize(model.USER_AUTH_DATA_MAX_LENGTH).SetUnique(true)
+	table.ColMap("AuthService").SetMaxSize(32)
+	table.ColMap("Email").SetMaxSize(model.USER_EMAIL_MAX_LENGTH).SetUnique(true)
+	table.ColMap("Nickname").SetMaxSize(model.USER_NICKNAME_MAX_RUNES)
+	table.ColMap("FirstName").SetMaxSize(model.USER_FIRST_NAME_MAX_RUNES)
+	table.ColMap("LastName").SetMaxSize(model.USER_LAST_NAME_MAX_RUNES)
+	table.ColMap("Roles").SetMaxSize(256)
+	table.ColMap("Props").SetMaxSize(4000)
+	table.ColMap("Locale").SetMaxSize(model.USER_LOCALE_MAX_LENGTH)
+	table.ColMap("Position").SetMaxSize(model.USER_POSITION_MAX_RUNES)
+	table.ColMap("Timezone").SetMaxSize(256)
+}
+
+func (us SqlUserStore) CreateIndexesIfNotExists() error {
+	if _, err := us.CreateIndexIfNotExists("idx_users_email", "Users", "Email"); err != nil {
+		return err
+	}
+	if _, err := us.CreateIndexIfNotExists("idx_users_update_at", "Users", "UpdateAt"); err != nil {
+		return err
+	}
+	if _, err := us.CreateIndexIfNotExists("idx_users_create_at", "Users", "CreateAt"); err != nil {
+		return err
+	}
+	if _, err := us.CreateIndexIfNotExists("idx_users_delete_at", "Users", "DeleteAt"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (us SqlUserStore) Save(user *model.User) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		if len(user.Id) > 0 {
+			result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.existing.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+			return
+		}
+
+		user.PreSave()
+		if result.Err = user.IsValid(); result.Err != nil {
+			return
+		}
+
+		if err := us.GetMaster().Insert(user); err != nil {
+			if IsUniqueConstraintError(err, []string{"Email", "users_email_key", "idx_users_email_unique"}) {
+				result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.email_exists.app_error", nil, "user_id="+user.Id+", "+err.Error(), http.StatusBadRequest)
+			} else if IsUniqueConstraintError(err, []string{"Username", "users_username_key", "idx_users_username_unique"}) {
+				result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.username_exists.app_error", nil, "user_id="+user.Id+", "+err.Error(), http.StatusBadRequest)
+			} else {
+				result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.app_error", nil, "user_id="+user.Id+", "+err.Error(), http.StatusInternalServerError)
+			}
+		} else {
+			result.Data = user
+		}
+	})
+}
+
+func (us SqlUserStore) Update(user *model.User, trustedUpdateData bool) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		user.PreUpdate()
+
+		if result.Err = user.IsValid(); result.Err != nil {
+			return
+		}
+
+		if oldUserResult, err := us.GetMaster().Get(model.User{}, user.Id); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.finding.app_error", nil, "user_id="+user.Id+", "+err.Error(), http.StatusInternalServerError)
+		} else if oldUserResult == nil {
+			result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.find.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+		} else {
+			oldUser := oldUserResult.(*model.User)
+			user.CreateAt = oldUser.CreateAt
+			user.AuthData = oldUser.AuthData
+			user.AuthService = oldUser.AuthService
+			user.Password = oldUser.Password
+			user.LastPasswordUpdate = oldUser.LastPasswordUpdate
+			user.LastPictureUpdate = oldUser.LastPictureUpdate
+			user.EmailVerified = oldUser.EmailVerified
+			user.FailedAttempts = oldUser.FailedAttempts
+
+			if !trustedUpdateData {
+				user.Roles = oldUser.Roles
+				user.DeleteAt = oldUser.DeleteAt
+			}
+
+			if user.Email != oldUser.Email {
+				user.EmailVerified = false
+			}
+
+			if count, err := us.GetMaster().Update(user); err != nil {
+				if IsUniqueConstraintError(err, []string{"Email", "users_email_key", "idx_users_email_unique"}) {
+					result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.email_taken.app_error", nil, "user_id="+user.Id+", "+err.Error(), http.StatusBadRequest)
+				} else if IsUniqueConstraintError(err, []string{"Username", "users_username_key", "idx_users_username_unique"}) {
+					result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.username_taken.app_error", nil, "user_id="+user.Id+", "+err.Error(), http.StatusBadRequest)
+				} else {
+					result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.updating.app_error", nil, "user_id="+user.Id+", "+err.Error(), http.StatusInternalServerError)
+				}
+			} else if count != 1 {
+				result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.app_error", nil, "user_id="+user.Id, http.StatusInternalServerError)
+			} else {
+				user.Sanitize()
+				oldUser.Sanitize()
+				result.Data = [2]*model.User{user, oldUser}
+			}
+		}
+	})
+}
+
+func (us SqlUserStore) UpdateLastPictureUpdate(userId string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		curTime := model.GetMillis()
+
+		if _, err := us.GetMaster().Exec("UPDATE Users SET LastPictureUpdate = :Time, UpdateAt = :Time WHERE Id = :UserId", map[string]interface{}{"Time": curTime, "UserId": userId}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.UpdateLastPictureUpdate", "store.sql_user.update_last_picture_update.app_error", nil, "user_id="+userId, http.StatusInternalServerError)
+		} else {
+			result.Data = userId
+		}
+	})
+}
+
+func (us SqlUserStore) UpdatePassword(userId, hashedPassword string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		updateAt := model.GetMillis()
+
+		if _, err := us.GetMaster().Exec("UPDATE Users SET Password = :Password, LastPasswordUpdate = :LastPasswordUpdate, UpdateAt = :UpdateAt, AuthData = NULL, AuthService = '', EmailVerified = true, FailedAttempts = 0 WHERE Id = :UserId", map[string]interface{}{"Password": hashedPassword, "LastPasswordUpdate": updateAt, "UpdateAt": updateAt, "UserId": userId}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.UpdatePassword", "store.sql_user.update_password.app_error", nil, "id="+userId+", "+err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = userId
+		}
+	})
+}
+
+func (us SqlUserStore) UpdateFailedPasswordAttempts(userId string, attempts int) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		if _, err := us.GetMaster().Exec("UPDATE Users SET FailedAttempts = :FailedAttempts WHERE Id = :UserId", map[string]interface{}{"FailedAttempts": attempts, "UserId": userId}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.UpdateFailedPasswordAttempts", "store.sql_user.update_failed_pwd_attempts.app_error", nil, "user_id="+userId, http.StatusInternalServerError)
+		} else {
+			result.Data = userId
+		}
+	})
+}
+
+func (us SqlUserStore) Get(id string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		if obj, err := us.GetReplica().Get(model.User{}, id); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.Get", "store.sql_user.get.app_error", nil, "user_id="+id+", "+err.Error(), http.StatusInternalServerError)
+		} else if obj == nil {
+			result.Err = model.NewAppError("SqlUserStore.Get", store.MISSING_ACCOUNT_ERROR, nil, "user_id="+id, http.StatusNotFound)
+		} else {
+			result.Data = obj.(*model.User)
+		}
+	})
+}
+
+func (us SqlUserStore) GetAll() store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		var data []*model.User
+		if _, err := us.GetReplica().Select(&data, "SELECT * FROM Users"); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.GetAll", "store.sql_user.get.app_error", nil, err.Error(), http.StatusInternalServerError)
+		}
+
+		result.Data = data
+	})
+}
+
+func (us SqlUserStore) GetAllProfiles(offset int, limit int) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		var users []*model.User
+
+		if _, err := us.GetReplica().Select(&users, "SELECT * FROM Users ORDER BY Username ASC LIMIT :Limit OFFSET :Offset", map[string]interface{}{"Offset": offset, "Limit": limit}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.GetAllProfiles", "store.sql_user.get_profiles.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+
+			for _, u := range users {
+				u.Sanitize()
+			}
+
+			result.Data = users
+		}
+	})
+}
+
+func (us SqlUserStore) GetProfileByIds(userIds []string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		users := []*model.User{}
+
+		if len(userIds) == 0 {
+			result.Data = users
+			return
+		}
+
+		keys, props := MapStringsToQueryParams(userIds, "userId")
+
+		if _, err := us.GetReplica().Select(&users, "SELECT * FROM Users WHERE Users.Id IN "+keys, props); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.GetProfileByIds", "store.sql_user.get_profiles.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+
+			for _, u := range users {
+				u.Sanitize()
+			}
+
+			result.Data = users
+		}
+	})
+}
+
+func (us SqlUserStore) GetByEmail(email string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		email = model.NormalizeEmail(email)
+
+		user := model.User{}
+
+		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE Email = :Email", map[string]interface{}{"Email": email}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.GetByEmail", store.MISSING_ACCOUNT_ERROR, nil, "email="+email+", "+err.Error(), http.StatusInternalServerError)
+		}
+
+		result.Data = &user
+	})
+}
+
+func (us SqlUserStore) GetByUsername(username string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		user := model.User{}
+
+		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE Username = :Username", map[string]interface{}{"Username": model.NormalizeUsername(username)}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.GetByUsername", "store.sql_user.get_by_username.app_error", nil, err.Error()+" -- "+username, http.StatusInternalServerError)
+		}
+
+		result.Data = &user
+	})
+}
+
+func (us SqlUserStore) GetForLogin(loginId string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		params := map[string]interface{}{
+			"LoginId": loginId,
+			"Email":   model.NormalizeEmail(loginId),
+		}
+
+		users := []*model.User{}
+		if _, err := us.GetReplica().Select(
+			&users,
+			`SELECT
+				*
+			FROM
+				Users
+			WHERE
+				Username = :LoginId
+				OR Email = :Email`,
+			params); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.GetForLogin", "store.sql_user.get_for_login.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else if len(users) == 1 {
+			result.Data = users[0]
+		} else if len(users) > 1 {
+			result.Err = model.NewAppError("SqlUserStore.GetForLogin", "store.sql_user.get_for_login.multiple_users", nil, "", http.StatusInternalServerError)
+		} else {
+			result.Err = model.NewAppError("SqlUserStore.GetForLogin", "store.sql_user.get_for_login.app_error", nil, "", http.StatusInternalServerError)
+		}
+	})
+}
+
+func (us SqlUserStore) VerifyEmail(userId string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		if _, err := us.GetMaster().Exec("UPDATE Users SET EmailVerified = true WHERE Id = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.VerifyEmail", "store.sql_user.verify_email.app_error", nil, "userId="+userId+", "+err.Error(), http.StatusInternalServerError)
+		}
+
+		result.Data = userId
+	})
+}
+
+func (us SqlUserStore) PermanentDelete(userId string) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		if _, err := us.GetMaster().Exec("DELETE FROM Users WHERE Id = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.PermanentDelete", "store.sql_user.permanent_delete.app_error", nil, "userId="+userId+", "+err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (us SqlUserStore) Count() store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		if count, err := us.GetReplica().SelectInt("SELECT COUNT(Id) FROM Users WHERE DeleteAt = 0"); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.Count", "store.sql_user.get_total_users_count.app_error", nil, err.Error(), http.StatusInternalServerError)
+		} else {
+			result.Data = count
+		}
+	})
+}
+
+var escapeLikeSearchChar = []string{
+	"%",
+	"_",
+}
+
+// Search returns the active users whose username, names, nickname or email start with term.
+func (us SqlUserStore) Search(term string, limit int) store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		term = strings.TrimSpace(strings.ToLower(term))
+		term = strings.TrimPrefix(term, "@")
+		for _, c := range escapeLikeSearchChar {
+			term = strings.Replace(term, c, "*"+c, -1)
+		}
+
+		users := []*model.User{}
+
+		if term == "" {
+			result.Data = users
+			return
+		}
+
+		clauses := make([]string, 0, 5)
+		for _, field := range strings.Split(USER_SEARCH_TYPE_ALL, ", ") {
+			clauses = append(clauses, "LOWER("+field+") LIKE :Term ESCAPE '*'")
+		}
+
+		query := "SELECT * FROM Users WHERE DeleteAt = 0 AND (" + strings.Join(clauses, " OR ") + ") ORDER BY Username ASC LIMIT :Limit"
+
+		if _, err := us.GetReplica().Select(&users, query, map[string]interface{}{"Term": term + "%", "Limit": limit}); err != nil {
+			result.Err = model.NewAppError("SqlUserStore.Search", "store.sql_user.search.app_error", nil, "term="+term+", "+err.Error(), http.StatusInternalServerError)
+		} else {
+			for _, u := range users {
+				u.Sanitize()
+			}
+
+			result.Data = users
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package sqlstore
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// MapStringsToQueryParams turns a list of values into an IN clause of named parameters and the map binding them,
+// e.g. (:Post0,:Post1) for the prefix "Post".
+func MapStringsToQueryParams(list []string, paramPrefix string) (string, map[string]interface{}) {
+	keys := bytes.Buffer{}
+	params := make(map[string]interface{}, len(list))
+	for i, entry := range list {
+		if keys.Len() > 0 {
+			keys.WriteString(",")
+		}
+
+		key := paramPrefix + strconv.Itoa(i)
+		keys.WriteString(":" + key)
+		params[key] = entry
+	}
+
+	return fmt.Sprintf("(%v)", keys.String()), params
+}
@@ -1,9 +1,31 @@
 package store
 
-import "github.com/mattermost/mattermost-server/model"
+import (
+	"context"
+	"net/http"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+const (
+	MISSING_ACCOUNT_ERROR = "store.sql_user.missing_account.const"
+	TIMEOUT_ERROR         = "store.timeout.app_error"
+	CANCELED_ERROR        = "store.canceled.app_error"
+)
 
 type Store interface {
+	Post() PostStore
+	User() UserStore
+	Session() SessionStore
+	Reaction() ReactionStore
+	Role() RoleStore
+	Scheme() SchemeStore
 	Close()
+
+	// WithTransaction runs f with a view of the store whose sub-stores all work in one transaction, which
+	// commits when f returns nil and rolls back otherwise. Calling it on such a view nests a transaction that
+	// rolls back on its own. f may run again after a deadlock, so it mustn't depend on an earlier attempt.
+	WithTransaction(ctx context.Context, f func(tx Store) error) error
 }
 
 type StoreResult struct {
@@ -13,7 +35,58 @@ type StoreResult struct {
 
 type StoreChannel chan StoreResult
 
+// Do runs f in a goroutine and delivers the result it fills in on the returned channel.
+func Do(f func(result *StoreResult)) StoreChannel {
+	storeChannel := make(StoreChannel, 1)
+	go func() {
+		result := StoreResult{}
+		f(&result)
+		storeChannel <- result
+		close(storeChannel)
+	}()
+	return storeChannel
+}
+
+// DoContext is Do for work that runs in ctx. f doesn't start once ctx is done, and an error it returns after
+// ctx ended is reported as a timeout or cancellation, see IsTimeoutError and IsCanceledError.
+func DoContext(ctx context.Context, f func(result *StoreResult)) StoreChannel {
+	return Do(func(result *StoreResult) {
+		if ctx.Err() != nil {
+			result.Err = NewContextError("DoContext", ctx.Err(), "")
+			return
+		}
+
+		f(result)
+
+		if result.Err != nil && ctx.Err() != nil {
+			result.Data = nil
+			result.Err = NewContextError(result.Err.Where, ctx.Err(), result.Err.Error())
+		}
+	})
+}
+
+// NewContextError returns the error for work that stopped because its context ended with err.
+func NewContextError(where string, err error, details string) *model.AppError {
+	if err == context.DeadlineExceeded {
+		return model.NewAppError(where, TIMEOUT_ERROR, nil, details, http.StatusGatewayTimeout)
+	}
+	return model.NewAppError(where, CANCELED_ERROR, nil, details, http.StatusRequestTimeout)
+}
+
+// IsTimeoutError reports whether err is due to the deadline of the context the store call ran in.
+func IsTimeoutError(err *model.AppError) bool {
+	return err != nil && err.Id == TIMEOUT_ERROR
+}
+
+// IsCanceledError reports whether err is due to the cancellation of the context the store call ran in.
+func IsCanceledError(err *model.AppError) bool {
+	return err != nil && err.Id == CANCELED_ERROR
+}
+
 type PostStore interface {
+	// WithContext returns a PostStore whose calls run in ctx. Their queries stop once ctx is cancelled or its
+	// deadline passes, failing with an error IsCanceledError or IsTimeoutError recognises.
+	WithContext(ctx context.Context) PostStore
 	Save(post *model.Post) StoreChannel
 	Update(newPost *model.Post, oldPost *model.Post) StoreChannel
 	Get(id string) StoreChannel
@@ -22,17 +95,14 @@ type PostStore interface {
 	PermanentDeleteByUser(userId string) StoreChannel
 	PermanentDeleteByChannel(channelId string) StoreChannel
 	GetPosts(channelId string, offset int, limit int, allowFromCache bool) StoreChannel
-	GetFlaggedPosts(userId string, offset int, limit int) StoreChannel
-	GetFlaggedPostsForTeam(userId, teamId string, offset int, limit int) StoreChannel
-	GetFlaggedPostsForChannel(userId, channelId string, offset int, limit int) StoreChannel
 	GetPostsBefore(channelId string, postId string, numPosts int, offset int) StoreChannel
 	GetPostsAfter(channelId string, postId string, numPosts int, offset int) StoreChannel
 	GetPostsSince(channelId string, time int64, allowFromCache bool) StoreChannel
 	GetEtag(channelId string, allowFromCache bool) StoreChannel
-	Search(teamId string, userId string, params *model.SearchParams) StoreChannel
-	AnalyticsUserCountsWithPostsByDay(teamId string) StoreChannel
-	AnalyticsPostCountsByDay(teamId string) StoreChannel
-	AnalyticsPostCount(teamId string, mustHaveFile bool, mustHaveHashtag bool) StoreChannel
+	Search(params *model.SearchParams) StoreChannel
+	AnalyticsUserCountsWithPostsByDay() StoreChannel
+	AnalyticsPostCountsByDay() StoreChannel
+	AnalyticsPostCount(mustHaveFile bool, mustHaveHashtag bool) StoreChannel
 	ClearCaches()
 	InvalidateLastPostTimeCache(channelId string)
 	GetPostsCreatedAt(channelId string, time int64) StoreChannel
@@ -42,4 +112,62 @@ type PostStore interface {
 	PermanentDeleteBatch(endTime int64, limit int64) StoreChannel
 	GetOldest() StoreChannel
 	GetMaxPostSize() StoreChannel
-}
\ No newline at end of file
+}
+
+type UserStore interface {
+	Save(user *model.User) StoreChannel
+	Update(user *model.User, allowRoleUpdate bool) StoreChannel
+	UpdatePassword(userId, newPassword string) StoreChannel
+	UpdateFailedPasswordAttempts(userId string, attempts int) StoreChannel
+	UpdateLastPictureUpdate(userId string) StoreChannel
+	Get(id string) StoreChannel
+	GetAll() StoreChannel
+	GetAllProfiles(offset int, limit int) StoreChannel
+	GetProfileByIds(userIds []string) StoreChannel
+	GetByEmail(email string) StoreChannel
+	GetByUsername(username string) StoreChannel
+	GetForLogin(loginId string) StoreChannel
+	VerifyEmail(userId string) StoreChannel
+	PermanentDelete(userId string) StoreChannel
+	Count() StoreChannel
+	Search(term string, limit int) StoreChannel
+}
+
+type SessionStore interface {
+	Save(session *model.Session) StoreChannel
+	Get(sessionIdOrToken string) StoreChannel
+	GetSessions(userId string) StoreChannel
+	Remove(sessionIdOrToken string) StoreChannel
+	RemoveAllSessions() StoreChannel
+	PermanentDeleteSessionsByUser(userId string) StoreChannel
+	UpdateLastActivityAt(sessionId string, time int64) StoreChannel
+	UpdateRoles(userId string, roles string) StoreChannel
+	UpdateDeviceId(id string, deviceId string, expiresAt int64) StoreChannel
+	AnalyticsSessionCount() StoreChannel
+	Cleanup(expiryTime int64, batchSize int64)
+}
+
+type ReactionStore interface {
+	Save(reaction *model.Reaction) StoreChannel
+	Delete(reaction *model.Reaction) StoreChannel
+	GetForPost(postId string, allowFromCache bool) StoreChannel
+	DeleteAllWithEmojiName(emojiName string) StoreChannel
+	PermanentDeleteBatch(endTime int64, limit int64) StoreChannel
+}
+
+type RoleStore interface {
+	Save(role *model.Role) StoreChannel
+	Get(roleId string) StoreChannel
+	GetByName(name string) StoreChannel
+	GetByNames(names []string) StoreChannel
+	Delete(roleId string) StoreChannel
+	PermanentDeleteAll() StoreChannel
+}
+
+type SchemeStore interface {
+	Save(scheme *model.Scheme) StoreChannel
+	Get(schemeId string) StoreChannel
+	Delete(schemeId string) StoreChannel
+	GetAllPage(scope string, offset int, limit int) StoreChannel
+	PermanentDeleteAll() StoreChannel
+}
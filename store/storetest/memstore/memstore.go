@@ -0,0 +1,172 @@
+// Package memstore implements store.Store in memory, so code that needs a working store can be tested without
+// a database. It follows the semantics of the sql store, including the errors it returns, but keeps no caches.
+package memstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+type MemStore struct {
+	mutex sync.RWMutex
+
+	posts     map[string]*model.Post
+	users     map[string]*model.User
+	sessions  map[string]*model.Session
+	reactions []*model.Reaction
+	roles     map[string]*model.Role
+	schemes   map[string]*model.Scheme
+
+	post     *MemPostStore
+	user     *MemUserStore
+	session  *MemSessionStore
+	reaction *MemReactionStore
+	role     *MemRoleStore
+	scheme   *MemSchemeStore
+}
+
+// New returns an empty store. Pass it to app.StoreOverride to run an App without a database.
+func New() *MemStore {
+	s := &MemStore{
+		posts:    make(map[string]*model.Post),
+		users:    make(map[string]*model.User),
+		sessions: make(map[string]*model.Session),
+		roles:    make(map[string]*model.Role),
+		schemes:  make(map[string]*model.Scheme),
+	}
+
+	s.post = &MemPostStore{MemStore: s, ctx: context.Background()}
+	s.user = &MemUserStore{s}
+	s.session = &MemSessionStore{s}
+	s.reaction = &MemReactionStore{s}
+	s.role = &MemRoleStore{s}
+	s.scheme = &MemSchemeStore{s}
+
+	return s
+}
+
+func (s *MemStore) Post() store.PostStore {
+	return s.post
+}
+
+func (s *MemStore) User() store.UserStore {
+	return s.user
+}
+
+func (s *MemStore) Session() store.SessionStore {
+	return s.session
+}
+
+func (s *MemStore) Reaction() store.ReactionStore {
+	return s.reaction
+}
+
+func (s *MemStore) Role() store.RoleStore {
+	return s.role
+}
+
+func (s *MemStore) Scheme() store.SchemeStore {
+	return s.scheme
+}
+
+func (s *MemStore) Close() {}
+
+// WithTransaction runs f on a copy of the store, which replaces the contents of the store when f succeeds. It
+// holds the write lock meanwhile, so transactions run one at a time as if serializable, and f must only use tx.
+func (s *MemStore) WithTransaction(ctx context.Context, f func(tx store.Store) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if ctx.Err() != nil {
+		return store.NewContextError("MemStore.WithTransaction", ctx.Err(), "")
+	}
+
+	tx := s.copy()
+	if err := f(tx); !isNilError(err) {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return store.NewContextError("MemStore.WithTransaction", ctx.Err(), "")
+	}
+
+	s.posts = tx.posts
+	s.users = tx.users
+	s.sessions = tx.sessions
+	s.reactions = tx.reactions
+	s.roles = tx.roles
+	s.schemes = tx.schemes
+
+	return nil
+}
+
+// copy returns a store with copies of the contents of s. The caller holds the lock.
+func (s *MemStore) copy() *MemStore {
+	c := New()
+
+	for id, post := range s.posts {
+		c.posts[id] = post.Clone()
+	}
+	for id, user := range s.users {
+		copied := *user
+		c.users[id] = &copied
+	}
+	for id, session := range s.sessions {
+		c.sessions[id] = session.DeepCopy()
+	}
+	for _, reaction := range s.reactions {
+		copied := *reaction
+		c.reactions = append(c.reactions, &copied)
+	}
+	for id, role := range s.roles {
+		copied := *role
+		c.roles[id] = &copied
+	}
+	for id, scheme := range s.schemes {
+		copied := *scheme
+		c.schemes[id] = &copied
+	}
+
+	return c
+}
+
+// isNilError reports whether err is nil, including a nil *model.AppError, which store calls return on success.
+func isNilError(err error) bool {
+	if appErr, ok := err.(*model.AppError); ok {
+		return appErr == nil
+	}
+	return err == nil
+}
+
+// do runs f under the write lock and delivers its result like the sql store does.
+func (s *MemStore) do(f func(result *store.StoreResult)) store.StoreChannel {
+	return s.doContext(context.Background(), f)
+}
+
+// read runs f under the read lock and delivers its result like the sql store does.
+func (s *MemStore) read(f func(result *store.StoreResult)) store.StoreChannel {
+	return s.readContext(context.Background(), f)
+}
+
+// doContext is do for a store call that runs in ctx.
+func (s *MemStore) doContext(ctx context.Context, f func(result *store.StoreResult)) store.StoreChannel {
+	return store.DoContext(ctx, func(result *store.StoreResult) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		f(result)
+	})
+}
+
+// readContext is read for a store call that runs in ctx.
+func (s *MemStore) readContext(ctx context.Context, f func(result *store.StoreResult)) store.StoreChannel {
+	return store.DoContext(ctx, func(result *store.StoreResult) {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+
+		f(result)
+	})
+}
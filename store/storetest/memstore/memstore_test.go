@@ -0,0 +1,35 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/store/storetest"
+)
+
+func TestPostStore(t *testing.T) {
+	storetest.TestPostStore(t, New())
+}
+
+func TestWithTransaction(t *testing.T) {
+	storetest.TestWithTransaction(t, New())
+}
+
+func TestReactionStore(t *testing.T) {
+	storetest.TestReactionStore(t, New())
+}
+
+func TestRoleStore(t *testing.T) {
+	storetest.TestRoleStore(t, New())
+}
+
+func TestSchemeStore(t *testing.T) {
+	storetest.TestSchemeStore(t, New())
+}
+
+func TestUserStore(t *testing.T) {
+	storetest.TestUserStore(t, New())
+}
+
+func TestSessionStore(t *testing.T) {
+	storetest.TestSessionStore(t, New())
+}
@@ -0,0 +1,664 @@
+package memstore
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+type MemPostStore struct {
+	*MemStore
+	ctx context.Context
+}
+
+func (s *MemPostStore) WithContext(ctx context.Context) store.PostStore {
+	return &MemPostStore{MemStore: s.MemStore, ctx: ctx}
+}
+
+// do and read run the calls of the store in its context.
+func (s *MemPostStore) do(f func(result *store.StoreResult)) store.StoreChannel {
+	return s.doContext(s.ctx, f)
+}
+
+func (s *MemPostStore) read(f func(result *store.StoreResult)) store.StoreChannel {
+	return s.readContext(s.ctx, f)
+}
+
+// sortByCreateAtDesc orders posts newest first, the order most queries return them in.
+func sortByCreateAtDesc(posts []*model.Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].CreateAt > posts[j].CreateAt
+	})
+}
+
+func clonePosts(posts []*model.Post) []*model.Post {
+	clones := make([]*model.Post, 0, len(posts))
+	for _, post := range posts {
+		clones = append(clones, post.Clone())
+	}
+	return clones
+}
+
+// filterPosts returns the stored posts for which keep is true, newest first.
+func (s *MemPostStore) filterPosts(keep func(post *model.Post) bool) []*model.Post {
+	var posts []*model.Post
+	for _, post := range s.posts {
+		if keep(post) {
+			posts = append(posts, post)
+		}
+	}
+
+	sortByCreateAtDesc(posts)
+	return posts
+}
+
+func pagePosts(posts []*model.Post, offset int, limit int) []*model.Post {
+	if offset >= len(posts) {
+		return nil
+	}
+
+	end := offset + limit
+	if end > len(posts) {
+		end = len(posts)
+	}
+
+	return posts[offset:end]
+}
+
+// threadsOf returns the live posts of the threads the given posts reply to.
+func (s *MemPostStore) threadsOf(posts []*model.Post, channelId string) []*model.Post {
+	rootIds := make(map[string]bool)
+	for _, post := range posts {
+		if post.RootId != "" {
+			rootIds[post.RootId] = true
+		}
+	}
+
+	return s.filterPosts(func(post *model.Post) bool {
+		return post.ChannelId == channelId && post.DeleteAt == 0 && (rootIds[post.Id] || rootIds[post.RootId])
+	})
+}
+
+func (s *MemPostStore) Save(post *model.Post) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if len(post.Id) > 0 {
+			result.Err = model.NewAppError("SqlPostStore.Save", "store.sql_post.save.existing.app_error", nil, "id="+post.Id, http.StatusBadRequest)
+			return
+		}
+
+		post.PreSave()
+		if result.Err = post.IsValid(model.POST_MESSAGE_MAX_RUNES_V2); result.Err != nil {
+			return
+		}
+
+		s.posts[post.Id] = post.Clone()
+
+		if root, ok := s.posts[post.RootId]; ok && len(post.RootId) > 0 {
+			root.UpdateAt = post.UpdateAt
+		}
+
+		result.Data = post
+	})
+}
+
+func (s *MemPostStore) Update(newPost *model.Post, oldPost *model.Post) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		newPost.UpdateAt = model.GetMillis()
+		newPost.PreCommit()
+
+		oldPost.DeleteAt = newPost.UpdateAt
+		oldPost.UpdateAt = newPost.UpdateAt
+		oldPost.Id = model.NewId()
+		oldPost.PreCommit()
+
+		if result.Err = newPost.IsValid(model.POST_MESSAGE_MAX_RUNES_V2); result.Err != nil {
+			return
+		}
+
+		if _, ok := s.posts[newPost.Id]; ok {
+			s.posts[newPost.Id] = newPost.Clone()
+		}
+
+		if root, ok := s.posts[newPost.RootId]; ok && len(newPost.RootId) > 0 && root.UpdateAt < newPost.UpdateAt {
+			root.UpdateAt = newPost.UpdateAt
+		}
+
+		// mark the old post as deleted
+		s.posts[oldPost.Id] = oldPost.Clone()
+
+		result.Data = newPost
+	})
+}
+
+func (s *MemPostStore) Overwrite(post *model.Post) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		post.UpdateAt = model.GetMillis()
+
+		if result.Err = post.IsValid(model.POST_MESSAGE_MAX_RUNES_V2); result.Err != nil {
+			return
+		}
+
+		if _, ok := s.posts[post.Id]; ok {
+			s.posts[post.Id] = post.Clone()
+		}
+
+		result.Data = post
+	})
+}
+
+func (s *MemPostStore) Get(id string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		if len(id) == 0 {
+			result.Err = model.NewAppError("SqlPostStore.GetPost", "store.sql_post.get.app_error", nil, "id="+id, http.StatusBadRequest)
+			return
+		}
+
+		post, ok := s.posts[id]
+		if !ok || post.DeleteAt != 0 {
+			result.Err = model.NewAppError("SqlPostStore.GetPost", "store.sql_post.get.app_error", nil, "id="+id, http.StatusNotFound)
+			return
+		}
+
+		pl := model.NewPostList()
+		pl.AddPost(post.Clone())
+		pl.AddOrder(id)
+
+		rootId := post.RootId
+		if rootId == "" {
+			rootId = post.Id
+		}
+
+		for _, p := range s.posts {
+			if (p.Id == rootId || p.RootId == rootId) && p.DeleteAt == 0 {
+				pl.AddPost(p.Clone())
+			}
+		}
+
+		result.Data = pl
+	})
+}
+
+func (s *MemPostStore) GetSingle(id string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		post, ok := s.posts[id]
+		if !ok || post.DeleteAt != 0 {
+			result.Err = model.NewAppError("SqlPostStore.GetSingle", "store.sql_post.get.app_error", nil, "id="+id, http.StatusNotFound)
+			result.Data = &model.Post{}
+			return
+		}
+
+		result.Data = post.Clone()
+	})
+}
+
+func (s *MemPostStore) GetEtag(channelId string, allowFromCache bool) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		var lastUpdateAt int64
+		for _, post := range s.posts {
+			if post.ChannelId == channelId && post.UpdateAt > lastUpdateAt {
+				lastUpdateAt = post.UpdateAt
+			}
+		}
+
+		if lastUpdateAt == 0 {
+			result.Data = model.Etag(model.GetMillis())
+		} else {
+			result.Data = model.Etag(lastUpdateAt)
+		}
+	})
+}
+
+func (s *MemPostStore) Delete(postId string, time int64, deleteByID string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		post, ok := s.posts[postId]
+		if !ok || post.DeleteAt != 0 {
+			result.Err = model.NewAppError("SqlPostStore.Delete", "store.sql_post.delete.app_error", nil, "id="+postId+", err=not found", http.StatusInternalServerError)
+			return
+		}
+
+		post.AddProp(model.POST_PROPS_DELETE_BY, deleteByID)
+		post.DeleteAt = time
+		post.UpdateAt = time
+
+		// the replies go with the post they belong to
+		for _, reply := range s.posts {
+			if reply.RootId == postId {
+				reply.DeleteAt = time
+				reply.UpdateAt = time
+			}
+		}
+	})
+}
+
+// permanentDelete removes a post and all of its replies.
+func (s *MemPostStore) permanentDelete(postId string) {
+	for id, post := range s.posts {
+		if id == postId || post.RootId == postId {
+			delete(s.posts, id)
+		}
+	}
+}
+
+func (s *MemPostStore) PermanentDeleteByUser(userId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		// First delete all the comments for the user, then the root posts together with their comments.
+		for id, post := range s.posts {
+			if post.UserId == userId && post.RootId != "" {
+				delete(s.posts, id)
+			}
+		}
+
+		for id, post := range s.posts {
+			if post.UserId == userId {
+				s.permanentDelete(id)
+			}
+		}
+	})
+}
+
+func (s *MemPostStore) PermanentDeleteByChannel(channelId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		for id, post := range s.posts {
+			if post.ChannelId == channelId {
+				delete(s.posts, id)
+			}
+		}
+	})
+}
+
+func (s *MemPostStore) GetPosts(channelId string, offset int, limit int, allowFromCache bool) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		if limit > 1000 {
+			result.Err = model.NewAppError("SqlPostStore.GetLinearPosts", "store.sql_post.get_posts.app_error", nil, "channelId="+channelId, http.StatusBadRequest)
+			return
+		}
+
+		posts := pagePosts(s.filterPosts(func(post *model.Post) bool {
+			return post.ChannelId == channelId && post.DeleteAt == 0
+		}), offset, limit)
+
+		list := model.NewPostList()
+
+		for _, p := range posts {
+			list.AddPost(p.Clone())
+			list.AddOrder(p.Id)
+		}
+
+		for _, p := range s.threadsOf(posts, channelId) {
+			list.AddPost(p.Clone())
+		}
+
+		list.MakeNonNil()
+
+		result.Data = list
+	})
+}
+
+func (s *MemPostStore) GetPostsSince(channelId string, time int64, allowFromCache bool) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		rootIds := make(map[string]bool)
+		for _, post := range s.posts {
+			if post.ChannelId == channelId && post.UpdateAt > time {
+				rootIds[post.RootId] = true
+			}
+		}
+
+		posts := pagePosts(s.filterPosts(func(post *model.Post) bool {
+			return (post.ChannelId == channelId && post.UpdateAt > time) || rootIds[post.Id]
+		}), 0, 1000)
+
+		list := model.NewPostList()
+
+		for _, p := range posts {
+			list.AddPost(p.Clone())
+			if p.UpdateAt > time {
+				list.AddOrder(p.Id)
+			}
+		}
+
+		result.Data = list
+	})
+}
+
+func (s *MemPostStore) GetPostsBefore(channelId string, postId string, numPosts int, offset int) store.StoreChannel {
+	return s.getPostsAround(channelId, postId, numPosts, offset, true)
+}
+
+func (s *MemPostStore) GetPostsAfter(channelId string, postId string, numPosts int, offset int) store.StoreChannel {
+	return s.getPostsAround(channelId, postId, numPosts, offset, false)
+}
+
+func (s *MemPostStore) getPostsAround(channelId string, postId string, numPosts int, offset int, before bool) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		list := model.NewPostList()
+
+		target, ok := s.posts[postId]
+		if !ok {
+			result.Data = list
+			return
+		}
+
+		posts := s.filterPosts(func(post *model.Post) bool {
+			if post.ChannelId != channelId || post.DeleteAt != 0 {
+				return false
+			}
+
+			if before {
+				return post.CreateAt < target.CreateAt
+			}
+			return post.CreateAt > target.CreateAt
+		})
+
+		if !before {
+			// select the posts closest to the target first, then hand them back newest first
+			sort.SliceStable(posts, func(i, j int) bool {
+				return posts[i].CreateAt < posts[j].CreateAt
+			})
+			posts = pagePosts(posts, offset, numPosts)
+			for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+				posts[i], posts[j] = posts[j], posts[i]
+			}
+		} else {
+			posts = pagePosts(posts, offset, numPosts)
+		}
+
+		for _, p := range posts {
+			list.AddPost(p.Clone())
+			list.AddOrder(p.Id)
+		}
+
+		for _, p := range s.threadsOf(posts, channelId) {
+			list.AddPost(p.Clone())
+		}
+
+		result.Data = list
+	})
+}
+
+// matchesTerms reports whether text contains the search terms as words, all of them or, with orTerms, any.
+// A term ending in * matches any word it is a prefix of.
+func matchesTerms(text string, terms []string, orTerms bool) bool {
+	words := strings.Fields(strings.ToLower(text))
+
+	matchesTerm := func(term string) bool {
+		term = strings.ToLower(term)
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.TrimSuffix(term, "*")
+
+		for _, word := range words {
+			if word == term || (prefix && strings.HasPrefix(word, term)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, term := range terms {
+		if matchesTerm(term) {
+			if orTerms {
+				return true
+			}
+		} else if !orTerms {
+			return false
+		}
+	}
+
+	return !orTerms
+}
+
+func (s *MemPostStore) usersIdsByUsername(usernames []string) map[string]bool {
+	wanted := make(map[string]bool)
+	for _, username := range usernames {
+		wanted[model.NormalizeUsername(username)] = true
+	}
+
+	ids := make(map[string]bool)
+	for _, user := range s.users {
+		if wanted[user.Username] {
+			ids[user.Id] = true
+		}
+	}
+
+	return ids
+}
+
+func (s *MemPostStore) Search(params *model.SearchParams) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		list := model.NewPostList()
+
+		if params.Terms == "" && len(params.InChannels) == 0 && len(params.FromUsers) == 0 && len(params.OnDate) == 0 && len(params.AfterDate) == 0 && len(params.BeforeDate) == 0 {
+			result.Data = list
+			return
+		}
+
+		inChannels := make(map[string]bool)
+		for _, channelId := range params.InChannels {
+			inChannels[channelId] = true
+		}
+
+		excludedChannels := make(map[string]bool)
+		for _, channelId := range params.ExcludedChannels {
+			excludedChannels[channelId] = true
+		}
+
+		fromUsers := s.usersIdsByUsername(params.FromUsers)
+		excludedUsers := s.usersIdsByUsername(params.ExcludedUsers)
+
+		var createdAfter, createdBefore int64
+		if len(params.OnDate) > 0 {
+			createdAfter, createdBefore = params.GetOnDateMillis()
+		} else {
+			if len(params.AfterDate) > 0 {
+				createdAfter = params.GetAfterDateMillis()
+			}
+			if len(params.BeforeDate) > 0 {
+				createdBefore = params.GetBeforeDateMillis()
+			}
+		}
+
+		terms := strings.Fields(params.Terms)
+
+		posts := s.filterPosts(func(post *model.Post) bool {
+			if post.DeleteAt != 0 || strings.HasPrefix(post.Type, model.POST_SYSTEM_MESSAGE_PREFIX) {
+				return false
+			}
+
+			if (len(params.InChannels) > 0 && !inChannels[post.ChannelId]) || excludedChannels[post.ChannelId] {
+				return false
+			}
+
+			if (len(params.FromUsers) > 0 && !fromUsers[post.UserId]) || excludedUsers[post.UserId] {
+				return false
+			}
+
+			if (createdAfter != 0 && post.CreateAt < createdAfter) || (createdBefore != 0 && post.CreateAt > createdBefore) {
+				return false
+			}
+
+			if len(terms) == 0 {
+				return true
+			}
+
+			if params.IsHashtag {
+				return matchesTerms(post.Hashtags, terms, params.OrTerms)
+			}
+
+			return matchesTerms(post.Message, terms, params.OrTerms)
+		})
+
+		for _, p := range pagePosts(posts, 0, 100) {
+			list.AddPost(p.Clone())
+			list.AddOrder(p.Id)
+		}
+
+		list.MakeNonNil()
+
+		result.Data = list
+	})
+}
+
+// analyticsByDay groups the posts of the last 31 full days by the day they were created on, newest day first.
+func (s *MemPostStore) analyticsByDay(value func(posts []*model.Post) float64) model.AnalyticsRows {
+	yesterday := time.Now().AddDate(0, 0, -1)
+	end := model.GetEndOfDayMillis(yesterday, 0)
+	start := model.GetStartOfDayMillis(yesterday.AddDate(0, 0, -31), 0)
+
+	days := make(map[string][]*model.Post)
+	for _, post := range s.posts {
+		if post.CreateAt >= start && post.CreateAt <= end {
+			day := time.Unix(0, post.CreateAt*int64(time.Millisecond)).UTC().Format("2006-01-02")
+			days[day] = append(days[day], post)
+		}
+	}
+
+	rows := model.AnalyticsRows{}
+	for day, posts := range days {
+		rows = append(rows, &model.AnalyticsRow{Name: day, Value: value(posts)})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Name > rows[j].Name
+	})
+
+	if len(rows) > 30 {
+		rows = rows[:30]
+	}
+
+	return rows
+}
+
+func (s *MemPostStore) AnalyticsUserCountsWithPostsByDay() store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		result.Data = s.analyticsByDay(func(posts []*model.Post) float64 {
+			users := make(map[string]bool)
+			for _, post := range posts {
+				users[post.UserId] = true
+			}
+			return float64(len(users))
+		})
+	})
+}
+
+func (s *MemPostStore) AnalyticsPostCountsByDay() store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		result.Data = s.analyticsByDay(func(posts []*model.Post) float64 {
+			return float64(len(posts))
+		})
+	})
+}
+
+func (s *MemPostStore) AnalyticsPostCount(mustHaveFile bool, mustHaveHashtag bool) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		var count int64
+		for _, post := range s.posts {
+			if post.DeleteAt != 0 {
+				continue
+			}
+
+			if mustHaveFile && len(post.FileIds) == 0 && len(post.Filenames) == 0 {
+				continue
+			}
+
+			if mustHaveHashtag && post.Hashtags == "" {
+				continue
+			}
+
+			count++
+		}
+
+		result.Data = count
+	})
+}
+
+func (s *MemPostStore) ClearCaches() {}
+
+func (s *MemPostStore) InvalidateLastPostTimeCache(channelId string) {}
+
+func (s *MemPostStore) GetPostsCreatedAt(channelId string, time int64) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		result.Data = clonePosts(s.filterPosts(func(post *model.Post) bool {
+			return post.ChannelId == channelId && post.CreateAt == time
+		}))
+	})
+}
+
+func (s *MemPostStore) GetPostsByIds(postIds []string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		ids := make(map[string]bool)
+		for _, id := range postIds {
+			ids[id] = true
+		}
+
+		result.Data = clonePosts(s.filterPosts(func(post *model.Post) bool {
+			return ids[post.Id]
+		}))
+	})
+}
+
+func (s *MemPostStore) GetPostsBatchForIndexing(startTime int64, endTime int64, limit int) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		posts := s.filterPosts(func(post *model.Post) bool {
+			return post.CreateAt >= startTime && post.CreateAt < endTime
+		})
+
+		sort.SliceStable(posts, func(i, j int) bool {
+			return posts[i].CreateAt < posts[j].CreateAt
+		})
+
+		batch := []*model.PostForIndexing{}
+		for _, post := range pagePosts(posts, 0, limit) {
+			postForIndexing := &model.PostForIndexing{Post: *post.Clone()}
+			if parent, ok := s.posts[post.RootId]; ok && post.RootId != "" {
+				postForIndexing.ParentCreateAt = model.NewInt64(parent.CreateAt)
+			}
+			batch = append(batch, postForIndexing)
+		}
+
+		result.Data = batch
+	})
+}
+
+func (s *MemPostStore) PermanentDeleteBatch(endTime int64, limit int64) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		posts := s.filterPosts(func(post *model.Post) bool {
+			return post.CreateAt < endTime
+		})
+
+		// delete the oldest posts first
+		var deleted int64
+		for i := len(posts) - 1; i >= 0 && deleted < limit; i-- {
+			delete(s.posts, posts[i].Id)
+			deleted++
+		}
+
+		result.Data = deleted
+	})
+}
+
+func (s *MemPostStore) GetOldest() store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		posts := s.filterPosts(func(post *model.Post) bool {
+			return true
+		})
+
+		if len(posts) == 0 {
+			result.Err = model.NewAppError("SqlPostStore.GetOldest", "store.sql_post.get.app_error", nil, "no posts", http.StatusNotFound)
+			result.Data = &model.Post{}
+			return
+		}
+
+		result.Data = posts[len(posts)-1].Clone()
+	})
+}
+
+func (s *MemPostStore) GetMaxPostSize() store.StoreChannel {
+	return store.Do(func(result *store.StoreResult) {
+		result.Data = model.POST_MESSAGE_MAX_RUNES_V2
+	})
+}
@@ -0,0 +1,132 @@
+package memstore
+
+import (
+	"sort"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+type MemReactionStore struct {
+	*MemStore
+}
+
+func sameReaction(a *model.Reaction, b *model.Reaction) bool {
+	return a.UserId == b.UserId && a.PostId == b.PostId && a.EmojiName == b.EmojiName
+}
+
+// updatePostHasReactions mirrors UPDATE_POST_HAS_REACTIONS_ON_DELETE_QUERY.
+func (s *MemReactionStore) updatePostHasReactions(postId string) {
+	post, ok := s.posts[postId]
+	if !ok {
+		return
+	}
+
+	post.HasReactions = false
+	for _, reaction := range s.reactions {
+		if reaction.PostId == postId {
+			post.HasReactions = true
+			break
+		}
+	}
+	post.UpdateAt = model.GetMillis()
+}
+
+func (s *MemReactionStore) Save(reaction *model.Reaction) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		reaction.PreSave()
+		if result.Err = reaction.IsValid(); result.Err != nil {
+			return
+		}
+
+		// We don't consider duplicated save calls as an error
+		for _, existing := range s.reactions {
+			if sameReaction(existing, reaction) {
+				result.Data = reaction
+				return
+			}
+		}
+
+		saved := *reaction
+		s.reactions = append(s.reactions, &saved)
+
+		if post, ok := s.posts[reaction.PostId]; ok {
+			post.HasReactions = true
+			post.UpdateAt = model.GetMillis()
+		}
+
+		result.Data = reaction
+	})
+}
+
+func (s *MemReactionStore) Delete(reaction *model.Reaction) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		kept := s.reactions[:0]
+		for _, existing := range s.reactions {
+			if !sameReaction(existing, reaction) {
+				kept = append(kept, existing)
+			}
+		}
+		s.reactions = kept
+
+		s.updatePostHasReactions(reaction.PostId)
+
+		result.Data = reaction
+	})
+}
+
+func (s *MemReactionStore) GetForPost(postId string, allowFromCache bool) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		reactions := []*model.Reaction{}
+		for _, reaction := range s.reactions {
+			if reaction.PostId == postId {
+				clone := *reaction
+				reactions = append(reactions, &clone)
+			}
+		}
+
+		sort.SliceStable(reactions, func(i, j int) bool {
+			return reactions[i].CreateAt < reactions[j].CreateAt
+		})
+
+		result.Data = reactions
+	})
+}
+
+func (s *MemReactionStore) DeleteAllWithEmojiName(emojiName string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		postIds := make(map[string]bool)
+
+		kept := s.reactions[:0]
+		for _, reaction := range s.reactions {
+			if reaction.EmojiName == emojiName {
+				postIds[reaction.PostId] = true
+			} else {
+				kept = append(kept, reaction)
+			}
+		}
+		s.reactions = kept
+
+		for postId := range postIds {
+			s.updatePostHasReactions(postId)
+		}
+	})
+}
+
+func (s *MemReactionStore) PermanentDeleteBatch(endTime int64, limit int64) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		var deleted int64
+
+		kept := s.reactions[:0]
+		for _, reaction := range s.reactions {
+			if reaction.CreateAt < endTime && deleted < limit {
+				deleted++
+			} else {
+				kept = append(kept, reaction)
+			}
+		}
+		s.reactions = kept
+
+		result.Data = deleted
+	})
+}
@@ -0,0 +1,128 @@
+package memstore
+
+import (
+	"net/http"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+type MemRoleStore struct {
+	*MemStore
+}
+
+func cloneRole(role *model.Role) *model.Role {
+	clone := *role
+	clone.Permissions = append([]string{}, role.Permissions...)
+	return &clone
+}
+
+// create stores a new role under a fresh id. The caller must hold the write lock.
+func (s *MemRoleStore) create(role *model.Role) (*model.Role, *model.AppError) {
+	if err := role.IsValidWithoutId(); err != nil {
+		return nil, model.NewAppError("SqlRoleStore.Save", "store.sql_role.save.invalid_role.app_error", nil, err.Error(), http.StatusBadRequest)
+	}
+
+	for _, existing := range s.roles {
+		if existing.Name == role.Name {
+			return nil, model.NewAppError("SqlRoleStore.Save", "store.sql_role.save.insert.app_error", nil, "name="+role.Name, http.StatusInternalServerError)
+		}
+	}
+
+	created := cloneRole(role)
+	created.Id = model.NewId()
+	created.CreateAt = model.GetMillis()
+	created.UpdateAt = created.CreateAt
+
+	s.roles[created.Id] = created
+
+	return cloneRole(created), nil
+}
+
+func (s *MemRoleStore) Save(role *model.Role) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if err := role.IsValidWithoutId(); err != nil {
+			result.Err = model.NewAppError("SqlRoleStore.Save", "store.sql_role.save.invalid_role.app_error", nil, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(role.Id) == 0 {
+			result.Data, result.Err = s.create(role)
+			return
+		}
+
+		if _, ok := s.roles[role.Id]; !ok {
+			result.Err = model.NewAppError("SqlRoleStore.Save", "store.sql_role.save.update.app_error", nil, "no record to update", http.StatusInternalServerError)
+			return
+		}
+
+		updated := cloneRole(role)
+		updated.UpdateAt = model.GetMillis()
+		s.roles[role.Id] = updated
+
+		result.Data = cloneRole(updated)
+	})
+}
+
+func (s *MemRoleStore) Get(roleId string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		if role, ok := s.roles[roleId]; ok {
+			result.Data = cloneRole(role)
+		} else {
+			result.Err = model.NewAppError("SqlRoleStore.Get", "store.sql_role.get.app_error", nil, "Id="+roleId, http.StatusNotFound)
+		}
+	})
+}
+
+func (s *MemRoleStore) GetByName(name string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		for _, role := range s.roles {
+			if role.Name == name {
+				result.Data = cloneRole(role)
+				return
+			}
+		}
+
+		result.Err = model.NewAppError("SqlRoleStore.GetByName", "store.sql_role.get_by_name.app_error", nil, "name="+name, http.StatusNotFound)
+	})
+}
+
+func (s *MemRoleStore) GetByNames(names []string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		wanted := make(map[string]bool)
+		for _, name := range names {
+			wanted[name] = true
+		}
+
+		roles := []*model.Role{}
+		for _, role := range s.roles {
+			if wanted[role.Name] {
+				roles = append(roles, cloneRole(role))
+			}
+		}
+
+		result.Data = roles
+	})
+}
+
+func (s *MemRoleStore) Delete(roleId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		role, ok := s.roles[roleId]
+		if !ok {
+			result.Err = model.NewAppError("SqlRoleStore.Delete", "store.sql_role.get.app_error", nil, "Id="+roleId, http.StatusNotFound)
+			return
+		}
+
+		time := model.GetMillis()
+		role.DeleteAt = time
+		role.UpdateAt = time
+
+		result.Data = cloneRole(role)
+	})
+}
+
+func (s *MemRoleStore) PermanentDeleteAll() store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		s.roles = make(map[string]*model.Role)
+	})
+}
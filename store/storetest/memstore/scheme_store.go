@@ -0,0 +1,187 @@
+package memstore
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+type MemSchemeStore struct {
+	*MemStore
+}
+
+func cloneScheme(scheme *model.Scheme) *model.Scheme {
+	clone := *scheme
+	return &clone
+}
+
+func (s *MemSchemeStore) Save(scheme *model.Scheme) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if len(scheme.Id) == 0 {
+			result.Data, result.Err = s.create(scheme)
+			return
+		}
+
+		if result.Err = scheme.IsValid(); result.Err != nil {
+			return
+		}
+
+		if _, ok := s.schemes[scheme.Id]; !ok {
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeSave", "store.sql_scheme.save.update.app_error", nil, "no record to update", http.StatusInternalServerError)
+			return
+		}
+
+		scheme.UpdateAt = model.GetMillis()
+		s.schemes[scheme.Id] = cloneScheme(scheme)
+
+		result.Data = scheme
+	})
+}
+
+// create stores the scheme together with its default roles. Nothing is stored unless all of them are created,
+// like the transaction of the sql store.
+func (s *MemSchemeStore) create(scheme *model.Scheme) (*model.Scheme, *model.AppError) {
+	roles := &MemRoleStore{s.MemStore}
+	var created []string
+
+	rollback := func() {
+		for _, id := range created {
+			delete(s.roles, id)
+		}
+	}
+
+	createSchemeRole := func(displayName string) (string, *model.AppError) {
+		role, err := roles.create(&model.Role{
+			Name:          model.NewId(),
+			DisplayName:   fmt.Sprintf("%v Role for Scheme %s", displayName, scheme.Name),
+			Permissions:   []string{},
+			SchemeManaged: true,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		created = append(created, role.Id)
+		return role.Name, nil
+	}
+
+	var err *model.AppError
+
+	if scheme.Scope == model.SCHEME_SCOPE_TEAM {
+		if scheme.DefaultTeamAdminRole, err = createSchemeRole("Team Admin"); err != nil {
+			rollback()
+			return nil, err
+		}
+
+		if scheme.DefaultTeamUserRole, err = createSchemeRole("Team User"); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+
+	if scheme.Scope == model.SCHEME_SCOPE_TEAM || scheme.Scope == model.SCHEME_SCOPE_CHANNEL {
+		if scheme.DefaultChannelAdminRole, err = createSchemeRole("Channel Admin"); err != nil {
+			rollback()
+			return nil, err
+		}
+
+		if scheme.DefaultChannelUserRole, err = createSchemeRole("Channel User"); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+
+	scheme.Id = model.NewId()
+	scheme.CreateAt = model.GetMillis()
+	scheme.UpdateAt = scheme.CreateAt
+
+	if err = scheme.IsValidForCreate(); err != nil {
+		rollback()
+		return nil, err
+	}
+
+	for _, existing := range s.schemes {
+		if existing.Name == scheme.Name {
+			rollback()
+			return nil, model.NewAppError("SqlSchemeStore.SchemeSave", "store.sql_scheme.save.insert.app_error", nil, "name="+scheme.Name, http.StatusInternalServerError)
+		}
+	}
+
+	s.schemes[scheme.Id] = cloneScheme(scheme)
+
+	return scheme, nil
+}
+
+func (s *MemSchemeStore) Get(schemeId string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		if scheme, ok := s.schemes[schemeId]; ok {
+			result.Data = cloneScheme(scheme)
+		} else {
+			result.Err = model.NewAppError("SqlSchemeStore.Get", "store.sql_scheme.get.app_error", nil, "Id="+schemeId, http.StatusNotFound)
+		}
+	})
+}
+
+func (s *MemSchemeStore) Delete(schemeId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		scheme, ok := s.schemes[schemeId]
+		if !ok {
+			result.Err = model.NewAppError("SqlSchemeStore.SchemeDelete", "store.sql_scheme.delete.get.app_error", nil, "Id="+schemeId, http.StatusNotFound)
+			return
+		}
+
+		time := model.GetMillis()
+
+		// Delete the roles belonging to the scheme
+		roleNames := make(map[string]bool)
+		for _, name := range scheme.RoleNames() {
+			roleNames[name] = true
+		}
+
+		for _, role := range s.roles {
+			if roleNames[role.Name] {
+				role.UpdateAt = time
+				role.DeleteAt = time
+			}
+		}
+
+		scheme.UpdateAt = time
+		scheme.DeleteAt = time
+
+		result.Data = cloneScheme(scheme)
+	})
+}
+
+func (s *MemSchemeStore) GetAllPage(scope string, offset int, limit int) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		schemes := []*model.Scheme{}
+		for _, scheme := range s.schemes {
+			if scheme.DeleteAt == 0 && (len(scope) == 0 || scheme.Scope == scope) {
+				schemes = append(schemes, cloneScheme(scheme))
+			}
+		}
+
+		sort.Slice(schemes, func(i, j int) bool {
+			return schemes[i].CreateAt > schemes[j].CreateAt
+		})
+
+		if offset >= len(schemes) {
+			schemes = []*model.Scheme{}
+		} else if offset+limit < len(schemes) {
+			schemes = schemes[offset : offset+limit]
+		} else {
+			schemes = schemes[offset:]
+		}
+
+		result.Data = schemes
+	})
+}
+
+func (s *MemSchemeStore) PermanentDeleteAll() store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		s.schemes = make(map[string]*model.Scheme)
+	})
+}
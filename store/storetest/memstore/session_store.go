@@ -0,0 +1,143 @@
+package memstore
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+type MemSessionStore struct {
+	*MemStore
+}
+
+func (s *MemSessionStore) Save(session *model.Session) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if len(session.Id) > 0 {
+			result.Err = model.NewAppError("SqlSessionStore.Save", "store.sql_session.save.existing.app_error", nil, "id="+session.Id, http.StatusBadRequest)
+			return
+		}
+
+		session.PreSave()
+
+		s.sessions[session.Id] = session.DeepCopy()
+
+		result.Data = session
+	})
+}
+
+func (s *MemSessionStore) Get(sessionIdOrToken string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		for _, session := range s.sessions {
+			if session.Id == sessionIdOrToken || string(session.Token) == sessionIdOrToken {
+				result.Data = session.DeepCopy()
+				return
+			}
+		}
+
+		result.Err = model.NewAppError("SqlSessionStore.Get", "store.sql_session.get.app_error", nil, "sessionIdOrToken="+sessionIdOrToken, http.StatusNotFound)
+	})
+}
+
+func (s *MemSessionStore) GetSessions(userId string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		sessions := []*model.Session{}
+		for _, session := range s.sessions {
+			if session.UserId == userId {
+				sessions = append(sessions, session.DeepCopy())
+			}
+		}
+
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].LastActivityAt > sessions[j].LastActivityAt
+		})
+
+		result.Data = sessions
+	})
+}
+
+func (s *MemSessionStore) Remove(sessionIdOrToken string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		for id, session := range s.sessions {
+			if session.Id == sessionIdOrToken || string(session.Token) == sessionIdOrToken {
+				delete(s.sessions, id)
+			}
+		}
+	})
+}
+
+func (s *MemSessionStore) RemoveAllSessions() store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		s.sessions = make(map[string]*model.Session)
+	})
+}
+
+func (s *MemSessionStore) PermanentDeleteSessionsByUser(userId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		for id, session := range s.sessions {
+			if session.UserId == userId {
+				delete(s.sessions, id)
+			}
+		}
+	})
+}
+
+func (s *MemSessionStore) UpdateLastActivityAt(sessionId string, time int64) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if session, ok := s.sessions[sessionId]; ok {
+			session.LastActivityAt = time
+		}
+
+		result.Data = sessionId
+	})
+}
+
+func (s *MemSessionStore) UpdateRoles(userId string, roles string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		for _, session := range s.sessions {
+			if session.UserId == userId {
+				session.Roles = roles
+			}
+		}
+
+		result.Data = userId
+	})
+}
+
+func (s *MemSessionStore) UpdateDeviceId(id string, deviceId string, expiresAt int64) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if session, ok := s.sessions[id]; ok {
+			session.DeviceId = deviceId
+			session.ExpiresAt = expiresAt
+		}
+
+		result.Data = deviceId
+	})
+}
+
+func (s *MemSessionStore) AnalyticsSessionCount() store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		now := model.GetMillis()
+
+		var count int64
+		for _, session := range s.sessions {
+			if session.ExpiresAt > now {
+				count++
+			}
+		}
+
+		result.Data = count
+	})
+}
+
+func (s *MemSessionStore) Cleanup(expiryTime int64, batchSize int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, session := range s.sessions {
+		if session.ExpiresAt != 0 && session.ExpiresAt < expiryTime {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package memstore
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+type MemUserStore struct {
+	*MemStore
+}
+
+func cloneUser(user *model.User) *model.User {
+	clone := *user
+	if user.AuthData != nil {
+		clone.AuthData = model.NewString(*user.AuthData)
+	}
+	if user.Props != nil {
+		clone.Props = model.CopyStringMap(user.Props)
+	}
+	if user.Timezone != nil {
+		clone.Timezone = model.CopyStringMap(user.Timezone)
+	}
+	return &clone
+}
+
+// sortedUsers returns clones of the stored users for which keep is true, ordered by username.
+func (s *MemUserStore) sortedUsers(keep func(user *model.User) bool) []*model.User {
+	users := []*model.User{}
+	for _, user := range s.users {
+		if keep(user) {
+			users = append(users, cloneUser(user))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users
+}
+
+// conflict returns the unique column another user already holds, if any.
+func (s *MemUserStore) conflict(user *model.User) string {
+	for _, other := range s.users {
+		if other.Id == user.Id {
+			continue
+		}
+
+		if other.Email == user.Email {
+			return "email"
+		}
+
+		if other.Username == user.Username {
+			return "username"
+		}
+
+		if other.AuthData != nil && user.AuthData != nil && *other.AuthData == *user.AuthData {
+			return "auth_data"
+		}
+	}
+
+	return ""
+}
+
+func (s *MemUserStore) Save(user *model.User) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if len(user.Id) > 0 {
+			result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.existing.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+			return
+		}
+
+		user.PreSave()
+		if result.Err = user.IsValid(); result.Err != nil {
+			return
+		}
+
+		switch s.conflict(user) {
+		case "email":
+			result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.email_exists.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+		case "username":
+			result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.username_exists.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+		case "auth_data":
+			result.Err = model.NewAppError("SqlUserStore.Save", "store.sql_user.save.app_error", nil, "user_id="+user.Id, http.StatusInternalServerError)
+		default:
+			s.users[user.Id] = cloneUser(user)
+			result.Data = user
+		}
+	})
+}
+
+func (s *MemUserStore) Update(user *model.User, trustedUpdateData bool) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		user.PreUpdate()
+
+		if result.Err = user.IsValid(); result.Err != nil {
+			return
+		}
+
+		stored, ok := s.users[user.Id]
+		if !ok {
+			result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.find.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+			return
+		}
+
+		oldUser := cloneUser(stored)
+		user.CreateAt = oldUser.CreateAt
+		user.AuthData = oldUser.AuthData
+		user.AuthService = oldUser.AuthService
+		user.Password = oldUser.Password
+		user.LastPasswordUpdate = oldUser.LastPasswordUpdate
+		user.LastPictureUpdate = oldUser.LastPictureUpdate
+		user.EmailVerified = oldUser.EmailVerified
+		user.FailedAttempts = oldUser.FailedAttempts
+
+		if !trustedUpdateData {
+			user.Roles = oldUser.Roles
+			user.DeleteAt = oldUser.DeleteAt
+		}
+
+		if user.Email != oldUser.Email {
+			user.EmailVerified = false
+		}
+
+		switch s.conflict(user) {
+		case "email":
+			result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.email_taken.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+		case "username":
+			result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.username_taken.app_error", nil, "user_id="+user.Id, http.StatusBadRequest)
+		case "auth_data":
+			result.Err = model.NewAppError("SqlUserStore.Update", "store.sql_user.update.updating.app_error", nil, "user_id="+user.Id, http.StatusInternalServerError)
+		default:
+			s.users[user.Id] = cloneUser(user)
+			user.Sanitize()
+			oldUser.Sanitize()
+			result.Data = [2]*model.User{user, oldUser}
+		}
+	})
+}
+
+func (s *MemUserStore) UpdateLastPictureUpdate(userId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if user, ok := s.users[userId]; ok {
+			user.LastPictureUpdate = model.GetMillis()
+			user.UpdateAt = user.LastPictureUpdate
+		}
+
+		result.Data = userId
+	})
+}
+
+func (s *MemUserStore) UpdatePassword(userId, hashedPassword string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if user, ok := s.users[userId]; ok {
+			updateAt := model.GetMillis()
+			user.Password = hashedPassword
+			user.LastPasswordUpdate = updateAt
+			user.UpdateAt = updateAt
+			user.AuthData = nil
+			user.AuthService = ""
+			user.EmailVerified = true
+			user.FailedAttempts = 0
+		}
+
+		result.Data = userId
+	})
+}
+
+func (s *MemUserStore) UpdateFailedPasswordAttempts(userId string, attempts int) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if user, ok := s.users[userId]; ok {
+			user.FailedAttempts = attempts
+		}
+
+		result.Data = userId
+	})
+}
+
+func (s *MemUserStore) Get(id string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		if user, ok := s.users[id]; ok {
+			result.Data = cloneUser(user)
+		} else {
+			result.Err = model.NewAppError("SqlUserStore.Get", store.MISSING_ACCOUNT_ERROR, nil, "user_id="+id, http.StatusNotFound)
+		}
+	})
+}
+
+func (s *MemUserStore) GetAll() store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		result.Data = s.sortedUsers(func(user *model.User) bool {
+			return true
+		})
+	})
+}
+
+func (s *MemUserStore) GetAllProfiles(offset int, limit int) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		users := s.sortedUsers(func(user *model.User) bool {
+			return true
+		})
+
+		if offset >= len(users) {
+			users = []*model.User{}
+		} else if offset+limit < len(users) {
+			users = users[offset : offset+limit]
+		} else {
+			users = users[offset:]
+		}
+
+		for _, u := range users {
+			u.Sanitize()
+		}
+
+		result.Data = users
+	})
+}
+
+func (s *MemUserStore) GetProfileByIds(userIds []string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		ids := make(map[string]bool)
+		for _, id := range userIds {
+			ids[id] = true
+		}
+
+		users := s.sortedUsers(func(user *model.User) bool {
+			return ids[user.Id]
+		})
+
+		for _, u := range users {
+			u.Sanitize()
+		}
+
+		result.Data = users
+	})
+}
+
+func (s *MemUserStore) GetByEmail(email string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		email = model.NormalizeEmail(email)
+
+		for _, user := range s.users {
+			if user.Email == email {
+				result.Data = cloneUser(user)
+				return
+			}
+		}
+
+		result.Err = model.NewAppError("SqlUserStore.GetByEmail", store.MISSING_ACCOUNT_ERROR, nil, "email="+email, http.StatusInternalServerError)
+		result.Data = &model.User{}
+	})
+}
+
+func (s *MemUserStore) GetByUsername(username string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		username = model.NormalizeUsername(username)
+
+		for _, user := range s.users {
+			if user.Username == username {
+				result.Data = cloneUser(user)
+				return
+			}
+		}
+
+		result.Err = model.NewAppError("SqlUserStore.GetByUsername", "store.sql_user.get_by_username.app_error", nil, "username="+username, http.StatusInternalServerError)
+		result.Data = &model.User{}
+	})
+}
+
+func (s *MemUserStore) GetForLogin(loginId string) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		email := model.NormalizeEmail(loginId)
+
+		users := s.sortedUsers(func(user *model.User) bool {
+			return user.Username == loginId || user.Email == email
+		})
+
+		if len(users) == 1 {
+			result.Data = users[0]
+		} else if len(users) > 1 {
+			result.Err = model.NewAppError("SqlUserStore.GetForLogin", "store.sql_user.get_for_login.multiple_users", nil, "", http.StatusInternalServerError)
+		} else {
+			result.Err = model.NewAppError("SqlUserStore.GetForLogin", "store.sql_user.get_for_login.app_error", nil, "", http.StatusInternalServerError)
+		}
+	})
+}
+
+func (s *MemUserStore) VerifyEmail(userId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		if user, ok := s.users[userId]; ok {
+			user.EmailVerified = true
+		}
+
+		result.Data = userId
+	})
+}
+
+func (s *MemUserStore) PermanentDelete(userId string) store.StoreChannel {
+	return s.do(func(result *store.StoreResult) {
+		delete(s.users, userId)
+	})
+}
+
+func (s *MemUserStore) Count() store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		var count int64
+		for _, user := range s.users {
+			if user.DeleteAt == 0 {
+				count++
+			}
+		}
+
+		result.Data = count
+	})
+}
+
+func (s *MemUserStore) Search(term string, limit int) store.StoreChannel {
+	return s.read(func(result *store.StoreResult) {
+		term = strings.TrimSpace(strings.ToLower(term))
+		term = strings.TrimPrefix(term, "@")
+
+		if term == "" {
+			result.Data = []*model.User{}
+			return
+		}
+
+		users := s.sortedUsers(func(user *model.User) bool {
+			if user.DeleteAt != 0 {
+				return false
+			}
+
+			for _, field := range []string{user.Username, user.FirstName, user.LastName, user.Nickname, user.Email} {
+				if strings.HasPrefix(strings.ToLower(field), term) {
+					return true
+				}
+			}
+
+			return false
+		})
+
+		if len(users) > limit {
+			users = users[:limit]
+		}
+
+		for _, u := range users {
+			u.Sanitize()
+		}
+
+		result.Data = users
+	})
+}
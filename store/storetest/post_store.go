@@ -0,0 +1,708 @@
+package storetest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func TestPostStore(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ss store.Store)
+	}{
+		{"Save", testPostStoreSave},
+		{"SaveInvalid", testPostStoreSaveInvalid},
+		{"Get", testPostStoreGet},
+		{"GetSingle", testPostStoreGetSingle},
+		{"Update", testPostStoreUpdate},
+		{"Overwrite", testPostStoreOverwrite},
+		{"GetEtag", testPostStoreGetEtag},
+		{"Delete", testPostStoreDelete},
+		{"PermanentDeleteByUser", testPostStorePermanentDeleteByUser},
+		{"PermanentDeleteByChannel", testPostStorePermanentDeleteByChannel},
+		{"GetPosts", testPostStoreGetPosts},
+		{"GetPostsFromCache", testPostStoreGetPostsFromCache},
+		{"GetPostsSince", testPostStoreGetPostsSince},
+		{"GetPostsBeforeAfter", testPostStoreGetPostsBeforeAfter},
+		{"Search", testPostStoreSearch},
+		{"AnalyticsUserCountsWithPostsByDay", testPostStoreAnalyticsUserCountsWithPostsByDay},
+		{"AnalyticsPostCountsByDay", testPostStoreAnalyticsPostCountsByDay},
+		{"AnalyticsPostCount", testPostStoreAnalyticsPostCount},
+		{"GetPostsCreatedAt", testPostStoreGetPostsCreatedAt},
+		{"GetPostsByIds", testPostStoreGetPostsByIds},
+		{"GetPostsBatchForIndexing", testPostStoreGetPostsBatchForIndexing},
+		{"GetOldest", testPostStoreGetOldest},
+		{"PermanentDeleteBatch", testPostStorePermanentDeleteBatch},
+		{"GetMaxPostSize", testPostStoreGetMaxPostSize},
+		{"WithContext", testPostStoreWithContext},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ss)
+		})
+	}
+}
+
+// must waits for the result of a store call and fails the test if it returned an error.
+func must(t *testing.T, sc store.StoreChannel) interface{} {
+	t.Helper()
+
+	result := <-sc
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	return result.Data
+}
+
+// mustFail waits for the result of a store call and fails the test unless it returned the error with the given id.
+func mustFail(t *testing.T, sc store.StoreChannel, id string) *model.AppError {
+	t.Helper()
+
+	result := <-sc
+	if result.Err == nil {
+		t.Fatalf("should have failed with %v", id)
+	}
+
+	if result.Err.Id != id {
+		t.Fatalf("should have failed with %v, got %v", id, result.Err.Id)
+	}
+
+	return result.Err
+}
+
+func savePost(t *testing.T, ss store.Store, post *model.Post) *model.Post {
+	t.Helper()
+
+	return must(t, ss.Post().Save(post)).(*model.Post)
+}
+
+func newPost(channelId string, userId string, message string, createAt int64) *model.Post {
+	return &model.Post{
+		ChannelId: channelId,
+		UserId:    userId,
+		Message:   message,
+		CreateAt:  createAt,
+	}
+}
+
+func newReply(root *model.Post, userId string, message string, createAt int64) *model.Post {
+	return &model.Post{
+		ChannelId: root.ChannelId,
+		UserId:    userId,
+		RootId:    root.Id,
+		ParentId:  root.Id,
+		Message:   message,
+		CreateAt:  createAt,
+	}
+}
+
+func checkOrder(t *testing.T, list *model.PostList, posts ...*model.Post) {
+	t.Helper()
+
+	if len(list.Order) != len(posts) {
+		t.Fatalf("should have returned %v posts in order, got %v", len(posts), len(list.Order))
+	}
+
+	for i, post := range posts {
+		if list.Order[i] != post.Id {
+			t.Fatalf("post %v out of order: expected %v, got %v", i, post.Id, list.Order[i])
+		}
+
+		if _, ok := list.Posts[post.Id]; !ok {
+			t.Fatalf("missing post %v", post.Id)
+		}
+	}
+}
+
+func sumRows(rows model.AnalyticsRows) float64 {
+	var sum float64
+	for _, row := range rows {
+		sum += row.Value
+	}
+	return sum
+}
+
+func testPostStoreSave(t *testing.T, ss store.Store) {
+	root := savePost(t, ss, newPost(model.NewId(), model.NewId(), "root", 0))
+	if len(root.Id) != 26 || root.CreateAt == 0 || root.UpdateAt != root.CreateAt {
+		t.Fatal("save should fill in the id and timestamps")
+	}
+
+	mustFail(t, ss.Post().Save(root), "store.sql_post.save.existing.app_error")
+
+	reply := savePost(t, ss, newReply(root, model.NewId(), "reply", root.CreateAt+10))
+
+	stored := must(t, ss.Post().GetSingle(root.Id)).(*model.Post)
+	if stored.UpdateAt != reply.UpdateAt {
+		t.Fatal("saving a reply should update the root post")
+	}
+}
+
+func testPostStoreSaveInvalid(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		post *model.Post
+		id   string
+	}{
+		{"bad user", &model.Post{ChannelId: model.NewId(), UserId: "junk"}, "model.post.is_valid.user_id.app_error"},
+		{"bad channel", &model.Post{ChannelId: "junk", UserId: model.NewId()}, "model.post.is_valid.channel_id.app_error"},
+		{"parent without root", &model.Post{ChannelId: model.NewId(), UserId: model.NewId(), ParentId: model.NewId()}, "model.post.is_valid.root_parent.app_error"},
+		{"bad type", &model.Post{ChannelId: model.NewId(), UserId: model.NewId(), Type: "junk"}, "model.post.is_valid.type.app_error"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mustFail(t, ss.Post().Save(tc.post), tc.id)
+		})
+	}
+}
+
+func testPostStoreGet(t *testing.T, ss store.Store) {
+	root := savePost(t, ss, newPost(model.NewId(), model.NewId(), "root", 0))
+	reply := savePost(t, ss, newReply(root, model.NewId(), "reply", root.CreateAt+1))
+	other := savePost(t, ss, newPost(root.ChannelId, model.NewId(), "other", root.CreateAt+2))
+
+	list := must(t, ss.Post().Get(reply.Id)).(*model.PostList)
+	if len(list.Order) != 1 || list.Order[0] != reply.Id {
+		t.Fatal("should order only the requested post")
+	}
+
+	if len(list.Posts) != 2 || list.Posts[root.Id] == nil || list.Posts[reply.Id] == nil {
+		t.Fatal("should return the whole thread")
+	}
+
+	if list.Posts[other.Id] != nil {
+		t.Fatal("should not return posts outside the thread")
+	}
+
+	if err := mustFail(t, ss.Post().Get(""), "store.sql_post.get.app_error"); err.StatusCode != http.StatusBadRequest {
+		t.Fatal("an empty id should be a bad request")
+	}
+
+	if err := mustFail(t, ss.Post().Get(model.NewId()), "store.sql_post.get.app_error"); err.StatusCode != http.StatusNotFound {
+		t.Fatal("a missing post should not be found")
+	}
+}
+
+func testPostStoreGetSingle(t *testing.T, ss store.Store) {
+	post := savePost(t, ss, newPost(model.NewId(), model.NewId(), "single", 0))
+
+	stored := must(t, ss.Post().GetSingle(post.Id)).(*model.Post)
+	if stored.Id != post.Id || stored.Message != post.Message {
+		t.Fatal("should return the saved post")
+	}
+
+	must(t, ss.Post().Delete(post.Id, model.GetMillis(), post.UserId))
+
+	mustFail(t, ss.Post().GetSingle(post.Id), "store.sql_post.get.app_error")
+	mustFail(t, ss.Post().GetSingle(model.NewId()), "store.sql_post.get.app_error")
+}
+
+func testPostStoreUpdate(t *testing.T, ss store.Store) {
+	root := savePost(t, ss, newPost(model.NewId(), model.NewId(), "root", model.GetMillis()-1000))
+	reply := savePost(t, ss, newReply(root, model.NewId(), "reply", root.CreateAt+1))
+
+	oldReply := reply.Clone()
+	reply.Message = "edited"
+	reply.EditAt = model.GetMillis()
+
+	updated := must(t, ss.Post().Update(reply, oldReply)).(*model.Post)
+	if updated.Message != "edited" {
+		t.Fatal("should return the updated post")
+	}
+
+	if oldReply.Id == reply.Id || oldReply.DeleteAt == 0 {
+		t.Fatal("should keep the old version under a new id, marked as deleted")
+	}
+
+	stored := must(t, ss.Post().GetSingle(reply.Id)).(*model.Post)
+	if stored.Message != "edited" || stored.EditAt != reply.EditAt {
+		t.Fatal("should have stored the update")
+	}
+
+	mustFail(t, ss.Post().GetSingle(oldReply.Id), "store.sql_post.get.app_error")
+
+	storedRoot := must(t, ss.Post().GetSingle(root.Id)).(*model.Post)
+	if storedRoot.UpdateAt != updated.UpdateAt {
+		t.Fatal("updating a reply should update the root post")
+	}
+}
+
+func testPostStoreOverwrite(t *testing.T, ss store.Store) {
+	post := savePost(t, ss, newPost(model.NewId(), model.NewId(), "original", 0))
+
+	post.Message = "overwritten"
+	post.FileIds = model.StringArray{model.NewId()}
+	must(t, ss.Post().Overwrite(post))
+
+	stored := must(t, ss.Post().GetSingle(post.Id)).(*model.Post)
+	if stored.Message != "overwritten" || len(stored.FileIds) != 1 {
+		t.Fatal("should have overwritten the post")
+	}
+
+	if stored.Id != post.Id {
+		t.Fatal("should not keep a copy of the old post")
+	}
+
+	post.UserId = "junk"
+	mustFail(t, ss.Post().Overwrite(post), "model.post.is_valid.user_id.app_error")
+}
+
+func testPostStoreGetEtag(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+	base := model.GetMillis() - 1000
+
+	savePost(t, ss, newPost(channelId, model.NewId(), "first", base))
+	etag1 := must(t, ss.Post().GetEtag(channelId, false)).(string)
+
+	savePost(t, ss, newPost(channelId, model.NewId(), "second", base+10))
+	etag2 := must(t, ss.Post().GetEtag(channelId, false)).(string)
+
+	if etag1 == etag2 {
+		t.Fatal("a new post should change the etag")
+	}
+
+	if etag2 != model.Etag(base+10) {
+		t.Fatalf("the etag should be built from the last update, got %v", etag2)
+	}
+}
+
+func testPostStoreDelete(t *testing.T, ss store.Store) {
+	deleterId := model.NewId()
+
+	root := savePost(t, ss, newPost(model.NewId(), model.NewId(), "root", 0))
+	reply := savePost(t, ss, newReply(root, model.NewId(), "reply", root.CreateAt+1))
+
+	must(t, ss.Post().Delete(root.Id, model.GetMillis(), deleterId))
+
+	mustFail(t, ss.Post().GetSingle(root.Id), "store.sql_post.get.app_error")
+	mustFail(t, ss.Post().GetSingle(reply.Id), "store.sql_post.get.app_error")
+
+	posts := must(t, ss.Post().GetPostsByIds([]string{root.Id, reply.Id})).([]*model.Post)
+	if len(posts) != 2 {
+		t.Fatal("deleted posts should still be stored")
+	}
+
+	for _, post := range posts {
+		if post.DeleteAt == 0 {
+			t.Fatal("the post and its replies should be marked as deleted")
+		}
+
+		if deletedBy, _ := post.Props[model.POST_PROPS_DELETE_BY].(string); post.Id == root.Id && deletedBy != deleterId {
+			t.Fatal("should record who deleted the post")
+		} else if post.Id == reply.Id && deletedBy != "" {
+			t.Fatal("should only record who deleted the post on the post itself")
+		}
+	}
+
+	mustFail(t, ss.Post().Delete(root.Id, model.GetMillis(), deleterId), "store.sql_post.delete.app_error")
+}
+
+func testPostStorePermanentDeleteByUser(t *testing.T, ss store.Store) {
+	userId := model.NewId()
+	otherId := model.NewId()
+	channelId := model.NewId()
+
+	root := savePost(t, ss, newPost(channelId, userId, "root", 0))
+	otherReply := savePost(t, ss, newReply(root, otherId, "reply to root", root.CreateAt+1))
+	otherRoot := savePost(t, ss, newPost(channelId, otherId, "other root", root.CreateAt+2))
+	reply := savePost(t, ss, newReply(otherRoot, userId, "reply to other root", root.CreateAt+3))
+
+	must(t, ss.Post().PermanentDeleteByUser(userId))
+
+	posts := must(t, ss.Post().GetPostsByIds([]string{root.Id, otherReply.Id, otherRoot.Id, reply.Id})).([]*model.Post)
+	if len(posts) != 1 || posts[0].Id != otherRoot.Id {
+		t.Fatal("should delete the posts of the user and the replies to them")
+	}
+}
+
+func testPostStorePermanentDeleteByChannel(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+
+	post1 := savePost(t, ss, newPost(channelId, model.NewId(), "first", 0))
+	post2 := savePost(t, ss, newPost(channelId, model.NewId(), "second", 0))
+	other := savePost(t, ss, newPost(model.NewId(), model.NewId(), "elsewhere", 0))
+
+	must(t, ss.Post().PermanentDeleteByChannel(channelId))
+
+	posts := must(t, ss.Post().GetPostsByIds([]string{post1.Id, post2.Id, other.Id})).([]*model.Post)
+	if len(posts) != 1 || posts[0].Id != other.Id {
+		t.Fatal("should only delete the posts of the channel")
+	}
+}
+
+func testPostStoreGetPosts(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+	base := model.GetMillis() - 1000
+
+	root := savePost(t, ss, newPost(channelId, model.NewId(), "root", base))
+	post1 := savePost(t, ss, newPost(channelId, model.NewId(), "first", base+1))
+	post2 := savePost(t, ss, newPost(channelId, model.NewId(), "second", base+2))
+	reply := savePost(t, ss, newReply(root, model.NewId(), "reply", base+3))
+	deleted := savePost(t, ss, newPost(channelId, model.NewId(), "deleted", base+4))
+	must(t, ss.Post().Delete(deleted.Id, model.GetMillis(), deleted.UserId))
+
+	list := must(t, ss.Post().GetPosts(channelId, 0, 60, false)).(*model.PostList)
+	checkOrder(t, list, reply, post2, post1, root)
+
+	list = must(t, ss.Post().GetPosts(channelId, 0, 2, false)).(*model.PostList)
+	checkOrder(t, list, reply, post2)
+	if list.Posts[root.Id] == nil {
+		t.Fatal("should include the root of the replies on the page")
+	}
+
+	list = must(t, ss.Post().GetPosts(channelId, 2, 2, false)).(*model.PostList)
+	checkOrder(t, list, post1, root)
+
+	list = must(t, ss.Post().GetPosts(channelId, 10, 2, false)).(*model.PostList)
+	checkOrder(t, list)
+
+	mustFail(t, ss.Post().GetPosts(channelId, 0, 1001, false), "store.sql_post.get_posts.app_error")
+}
+
+func testPostStoreGetPostsFromCache(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+	base := model.GetMillis() - 1000
+
+	post1 := savePost(t, ss, newPost(channelId, model.NewId(), "first", base))
+
+	list := must(t, ss.Post().GetPosts(channelId, 0, 60, true)).(*model.PostList)
+	checkOrder(t, list, post1)
+
+	post2 := savePost(t, ss, newPost(channelId, model.NewId(), "second", base+1))
+	ss.Post().InvalidateLastPostTimeCache(channelId)
+
+	list = must(t, ss.Post().GetPosts(channelId, 0, 60, true)).(*model.PostList)
+	checkOrder(t, list, post2, post1)
+
+	ss.Post().ClearCaches()
+
+	list = must(t, ss.Post().GetPosts(channelId, 0, 60, true)).(*model.PostList)
+	checkOrder(t, list, post2, post1)
+}
+
+func testPostStoreGetPostsSince(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+	base := model.GetMillis() - 1000
+
+	root := savePost(t, ss, newPost(channelId, model.NewId(), "root", base))
+	post1 := savePost(t, ss, newPost(channelId, model.NewId(), "first", base+1))
+	post2 := savePost(t, ss, newPost(channelId, model.NewId(), "second", base+2))
+
+	list := must(t, ss.Post().GetPostsSince(channelId, base, false)).(*model.PostList)
+	checkOrder(t, list, post2, post1)
+
+	// a new reply bumps its root, so both come back
+	reply := savePost(t, ss, newReply(root, model.NewId(), "reply", base+3))
+
+	list = must(t, ss.Post().GetPostsSince(channelId, base+2, false)).(*model.PostList)
+	checkOrder(t, list, reply, root)
+
+	list = must(t, ss.Post().GetPostsSince(channelId, base+3, false)).(*model.PostList)
+	checkOrder(t, list)
+
+	list = must(t, ss.Post().GetPostsSince(model.NewId(), 0, false)).(*model.PostList)
+	checkOrder(t, list)
+}
+
+func testPostStoreGetPostsBeforeAfter(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+	base := model.GetMillis() - 1000
+
+	var posts []*model.Post
+	for i := 0; i < 5; i++ {
+		posts = append(posts, savePost(t, ss, newPost(channelId, model.NewId(), "post", base+int64(i))))
+	}
+
+	tests := []struct {
+		name     string
+		before   bool
+		postId   string
+		numPosts int
+		offset   int
+		expected []*model.Post
+	}{
+		{"before", true, posts[2].Id, 10, 0, []*model.Post{posts[1], posts[0]}},
+		{"before, limited", true, posts[4].Id, 2, 0, []*model.Post{posts[3], posts[2]}},
+		{"before, with offset", true, posts[4].Id, 2, 1, []*model.Post{posts[2], posts[1]}},
+		{"before the first", true, posts[0].Id, 10, 0, nil},
+		{"after", false, posts[2].Id, 10, 0, []*model.Post{posts[4], posts[3]}},
+		{"after, limited", false, posts[0].Id, 2, 0, []*model.Post{posts[2], posts[1]}},
+		{"after, with offset", false, posts[0].Id, 2, 1, []*model.Post{posts[3], posts[2]}},
+		{"after the last", false, posts[4].Id, 10, 0, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var sc store.StoreChannel
+			if tc.before {
+				sc = ss.Post().GetPostsBefore(channelId, tc.postId, tc.numPosts, tc.offset)
+			} else {
+				sc = ss.Post().GetPostsAfter(channelId, tc.postId, tc.numPosts, tc.offset)
+			}
+
+			checkOrder(t, must(t, sc).(*model.PostList), tc.expected...)
+		})
+	}
+}
+
+func testPostStoreSearch(t *testing.T, ss store.Store) {
+	user := must(t, ss.User().Save(&model.User{
+		Email:    model.NewId() + "@example.com",
+		Username: "u" + model.NewId(),
+	})).(*model.User)
+	otherId := model.NewId()
+
+	channelId := model.NewId()
+	otherChannelId := model.NewId()
+	base := model.GetMillis() - 1000
+
+	post1 := savePost(t, ss, newPost(channelId, user.Id, "apple banana", base))
+	post2 := savePost(t, ss, newPost(channelId, otherId, "apple cherry", base+1))
+	post3 := &model.Post{ChannelId: channelId, UserId: otherId, Message: "fruit basket", Hashtags: "#fruit", CreateAt: base + 2}
+	savePost(t, ss, post3)
+	post4 := savePost(t, ss, newPost(otherChannelId, user.Id, "apple pie", base+3))
+	deleted := savePost(t, ss, newPost(channelId, user.Id, "apple deleted", base+4))
+	must(t, ss.Post().Delete(deleted.Id, model.GetMillis(), user.Id))
+
+	channels := []string{channelId, otherChannelId}
+
+	tests := []struct {
+		name     string
+		params   *model.SearchParams
+		expected []*model.Post
+	}{
+		{"no terms", &model.SearchParams{}, nil},
+		{"one term", &model.SearchParams{Terms: "apple", InChannels: channels}, []*model.Post{post4, post2, post1}},
+		{"all terms", &model.SearchParams{Terms: "apple banana", InChannels: channels}, []*model.Post{post1}},
+		{"any term", &model.SearchParams{Terms: "banana cherry", InChannels: channels, OrTerms: true}, []*model.Post{post2, post1}},
+		{"wildcard", &model.SearchParams{Terms: "cher*", InChannels: channels}, []*model.Post{post2}},
+		{"hashtag", &model.SearchParams{Terms: "#fruit", IsHashtag: true, InChannels: channels}, []*model.Post{post3}},
+		{"in channel", &model.SearchParams{Terms: "apple", InChannels: []string{otherChannelId}}, []*model.Post{post4}},
+		{"excluded channel", &model.SearchParams{Terms: "apple", InChannels: channels, ExcludedChannels: []string{otherChannelId}}, []*model.Post{post2, post1}},
+		{"from user", &model.SearchParams{InChannels: channels, FromUsers: []string{user.Username}}, []*model.Post{post4, post1}},
+		{"excluded user", &model.SearchParams{Terms: "apple", InChannels: channels, ExcludedUsers: []string{user.Username}}, []*model.Post{post2}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			checkOrder(t, must(t, ss.Post().Search(tc.params)).(*model.PostList), tc.expected...)
+		})
+	}
+}
+
+func testPostStoreAnalyticsUserCountsWithPostsByDay(t *testing.T, ss store.Store) {
+	before := sumRows(must(t, ss.Post().AnalyticsUserCountsWithPostsByDay()).(model.AnalyticsRows))
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	createAt := model.GetStartOfDayMillis(yesterday, 0) + int64(12*time.Hour/time.Millisecond)
+
+	userId := model.NewId()
+	savePost(t, ss, newPost(model.NewId(), userId, "first", createAt))
+	savePost(t, ss, newPost(model.NewId(), userId, "second", createAt+1))
+
+	after := sumRows(must(t, ss.Post().AnalyticsUserCountsWithPostsByDay()).(model.AnalyticsRows))
+	if after != before+1 {
+		t.Fatalf("should count the user once, counted %v", after-before)
+	}
+}
+
+func testPostStoreAnalyticsPostCountsByDay(t *testing.T, ss store.Store) {
+	before := sumRows(must(t, ss.Post().AnalyticsPostCountsByDay()).(model.AnalyticsRows))
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	createAt := model.GetStartOfDayMillis(yesterday, 0) + int64(12*time.Hour/time.Millisecond)
+
+	savePost(t, ss, newPost(model.NewId(), model.NewId(), "first", createAt))
+	savePost(t, ss, newPost(model.NewId(), model.NewId(), "second", createAt+1))
+	savePost(t, ss, newPost(model.NewId(), model.NewId(), "today", 0))
+
+	after := sumRows(must(t, ss.Post().AnalyticsPostCountsByDay()).(model.AnalyticsRows))
+	if after != before+2 {
+		t.Fatalf("should count the posts up to yesterday, counted %v", after-before)
+	}
+}
+
+func testPostStoreAnalyticsPostCount(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name            string
+		mustHaveFile    bool
+		mustHaveHashtag bool
+		expected        int64
+	}{
+		{"all", false, false, 3},
+		{"with file", true, false, 2},
+		{"with hashtag", false, true, 2},
+		{"with file and hashtag", true, true, 1},
+	}
+
+	before := make([]int64, len(tests))
+	for i, tc := range tests {
+		before[i] = must(t, ss.Post().AnalyticsPostCount(tc.mustHaveFile, tc.mustHaveHashtag)).(int64)
+	}
+
+	channelId := model.NewId()
+	savePost(t, ss, &model.Post{ChannelId: channelId, UserId: model.NewId(), Message: "file", FileIds: model.StringArray{model.NewId()}})
+	savePost(t, ss, &model.Post{ChannelId: channelId, UserId: model.NewId(), Message: "#tag", Hashtags: "#tag"})
+	savePost(t, ss, &model.Post{ChannelId: channelId, UserId: model.NewId(), Message: "#both", Hashtags: "#both", FileIds: model.StringArray{model.NewId()}})
+
+	deleted := savePost(t, ss, &model.Post{ChannelId: channelId, UserId: model.NewId(), Message: "#gone", Hashtags: "#gone", FileIds: model.StringArray{model.NewId()}})
+	must(t, ss.Post().Delete(deleted.Id, model.GetMillis(), deleted.UserId))
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			count := must(t, ss.Post().AnalyticsPostCount(tc.mustHaveFile, tc.mustHaveHashtag)).(int64)
+			if count-before[i] != tc.expected {
+				t.Fatalf("should have counted %v posts, counted %v", tc.expected, count-before[i])
+			}
+		})
+	}
+}
+
+func testPostStoreGetPostsCreatedAt(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+	createAt := model.GetMillis() - 1000
+
+	savePost(t, ss, newPost(channelId, model.NewId(), "first", createAt))
+	savePost(t, ss, newPost(channelId, model.NewId(), "second", createAt))
+	savePost(t, ss, newPost(channelId, model.NewId(), "later", createAt+1))
+	savePost(t, ss, newPost(model.NewId(), model.NewId(), "elsewhere", createAt))
+
+	posts := must(t, ss.Post().GetPostsCreatedAt(channelId, createAt)).([]*model.Post)
+	if len(posts) != 2 {
+		t.Fatalf("should have returned 2 posts, got %v", len(posts))
+	}
+}
+
+func testPostStoreGetPostsByIds(t *testing.T, ss store.Store) {
+	base := model.GetMillis() - 1000
+
+	post1 := savePost(t, ss, newPost(model.NewId(), model.NewId(), "first", base))
+	post2 := savePost(t, ss, newPost(model.NewId(), model.NewId(), "second", base+1))
+	post3 := savePost(t, ss, newPost(model.NewId(), model.NewId(), "third", base+2))
+
+	posts := must(t, ss.Post().GetPostsByIds([]string{post1.Id, post3.Id, model.NewId()})).([]*model.Post)
+	if len(posts) != 2 || posts[0].Id != post3.Id || posts[1].Id != post1.Id {
+		t.Fatal("should return the existing posts, newest first")
+	}
+
+	posts = must(t, ss.Post().GetPostsByIds([]string{post2.Id})).([]*model.Post)
+	if len(posts) != 1 || posts[0].Message != "second" {
+		t.Fatal("should return the post")
+	}
+}
+
+func testPostStoreGetPostsBatchForIndexing(t *testing.T, ss store.Store) {
+	// far enough in the past that nothing else is in the window
+	base := int64(1000000)
+
+	root := savePost(t, ss, newPost(model.NewId(), model.NewId(), "root", base))
+	reply := savePost(t, ss, newReply(root, model.NewId(), "reply", base+1))
+	later := savePost(t, ss, newPost(model.NewId(), model.NewId(), "later", base+2))
+
+	batch := must(t, ss.Post().GetPostsBatchForIndexing(base, base+3, 100)).([]*model.PostForIndexing)
+	if len(batch) != 3 || batch[0].Id != root.Id || batch[1].Id != reply.Id || batch[2].Id != later.Id {
+		t.Fatal("should return the posts in the window, oldest first")
+	}
+
+	if batch[0].ParentCreateAt != nil {
+		t.Fatal("a root post has no parent")
+	}
+
+	if batch[1].ParentCreateAt == nil || *batch[1].ParentCreateAt != root.CreateAt {
+		t.Fatal("a reply should carry the creation time of its root")
+	}
+
+	batch = must(t, ss.Post().GetPostsBatchForIndexing(base, base+3, 1)).([]*model.PostForIndexing)
+	if len(batch) != 1 || batch[0].Id != root.Id {
+		t.Fatal("should limit the batch")
+	}
+
+	batch = must(t, ss.Post().GetPostsBatchForIndexing(base+1, base+2, 100)).([]*model.PostForIndexing)
+	if len(batch) != 1 || batch[0].Id != reply.Id {
+		t.Fatal("the window should include its start and exclude its end")
+	}
+}
+
+func testPostStoreGetOldest(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+
+	oldest := savePost(t, ss, newPost(channelId, model.NewId(), "oldest", 1))
+	savePost(t, ss, newPost(channelId, model.NewId(), "newer", 2))
+
+	post := must(t, ss.Post().GetOldest()).(*model.Post)
+	if post.Id != oldest.Id {
+		t.Fatal("should return the oldest post")
+	}
+
+	must(t, ss.Post().PermanentDeleteByChannel(channelId))
+}
+
+func testPostStorePermanentDeleteBatch(t *testing.T, ss store.Store) {
+	channelId := model.NewId()
+
+	post1 := savePost(t, ss, newPost(channelId, model.NewId(), "first", 10))
+	post2 := savePost(t, ss, newPost(channelId, model.NewId(), "second", 11))
+	post3 := savePost(t, ss, newPost(channelId, model.NewId(), "third", 12))
+	kept := savePost(t, ss, newPost(channelId, model.NewId(), "kept", 100))
+
+	if deleted := must(t, ss.Post().PermanentDeleteBatch(100, 2)).(int64); deleted != 2 {
+		t.Fatalf("should delete up to the limit, deleted %v", deleted)
+	}
+
+	if deleted := must(t, ss.Post().PermanentDeleteBatch(100, 2)).(int64); deleted != 1 {
+		t.Fatalf("should delete the rest, deleted %v", deleted)
+	}
+
+	posts := must(t, ss.Post().GetPostsByIds([]string{post1.Id, post2.Id, post3.Id, kept.Id})).([]*model.Post)
+	if len(posts) != 1 || posts[0].Id != kept.Id {
+		t.Fatal("should only delete the posts created before the end time")
+	}
+
+	must(t, ss.Post().PermanentDeleteByChannel(channelId))
+}
+
+func testPostStoreGetMaxPostSize(t *testing.T, ss store.Store) {
+	size := must(t, ss.Post().GetMaxPostSize()).(int)
+	if size != model.POST_MESSAGE_MAX_RUNES_V1 && size != model.POST_MESSAGE_MAX_RUNES_V2 {
+		t.Fatalf("unexpected max post size %v", size)
+	}
+}
+
+func testPostStoreWithContext(t *testing.T, ss store.Store) {
+	post := savePost(t, ss, newPost(model.NewId(), model.NewId(), "context", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stored := must(t, ss.Post().WithContext(ctx).GetSingle(post.Id)).(*model.Post)
+	if stored.Id != post.Id {
+		t.Fatal("should return the saved post")
+	}
+
+	cancel()
+	if err := mustFail(t, ss.Post().WithContext(ctx).GetSingle(post.Id), store.CANCELED_ERROR); !store.IsCanceledError(err) || store.IsTimeoutError(err) {
+		t.Fatal("should be a cancellation")
+	}
+	mustFail(t, ss.Post().WithContext(ctx).Save(newPost(model.NewId(), model.NewId(), "cancelled", 0)), store.CANCELED_ERROR)
+	mustFail(t, ss.Post().WithContext(ctx).Update(post.Clone(), post.Clone()), store.CANCELED_ERROR)
+	mustFail(t, ss.Post().WithContext(ctx).Overwrite(post.Clone()), store.CANCELED_ERROR)
+	mustFail(t, ss.Post().WithContext(ctx).Delete(post.Id, model.GetMillis(), ""), store.CANCELED_ERROR)
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	if err := mustFail(t, ss.Post().WithContext(expired).GetSingle(post.Id), store.TIMEOUT_ERROR); !store.IsTimeoutError(err) {
+		t.Fatal("should be a timeout")
+	}
+
+	// The context only applies to the store WithContext returned.
+	must(t, ss.Post().GetSingle(post.Id))
+}
@@ -0,0 +1,76 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func TestReactionStore(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ss store.Store)
+	}{
+		{"SaveDelete", testReactionStoreSaveDelete},
+		{"DeleteAllWithEmojiName", testReactionStoreDeleteAllWithEmojiName},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ss)
+		})
+	}
+}
+
+func saveReaction(t *testing.T, ss store.Store, post *model.Post, emojiName string) *model.Reaction {
+	t.Helper()
+
+	reaction := &model.Reaction{UserId: model.NewId(), PostId: post.Id, EmojiName: emojiName}
+	return must(t, ss.Reaction().Save(reaction)).(*model.Reaction)
+}
+
+func testReactionStoreSaveDelete(t *testing.T, ss store.Store) {
+	post := savePost(t, ss, newPost(model.NewId(), model.NewId(), "reacted", 0))
+	reaction := saveReaction(t, ss, post, "smile")
+
+	if reaction.CreateAt == 0 {
+		t.Fatal("save should fill in CreateAt")
+	}
+
+	// Saving the same reaction again is not an error.
+	must(t, ss.Reaction().Save(reaction))
+
+	reactions := must(t, ss.Reaction().GetForPost(post.Id, false)).([]*model.Reaction)
+	if len(reactions) != 1 || reactions[0].UserId != reaction.UserId || reactions[0].EmojiName != "smile" {
+		t.Fatalf("should get the saved reaction, got %v", reactions)
+	}
+
+	if !must(t, ss.Post().GetSingle(post.Id)).(*model.Post).HasReactions {
+		t.Fatal("post should have reactions")
+	}
+
+	must(t, ss.Reaction().Delete(reaction))
+
+	if reactions := must(t, ss.Reaction().GetForPost(post.Id, false)).([]*model.Reaction); len(reactions) != 0 {
+		t.Fatalf("should have deleted the reaction, got %v", reactions)
+	}
+
+	if must(t, ss.Post().GetSingle(post.Id)).(*model.Post).HasReactions {
+		t.Fatal("post should no longer have reactions")
+	}
+}
+
+func testReactionStoreDeleteAllWithEmojiName(t *testing.T, ss store.Store) {
+	post := savePost(t, ss, newPost(model.NewId(), model.NewId(), "reacted", 0))
+	emojiName := "emoji_" + model.NewId()
+	saveReaction(t, ss, post, emojiName)
+	kept := saveReaction(t, ss, post, "smile")
+
+	must(t, ss.Reaction().DeleteAllWithEmojiName(emojiName))
+
+	reactions := must(t, ss.Reaction().GetForPost(post.Id, false)).([]*model.Reaction)
+	if len(reactions) != 1 || reactions[0].UserId != kept.UserId {
+		t.Fatalf("should only delete the reactions with the emoji, got %v", reactions)
+	}
+}
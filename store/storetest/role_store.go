@@ -0,0 +1,75 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func TestRoleStore(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ss store.Store)
+	}{
+		{"SaveGet", testRoleStoreSaveGet},
+		{"Delete", testRoleStoreDelete},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ss)
+		})
+	}
+}
+
+func newRole() *model.Role {
+	return &model.Role{
+		Name:        model.NewId(),
+		DisplayName: "Role",
+		Permissions: []string{"create_post", "edit_post"},
+	}
+}
+
+func testRoleStoreSaveGet(t *testing.T, ss store.Store) {
+	role := must(t, ss.Role().Save(newRole())).(*model.Role)
+	if len(role.Id) != 26 || role.CreateAt == 0 {
+		t.Fatal("save should fill in the id and timestamps")
+	}
+
+	if got := must(t, ss.Role().Get(role.Id)).(*model.Role); got.Name != role.Name || len(got.Permissions) != 2 {
+		t.Fatalf("should get the saved role, got %v", got)
+	}
+
+	if got := must(t, ss.Role().GetByName(role.Name)).(*model.Role); got.Id != role.Id {
+		t.Fatalf("should get the role by name, got %v", got.Id)
+	}
+
+	other := must(t, ss.Role().Save(newRole())).(*model.Role)
+	roles := must(t, ss.Role().GetByNames([]string{role.Name, other.Name, model.NewId()})).([]*model.Role)
+	if len(roles) != 2 {
+		t.Fatalf("should get the roles that exist, got %v", len(roles))
+	}
+
+	role.Permissions = []string{"create_post"}
+	if updated := must(t, ss.Role().Save(role)).(*model.Role); len(updated.Permissions) != 1 {
+		t.Fatalf("should update the role, got %v", updated.Permissions)
+	}
+
+	mustFail(t, ss.Role().Get(model.NewId()), "store.sql_role.get.app_error")
+	mustFail(t, ss.Role().GetByName(model.NewId()), "store.sql_role.get_by_name.app_error")
+}
+
+func testRoleStoreDelete(t *testing.T, ss store.Store) {
+	role := must(t, ss.Role().Save(newRole())).(*model.Role)
+
+	if deleted := must(t, ss.Role().Delete(role.Id)).(*model.Role); deleted.DeleteAt == 0 {
+		t.Fatal("delete should set DeleteAt")
+	}
+
+	if got := must(t, ss.Role().Get(role.Id)).(*model.Role); got.DeleteAt == 0 {
+		t.Fatal("deleted role should be kept with DeleteAt set")
+	}
+
+	mustFail(t, ss.Role().Delete(model.NewId()), "store.sql_role.get.app_error")
+}
@@ -0,0 +1,86 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func TestSchemeStore(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ss store.Store)
+	}{
+		{"SaveGet", testSchemeStoreSaveGet},
+		{"Delete", testSchemeStoreDelete},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ss)
+		})
+	}
+}
+
+func newScheme(scope string) *model.Scheme {
+	return &model.Scheme{
+		Name:        model.NewId(),
+		DisplayName: "Scheme",
+		Scope:       scope,
+	}
+}
+
+func testSchemeStoreSaveGet(t *testing.T, ss store.Store) {
+	scheme := must(t, ss.Scheme().Save(newScheme(model.SCHEME_SCOPE_TEAM))).(*model.Scheme)
+	if len(scheme.Id) != 26 || scheme.CreateAt == 0 {
+		t.Fatal("save should fill in the id and timestamps")
+	}
+
+	// A team scheme gets its own default team and channel roles.
+	for _, name := range []string{scheme.DefaultTeamAdminRole, scheme.DefaultTeamUserRole, scheme.DefaultChannelAdminRole, scheme.DefaultChannelUserRole} {
+		if role := must(t, ss.Role().GetByName(name)).(*model.Role); !role.SchemeManaged {
+			t.Fatalf("role %v should be managed by the scheme", name)
+		}
+	}
+
+	if got := must(t, ss.Scheme().Get(scheme.Id)).(*model.Scheme); got.Name != scheme.Name {
+		t.Fatalf("should get the saved scheme, got %v", got.Name)
+	}
+
+	channelScheme := must(t, ss.Scheme().Save(newScheme(model.SCHEME_SCOPE_CHANNEL))).(*model.Scheme)
+	if channelScheme.DefaultTeamAdminRole != "" || channelScheme.DefaultChannelAdminRole == "" {
+		t.Fatal("a channel scheme should only get channel roles")
+	}
+
+	found := false
+	for _, s := range must(t, ss.Scheme().GetAllPage(model.SCHEME_SCOPE_CHANNEL, 0, 100)).([]*model.Scheme) {
+		if s.Scope != model.SCHEME_SCOPE_CHANNEL {
+			t.Fatalf("should only list channel schemes, got %v", s.Scope)
+		}
+		found = found || s.Id == channelScheme.Id
+	}
+	if !found {
+		t.Fatal("should list the channel scheme")
+	}
+
+	mustFail(t, ss.Scheme().Get(model.NewId()), "store.sql_scheme.get.app_error")
+}
+
+func testSchemeStoreDelete(t *testing.T, ss store.Store) {
+	scheme := must(t, ss.Scheme().Save(newScheme(model.SCHEME_SCOPE_CHANNEL))).(*model.Scheme)
+
+	if deleted := must(t, ss.Scheme().Delete(scheme.Id)).(*model.Scheme); deleted.DeleteAt == 0 {
+		t.Fatal("delete should set DeleteAt")
+	}
+
+	if role := must(t, ss.Role().GetByName(scheme.DefaultChannelAdminRole)).(*model.Role); role.DeleteAt == 0 {
+		t.Fatal("delete should also delete the roles of the scheme")
+	}
+
+	for _, s := range must(t, ss.Scheme().GetAllPage("", 0, 100)).([]*model.Scheme) {
+		if s.Id == scheme.Id {
+			t.Fatal("should not list a deleted scheme")
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func TestSessionStore(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ss store.Store)
+	}{
+		{"Save", testSessionStoreSave},
+		{"Get", testSessionStoreGet},
+		{"GetSessions", testSessionStoreGetSessions},
+		{"Remove", testSessionStoreRemove},
+		{"PermanentDeleteSessionsByUser", testSessionStorePermanentDeleteSessionsByUser},
+		{"UpdateLastActivityAt", testSessionStoreUpdateLastActivityAt},
+		{"UpdateRoles", testSessionStoreUpdateRoles},
+		{"UpdateDeviceId", testSessionStoreUpdateDeviceId},
+		{"AnalyticsSessionCount", testSessionStoreAnalyticsSessionCount},
+		{"Cleanup", testSessionStoreCleanup},
+		{"RemoveAllSessions", testSessionStoreRemoveAllSessions},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ss)
+		})
+	}
+}
+
+func saveSession(t *testing.T, ss store.Store, session *model.Session) *model.Session {
+	t.Helper()
+
+	return must(t, ss.Session().Save(session)).(*model.Session)
+}
+
+func testSessionStoreSave(t *testing.T, ss store.Store) {
+	session := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+	if len(session.Id) != 26 || len(session.Token) != 26 || session.CreateAt == 0 {
+		t.Fatal("save should fill in the id, token and timestamps")
+	}
+
+	mustFail(t, ss.Session().Save(session), "store.sql_session.save.existing.app_error")
+}
+
+func testSessionStoreGet(t *testing.T, ss store.Store) {
+	session := saveSession(t, ss, &model.Session{UserId: model.NewId(), Roles: model.SYSTEM_USER_ROLE_ID, Props: map[string]string{"os": "linux"}})
+
+	got := must(t, ss.Session().Get(session.Id)).(*model.Session)
+	if got.Id != session.Id || got.Token != session.Token || got.UserId != session.UserId || got.Props["os"] != "linux" {
+		t.Fatalf("should get the session by id, got %v", got)
+	}
+
+	if got := must(t, ss.Session().Get(string(session.Token))).(*model.Session); got.Id != session.Id || got.Token != session.Token {
+		t.Fatalf("should get the session by token, got %v", got)
+	}
+
+	mustFail(t, ss.Session().Get(model.NewId()), "store.sql_session.get.app_error")
+}
+
+func testSessionStoreGetSessions(t *testing.T, ss store.Store) {
+	userId := model.NewId()
+	s1 := saveSession(t, ss, &model.Session{UserId: userId})
+	s2 := saveSession(t, ss, &model.Session{UserId: userId})
+	saveSession(t, ss, &model.Session{UserId: model.NewId()})
+
+	must(t, ss.Session().UpdateLastActivityAt(s1.Id, s2.LastActivityAt+1000))
+
+	sessions := must(t, ss.Session().GetSessions(userId)).([]*model.Session)
+	if len(sessions) != 2 || sessions[0].Id != s1.Id || sessions[1].Id != s2.Id {
+		t.Fatalf("should get the user's sessions by latest activity, got %v", sessions)
+	}
+	if sessions[0].Token != s1.Token {
+		t.Fatal("should return the session tokens")
+	}
+
+	if sessions := must(t, ss.Session().GetSessions(model.NewId())).([]*model.Session); len(sessions) != 0 {
+		t.Fatalf("should get no sessions for another user, got %v", len(sessions))
+	}
+}
+
+func testSessionStoreRemove(t *testing.T, ss store.Store) {
+	byId := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+	byToken := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+
+	must(t, ss.Session().Remove(byId.Id))
+	must(t, ss.Session().Remove(string(byToken.Token)))
+
+	mustFail(t, ss.Session().Get(byId.Id), "store.sql_session.get.app_error")
+	mustFail(t, ss.Session().Get(byToken.Id), "store.sql_session.get.app_error")
+}
+
+func testSessionStorePermanentDeleteSessionsByUser(t *testing.T, ss store.Store) {
+	userId := model.NewId()
+	saveSession(t, ss, &model.Session{UserId: userId})
+	saveSession(t, ss, &model.Session{UserId: userId})
+	other := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+
+	must(t, ss.Session().PermanentDeleteSessionsByUser(userId))
+
+	if sessions := must(t, ss.Session().GetSessions(userId)).([]*model.Session); len(sessions) != 0 {
+		t.Fatalf("should delete the user's sessions, got %v", len(sessions))
+	}
+	must(t, ss.Session().Get(other.Id))
+}
+
+func testSessionStoreUpdateLastActivityAt(t *testing.T, ss store.Store) {
+	session := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+
+	must(t, ss.Session().UpdateLastActivityAt(session.Id, 1234))
+
+	if got := must(t, ss.Session().Get(session.Id)).(*model.Session); got.LastActivityAt != 1234 {
+		t.Fatalf("should update the last activity, got %v", got.LastActivityAt)
+	}
+}
+
+func testSessionStoreUpdateRoles(t *testing.T, ss store.Store) {
+	userId := model.NewId()
+	s1 := saveSession(t, ss, &model.Session{UserId: userId, Roles: model.SYSTEM_USER_ROLE_ID})
+	s2 := saveSession(t, ss, &model.Session{UserId: userId, Roles: model.SYSTEM_USER_ROLE_ID})
+	other := saveSession(t, ss, &model.Session{UserId: model.NewId(), Roles: model.SYSTEM_USER_ROLE_ID})
+
+	must(t, ss.Session().UpdateRoles(userId, model.SYSTEM_ADMIN_ROLE_ID))
+
+	for _, session := range []*model.Session{s1, s2} {
+		if got := must(t, ss.Session().Get(session.Id)).(*model.Session); got.Roles != model.SYSTEM_ADMIN_ROLE_ID {
+			t.Fatalf("should update the roles of the user's sessions, got %v", got.Roles)
+		}
+	}
+
+	if got := must(t, ss.Session().Get(other.Id)).(*model.Session); got.Roles != model.SYSTEM_USER_ROLE_ID {
+		t.Fatalf("should not update the roles of other sessions, got %v", got.Roles)
+	}
+}
+
+func testSessionStoreUpdateDeviceId(t *testing.T, ss store.Store) {
+	session := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+	expiresAt := model.GetMillis() + 60000
+
+	if deviceId := must(t, ss.Session().UpdateDeviceId(session.Id, "device", expiresAt)).(string); deviceId != "device" {
+		t.Fatalf("should return the device id, got %v", deviceId)
+	}
+
+	if got := must(t, ss.Session().Get(session.Id)).(*model.Session); got.DeviceId != "device" || got.ExpiresAt != expiresAt {
+		t.Fatalf("should update the device and expiry, got %v %v", got.DeviceId, got.ExpiresAt)
+	}
+}
+
+func testSessionStoreAnalyticsSessionCount(t *testing.T, ss store.Store) {
+	before := must(t, ss.Session().AnalyticsSessionCount()).(int64)
+
+	saveSession(t, ss, &model.Session{UserId: model.NewId(), ExpiresAt: model.GetMillis() + 60000})
+	saveSession(t, ss, &model.Session{UserId: model.NewId(), ExpiresAt: model.GetMillis() - 60000})
+
+	if count := must(t, ss.Session().AnalyticsSessionCount()).(int64); count != before+1 {
+		t.Fatalf("should count the unexpired sessions, got %v, expected %v", count, before+1)
+	}
+}
+
+func testSessionStoreCleanup(t *testing.T, ss store.Store) {
+	now := model.GetMillis()
+	expired := saveSession(t, ss, &model.Session{UserId: model.NewId(), ExpiresAt: now - 60000})
+	active := saveSession(t, ss, &model.Session{UserId: model.NewId(), ExpiresAt: now + 60000})
+	unlimited := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+
+	ss.Session().Cleanup(now, 1)
+
+	mustFail(t, ss.Session().Get(expired.Id), "store.sql_session.get.app_error")
+	must(t, ss.Session().Get(active.Id))
+	must(t, ss.Session().Get(unlimited.Id))
+}
+
+func testSessionStoreRemoveAllSessions(t *testing.T, ss store.Store) {
+	session := saveSession(t, ss, &model.Session{UserId: model.NewId()})
+
+	must(t, ss.Session().RemoveAllSessions())
+
+	mustFail(t, ss.Session().Get(session.Id), "store.sql_session.get.app_error")
+}
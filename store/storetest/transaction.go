@@ -0,0 +1,152 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func TestWithTransaction(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ss store.Store)
+	}{
+		{"Commit", testWithTransactionCommit},
+		{"Rollback", testWithTransactionRollback},
+		{"Nested", testWithTransactionNested},
+		{"Cancelled", testWithTransactionCancelled},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ss)
+		})
+	}
+}
+
+// saveInTransaction saves a post and a session of its author through tx.
+func saveInTransaction(tx store.Store, message string) (*model.Post, *model.Session, *model.AppError) {
+	post := newPost(model.NewId(), model.NewId(), message, 0)
+	if result := <-tx.Post().Save(post); result.Err != nil {
+		return nil, nil, result.Err
+	}
+
+	session := &model.Session{UserId: post.UserId}
+	if result := <-tx.Session().Save(session); result.Err != nil {
+		return nil, nil, result.Err
+	}
+
+	return post, session, nil
+}
+
+func testWithTransactionCommit(t *testing.T, ss store.Store) {
+	var post *model.Post
+	var session *model.Session
+
+	err := ss.WithTransaction(context.Background(), func(tx store.Store) error {
+		var err *model.AppError
+		post, session, err = saveInTransaction(tx, "commit")
+		if err != nil {
+			return err
+		}
+
+		// Reads in the transaction see its writes.
+		if result := <-tx.Post().GetSingle(post.Id); result.Err != nil {
+			return result.Err
+		}
+
+		// A nil *model.AppError counts as success.
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	must(t, ss.Post().GetSingle(post.Id))
+	must(t, ss.Session().Get(session.Id))
+}
+
+func testWithTransactionRollback(t *testing.T, ss store.Store) {
+	var post *model.Post
+	var session *model.Session
+	failure := errors.New("failure")
+
+	err := ss.WithTransaction(context.Background(), func(tx store.Store) error {
+		var err *model.AppError
+		if post, session, err = saveInTransaction(tx, "rollback"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("should return the error of f, got %v", err)
+	}
+
+	mustFail(t, ss.Post().GetSingle(post.Id), "store.sql_post.get.app_error")
+	mustFail(t, ss.Session().Get(session.Id), "store.sql_session.get.app_error")
+}
+
+func testWithTransactionNested(t *testing.T, ss store.Store) {
+	var outer, committed, rolledBack *model.Post
+
+	err := ss.WithTransaction(context.Background(), func(tx store.Store) error {
+		var err *model.AppError
+		if outer, _, err = saveInTransaction(tx, "outer"); err != nil {
+			return err
+		}
+
+		if err := tx.WithTransaction(context.Background(), func(nested store.Store) error {
+			var err *model.AppError
+			committed, _, err = saveInTransaction(nested, "committed")
+			return err
+		}); err != nil {
+			return err
+		}
+
+		failure := errors.New("failure")
+		if err := tx.WithTransaction(context.Background(), func(nested store.Store) error {
+			var err *model.AppError
+			if rolledBack, _, err = saveInTransaction(nested, "rolled back"); err != nil {
+				return err
+			}
+			return failure
+		}); err != failure {
+			t.Errorf("should return the error of the nested f, got %v", err)
+		}
+
+		// The outer transaction goes on after the nested one rolled back.
+		if result := <-tx.Post().GetSingle(outer.Id); result.Err != nil {
+			return result.Err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	must(t, ss.Post().GetSingle(outer.Id))
+	must(t, ss.Post().GetSingle(committed.Id))
+	mustFail(t, ss.Post().GetSingle(rolledBack.Id), "store.sql_post.get.app_error")
+}
+
+func testWithTransactionCancelled(t *testing.T, ss store.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := ss.WithTransaction(ctx, func(tx store.Store) error {
+		called = true
+		return nil
+	})
+
+	appErr, ok := err.(*model.AppError)
+	if !ok || !store.IsCanceledError(appErr) {
+		t.Fatalf("should fail with a cancellation, got %v", err)
+	}
+	if called {
+		t.Fatal("should not run f once the context is done")
+	}
+}
@@ -0,0 +1,356 @@
+package storetest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+	"github.com/OhBonsai/go-web-boilerplate/store"
+)
+
+func TestUserStore(t *testing.T, ss store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ss store.Store)
+	}{
+		{"Save", testUserStoreSave},
+		{"Update", testUserStoreUpdate},
+		{"UpdatePassword", testUserStoreUpdatePassword},
+		{"UpdateFailedPasswordAttempts", testUserStoreUpdateFailedPasswordAttempts},
+		{"UpdateLastPictureUpdate", testUserStoreUpdateLastPictureUpdate},
+		{"Get", testUserStoreGet},
+		{"GetAllProfiles", testUserStoreGetAllProfiles},
+		{"GetProfileByIds", testUserStoreGetProfileByIds},
+		{"GetByEmail", testUserStoreGetByEmail},
+		{"GetByUsername", testUserStoreGetByUsername},
+		{"GetForLogin", testUserStoreGetForLogin},
+		{"VerifyEmail", testUserStoreVerifyEmail},
+		{"PermanentDelete", testUserStorePermanentDelete},
+		{"Count", testUserStoreCount},
+		{"Search", testUserStoreSearch},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, ss)
+		})
+	}
+}
+
+func newUser() *model.User {
+	id := model.NewId()
+	return &model.User{
+		Username: "u" + id,
+		Email:    "u" + id + "@example.com",
+	}
+}
+
+func saveUser(t *testing.T, ss store.Store, user *model.User) *model.User {
+	t.Helper()
+
+	return must(t, ss.User().Save(user)).(*model.User)
+}
+
+func testUserStoreSave(t *testing.T, ss store.Store) {
+	user := newUser()
+	user.Email = strings.ToUpper(user.Email)
+	saveUser(t, ss, user)
+	if len(user.Id) != 26 || user.CreateAt == 0 || user.UpdateAt != user.CreateAt {
+		t.Fatal("save should fill in the id and timestamps")
+	}
+	if user.Email != strings.ToLower(user.Email) {
+		t.Fatalf("save should normalize the email, got %v", user.Email)
+	}
+
+	mustFail(t, ss.User().Save(user), "store.sql_user.save.existing.app_error")
+
+	duplicate := newUser()
+	duplicate.Email = user.Email
+	mustFail(t, ss.User().Save(duplicate), "store.sql_user.save.email_exists.app_error")
+
+	duplicate = newUser()
+	duplicate.Username = user.Username
+	mustFail(t, ss.User().Save(duplicate), "store.sql_user.save.username_exists.app_error")
+
+	invalid := newUser()
+	invalid.Email = ""
+	if result := <-ss.User().Save(invalid); result.Err == nil {
+		t.Fatal("should not save an invalid user")
+	}
+}
+
+func testUserStoreUpdate(t *testing.T, ss store.Store) {
+	user := newUser()
+	user.Roles = model.SYSTEM_USER_ROLE_ID
+	saveUser(t, ss, user)
+	must(t, ss.User().VerifyEmail(user.Id))
+
+	update := *user
+	update.Nickname = "nick"
+	update.Roles = model.SYSTEM_ADMIN_ROLE_ID
+	update.Password = "changed"
+	users := must(t, ss.User().Update(&update, false)).([2]*model.User)
+	if users[0].Nickname != "nick" || users[1].Id != user.Id {
+		t.Fatalf("should return the updated and the previous user, got %v", users)
+	}
+
+	got := must(t, ss.User().Get(user.Id)).(*model.User)
+	if got.Nickname != "nick" {
+		t.Fatalf("should update the user, got %v", got.Nickname)
+	}
+	if got.Roles != model.SYSTEM_USER_ROLE_ID {
+		t.Fatalf("an untrusted update should keep the roles, got %v", got.Roles)
+	}
+	if got.Password != user.Password || !got.EmailVerified {
+		t.Fatal("update should keep the password and email verification")
+	}
+
+	update = *got
+	update.Roles = model.SYSTEM_ADMIN_ROLE_ID
+	update.Email = newUser().Email
+	must(t, ss.User().Update(&update, true))
+
+	got = must(t, ss.User().Get(user.Id)).(*model.User)
+	if got.Roles != model.SYSTEM_ADMIN_ROLE_ID {
+		t.Fatalf("a trusted update should change the roles, got %v", got.Roles)
+	}
+	if got.EmailVerified {
+		t.Fatal("changing the email should reset its verification")
+	}
+
+	other := saveUser(t, ss, newUser())
+	update = *got
+	update.Email = other.Email
+	mustFail(t, ss.User().Update(&update, false), "store.sql_user.update.email_taken.app_error")
+
+	update = *got
+	update.Username = other.Username
+	mustFail(t, ss.User().Update(&update, false), "store.sql_user.update.username_taken.app_error")
+
+	missing := newUser()
+	missing.Id = model.NewId()
+	missing.CreateAt = model.GetMillis()
+	mustFail(t, ss.User().Update(missing, false), "store.sql_user.update.find.app_error")
+}
+
+func testUserStoreUpdatePassword(t *testing.T, ss store.Store) {
+	user := newUser()
+	user.AuthService = "gitlab"
+	user.AuthData = model.NewString(model.NewId())
+	saveUser(t, ss, user)
+	must(t, ss.User().UpdateFailedPasswordAttempts(user.Id, 3))
+
+	must(t, ss.User().UpdatePassword(user.Id, "hashed"))
+
+	got := must(t, ss.User().Get(user.Id)).(*model.User)
+	if got.Password != "hashed" || got.LastPasswordUpdate < user.CreateAt {
+		t.Fatalf("should update the password, got %v", got.Password)
+	}
+	if got.AuthData != nil || got.AuthService != "" {
+		t.Fatal("a password should replace the auth service")
+	}
+	if !got.EmailVerified || got.FailedAttempts != 0 {
+		t.Fatal("a password update should verify the email and reset the failed attempts")
+	}
+}
+
+func testUserStoreUpdateFailedPasswordAttempts(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	must(t, ss.User().UpdateFailedPasswordAttempts(user.Id, 3))
+
+	if got := must(t, ss.User().Get(user.Id)).(*model.User); got.FailedAttempts != 3 {
+		t.Fatalf("should update the failed attempts, got %v", got.FailedAttempts)
+	}
+}
+
+func testUserStoreUpdateLastPictureUpdate(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	must(t, ss.User().UpdateLastPictureUpdate(user.Id))
+
+	if got := must(t, ss.User().Get(user.Id)).(*model.User); got.LastPictureUpdate == 0 || got.UpdateAt != got.LastPictureUpdate {
+		t.Fatalf("should update the picture time, got %v", got.LastPictureUpdate)
+	}
+}
+
+func testUserStoreGet(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	got := must(t, ss.User().Get(user.Id)).(*model.User)
+	if got.Username != user.Username || got.Email != user.Email {
+		t.Fatalf("should get the saved user, got %v", got)
+	}
+
+	got.Nickname = "changed"
+	if got := must(t, ss.User().Get(user.Id)).(*model.User); got.Nickname != "" {
+		t.Fatal("changing a returned user should not change the stored one")
+	}
+
+	mustFail(t, ss.User().Get(model.NewId()), store.MISSING_ACCOUNT_ERROR)
+
+	all := must(t, ss.User().GetAll()).([]*model.User)
+	found := false
+	for _, u := range all {
+		found = found || u.Id == user.Id
+	}
+	if !found {
+		t.Fatal("should get all the users")
+	}
+}
+
+func testUserStoreGetAllProfiles(t *testing.T, ss store.Store) {
+	saveUser(t, ss, newUser())
+	saveUser(t, ss, newUser())
+
+	users := must(t, ss.User().GetAllProfiles(0, 100)).([]*model.User)
+	if len(users) < 2 {
+		t.Fatalf("should get the profiles, got %v", len(users))
+	}
+	for i, u := range users {
+		if u.Password != "" {
+			t.Fatal("profiles should be sanitized")
+		}
+		if i > 0 && users[i-1].Username > u.Username {
+			t.Fatal("profiles should be ordered by username")
+		}
+	}
+
+	if page := must(t, ss.User().GetAllProfiles(1, 1)).([]*model.User); len(page) != 1 || page[0].Id != users[1].Id {
+		t.Fatalf("should page the profiles, got %v", page)
+	}
+
+	if page := must(t, ss.User().GetAllProfiles(len(users), 10)).([]*model.User); len(page) != 0 {
+		t.Fatalf("should get no profiles past the end, got %v", len(page))
+	}
+}
+
+func testUserStoreGetProfileByIds(t *testing.T, ss store.Store) {
+	u1 := saveUser(t, ss, newUser())
+	u2 := saveUser(t, ss, newUser())
+	saveUser(t, ss, newUser())
+
+	users := must(t, ss.User().GetProfileByIds([]string{u1.Id, u2.Id, model.NewId()})).([]*model.User)
+	if len(users) != 2 {
+		t.Fatalf("should get the profiles that exist, got %v", len(users))
+	}
+	for _, u := range users {
+		if u.Id != u1.Id && u.Id != u2.Id {
+			t.Fatalf("should only get the requested profiles, got %v", u.Id)
+		}
+		if u.Password != "" {
+			t.Fatal("profiles should be sanitized")
+		}
+	}
+
+	if users := must(t, ss.User().GetProfileByIds([]string{})).([]*model.User); len(users) != 0 {
+		t.Fatalf("should get no profiles for no ids, got %v", len(users))
+	}
+}
+
+func testUserStoreGetByEmail(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	if got := must(t, ss.User().GetByEmail(strings.ToUpper(user.Email))).(*model.User); got.Id != user.Id {
+		t.Fatalf("should get the user by a normalized email, got %v", got.Id)
+	}
+
+	mustFail(t, ss.User().GetByEmail(newUser().Email), store.MISSING_ACCOUNT_ERROR)
+}
+
+func testUserStoreGetByUsername(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	if got := must(t, ss.User().GetByUsername(strings.ToUpper(user.Username))).(*model.User); got.Id != user.Id {
+		t.Fatalf("should get the user by a normalized username, got %v", got.Id)
+	}
+
+	mustFail(t, ss.User().GetByUsername(newUser().Username), "store.sql_user.get_by_username.app_error")
+}
+
+func testUserStoreGetForLogin(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	if got := must(t, ss.User().GetForLogin(user.Username)).(*model.User); got.Id != user.Id {
+		t.Fatalf("should log in by username, got %v", got.Id)
+	}
+
+	if got := must(t, ss.User().GetForLogin(strings.ToUpper(user.Email))).(*model.User); got.Id != user.Id {
+		t.Fatalf("should log in by email, got %v", got.Id)
+	}
+
+	mustFail(t, ss.User().GetForLogin(model.NewId()), "store.sql_user.get_for_login.app_error")
+}
+
+func testUserStoreVerifyEmail(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	must(t, ss.User().VerifyEmail(user.Id))
+
+	if got := must(t, ss.User().Get(user.Id)).(*model.User); !got.EmailVerified {
+		t.Fatal("should verify the email")
+	}
+}
+
+func testUserStorePermanentDelete(t *testing.T, ss store.Store) {
+	user := saveUser(t, ss, newUser())
+
+	must(t, ss.User().PermanentDelete(user.Id))
+
+	mustFail(t, ss.User().Get(user.Id), store.MISSING_ACCOUNT_ERROR)
+}
+
+func testUserStoreCount(t *testing.T, ss store.Store) {
+	before := must(t, ss.User().Count()).(int64)
+
+	saveUser(t, ss, newUser())
+	deleted := newUser()
+	deleted.DeleteAt = model.GetMillis()
+	saveUser(t, ss, deleted)
+
+	if count := must(t, ss.User().Count()).(int64); count != before+1 {
+		t.Fatalf("should count the active users, got %v, expected %v", count, before+1)
+	}
+}
+
+func testUserStoreSearch(t *testing.T, ss store.Store) {
+	prefix := "s" + model.NewId()[:10]
+
+	u1 := newUser()
+	u1.Username = prefix + "_b"
+	saveUser(t, ss, u1)
+
+	u2 := newUser()
+	u2.FirstName = strings.ToUpper(prefix)
+	u2.Username = "z" + model.NewId()
+	saveUser(t, ss, u2)
+
+	deleted := newUser()
+	deleted.Username = prefix + "_a"
+	deleted.DeleteAt = model.GetMillis()
+	saveUser(t, ss, deleted)
+
+	other := newUser()
+	other.Username = prefix[:5] + "x" + model.NewId()
+	saveUser(t, ss, other)
+
+	users := must(t, ss.User().Search("@"+prefix, 10)).([]*model.User)
+	if len(users) != 2 || users[0].Id != u1.Id || users[1].Id != u2.Id {
+		t.Fatalf("should find the active users by prefix ordered by username, got %v", users)
+	}
+	if users[0].Password != "" {
+		t.Fatal("search results should be sanitized")
+	}
+
+	if users := must(t, ss.User().Search(prefix, 1)).([]*model.User); len(users) != 1 || users[0].Id != u1.Id {
+		t.Fatalf("should limit the results, got %v", users)
+	}
+
+	if users := must(t, ss.User().Search(prefix+"%", 10)).([]*model.User); len(users) != 0 {
+		t.Fatalf("should match wildcards literally, got %v", len(users))
+	}
+
+	if users := must(t, ss.User().Search("  ", 10)).([]*model.User); len(users) != 0 {
+		t.Fatalf("should find nothing for an empty term, got %v", len(users))
+	}
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+var cacheRegistry = struct {
+	sync.RWMutex
+	caches map[string]*Cache
+}{caches: make(map[string]*Cache)}
+
+// RegisterCache makes a named cache visible to GetCacheStats and PurgeCache. A cache registered under
+// an existing name replaces the previous one.
+func RegisterCache(cache *Cache) {
+	cacheRegistry.Lock()
+	defer cacheRegistry.Unlock()
+
+	cacheRegistry.caches[cache.Name()] = cache
+}
+
+// UnregisterCache removes the cache registered under name.
+func UnregisterCache(name string) {
+	cacheRegistry.Lock()
+	defer cacheRegistry.Unlock()
+
+	delete(cacheRegistry.caches, name)
+}
+
+// Unregister removes the cache from the registry, unless another cache was registered under its name since.
+// Owners of named caches call it when they shut down.
+func (c *Cache) Unregister() {
+	cacheRegistry.Lock()
+	defer cacheRegistry.Unlock()
+
+	if cacheRegistry.caches[c.Name()] == c {
+		delete(cacheRegistry.caches, c.Name())
+	}
+}
+
+// GetRegisteredCache returns the cache registered under name, or nil if there is none.
+func GetRegisteredCache(name string) *Cache {
+	cacheRegistry.RLock()
+	defer cacheRegistry.RUnlock()
+
+	return cacheRegistry.caches[name]
+}
+
+// GetRegisteredCaches returns every registered cache, sorted by name.
+func GetRegisteredCaches() []*Cache {
+	cacheRegistry.RLock()
+	defer cacheRegistry.RUnlock()
+
+	caches := make([]*Cache, 0, len(cacheRegistry.caches))
+	for _, cache := range cacheRegistry.caches {
+		caches = append(caches, cache)
+	}
+
+	sort.Slice(caches, func(i, j int) bool {
+		return caches[i].Name() < caches[j].Name()
+	})
+
+	return caches
+}
+
+// GetCacheStats returns the statistics of every registered cache, sorted by name.
+func GetCacheStats() []*model.CacheStats {
+	caches := GetRegisteredCaches()
+
+	stats := make([]*model.CacheStats, 0, len(caches))
+	for _, cache := range caches {
+		stats = append(stats, cache.Stats())
+	}
+
+	return stats
+}
+
+// PurgeCache empties the cache registered under name. It returns false if there is no such cache.
+func PurgeCache(name string) bool {
+	cache := GetRegisteredCache(name)
+	if cache == nil {
+		return false
+	}
+
+	cache.Purge()
+	return true
+}
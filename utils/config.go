@@ -15,12 +15,22 @@ import (
 	"github.com/mattermost/mattermost-server/utils/jsonutils"
 	"bytes"
 	"reflect"
+	"time"
+	"net/http"
 )
 
 const (
 	LOG_FILENAME    = "bonsai.log"
+
+	// Environment variables named <prefix>_<SECTION>_<FIELD>, e.g. MM_SQLSETTINGS_DATASOURCE,
+	// override the matching config.json setting.
+	DEFAULT_ENV_PREFIX = "mm"
 )
 
+// Editors usually produce several write events when saving a file, so changes are only acted upon once
+// the file has been quiet for this long.
+const CONFIG_WATCHER_DEBOUNCE = 500 * time.Millisecond
+
 
 type ConfigWatcher struct {
 	watcher *fsnotify.Watcher
@@ -28,6 +38,68 @@ type ConfigWatcher struct {
 	closed  chan struct{}
 }
 
+// NewConfigWatcher creates a new ConfigWatcher which calls f after the config file changes. Changes that
+// leave the file unreadable or invalid, once overridden by the environment variables named after
+// envPrefix, are logged and ignored.
+func NewConfigWatcher(cfgFileName string, envPrefix string, f func()) (*ConfigWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config watcher for file: %v, err=%v", cfgFileName, err)
+	}
+
+	configFile := filepath.Clean(cfgFileName)
+	configDir, _ := filepath.Split(configFile)
+	if err := watcher.Add(configDir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch config directory: %v, err=%v", configDir, err)
+	}
+
+	ret := &ConfigWatcher{
+		watcher: watcher,
+		close:   make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(ret.closed)
+		defer watcher.Close()
+
+		debounce := time.NewTimer(CONFIG_WATCHER_DEBOUNCE)
+		debounce.Stop()
+		defer debounce.Stop()
+
+		for {
+			select {
+			case event := <-watcher.Events:
+				// we only care about the config file
+				if filepath.Clean(event.Name) == configFile {
+					if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
+						debounce.Reset(CONFIG_WATCHER_DEBOUNCE)
+					}
+				}
+			case <-debounce.C:
+				mlog.Info(fmt.Sprintf("Config file watcher detected a change reloading %v", cfgFileName))
+
+				if _, _, _, configReadErr := LoadConfig(cfgFileName, envPrefix); configReadErr == nil {
+					f()
+				} else {
+					mlog.Error(fmt.Sprintf("Failed to read while watching config file at %v with err=%v", cfgFileName, configReadErr.Error()))
+				}
+			case err := <-watcher.Errors:
+				mlog.Error(fmt.Sprintf("Failed while watching config file at %v with err=%v", cfgFileName, err.Error()))
+			case <-ret.close:
+				return
+			}
+		}
+	}()
+
+	return ret, nil
+}
+
+func (w *ConfigWatcher) Close() {
+	close(w.close)
+	<-w.closed
+}
 
 func FindDir(dir string) (string, bool) {
 	for _, parent := range []string{".", "..", "../..", "../../.."} {
@@ -78,7 +150,9 @@ func FindConfigFile(fileName string) (path string) {
 	return ""
 }
 
-func ReadConfig(r io.Reader, allowEnvironmentOverrides bool) (*model.Config, map[string]interface{}, error) {
+// ReadConfig decodes the config in r, overriding its settings with the environment variables named after
+// envPrefix. An empty envPrefix leaves the environment out.
+func ReadConfig(r io.Reader, envPrefix string) (*model.Config, map[string]interface{}, error) {
 	// Pre-flight check the syntax of the configuration file to improve error messaging.
 	configData, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -90,7 +164,7 @@ func ReadConfig(r io.Reader, allowEnvironmentOverrides bool) (*model.Config, map
 		}
 	}
 
-	v := newViper(allowEnvironmentOverrides)
+	v := newViper(envPrefix)
 	if err := v.ReadConfig(bytes.NewReader(configData)); err != nil {
 		return nil, nil, err
 	}
@@ -146,13 +220,13 @@ func fixEnvSettingsCase(in map[string]interface{}) (out map[string]interface{},
 }
 
 
-func ReadConfigFile(path string, allowEnvironmentOverrides bool) (*model.Config, map[string]interface{}, error) {
+func ReadConfigFile(path string, envPrefix string) (*model.Config, map[string]interface{}, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer f.Close()
-	return ReadConfig(f, allowEnvironmentOverrides)
+	return ReadConfig(f, envPrefix)
 }
 
 func EnsureConfigFile(fileName string) (string, error) {
@@ -179,7 +253,7 @@ func EnsureConfigFile(fileName string) (string, error) {
 }
 
 
-func LoadConfig(fileName string) (*model.Config, string, map[string]interface{}, *model.AppError) {
+func LoadConfig(fileName string, envPrefix string) (*model.Config, string, map[string]interface{}, *model.AppError) {
 	var configPath string
 
 	if fileName != filepath.Base(fileName) {
@@ -193,14 +267,13 @@ func LoadConfig(fileName string) (*model.Config, string, map[string]interface{},
 		}
 	}
 
-	config, envConfig, err := ReadConfigFile(configPath, true)
+	config, envConfig, err := ReadConfigFile(configPath, envPrefix)
 	if err != nil {
 		appErr := model.NewAppError("LoadConfig", "utils.config.load_config.decoding.panic", map[string]interface{}{"Filename": fileName, "Error": err.Error()}, "", 0)
 		return nil, "", nil, appErr
 	}
 
-	needSave := len(config.SqlSettings.AtRestEncryptKey) == 0 || len(*config.FileSettings.PublicLinkSalt) == 0 ||
-		len(config.EmailSettings.InviteSalt) == 0
+	needSave := len(config.SqlSettings.AtRestEncryptKey) == 0
 
 	config.SetDefaults()
 
@@ -209,34 +282,132 @@ func LoadConfig(fileName string) (*model.Config, string, map[string]interface{},
 	}
 
 	if needSave {
-		if err := SaveConfig(configPath, config); err != nil {
+		if err := SaveConfig(configPath, config, envPrefix); err != nil {
 			mlog.Warn(err.Error())
 		}
 	}
 
 	if err := ValidateLocales(config); err != nil {
-		if err := SaveConfig(configPath, config); err != nil {
+		if err := SaveConfig(configPath, config, envPrefix); err != nil {
 			mlog.Warn(err.Error())
 		}
 	}
 
-	if *config.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
-		dir := config.FileSettings.Directory
-		if len(dir) > 0 && dir[len(dir)-1:] != "/" {
-			config.FileSettings.Directory += "/"
+	return config, configPath, envConfig, nil
+}
+
+// SaveConfig writes config to fileName. Settings currently overridden by the environment variables named
+// after envPrefix keep the value they have on disk, so secrets passed in through the environment are never
+// persisted.
+func SaveConfig(fileName string, config *model.Config, envPrefix string) *model.AppError {
+	config = RemoveEnvOverrides(fileName, config, envPrefix)
+
+	b, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return model.NewAppError("SaveConfig", "utils.config.save_config.saving.app_error",
+			map[string]interface{}{"Filename": fileName}, err.Error(), http.StatusBadRequest)
+	}
+
+	err = ioutil.WriteFile(fileName, b, 0644)
+	if err != nil {
+		return model.NewAppError("SaveConfig", "utils.config.save_config.saving.app_error",
+			map[string]interface{}{"Filename": fileName}, err.Error(), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// GetEnvironmentConfig returns the settings currently overridden by the environment variables named after
+// envPrefix as a nested map of section and field names.
+func GetEnvironmentConfig(envPrefix string) map[string]interface{} {
+	envConfig, err := fixEnvSettingsCase(newViper(envPrefix).EnvSettings())
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return envConfig
+}
+
+// GetEnvironmentOverrides maps the dotted key of every setting overridden by the environment, e.g.
+// "SqlSettings.DataSource", to its value in config.
+func GetEnvironmentOverrides(config *model.Config, envConfig map[string]interface{}) map[string]interface{} {
+	overrides := make(map[string]interface{})
+
+	for key := range flattenStructToMap(envConfig) {
+		if field, ok := configFieldByKey(reflect.ValueOf(config).Elem(), key); ok {
+			overrides[key] = field.Interface()
+		}
+	}
+
+	return overrides
+}
+
+// RemoveEnvOverrides returns a copy of config in which every setting overridden by the environment is
+// replaced with the value persisted in fileName, or with its default when the file cannot be read.
+func RemoveEnvOverrides(fileName string, config *model.Config, envPrefix string) *model.Config {
+	persisted, _, err := ReadConfigFile(fileName, "")
+	if err != nil || persisted == nil {
+		persisted = &model.Config{}
+	}
+
+	return RemoveEnvOverridesFrom(persisted, config, envPrefix)
+}
+
+// RemoveEnvOverridesFrom returns a copy of config in which every setting overridden by the environment
+// is replaced with its value in persisted.
+func RemoveEnvOverridesFrom(persisted *model.Config, config *model.Config, envPrefix string) *model.Config {
+	envConfig := GetEnvironmentConfig(envPrefix)
+	if len(envConfig) == 0 {
+		return config
+	}
+
+	persisted = persisted.Clone()
+	persisted.SetDefaults()
+
+	out := config.Clone()
+	for key := range flattenStructToMap(envConfig) {
+		dst, ok := configFieldByKey(reflect.ValueOf(out).Elem(), key)
+		if !ok {
+			continue
+		}
+		if src, ok := configFieldByKey(reflect.ValueOf(persisted).Elem(), key); ok {
+			dst.Set(src)
 		}
 	}
 
-	return config, configPath, envConfig, nil
+	return out
+}
+
+// configFieldByKey follows a dotted key such as "ServiceSettings.SiteURL" through the config struct.
+// Names are matched case-insensitively, as viper does.
+func configFieldByKey(v reflect.Value, key string) (reflect.Value, bool) {
+	for _, name := range strings.Split(key, ".") {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		name := name
+		v = v.FieldByNameFunc(func(fieldName string) bool {
+			return strings.EqualFold(fieldName, name)
+		})
+		if !v.IsValid() {
+			return reflect.Value{}, false
+		}
+	}
+	return v, true
 }
 
-func newViper(allowEnvironmentOverrides bool) *viper.Viper {
+func newViper(envPrefix string) *viper.Viper {
 	v := viper.New()
 
 	v.SetConfigType("json")
 
-	if allowEnvironmentOverrides {
-		v.SetEnvPrefix("mm")
+	if envPrefix != "" {
+		v.SetEnvPrefix(envPrefix)
 		v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 		v.AutomaticEnv()
 	}
@@ -315,42 +486,3 @@ func structToMap(t reflect.Type) (out map[string]interface{}) {
 
 	return
 }
-
-func (o *Config) SetDefaults() {
-	o.LdapSettings.SetDefaults()
-	o.SamlSettings.SetDefaults()
-
-	if o.TeamSettings.TeammateNameDisplay == nil {
-		o.TeamSettings.TeammateNameDisplay = NewString(SHOW_USERNAME)
-
-		if *o.SamlSettings.Enable || *o.LdapSettings.Enable {
-			*o.TeamSettings.TeammateNameDisplay = SHOW_FULLNAME
-		}
-	}
-
-	o.SqlSettings.SetDefaults()
-	o.FileSettings.SetDefaults()
-	o.EmailSettings.SetDefaults()
-	o.ServiceSettings.SetDefaults()
-	o.PasswordSettings.SetDefaults()
-	o.TeamSettings.SetDefaults()
-	o.MetricsSettings.SetDefaults()
-	o.SupportSettings.SetDefaults()
-	o.AnnouncementSettings.SetDefaults()
-	o.ThemeSettings.SetDefaults()
-	o.ClusterSettings.SetDefaults()
-	o.PluginSettings.SetDefaults()
-	o.AnalyticsSettings.SetDefaults()
-	o.ComplianceSettings.SetDefaults()
-	o.LocalizationSettings.SetDefaults()
-	o.ElasticsearchSettings.SetDefaults()
-	o.NativeAppSettings.SetDefaults()
-	o.DataRetentionSettings.SetDefaults()
-	o.RateLimitSettings.SetDefaults()
-	o.LogSettings.SetDefaults()
-	o.JobSettings.SetDefaults()
-	o.WebrtcSettings.SetDefaults()
-	o.MessageExportSettings.SetDefaults()
-	o.TimezoneSettings.SetDefaults()
-	o.DisplaySettings.SetDefaults()
-}
\ No newline at end of file
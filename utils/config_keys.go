@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+// GetConfigValue returns the value of the setting named by a dotted key such as "SqlSettings.DriverName".
+func GetConfigValue(config *model.Config, key string) (interface{}, error) {
+	field, ok := configFieldByKey(reflect.ValueOf(config).Elem(), key)
+	if !ok {
+		return nil, fmt.Errorf("unknown config setting %v", key)
+	}
+
+	return field.Interface(), nil
+}
+
+// SetConfigValue parses values according to the type of the setting named by key and stores the result
+// in config. Array settings take every value, all other settings exactly one.
+func SetConfigValue(config *model.Config, key string, values []string) error {
+	field, ok := configFieldByKey(reflect.ValueOf(config).Elem(), key)
+	if !ok {
+		return fmt.Errorf("unknown config setting %v", key)
+	}
+
+	t := field.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String {
+		return setField(field, reflect.ValueOf(append([]string{}, values...)))
+	}
+
+	if len(values) != 1 {
+		return fmt.Errorf("config setting %v takes exactly one value", key)
+	}
+	value := values[0]
+
+	var parsed reflect.Value
+	switch t.Kind() {
+	case reflect.String:
+		parsed = reflect.ValueOf(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("config setting %v must be true or false", key)
+		}
+		parsed = reflect.ValueOf(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, t.Bits())
+		if err != nil {
+			return fmt.Errorf("config setting %v must be a number", key)
+		}
+		parsed = reflect.ValueOf(i).Convert(t)
+	default:
+		return fmt.Errorf("config setting %v is a section and cannot be set directly", key)
+	}
+
+	return setField(field, parsed)
+}
+
+func setField(field reflect.Value, value reflect.Value) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(value)
+		field.Set(ptr)
+		return nil
+	}
+
+	field.Set(value)
+	return nil
+}
+
+type ConfigDifference struct {
+	Key          string
+	DefaultValue interface{}
+	ActualValue  interface{}
+}
+
+// DiffConfig lists every setting of config whose value differs from base, sorted by key.
+func DiffConfig(base *model.Config, config *model.Config) ([]ConfigDifference, error) {
+	baseMap, err := configToFlatMap(base)
+	if err != nil {
+		return nil, err
+	}
+
+	configMap, err := configToFlatMap(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []ConfigDifference
+	for key, value := range configMap {
+		if !reflect.DeepEqual(baseMap[key], value) {
+			diffs = append(diffs, ConfigDifference{Key: key, DefaultValue: baseMap[key], ActualValue: value})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key < diffs[j].Key
+	})
+
+	return diffs, nil
+}
+
+func configToFlatMap(config *model.Config) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(config.ToJson()), &m); err != nil {
+		return nil, err
+	}
+
+	return flattenStructToMap(m), nil
+}
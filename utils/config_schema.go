@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"reflect"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
+)
+
+const CONFIG_SCHEMA_DRAFT = "http://json-schema.org/draft-07/schema#"
+
+// GenerateDefaultConfig returns the config produced by SetDefaults with the secrets that are generated
+// per installation left empty, so that it can be published as default.json.
+func GenerateDefaultConfig() *model.Config {
+	config := &model.Config{}
+	config.SetDefaults()
+
+	config.SqlSettings.AtRestEncryptKey = ""
+
+	return config
+}
+
+// GenerateConfigSchema describes model.Config as a JSON Schema. Every field carries its JSON type,
+// whether it may be null (pointer fields) and its default from SetDefaults.
+func GenerateConfigSchema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(model.Config{}), reflect.ValueOf(GenerateDefaultConfig()).Elem())
+	schema["$schema"] = CONFIG_SCHEMA_DRAFT
+	schema["title"] = "Bonsai configuration"
+
+	return schema
+}
+
+func structSchema(t reflect.Type, defaults reflect.Value) map[string]interface{} {
+	properties := make(map[string]interface{}, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported fields are never serialised
+			continue
+		}
+
+		var value reflect.Value
+		if defaults.IsValid() {
+			value = defaults.Field(i)
+		}
+		properties[field.Name] = fieldSchema(field.Type, value)
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func fieldSchema(t reflect.Type, value reflect.Value) map[string]interface{} {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		nullable = true
+		t = t.Elem()
+		if value.IsValid() {
+			if value.IsNil() {
+				value = reflect.Value{}
+			} else {
+				value = value.Elem()
+			}
+		}
+	}
+
+	var schema map[string]interface{}
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t, value)
+	case reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": fieldSchema(t.Elem(), reflect.Value{})}
+		// a nil slice is written out as null
+		nullable = true
+	case reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": fieldSchema(t.Elem(), reflect.Value{})}
+		nullable = true
+	default:
+		return map[string]interface{}{}
+	}
+
+	if nullable {
+		schema["type"] = []string{schema["type"].(string), "null"}
+	}
+
+	if value.IsValid() && !((value.Kind() == reflect.Slice || value.Kind() == reflect.Map) && value.IsNil()) {
+		schema["default"] = value.Interface()
+	}
+
+	return schema
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"net/http"
 )
 
 var T i18n.TranslateFunc
@@ -90,4 +91,50 @@ func TfuncWithFallback(pref string) i18n.TranslateFunc {
 		t, _ := i18n.Tfunc(model.DEFAULT_LOCALE)
 		return t(translationID, args...)
 	}
-}
\ No newline at end of file
+}
+
+func GetSupportedLocales() map[string]string {
+	return locales
+}
+
+// ValidateLocales resets any locale setting that has no translation file back to the default locale.
+func ValidateLocales(cfg *model.Config) *model.AppError {
+	var err *model.AppError
+	locales := GetSupportedLocales()
+	if _, ok := locales[*cfg.LocalizationSettings.DefaultServerLocale]; !ok {
+		*cfg.LocalizationSettings.DefaultServerLocale = model.DEFAULT_LOCALE
+		err = model.NewAppError("ValidateLocales", "utils.config.supported_server_locale.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if _, ok := locales[*cfg.LocalizationSettings.DefaultClientLocale]; !ok {
+		*cfg.LocalizationSettings.DefaultClientLocale = model.DEFAULT_LOCALE
+		err = model.NewAppError("ValidateLocales", "utils.config.supported_client_locale.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if len(*cfg.LocalizationSettings.AvailableLocales) > 0 {
+		isDefaultClientLocaleInAvailableLocales := false
+		for _, word := range strings.Split(*cfg.LocalizationSettings.AvailableLocales, ",") {
+			if _, ok := locales[word]; !ok {
+				*cfg.LocalizationSettings.AvailableLocales = ""
+				isDefaultClientLocaleInAvailableLocales = true
+				err = model.NewAppError("ValidateLocales", "utils.config.supported_available_locales.app_error", nil, "", http.StatusBadRequest)
+				break
+			}
+
+			if word == *cfg.LocalizationSettings.DefaultClientLocale {
+				isDefaultClientLocaleInAvailableLocales = true
+			}
+		}
+
+		availableLocales := *cfg.LocalizationSettings.AvailableLocales
+
+		if !isDefaultClientLocaleInAvailableLocales {
+			availableLocales += "," + *cfg.LocalizationSettings.DefaultClientLocale
+			err = model.NewAppError("ValidateLocales", "utils.config.add_client_locale.app_error", nil, "", http.StatusBadRequest)
+		}
+
+		*cfg.LocalizationSettings.AvailableLocales = strings.Join(RemoveDuplicatesFromStringArray(strings.Split(availableLocales, ",")), ",")
+	}
+
+	return err
+}
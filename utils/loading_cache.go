@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errLoaderPanicked = errors.New("the cache loader panicked")
+
+// LoadingCacheOptions configures a LoadingCache.
+type LoadingCacheOptions struct {
+	Size int
+
+	// Name registers the cache for GetCacheStats when set.
+	Name string
+
+	InvalidateClusterEvent string
+
+	// Expiry is how long a loaded value is fresh. Zero means values never expire.
+	Expiry time.Duration
+
+	// StaleWhileRevalidate is how long after Expiry the old value is still served while it is refreshed
+	// in the background.
+	StaleWhileRevalidate time.Duration
+
+	// NegativeExpiry is how long a loader error is cached, so a missing key does not reach the loader on
+	// every lookup. Zero disables negative caching.
+	NegativeExpiry time.Duration
+
+	// IsNegative selects the loader errors that are cached, such as not found errors. When nil, every
+	// error is cached for NegativeExpiry.
+	IsNegative func(err error) bool
+}
+
+// LoadingCache is a typed LRU cache that fills its misses with a loader. Concurrent misses for the same
+// key share a single load.
+type LoadingCache[K comparable, V any] struct {
+	cache   *Cache
+	options LoadingCacheOptions
+	loader  func(key K) (V, error)
+
+	lock  sync.Mutex
+	calls map[K]*loadCall[V]
+}
+
+type loadingEntry[V any] struct {
+	value      V
+	err        error
+	freshUntil time.Time
+}
+
+type loadCall[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+
+	// invalidated is set when the key is invalidated while loading, so the result is not stored.
+	invalidated bool
+}
+
+func NewLoadingCache[K comparable, V any](options LoadingCacheOptions, loader func(key K) (V, error)) *LoadingCache[K, V] {
+	return &LoadingCache[K, V]{
+		cache:   NewLruWithParams(options.Size, options.Name, 0, options.InvalidateClusterEvent),
+		options: options,
+		loader:  loader,
+		calls:   make(map[K]*loadCall[V]),
+	}
+}
+
+// Get returns the value for key, loading it on a miss. A value past its expiry but within the
+// stale-while-revalidate window is returned as is while a refresh runs in the background.
+func (c *LoadingCache[K, V]) Get(key K) (V, error) {
+	if cached, ok := c.cache.Get(key); ok {
+		entry := cached.(*loadingEntry[V])
+
+		if entry.err == nil && !entry.freshUntil.IsZero() && time.Now().After(entry.freshUntil) {
+			c.refresh(key)
+		}
+
+		return entry.value, entry.err
+	}
+
+	return c.load(key, true)
+}
+
+// Set stores value for key as if it had just been loaded.
+func (c *LoadingCache[K, V]) Set(key K, value V) {
+	c.store(key, value, nil)
+}
+
+// Invalidate removes key, so the next Get loads it again.
+func (c *LoadingCache[K, V]) Invalidate(key K) {
+	c.lock.Lock()
+	if call, ok := c.calls[key]; ok {
+		call.invalidated = true
+	}
+	c.lock.Unlock()
+
+	c.cache.Remove(key)
+}
+
+func (c *LoadingCache[K, V]) Purge() {
+	c.lock.Lock()
+	for _, call := range c.calls {
+		call.invalidated = true
+	}
+	c.lock.Unlock()
+
+	c.cache.Purge()
+}
+
+func (c *LoadingCache[K, V]) Len() int {
+	return c.cache.Len()
+}
+
+// Cache returns the underlying LRU, for instance to register it for cluster invalidation.
+func (c *LoadingCache[K, V]) Cache() *Cache {
+	return c.cache
+}
+
+func (c *LoadingCache[K, V]) refresh(key K) {
+	c.lock.Lock()
+	_, loading := c.calls[key]
+	c.lock.Unlock()
+
+	if !loading {
+		go c.load(key, false)
+	}
+}
+
+// load runs the loader for key unless a load is already in flight, in which case it waits for that one.
+// A failed background refresh keeps the stale value rather than replacing it with the error.
+func (c *LoadingCache[K, V]) load(key K, storeErr bool) (V, error) {
+	c.lock.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.lock.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+
+	call := &loadCall[V]{err: errLoaderPanicked}
+	call.wg.Add(1)
+	c.calls[key] = call
+	c.lock.Unlock()
+
+	defer func() {
+		c.lock.Lock()
+		delete(c.calls, key)
+		c.lock.Unlock()
+		call.wg.Done()
+	}()
+
+	value, err := c.loader(key)
+	call.value, call.err = value, err
+
+	c.lock.Lock()
+	invalidated := call.invalidated
+	c.lock.Unlock()
+
+	if !invalidated && (err == nil || storeErr) {
+		c.store(key, value, err)
+	}
+
+	return value, err
+}
+
+func (c *LoadingCache[K, V]) store(key K, value V, err error) {
+	if err != nil {
+		if c.options.NegativeExpiry > 0 && (c.options.IsNegative == nil || c.options.IsNegative(err)) {
+			c.cache.AddWithExpiry(key, &loadingEntry[V]{err: err}, c.options.NegativeExpiry)
+		}
+		return
+	}
+
+	entry := &loadingEntry[V]{value: value}
+	if c.options.Expiry <= 0 {
+		c.cache.AddWithExpiry(key, entry, 0)
+		return
+	}
+
+	entry.freshUntil = time.Now().Add(c.options.Expiry)
+	c.cache.AddWithExpiry(key, entry, c.options.Expiry+c.options.StaleWhileRevalidate)
+}
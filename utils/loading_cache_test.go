@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadingCacheLoadsOnMiss(t *testing.T) {
+	var loads int32
+	c := NewLoadingCache(LoadingCacheOptions{Size: 10}, func(key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		return len(key), nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get("abc"); err != nil || v != 3 {
+			t.Fatalf("bad value: %v %v", v, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("should load once, loaded %v times", loads)
+	}
+
+	c.Invalidate("abc")
+	c.Get("abc")
+	if loads != 2 {
+		t.Fatalf("should load again after invalidation, loaded %v times", loads)
+	}
+}
+
+func TestLoadingCacheSharesConcurrentLoads(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	c := NewLoadingCache(LoadingCacheOptions{Size: 10}, func(key string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return key + "!", nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get("hot"); err != nil || v != "hot!" {
+				t.Errorf("bad value: %v %v", v, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Fatalf("concurrent misses should share one load, loaded %v times", loads)
+	}
+}
+
+func TestLoadingCacheStaleWhileRevalidate(t *testing.T) {
+	var version int32
+	refreshed := make(chan struct{}, 1)
+	c := NewLoadingCache(LoadingCacheOptions{Size: 10, Expiry: 50 * time.Millisecond, StaleWhileRevalidate: time.Second}, func(key string) (int32, error) {
+		v := atomic.AddInt32(&version, 1)
+		if v > 1 {
+			refreshed <- struct{}{}
+		}
+		return v, nil
+	})
+
+	if v, _ := c.Get("k"); v != 1 {
+		t.Fatalf("bad value: %v", v)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if v, _ := c.Get("k"); v != 1 {
+		t.Fatalf("should serve the stale value while refreshing, got %v", v)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("should refresh in the background")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := c.Get("k"); v == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("should serve the refreshed value")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLoadingCacheNegativeResults(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errTransient := errors.New("transient")
+
+	var loads int32
+	c := NewLoadingCache(LoadingCacheOptions{
+		Size:           10,
+		NegativeExpiry: 100 * time.Millisecond,
+		IsNegative: func(err error) bool {
+			return err == errNotFound
+		},
+	}, func(key string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "missing" {
+			return "", errNotFound
+		}
+		return "", errTransient
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get("missing"); err != errNotFound {
+			t.Fatalf("bad error: %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("negative result should be cached, loaded %v times", loads)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	c.Get("missing")
+	if loads != 2 {
+		t.Fatalf("negative result should expire, loaded %v times", loads)
+	}
+
+	c.Get("flaky")
+	c.Get("flaky")
+	if loads != 4 {
+		t.Fatalf("errors that are not negative should not be cached, loaded %v times", loads)
+	}
+}
+
+func TestLoadingCacheInvalidateDuringLoad(t *testing.T) {
+	release := make(chan struct{})
+	c := NewLoadingCache(LoadingCacheOptions{Size: 10}, func(key string) (string, error) {
+		<-release
+		return "old", nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.Get("k")
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	c.Invalidate("k")
+	close(release)
+	<-done
+
+	if c.Len() != 0 {
+		t.Fatal("a load invalidated while running should not be stored")
+	}
+}
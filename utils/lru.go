@@ -1,10 +1,17 @@
+// This files was copied/modified from https://github.com/hashicorp/golang-lru
+// which is under the Mozilla Public License 2.0.
+
 package utils
 
 import (
 	"container/list"
 	"sync"
+	"time"
+
+	"github.com/OhBonsai/go-web-boilerplate/model"
 )
 
+// Cache is a thread-safe fixed size LRU cache.
 type Cache struct {
 	size                   int
 	evictList              *list.List
@@ -15,13 +22,264 @@ type Cache struct {
 	invalidateClusterEvent string
 	currentGeneration      int64
 	len                    int
+	hits                   int64
+	misses                 int64
+	evictions              int64
+	expirations            int64
+	onInvalidate           func(key string, purged bool)
 }
 
+// entry is used to hold a value in the evictList.
+type entry struct {
+	key        interface{}
+	value      interface{}
+	expires    time.Time
+	generation int64
+}
 
+// NewLru creates an LRU of the given size.
 func NewLru(size int) *Cache {
 	return &Cache{
 		size:      size,
 		evictList: list.New(),
 		items:     make(map[interface{}]*list.Element, size),
 	}
-}
\ No newline at end of file
+}
+
+// NewLruWithParams creates an LRU of the given size whose entries expire after defaultExpiry seconds
+// unless added with their own expiry. A defaultExpiry of 0 means entries never expire. Caches with a
+// name are registered so their statistics can be inspected with GetCacheStats.
+func NewLruWithParams(size int, name string, defaultExpiry int64, invalidateClusterEvent string) *Cache {
+	lru := NewLru(size)
+	lru.name = name
+	lru.defaultExpiry = defaultExpiry
+	lru.invalidateClusterEvent = invalidateClusterEvent
+	if name != "" {
+		RegisterCache(lru)
+	}
+	return lru
+}
+
+// SetInvalidationHandler registers f to be called with a key after it is removed from the cache, or with
+// purged set after the cache is purged, so the invalidation can be shared with other nodes. Only string keys
+// are reported.
+func (c *Cache) SetInvalidationHandler(f func(key string, purged bool)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.onInvalidate = f
+}
+
+// Purge is used to completely clear the cache.
+func (c *Cache) Purge() {
+	c.PurgeLocal()
+
+	if f := c.invalidationHandler(); f != nil {
+		f("", true)
+	}
+}
+
+// PurgeLocal clears the cache without calling the invalidation handler. It is used to apply invalidations
+// received from other nodes.
+func (c *Cache) PurgeLocal() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.len = 0
+	c.currentGeneration++
+}
+
+// Add adds the given key and value to the store without an expiry. If the cache was created with a
+// default expiry, it is used instead.
+func (c *Cache) Add(key, value interface{}) {
+	c.AddWithExpiresInSecs(key, value, c.defaultExpiry)
+}
+
+// AddWithExpiresInSecs adds the given key and value to the cache with the given expiry. An expiry of 0
+// means the entry never expires.
+func (c *Cache) AddWithExpiresInSecs(key, value interface{}, expireAtSecs int64) {
+	c.AddWithExpiry(key, value, time.Duration(expireAtSecs)*time.Second)
+}
+
+// AddWithExpiry adds the given key and value to the cache, expiring after ttl. A ttl of 0 means the
+// entry never expires.
+func (c *Cache) AddWithExpiry(key, value interface{}, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	// Check for existing item, ignoring expiry since we'd update anyway.
+	if ent, ok := c.items[key]; ok {
+		c.evictList.MoveToFront(ent)
+		e := ent.Value.(*entry)
+		e.value = value
+		e.expires = expires
+		if e.generation != c.currentGeneration {
+			e.generation = c.currentGeneration
+			c.len++
+		}
+		return
+	}
+
+	// Add new item
+	ent := &entry{key, value, expires, c.currentGeneration}
+	c.items[key] = c.evictList.PushFront(ent)
+	c.len++
+
+	if c.evictList.Len() > c.size {
+		oldest := c.evictList.Back()
+		if oldest.Value.(*entry).generation == c.currentGeneration {
+			c.evictions++
+		}
+		c.removeElement(oldest)
+	}
+}
+
+// Get returns the value stored in the cache for a key, or nil if no value is present. The ok result
+// indicates whether value was found in the cache. Expired entries are treated as misses.
+func (c *Cache) Get(key interface{}) (value interface{}, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if ent, ok := c.items[key]; ok {
+		e := ent.Value.(*entry)
+
+		if e.generation != c.currentGeneration {
+			c.removeElement(ent)
+			c.misses++
+			return nil, false
+		}
+
+		if !e.expires.IsZero() && time.Now().After(e.expires) {
+			c.removeElement(ent)
+			c.expirations++
+			c.misses++
+			return nil, false
+		}
+
+		c.evictList.MoveToFront(ent)
+		c.hits++
+		return e.value, true
+	}
+
+	c.misses++
+	return nil, false
+}
+
+// Remove deletes the value for a key.
+func (c *Cache) Remove(key interface{}) {
+	c.RemoveLocal(key)
+
+	if f := c.invalidationHandler(); f != nil {
+		if k, ok := key.(string); ok {
+			f(k, false)
+		}
+	}
+}
+
+// RemoveLocal deletes the value for a key without calling the invalidation handler. It is used to apply
+// invalidations received from other nodes.
+func (c *Cache) RemoveLocal(key interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if ent, ok := c.items[key]; ok {
+		c.removeElement(ent)
+	}
+}
+
+// Keys returns a slice of the keys in the cache, from oldest to newest. Expired entries are evicted
+// first.
+func (c *Cache) Keys() []interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeExpired()
+
+	keys := make([]interface{}, c.len)
+	i := 0
+	for ent := c.evictList.Back(); ent != nil; ent = ent.Prev() {
+		e := ent.Value.(*entry)
+		if e.generation == c.currentGeneration {
+			keys[i] = e.key
+			i++
+		}
+	}
+
+	return keys
+}
+
+// Len returns the number of items in the cache, evicting the expired ones first.
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeExpired()
+	return c.len
+}
+
+// Stats returns a snapshot of the size and effectiveness of the cache. Expired entries are evicted first.
+func (c *Cache) Stats() *model.CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeExpired()
+
+	stats := &model.CacheStats{
+		Name:        c.name,
+		Size:        c.len,
+		Capacity:    c.size,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+	}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		stats.HitRatio = float64(c.hits) / float64(lookups)
+	}
+
+	return stats
+}
+
+// Name identifies this cache instance among others in the system.
+func (c *Cache) Name() string {
+	return c.name
+}
+
+// GetInvalidateClusterEvent returns the cluster event configured when this cache was created.
+func (c *Cache) GetInvalidateClusterEvent() string {
+	return c.invalidateClusterEvent
+}
+
+func (c *Cache) invalidationHandler() func(key string, purged bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.onInvalidate
+}
+
+// removeExpired evicts every expired entry of the current generation. The caller holds the write lock.
+func (c *Cache) removeExpired() {
+	now := time.Now()
+	for ent := c.evictList.Back(); ent != nil; {
+		prev := ent.Prev()
+		if e := ent.Value.(*entry); e.generation == c.currentGeneration && !e.expires.IsZero() && now.After(e.expires) {
+			c.removeElement(ent)
+			c.expirations++
+		}
+		ent = prev
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) {
+	c.evictList.Remove(e)
+	kv := e.Value.(*entry)
+	if kv.generation == c.currentGeneration {
+		c.len--
+	}
+	delete(c.items, kv.key)
+}
@@ -0,0 +1,209 @@
+// This files was copied/modified from https://github.com/hashicorp/golang-lru
+// which is under the Mozilla Public License 2.0.
+
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	l := NewLru(128)
+
+	for i := 0; i < 256; i++ {
+		l.Add(i, i)
+	}
+	if l.Len() != 128 {
+		t.Fatalf("bad len: %v", l.Len())
+	}
+
+	for i, k := range l.Keys() {
+		if v, ok := l.Get(k); !ok || v != k || v != i+128 {
+			t.Fatalf("bad key: %v", k)
+		}
+	}
+	for i := 0; i < 128; i++ {
+		if _, ok := l.Get(i); ok {
+			t.Fatalf("should be evicted")
+		}
+	}
+	for i := 128; i < 256; i++ {
+		if _, ok := l.Get(i); !ok {
+			t.Fatalf("should not be evicted")
+		}
+	}
+	for i := 128; i < 192; i++ {
+		l.Remove(i)
+		if _, ok := l.Get(i); ok {
+			t.Fatalf("should be deleted")
+		}
+	}
+
+	l.Get(192) // expect 192 to be last key in l.Keys()
+
+	for i, k := range l.Keys() {
+		if (i < 63 && k != i+193) || (i == 63 && k != 192) {
+			t.Fatalf("out of order key: %v", k)
+		}
+	}
+
+	l.Purge()
+	if l.Len() != 0 {
+		t.Fatalf("bad len: %v", l.Len())
+	}
+	if _, ok := l.Get(200); ok {
+		t.Fatalf("should contain nothing")
+	}
+}
+
+func TestLRUAddUpdatesRecency(t *testing.T) {
+	l := NewLru(2)
+
+	l.Add(1, 1)
+	l.Add(2, 2)
+	l.Add(1, 10)
+	l.Add(3, 3)
+
+	if _, ok := l.Get(2); ok {
+		t.Fatalf("2 should be evicted as least recently used")
+	}
+	if v, ok := l.Get(1); !ok || v != 10 {
+		t.Fatalf("1 should hold the updated value, got %v", v)
+	}
+}
+
+func TestLRUPurgeThenAdd(t *testing.T) {
+	l := NewLru(4)
+
+	l.Add(1, 1)
+	l.Add(2, 2)
+	l.Purge()
+	l.Add(1, 100)
+
+	if l.Len() != 1 {
+		t.Fatalf("bad len: %v", l.Len())
+	}
+	if keys := l.Keys(); len(keys) != 1 || keys[0] != 1 {
+		t.Fatalf("bad keys: %v", keys)
+	}
+	if v, ok := l.Get(1); !ok || v != 100 {
+		t.Fatalf("bad value: %v", v)
+	}
+}
+
+func TestLRUExpire(t *testing.T) {
+	l := NewLru(128)
+
+	l.AddWithExpiresInSecs(1, 1, 1)
+	l.AddWithExpiresInSecs(2, 2, 1)
+	l.AddWithExpiresInSecs(3, 3, 0)
+
+	time.Sleep(time.Millisecond * 2100)
+
+	if r1, ok := l.Get(1); ok {
+		t.Fatal(r1)
+	}
+
+	if _, ok := l.Get(3); !ok {
+		t.Fatal("should exist")
+	}
+
+	if l.Len() != 1 {
+		t.Fatalf("expired entries should not be counted, bad len: %v", l.Len())
+	}
+
+	if keys := l.Keys(); len(keys) != 1 || keys[0] != 3 {
+		t.Fatalf("expired entries should not be listed, bad keys: %v", keys)
+	}
+}
+
+func TestLRUKeysEvictExpired(t *testing.T) {
+	l := NewLru(128)
+
+	l.AddWithExpiry(1, 1, 10*time.Millisecond)
+	l.Add(2, 2)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if keys := l.Keys(); len(keys) != 1 || keys[0] != 2 {
+		t.Fatalf("bad keys: %v", keys)
+	}
+	if stats := l.Stats(); stats.Size != 1 || stats.Expirations != 1 {
+		t.Fatalf("expired entry should be evicted once, bad stats: %+v", stats)
+	}
+
+	// Adding the key back makes it live again.
+	l.Add(1, 1)
+	if l.Len() != 2 {
+		t.Fatalf("bad len: %v", l.Len())
+	}
+}
+
+func TestLRUDefaultExpiry(t *testing.T) {
+	l := NewLruWithParams(128, "test", 1, "")
+
+	l.Add(1, 1)
+	l.AddWithExpiresInSecs(2, 2, 0)
+
+	time.Sleep(time.Millisecond * 1100)
+
+	if _, ok := l.Get(1); ok {
+		t.Fatal("should use the default expiry")
+	}
+	if _, ok := l.Get(2); !ok {
+		t.Fatal("an explicit expiry of 0 should never expire")
+	}
+	if l.Name() != "test" {
+		t.Fatalf("bad name: %v", l.Name())
+	}
+}
+
+func TestLRUStats(t *testing.T) {
+	l := NewLruWithParams(2, "TestLRUStats", 0, "")
+	defer UnregisterCache("TestLRUStats")
+
+	l.Add(1, 1)
+	l.AddWithExpiresInSecs(2, 2, 1)
+	l.Get(1)
+	l.Get(3)
+	l.Add(3, 3) // evicts 2
+
+	stats := l.Stats()
+	if stats.Size != 2 || stats.Capacity != 2 {
+		t.Fatalf("bad size: %v/%v", stats.Size, stats.Capacity)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Fatalf("bad counters: %+v", stats)
+	}
+	if stats.HitRatio != 0.5 {
+		t.Fatalf("bad hit ratio: %v", stats.HitRatio)
+	}
+
+	if GetRegisteredCache("TestLRUStats") != l {
+		t.Fatal("named cache should be registered")
+	}
+	if !PurgeCache("TestLRUStats") || l.Len() != 0 {
+		t.Fatal("registered cache should be purged")
+	}
+	if PurgeCache("missing") {
+		t.Fatal("purging an unknown cache should fail")
+	}
+}
+
+func TestCacheUnregister(t *testing.T) {
+	previous := NewLruWithParams(2, "TestCacheUnregister", 0, "")
+	current := NewLruWithParams(2, "TestCacheUnregister", 0, "")
+	defer UnregisterCache("TestCacheUnregister")
+
+	// A cache replaced under its name leaves its successor registered.
+	previous.Unregister()
+	if GetRegisteredCache("TestCacheUnregister") != current {
+		t.Fatal("should keep the cache registered under the name since")
+	}
+
+	current.Unregister()
+	if GetRegisteredCache("TestCacheUnregister") != nil {
+		t.Fatal("should unregister the cache")
+	}
+}
@@ -28,3 +28,17 @@ func GetIpAddress(r *http.Request) string {
 
 	return address
 }
+
+func RemoveDuplicatesFromStringArray(arr []string) []string {
+	result := make([]string, 0, len(arr))
+	seen := make(map[string]bool)
+
+	for _, item := range arr {
+		if !seen[item] {
+			result = append(result, item)
+			seen[item] = true
+		}
+	}
+
+	return result
+}